@@ -0,0 +1,110 @@
+// Command offline runs the sales of a machine against its local store, so the
+// machine keeps selling without the API, and syncs the store when it is back.
+//
+//	go run ./cmd/offline -store machine.json -secret SECRET deposit 7 50
+//	go run ./cmd/offline -store machine.json -secret SECRET buy 7 A1 1
+//	go run ./cmd/offline -store machine.json -secret SECRET reset 7
+//	go run ./cmd/offline -store machine.json -api http://localhost:7000 -key vmk_... sync
+//
+// The signing secret and machine key are issued to the machine by an operator.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/femibiwoye/go-test/offline"
+)
+
+func main() {
+	storePath := flag.String("store", "machine.json", "file the local store is kept in")
+	secret := flag.String("secret", os.Getenv("MACHINE_SIGNING_SECRET"), "signing secret of the machine")
+	api := flag.String("api", os.Getenv("MACHINE_API_URL"), "base URL of the API, for sync")
+	key := flag.String("key", os.Getenv("MACHINE_KEY"), "machine key, for sync")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("the signing secret is required")
+	}
+
+	store, err := offline.Open(*storePath, []byte(*secret))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		log.Fatal("usage: offline [flags] sync | pending | deposit USER COIN | buy USER SLOT [QUANTITY] | reset USER")
+	}
+
+	switch args[0] {
+	case "sync":
+		report, err := offline.NewClient(*api, *key).Sync(store)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("applied=%d duplicates=%d rejected=%d adjusted=%d\n", report.Applied, report.Duplicates, len(report.Rejected), len(report.Adjusted))
+		for _, rejection := range report.Rejected {
+			fmt.Printf("  rejected %d: %s\n", rejection.Seq, rejection.Reason)
+		}
+		for _, outcome := range report.Adjusted {
+			fmt.Printf("  adjusted %d %s: short=%d from_account=%d unpaid=%d\n", outcome.Seq, outcome.Kind, outcome.Short, outcome.FromAccount, outcome.Unpaid)
+		}
+
+	case "pending":
+		for _, tx := range store.Pending() {
+			fmt.Printf("%d %s user=%d amount=%d\n", tx.Seq, tx.Kind, tx.UserID, tx.Amount)
+		}
+
+	case "deposit":
+		userID, coin := uintArg(args, 1), intArg(args, 2, 0)
+		if _, err := store.Deposit(userID, coin); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("credit=%d\n", store.Credit(userID))
+
+	case "buy":
+		userID := uintArg(args, 1)
+		if len(args) < 3 {
+			log.Fatal("buy needs a user and a slot")
+		}
+		tx, err := store.Buy(userID, args[2], intArg(args, 3, 1))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("vended %d from %s for %d, credit=%d\n", tx.Quantity, tx.SlotCode, tx.Amount, store.Credit(userID))
+
+	case "reset":
+		userID := uintArg(args, 1)
+		tx, err := store.Reset(userID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("returned %d in %v, credit=%d\n", tx.Amount, tx.Coins, store.Credit(userID))
+
+	default:
+		log.Fatalf("unknown command %q", args[0])
+	}
+}
+
+func uintArg(args []string, i int) uint {
+	return uint(intArg(args, i, -1))
+}
+
+// intArg parses argument i, which is required when fallback is negative.
+func intArg(args []string, i, fallback int) int {
+	if len(args) <= i {
+		if fallback < 0 {
+			log.Fatalf("%s needs more arguments", args[0])
+		}
+		return fallback
+	}
+	value, err := strconv.Atoi(args[i])
+	if err != nil || value < 0 {
+		log.Fatalf("invalid number %q", args[i])
+	}
+	return value
+}
@@ -0,0 +1,59 @@
+// Command simulator runs a vending machine script against a simulated machine
+// and prints what the machine did after each step.
+//
+//	go run ./cmd/simulator session.txt
+//
+// The script is read from standard input when no file is given.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/femibiwoye/go-test/machine"
+)
+
+var denominations = []int{5, 10, 20, 50, 100}
+
+func main() {
+	var input io.Reader = os.Stdin
+	if len(os.Args) > 1 {
+		file, err := os.Open(os.Args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	steps, err := machine.ParseScript(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	results, err := machine.NewSimulator(denominations).Run(steps)
+	for _, result := range results {
+		line := fmt.Sprintf("%3d %-24s %-18s credit=%d", result.Step.Line, describe(result.Step), result.State, result.Credit)
+		if result.Output != "" {
+			line += "  " + result.Output
+		}
+		if result.Err != nil {
+			line += "  error: " + result.Err.Error()
+		}
+		fmt.Println(line)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func describe(step machine.Step) string {
+	out := step.Command
+	for _, arg := range step.Args {
+		out += " " + arg
+	}
+	return out
+}
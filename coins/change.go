@@ -0,0 +1,75 @@
+// Package coins works out the coins a machine pays out as change.
+package coins
+
+import "sort"
+
+// MakeChange returns the coins to pay out amount from inventory, a count of
+// coins by denomination. It uses as few coins as possible. When the exact
+// amount cannot be paid it pays the largest amount below it that can be, and
+// returns the amount paid alongside the coins.
+func MakeChange(amount int, inventory map[int]int) (map[int]int, int) {
+	if amount <= 0 {
+		return map[int]int{}, 0
+	}
+
+	denominations := make([]int, 0, len(inventory))
+	for denomination, count := range inventory {
+		if denomination > 0 && count > 0 {
+			denominations = append(denominations, denomination)
+		}
+	}
+	sort.Ints(denominations)
+
+	// fewest[v] is the fewest coins paying exactly v, -1 when v cannot be paid.
+	// used[i][v] is how many coins of denominations[i] the best way to pay v uses
+	// once the first i+1 denominations are considered.
+	fewest := make([]int, amount+1)
+	for v := 1; v <= amount; v++ {
+		fewest[v] = -1
+	}
+	used := make([][]int, len(denominations))
+
+	for i, denomination := range denominations {
+		used[i] = make([]int, amount+1)
+		next := make([]int, amount+1)
+		for v := 0; v <= amount; v++ {
+			next[v] = fewest[v]
+			for n := 1; n <= inventory[denomination] && n*denomination <= v; n++ {
+				rest := fewest[v-n*denomination]
+				if rest < 0 {
+					continue
+				}
+				if next[v] < 0 || rest+n < next[v] {
+					next[v] = rest + n
+					used[i][v] = n
+				}
+			}
+		}
+		fewest = next
+	}
+
+	paid := amount
+	for paid > 0 && fewest[paid] < 0 {
+		paid--
+	}
+
+	change := map[int]int{}
+	remaining := paid
+	for i := len(denominations) - 1; i >= 0 && remaining > 0; i-- {
+		if n := used[i][remaining]; n > 0 {
+			change[denominations[i]] = n
+			remaining -= n * denominations[i]
+		}
+	}
+
+	return change, paid
+}
+
+// Total is the value of a set of coins.
+func Total(coins map[int]int) int {
+	total := 0
+	for denomination, count := range coins {
+		total += denomination * count
+	}
+	return total
+}
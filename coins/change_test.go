@@ -0,0 +1,72 @@
+package coins
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakeChange(t *testing.T) {
+	tests := []struct {
+		name      string
+		amount    int
+		inventory map[int]int
+		expected  map[int]int
+		paid      int
+	}{
+		{
+			name:      "uses the largest coins available",
+			amount:    85,
+			inventory: map[int]int{5: 10, 10: 10, 20: 10, 50: 10, 100: 10},
+			expected:  map[int]int{50: 1, 20: 1, 10: 1, 5: 1},
+			paid:      85,
+		},
+		{
+			name:      "works around missing coins",
+			amount:    60,
+			inventory: map[int]int{10: 1, 20: 3, 50: 1},
+			expected:  map[int]int{50: 1, 10: 1},
+			paid:      60,
+		},
+		{
+			name:      "beats greedy when it would get stuck",
+			amount:    60,
+			inventory: map[int]int{20: 3, 50: 1},
+			expected:  map[int]int{20: 3},
+			paid:      60,
+		},
+		{
+			name:      "pays as much as it can when exact change is impossible",
+			amount:    45,
+			inventory: map[int]int{10: 2, 20: 1},
+			expected:  map[int]int{20: 1, 10: 2},
+			paid:      40,
+		},
+		{
+			name:      "empty machine pays nothing",
+			amount:    30,
+			inventory: map[int]int{},
+			expected:  map[int]int{},
+			paid:      0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			change, paid := MakeChange(tc.amount, tc.inventory)
+			if paid != tc.paid {
+				t.Errorf("expected to pay %d, paid %d", tc.paid, paid)
+			}
+			if !reflect.DeepEqual(change, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, change)
+			}
+			if Total(change) != paid {
+				t.Errorf("coins %v do not add up to %d", change, paid)
+			}
+			for denomination, count := range change {
+				if count > tc.inventory[denomination] {
+					t.Errorf("used %d coins of %d, only %d available", count, denomination, tc.inventory[denomination])
+				}
+			}
+		})
+	}
+}
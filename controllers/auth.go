@@ -113,6 +113,14 @@ func UserCreate(response http.ResponseWriter, request *http.Request) {
 	user.Password = hashPassword
 	user.IsVerified = true
 	user.Role = "buyer"
+	user.DateOfBirthVerified = false
+
+	if user.DateOfBirth != "" {
+		if _, err := parseDateOfBirth(user.DateOfBirth); err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+	}
 
 	res := utils.CreateItem(&user)
 
@@ -245,6 +253,29 @@ func TokenValid(r *http.Request) (string, error) {
 	return fmt.Sprintf("%v", claims["user_id"]), nil
 }
 
+// AuthenticatedUser will check if token is valid and load the user it belongs to
+// Returns ErrUserNotFound if the user no longer exists
+func AuthenticatedUser(r *http.Request) (models.User, error) {
+	var user models.User
+
+	userID, err := TokenValid(r)
+	if err != nil {
+		return user, err
+	}
+
+	uintID, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		return user, err
+	}
+
+	result := utils.GetItemByPrimaryKey(&user, uint(uintID))
+	if result.RowsAffected < 1 {
+		return user, ErrUserNotFound
+	}
+
+	return user, nil
+}
+
 // DeleteMapProps will delete map properties
 func DeleteMapProps(m map[string]interface{}, s []string) {
 	for _, v := range s {
@@ -344,6 +375,12 @@ func UserUpdate(response http.ResponseWriter, request *http.Request) {
 		utils.GetError(errors.New("bad update data"), http.StatusBadRequest, response)
 		return
 	}
+	// users can only switch between the self-service roles, other roles are granted by an admin
+	if role := strings.ToLower(user.Role); role != "" && role != "buyer" && role != "seller" {
+		utils.GetError(errors.New("role must be buyer or seller"), http.StatusBadRequest, response)
+		return
+	}
+
 	updateMap := map[string]interface{}{}
 
 	if user.FullName != "" {
@@ -354,6 +391,16 @@ func UserUpdate(response http.ResponseWriter, request *http.Request) {
 		updateMap["role"] = user.Role
 	}
 
+	// a new date of birth has to be verified again before age restricted products can be bought
+	if user.DateOfBirth != "" {
+		if _, err := parseDateOfBirth(user.DateOfBirth); err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+		updateMap["date_of_birth"] = user.DateOfBirth
+		updateMap["date_of_birth_verified"] = false
+	}
+
 	if len(updateMap) == 0 {
 		utils.GetError(errors.New("empty/invalid user input data"), http.StatusBadRequest, response)
 		return
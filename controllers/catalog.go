@@ -0,0 +1,447 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const (
+	attributeString = "string"
+	attributeNumber = "number"
+	attributeList   = "list"
+
+	maxProductTags = 20
+	maxTagLength   = 32
+)
+
+// productAttributeTypes lists the attributes a seller can set on a product and their type.
+var productAttributeTypes = map[string]string{
+	"size":      attributeString,
+	"flavour":   attributeString,
+	"allergens": attributeList,
+	"calories":  attributeNumber,
+}
+
+// CategoryCreate is a function to create a new category, optionally under a parent category
+func CategoryCreate(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "seller" {
+		utils.GetError(fmt.Errorf("user is not a seller"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	var category models.Category
+	if err := utils.ParseJSONFromRequest(request, &category); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		utils.GetError(errors.New("category name is required"), http.StatusBadRequest, response)
+		return
+	}
+
+	if category.ParentID != nil {
+		var parent models.Category
+		if tx := utils.GetItemByPrimaryKey(&parent, *category.ParentID); tx.RowsAffected < 1 {
+			utils.GetError(errors.New("parent category not found"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	category.ID = 0
+	category.CreatedBy = user.ID
+
+	if res := utils.CreateItem(&category); res.RowsAffected < 1 {
+		utils.GetError(errors.New("error adding category"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("category added successfully", map[string]interface{}{"category_id": category.ID}, response)
+}
+
+// CategoryGetAll is a function to get all categories as a tree
+func CategoryGetAll(response http.ResponseWriter, request *http.Request) {
+	_, err := TokenValid(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	categories, err := loadCategories()
+	if err != nil {
+		utils.GetError(errors.New("error fetching categories"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("categories retreived successfully", categoryTree(categories), response)
+}
+
+// CategoryUpdate is a function to rename or move a category. Only the seller who created it can update it.
+func CategoryUpdate(response http.ResponseWriter, request *http.Request) {
+	categoryID := mux.Vars(request)["category_id"]
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	uintCategoryID, _ := strconv.ParseUint(categoryID, 10, 64)
+
+	var category models.Category
+	if tx := utils.GetItemByPrimaryKey(&category, uint(uintCategoryID)); tx.RowsAffected < 1 {
+		utils.GetError(errors.New("category not found"), http.StatusNotFound, response)
+		return
+	}
+
+	if user.ID != category.CreatedBy {
+		utils.GetError(errors.New("user not authorized to update category"), http.StatusUnauthorized, response)
+		return
+	}
+
+	var updateRequest models.CategoryUpdate
+	if err := utils.ParseJSONFromRequest(request, &updateRequest); err != nil {
+		utils.GetError(errors.New("bad update data"), http.StatusBadRequest, response)
+		return
+	}
+
+	updateMap := map[string]interface{}{}
+
+	if name := strings.TrimSpace(updateRequest.Name); name != "" {
+		updateMap["name"] = name
+	}
+
+	if updateRequest.ParentID != nil {
+		if *updateRequest.ParentID == 0 {
+			updateMap["parent_id"] = nil
+		} else {
+			categories, err := loadCategories()
+			if err != nil {
+				utils.GetError(errors.New("error fetching categories"), http.StatusInternalServerError, response)
+				return
+			}
+
+			if _, ok := categories[*updateRequest.ParentID]; !ok {
+				utils.GetError(errors.New("parent category not found"), http.StatusBadRequest, response)
+				return
+			}
+
+			for _, id := range categoryDescendants(categories, category.ID) {
+				if id == *updateRequest.ParentID {
+					utils.GetError(errors.New("a category cannot be moved under itself"), http.StatusBadRequest, response)
+					return
+				}
+			}
+
+			updateMap["parent_id"] = *updateRequest.ParentID
+		}
+	}
+
+	if len(updateMap) == 0 {
+		utils.GetError(errors.New("empty/invalid user input data"), http.StatusBadRequest, response)
+		return
+	}
+
+	result := utils.Db.Table("categories").Where("id = ?", category.ID).Updates(updateMap)
+	if result.Error != nil {
+		utils.GetError(errors.New("category update failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("category successfully updated", nil, response)
+}
+
+// CategoryDelete is a function to delete an empty category. Only the seller who created it can delete it.
+func CategoryDelete(response http.ResponseWriter, request *http.Request) {
+	categoryID := mux.Vars(request)["category_id"]
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	uintCategoryID, _ := strconv.ParseUint(categoryID, 10, 64)
+
+	var category models.Category
+	if tx := utils.GetItemByPrimaryKey(&category, uint(uintCategoryID)); tx.RowsAffected < 1 {
+		utils.GetError(errors.New("category not found"), http.StatusNotFound, response)
+		return
+	}
+
+	if user.ID != category.CreatedBy {
+		utils.GetError(errors.New("user not authorized to delete category"), http.StatusUnauthorized, response)
+		return
+	}
+
+	var children, products int64
+	utils.Db.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children)
+	utils.Db.Model(&models.Product{}).Where("category_id = ?", category.ID).Count(&products)
+	if children > 0 || products > 0 {
+		utils.GetError(errors.New("category still has sub-categories or products"), http.StatusConflict, response)
+		return
+	}
+
+	if result := utils.Db.Delete(models.Category{}, "id = ?", category.ID); result.RowsAffected < 1 {
+		utils.GetError(errors.New("category delete failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("category successfully deleted", nil, response)
+}
+
+// loadCategories returns every category keyed by ID.
+func loadCategories() (map[uint]models.Category, error) {
+	var categories []models.Category
+	if err := utils.Db.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]models.Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	return byID, nil
+}
+
+// categoryPath returns the full path of a category, e.g. "Drinks > Soda".
+func categoryPath(categories map[uint]models.Category, id uint) string {
+	var names []string
+	seen := map[uint]bool{}
+
+	for current, ok := categories[id]; ok && !seen[current.ID]; {
+		seen[current.ID] = true
+		names = append([]string{current.Name}, names...)
+		if current.ParentID == nil {
+			break
+		}
+		current, ok = categories[*current.ParentID]
+	}
+
+	return strings.Join(names, " > ")
+}
+
+// categoryDescendants returns the ID of a category and of every category below it.
+func categoryDescendants(categories map[uint]models.Category, id uint) []uint {
+	children := map[uint][]uint{}
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+
+	return ids
+}
+
+// categoryTree arranges categories under their parents, sorted by name.
+func categoryTree(categories map[uint]models.Category) []models.Category {
+	children := map[uint][]models.Category{}
+	var roots []models.Category
+
+	for _, category := range categories {
+		category.Path = categoryPath(categories, category.ID)
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var build func(nodes []models.Category) []models.Category
+	build = func(nodes []models.Category) []models.Category {
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+		for i := range nodes {
+			nodes[i].Children = build(children[nodes[i].ID])
+		}
+		return nodes
+	}
+
+	tree := build(roots)
+	if tree == nil {
+		tree = []models.Category{}
+	}
+
+	return tree
+}
+
+// normalizeTags lower-cases, trims and de-duplicates product tags.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > maxProductTags {
+		return nil, fmt.Errorf("a product can have at most %d tags", maxProductTags)
+	}
+
+	return normalized, nil
+}
+
+// parseAttributes validates product attributes against productAttributeTypes
+// and converts them to rows.
+func parseAttributes(attributes map[string]interface{}) ([]models.ProductAttribute, error) {
+	var rows []models.ProductAttribute
+
+	for name, value := range attributes {
+		attributeType, ok := productAttributeTypes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown product attribute: %s", name)
+		}
+
+		switch attributeType {
+		case attributeString:
+			text, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("attribute %s must be a string", name)
+			}
+			rows = append(rows, models.ProductAttribute{Name: name, Value: strings.TrimSpace(text)})
+		case attributeNumber:
+			number, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("attribute %s must be a number", name)
+			}
+			rows = append(rows, models.ProductAttribute{Name: name, Value: strconv.FormatFloat(number, 'f', -1, 64)})
+		case attributeList:
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("attribute %s must be a list of strings", name)
+			}
+			for _, item := range items {
+				text, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("attribute %s must be a list of strings", name)
+				}
+				rows = append(rows, models.ProductAttribute{Name: name, Value: strings.ToLower(strings.TrimSpace(text))})
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// saveProductTags replaces the tags of a product.
+func saveProductTags(tx *gorm.DB, productID uint, tags []string) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductTag{}).Error; err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := tx.Create(&models.ProductTag{ProductID: productID, Tag: tag}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveProductAttributes replaces the attributes of a product.
+func saveProductAttributes(tx *gorm.DB, productID uint, attributes []models.ProductAttribute) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductAttribute{}).Error; err != nil {
+		return err
+	}
+
+	for _, attribute := range attributes {
+		attribute.ProductID = productID
+		if err := tx.Create(&attribute).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadProductDetails fills in the image URLs, category path, tags and attributes of products.
+func loadProductDetails(products []models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	setProductImageURLs(products)
+
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+
+	categories, err := loadCategories()
+	if err != nil {
+		return err
+	}
+
+	var tags []models.ProductTag
+	if err := utils.Db.Where("product_id IN ?", ids).Order("tag").Find(&tags).Error; err != nil {
+		return err
+	}
+
+	var attributes []models.ProductAttribute
+	if err := utils.Db.Where("product_id IN ?", ids).Order("id").Find(&attributes).Error; err != nil {
+		return err
+	}
+
+	tagsByProduct := map[uint][]string{}
+	for _, tag := range tags {
+		tagsByProduct[tag.ProductID] = append(tagsByProduct[tag.ProductID], tag.Tag)
+	}
+
+	attributesByProduct := map[uint]map[string]interface{}{}
+	for _, attribute := range attributes {
+		if attributesByProduct[attribute.ProductID] == nil {
+			attributesByProduct[attribute.ProductID] = map[string]interface{}{}
+		}
+		values := attributesByProduct[attribute.ProductID]
+
+		switch productAttributeTypes[attribute.Name] {
+		case attributeNumber:
+			number, _ := strconv.ParseFloat(attribute.Value, 64)
+			values[attribute.Name] = number
+		case attributeList:
+			list, _ := values[attribute.Name].([]string)
+			values[attribute.Name] = append(list, attribute.Value)
+		default:
+			values[attribute.Name] = attribute.Value
+		}
+	}
+
+	for i := range products {
+		if products[i].CategoryID != nil {
+			products[i].CategoryPath = categoryPath(categories, *products[i].CategoryID)
+		}
+		products[i].Tags = tagsByProduct[products[i].ID]
+		products[i].Attributes = attributesByProduct[products[i].ID]
+	}
+
+	return nil
+}
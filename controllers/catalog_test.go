@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+func testCategories() map[uint]models.Category {
+	id := func(v uint) *uint { return &v }
+	return map[uint]models.Category{
+		1: {ID: 1, Name: "Drinks"},
+		2: {ID: 2, Name: "Soda", ParentID: id(1)},
+		3: {ID: 3, Name: "Cola", ParentID: id(2)},
+		4: {ID: 4, Name: "Juice", ParentID: id(1)},
+		5: {ID: 5, Name: "Snacks"},
+	}
+}
+
+// TestCategoryPath tests the full path of categories
+func TestCategoryPath(t *testing.T) {
+	categories := testCategories()
+
+	tests := []struct {
+		id       uint
+		expected string
+	}{
+		{1, "Drinks"},
+		{3, "Drinks > Soda > Cola"},
+		{4, "Drinks > Juice"},
+		{9, ""},
+	}
+
+	for _, test := range tests {
+		if got := categoryPath(categories, test.id); got != test.expected {
+			t.Errorf("path of %d: got %q expected %q", test.id, got, test.expected)
+		}
+	}
+
+	t.Run("test a cycle stops", func(t *testing.T) {
+		parent := uint(7)
+		child := uint(6)
+		cyclic := map[uint]models.Category{
+			6: {ID: 6, Name: "A", ParentID: &parent},
+			7: {ID: 7, Name: "B", ParentID: &child},
+		}
+		if got := categoryPath(cyclic, 6); got != "B > A" {
+			t.Errorf("got %q expected %q", got, "B > A")
+		}
+	})
+}
+
+// TestCategoryDescendants tests finding a category and every category below it
+func TestCategoryDescendants(t *testing.T) {
+	categories := testCategories()
+
+	tests := []struct {
+		id       uint
+		expected []uint
+	}{
+		{1, []uint{1, 2, 3, 4}},
+		{2, []uint{2, 3}},
+		{3, []uint{3}},
+		{5, []uint{5}},
+	}
+
+	for _, test := range tests {
+		got := categoryDescendants(categories, test.id)
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("descendants of %d: got %v expected %v", test.id, got, test.expected)
+		}
+	}
+}
+
+// TestNormalizeTags tests tags are trimmed, lower-cased and de-duplicated
+func TestNormalizeTags(t *testing.T) {
+	tooMany := make([]string, maxProductTags+1)
+	for i := range tooMany {
+		tooMany[i] = strings.Repeat("t", i+1)
+	}
+
+	tests := []struct {
+		name     string
+		tags     []string
+		expected []string
+		err      string
+	}{
+		{"empty", nil, []string{}, ""},
+		{"normalised", []string{" Cold ", "cold", "SUGAR free", ""}, []string{"cold", "sugar free"}, ""},
+		{"too long", []string{strings.Repeat("x", maxTagLength+1)}, nil, "is longer than"},
+		{"too many", tooMany, nil, "at most"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := normalizeTags(test.tags)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v expected one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %v expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+// TestParseAttributes tests attributes are checked against their type
+func TestParseAttributes(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string]interface{}
+		expected   []models.ProductAttribute
+		err        string
+	}{
+		{"string", map[string]interface{}{"size": " 330ml "}, []models.ProductAttribute{{Name: "size", Value: "330ml"}}, ""},
+		{"number", map[string]interface{}{"calories": 139.5}, []models.ProductAttribute{{Name: "calories", Value: "139.5"}}, ""},
+		{"list", map[string]interface{}{"allergens": []interface{}{"Nuts", " milk"}}, []models.ProductAttribute{{Name: "allergens", Value: "nuts"}, {Name: "allergens", Value: "milk"}}, ""},
+		{"unknown", map[string]interface{}{"colour": "red"}, nil, "unknown product attribute: colour"},
+		{"string as number", map[string]interface{}{"size": 330.0}, nil, "attribute size must be a string"},
+		{"number as string", map[string]interface{}{"calories": "139"}, nil, "attribute calories must be a number"},
+		{"list of numbers", map[string]interface{}{"allergens": []interface{}{1.0}}, nil, "attribute allergens must be a list of strings"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseAttributes(test.attributes)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("got error %v expected %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %+v expected %+v", got, test.expected)
+			}
+		})
+	}
+}
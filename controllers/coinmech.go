@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/femibiwoye/go-test/device"
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const coinPollInterval = 200 * time.Millisecond
+
+var (
+	coinMechsMu sync.Mutex
+	coinMechs   = map[uint]*device.Acceptor{}
+)
+
+// AttachCoinMech connects the coin mechanism of a machine so deposits there credit
+// the coins it accepts and change is paid out through it.
+func AttachCoinMech(machineID uint, mech device.CoinMech) error {
+	acceptor := device.NewAcceptor(mech)
+	if err := acceptor.Setup(possibleDepositAmounts); err != nil {
+		return err
+	}
+	acceptor.Start(coinPollInterval)
+
+	coinMechsMu.Lock()
+	defer coinMechsMu.Unlock()
+	if previous, ok := coinMechs[machineID]; ok {
+		previous.Stop()
+	}
+	coinMechs[machineID] = acceptor
+
+	return nil
+}
+
+// coinAcceptor returns the coin mechanism attached to a machine, nil without one.
+func coinAcceptor(machineID uint) *device.Acceptor {
+	coinMechsMu.Lock()
+	defer coinMechsMu.Unlock()
+	return coinMechs[machineID]
+}
+
+// insertedCoins returns the coins deposited into a machine for session: the coins its
+// coin mechanism counted while session was open at it, with the mechanism, or else the
+// single coin amount sent.
+func insertedCoins(machineID uint, session string, amount int) ([]int, *device.Acceptor, *requestError) {
+	acceptor := coinAcceptor(machineID)
+	if acceptor == nil {
+		if !Contains(amount, possibleDepositAmounts) {
+			return nil, nil, &requestError{errors.New("you can only deposit, 5, 10, 20, 50, 100 coins"), http.StatusBadRequest}
+		}
+		return []int{amount}, nil, nil
+	}
+
+	coins, err := acceptor.Take(session)
+	if err != nil {
+		return nil, nil, &requestError{err, http.StatusConflict}
+	}
+	if len(coins) == 0 {
+		return nil, nil, &requestError{errors.New("no coins inserted"), http.StatusBadRequest}
+	}
+	return coins, acceptor, nil
+}
+
+// openCoinSession makes session the one the coin mechanism of a machine holds
+// coins for. Machines without a coin mechanism have nothing to hold.
+func openCoinSession(machineID uint, session string) error {
+	if acceptor := coinAcceptor(machineID); acceptor != nil {
+		return acceptor.Open(session)
+	}
+	return nil
+}
+
+// closeCoinSession ends session at the coin mechanism of a machine.
+func closeCoinSession(machineID uint, session string) {
+	if acceptor := coinAcceptor(machineID); acceptor != nil {
+		acceptor.Close(session)
+	}
+}
+
+// CoinSessionStart is a function for a machine with a coin mechanism to open it for a
+// buyer with an account, e.g. after scanning their app. The machine authenticates with
+// its machine key, so only the buyer at the machine is credited the coins inserted.
+func CoinSessionStart(response http.ResponseWriter, request *http.Request) {
+	machine, err := authenticateMachine(request)
+	if err != nil {
+		utils.GetError(err, http.StatusUnauthorized, response)
+		return
+	}
+
+	if _, rerr := activeMachine(machine.ID); rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	if coinAcceptor(machine.ID) == nil {
+		utils.GetError(errors.New("machine has no coin mechanism"), http.StatusBadRequest, response)
+		return
+	}
+
+	var sessionRequest models.CoinSessionRequest
+	utils.ParseJSONFromRequest(request, &sessionRequest)
+
+	var user models.User
+	if tx := utils.GetItemByPrimaryKey(&user, sessionRequest.UserID); tx.RowsAffected < 1 {
+		utils.GetError(fmt.Errorf("user not found"), http.StatusNotFound, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "buyer" {
+		utils.GetError(fmt.Errorf("user is not a buyer"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	if err := openCoinSession(machine.ID, userSession(user.ID)); err != nil {
+		utils.GetError(err, http.StatusConflict, response)
+		return
+	}
+
+	utils.GetSuccess("coin session started", map[string]interface{}{"machine_id": machine.ID, "user_id": user.ID}, response)
+}
+
+// ReportCoinMechFaults records the faults reported by the coin mechanisms since the
+// last run as jams of their machines, which takes them out of service, and logs
+// mechanisms that cannot be polled. It returns the number of faults recorded.
+func ReportCoinMechFaults() (int, error) {
+	coinMechsMu.Lock()
+	acceptors := make(map[uint]*device.Acceptor, len(coinMechs))
+	for machineID, acceptor := range coinMechs {
+		acceptors[machineID] = acceptor
+	}
+	coinMechsMu.Unlock()
+
+	now := time.Now()
+	reported := 0
+	for machineID, acceptor := range acceptors {
+		if err := acceptor.Err(); err != nil {
+			log.Printf("Error polling coin mechanism of machine %d: %v", machineID, err)
+		}
+
+		faults := acceptor.Faults()
+		if len(faults) == 0 {
+			continue
+		}
+
+		var machine models.Machine
+		if tx := utils.GetItemByPrimaryKey(&machine, machineID); tx.RowsAffected < 1 {
+			continue
+		}
+
+		events := make([]models.TelemetryEvent, 0, len(faults))
+		for _, fault := range faults {
+			events = append(events, models.TelemetryEvent{
+				MachineID:  machine.ID,
+				Kind:       models.TelemetryJam,
+				Detail:     "coin mechanism: " + fault.Detail,
+				RecordedAt: now.Unix(),
+			})
+		}
+		if err := recordTelemetry(machine, events, now); err != nil {
+			return reported, err
+		}
+		reported += len(events)
+	}
+
+	return reported, nil
+}
+
+// payOutChange dispenses the change of reset through the coin mechanism of machine.
+// Coins the mechanism fails to pay out are put back in the machine and credited
+// back to the buyer, so the response only lists coins that were paid.
+func payOutChange(machine models.Machine, userID uint, reset models.ResetResponse) (models.ResetResponse, error) {
+	return dispenseChange(machine, reset, func(tx *gorm.DB, unpaid int) error {
+		deposit := models.MachineDeposit{UserID: userID, MachineID: machine.ID, Amount: unpaid}
+		return tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{"amount": gorm.Expr("amount + ?", unpaid)}),
+		}).Create(&deposit).Error
+	})
+}
+
+// dispenseChange pays out the coins of reset through the coin mechanism of machine.
+// Coins it fails to pay out are put back in the machine and credit gives their
+// value back to whoever the change was for, in the same transaction.
+func dispenseChange(machine models.Machine, reset models.ResetResponse, credit func(tx *gorm.DB, unpaid int) error) (models.ResetResponse, error) {
+	acceptor := coinAcceptor(machine.ID)
+	if acceptor == nil || reset.Returned == 0 {
+		return reset, nil
+	}
+
+	paid, payErr := acceptor.PayOut(reset.Coins)
+	if payErr == nil {
+		return reset, nil
+	}
+	log.Printf("Error paying out change at machine %d: %v", machine.ID, payErr)
+
+	unpaid := 0
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		for denomination, count := range reset.Coins {
+			owed := count - paid[denomination]
+			if owed == 0 {
+				continue
+			}
+			unpaid += owed * denomination
+			err := tx.Model(&models.MachineCoin{}).
+				Where("machine_id = ? AND denomination = ?", machine.ID, denomination).
+				Update("count", gorm.Expr("count + ?", owed)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return credit(tx, unpaid)
+	})
+	if err != nil {
+		return reset, err
+	}
+
+	reset.Coins = paid
+	reset.Returned -= unpaid
+	reset.Remaining += unpaid
+	return reset, nil
+}
@@ -174,9 +174,10 @@ func setupProduct() (uint, error) {
 	}
 
 	product := models.Product{
-		Cost:        50,
-		ProductName: "Test Product",
-		SellerId:    checkUser.ID,
+		Cost:            50,
+		ProductName:     "Test Product",
+		SellerId:        checkUser.ID,
+		AmountAvailable: 100,
 	}
 
 	res := utils.CreateItem(&product)
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/femibiwoye/go-test/forecast"
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+)
+
+// MachineForecast is a function for operators to forecast the demand for each product in a
+// machine from its sales, with the quantity to restock and the day to restock it by. The
+// query can set the method, the days of history to use, the horizon in days to look ahead
+// and the cycle in days a restock should last. Days a product sold out on are left out of
+// its history, as its sales then show the stock there was rather than the demand.
+func MachineForecast(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	params := request.URL.Query()
+	model := forecast.Model{Method: forecast.Method(params.Get("method"))}
+	if model.Method == "" {
+		model.Method = forecast.ExponentialSmoothing
+	}
+	if model.Method != forecast.MovingAverage && model.Method != forecast.ExponentialSmoothing {
+		utils.GetError(errors.New("method must be moving_average or exponential_smoothing"), http.StatusBadRequest, response)
+		return
+	}
+
+	history, err := dayParam(params, "history", 56, 365)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+	horizon, err := dayParam(params, "horizon", 28, 90)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+	cycle, err := dayParam(params, "cycle", 7, 90)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var slots []models.MachineSlot
+	if err := utils.Db.Where("machine_id = ? AND product_id <> 0", machine.ID).Find(&slots).Error; err != nil {
+		utils.GetError(errors.New("error forecasting demand"), http.StatusInternalServerError, response)
+		return
+	}
+
+	// a product can be sold from more than one slot
+	stock := map[uint]forecast.Stock{}
+	for _, slot := range slots {
+		productStock := stock[slot.ProductID]
+		productStock.Quantity += slot.Quantity
+		productStock.Capacity += slot.Capacity
+		productStock.ParLevel += slot.ParLevel
+		stock[slot.ProductID] = productStock
+	}
+
+	today := forecast.Midnight(time.Now())
+	from := today.AddDate(0, 0, -history)
+
+	sales, err := machineSales(machine.ID, from)
+	if err != nil {
+		utils.GetError(errors.New("error forecasting demand"), http.StatusInternalServerError, response)
+		return
+	}
+
+	loads, err := machineLoads(machine.ID, from)
+	if err != nil {
+		utils.GetError(errors.New("error forecasting demand"), http.StatusInternalServerError, response)
+		return
+	}
+
+	productIDs := make([]uint, 0, len(stock))
+	for productID := range stock {
+		productIDs = append(productIDs, productID)
+	}
+	names, err := productNames(productIDs)
+	if err != nil {
+		utils.GetError(errors.New("error forecasting demand"), http.StatusInternalServerError, response)
+		return
+	}
+
+	machineForecast := models.MachineForecast{
+		MachineID: machine.ID,
+		Method:    string(model.Method),
+		History:   history,
+		Horizon:   horizon,
+		Cycle:     cycle,
+		Products:  []models.ProductForecast{},
+	}
+
+	for productID, productStock := range stock {
+		// today is not part of the history but leads back from the stock now to its start
+		sold := forecast.Daily(sales[productID], from, history+1)
+		loaded := forecast.Daily(loads[productID], from, history+1)
+		days := forecast.DropSoldOut(sold, loaded, productStock.Quantity)[:history]
+
+		fitted, err := model.Fit(days, from)
+		if err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+
+		suggestion := forecast.Suggest(fitted, productStock, today, horizon, cycle)
+		productForecast := models.ProductForecast{
+			ProductID:   productID,
+			ProductName: names[productID],
+			Stock:       productStock.Quantity,
+			Capacity:    productStock.Capacity,
+			ParLevel:    productStock.ParLevel,
+			DailyDemand: roundHundredths(fitted.Over(today, 7) / 7),
+			NeedsVisit:  suggestion.NeedsVisit,
+			Days:        suggestion.Days,
+			Projected:   suggestion.Projected,
+			Quantity:    suggestion.Quantity,
+			CycleDemand: roundHundredths(suggestion.CycleDemand),
+		}
+		if suggestion.NeedsVisit {
+			productForecast.RestockBy = suggestion.RestockBy.Unix()
+			if machineForecast.NextVisit == 0 || productForecast.RestockBy < machineForecast.NextVisit {
+				machineForecast.NextVisit = productForecast.RestockBy
+			}
+		}
+		machineForecast.Products = append(machineForecast.Products, productForecast)
+	}
+
+	sort.Slice(machineForecast.Products, func(i, j int) bool {
+		return machineForecast.Products[i].ProductID < machineForecast.Products[j].ProductID
+	})
+
+	utils.GetSuccess("forecast retreived successfully", machineForecast, response)
+}
+
+// machineSales returns the sales of each product at a machine since from.
+func machineSales(machineID uint, from time.Time) (map[uint][]forecast.Sale, error) {
+	var rows []struct {
+		ProductID uint
+		Quantity  int
+		CreatedAt int64
+	}
+	err := utils.Db.Table("order_items").
+		Select("order_items.product_id, order_items.quantity, orders.created_at").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.machine_id = ? AND orders.created_at >= ?", machineID, from.Unix()).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sales := map[uint][]forecast.Sale{}
+	for _, row := range rows {
+		sales[row.ProductID] = append(sales[row.ProductID], forecast.Sale{At: time.Unix(row.CreatedAt, 0), Quantity: row.Quantity})
+	}
+	return sales, nil
+}
+
+// machineLoads returns the units of each product loaded into a machine on restock
+// visits completed since from.
+func machineLoads(machineID uint, from time.Time) (map[uint][]forecast.Sale, error) {
+	var rows []struct {
+		ProductID   uint
+		Loaded      int
+		CompletedAt int64
+	}
+	err := utils.Db.Table("restock_items").
+		Select("restock_items.product_id, restock_items.loaded, restock_visits.completed_at").
+		Joins("JOIN restock_visits ON restock_visits.id = restock_items.visit_id").
+		Where("restock_visits.machine_id = ? AND restock_visits.status = ? AND restock_visits.completed_at >= ? AND restock_items.loaded > 0", machineID, models.VisitCompleted, from.Unix()).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	loads := map[uint][]forecast.Sale{}
+	for _, row := range rows {
+		loads[row.ProductID] = append(loads[row.ProductID], forecast.Sale{At: time.Unix(row.CompletedAt, 0), Quantity: row.Loaded})
+	}
+	return loads, nil
+}
+
+// productNames returns the names of products by ID.
+func productNames(productIDs []uint) (map[uint]string, error) {
+	names := map[uint]string{}
+	if len(productIDs) == 0 {
+		return names, nil
+	}
+
+	var products []models.Product
+	if err := utils.Db.Select("id", "product_name").Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	for _, product := range products {
+		names[product.ID] = product.ProductName
+	}
+	return names, nil
+}
+
+// dayParam reads a number of days from the query, between 1 and max.
+func dayParam(params url.Values, name string, fallback, max int) (int, error) {
+	value := params.Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 || days > max {
+		return 0, fmt.Errorf("%s must be a number of days between 1 and %d", name, max)
+	}
+	return days, nil
+}
@@ -0,0 +1,544 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	hardware "github.com/femibiwoye/go-test/machine"
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const guestSessionHeader = "X-Guest-Session"
+
+var (
+	errGuestSessionInvalid = errors.New("guest session invalid")
+	errMachineInUse        = errors.New("machine is in use by another guest")
+)
+
+// GuestSessionStart is a function for a machine to start a session for a customer
+// without an account. It authenticates with its machine key and hands the token to
+// the customer. An idle session with no balance left at the machine is ended first, and
+// the coin mechanism of the machine is opened to the new session.
+func GuestSessionStart(response http.ResponseWriter, request *http.Request) {
+	machine, err := authenticateMachine(request)
+	if err != nil {
+		utils.GetError(err, http.StatusUnauthorized, response)
+		return
+	}
+
+	if _, rerr := activeMachine(machine.ID); rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	token, err := generateToken("vgs_")
+	if err != nil {
+		utils.GetError(errors.New("could not start guest session"), http.StatusInternalServerError, response)
+		return
+	}
+
+	now := time.Now().Unix()
+	session := models.GuestSession{
+		MachineID:      machine.ID,
+		TokenHash:      hashToken(token),
+		Status:         models.GuestSessionOpen,
+		LastActivityAt: now,
+	}
+
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		// the machine row serialises sessions starting at the same machine
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Machine{}, machine.ID).Error; err != nil {
+			return err
+		}
+
+		var open []models.GuestSession
+		if err := tx.Where("machine_id = ? AND status = ?", machine.ID, models.GuestSessionOpen).Find(&open).Error; err != nil {
+			return err
+		}
+		for _, previous := range open {
+			if previous.Balance > 0 {
+				return errMachineInUse
+			}
+			if err := tx.Model(&previous).Updates(map[string]interface{}{
+				"status":     models.GuestSessionEnded,
+				"end_reason": models.GuestReplaced,
+				"ended_at":   now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		// coins inserted from now on are credited to this session
+		if err := openCoinSession(machine.ID, guestSessionKey(session.ID)); err != nil {
+			return errMachineInUse
+		}
+		return nil
+	})
+	if err != nil && session.ID != 0 {
+		closeCoinSession(machine.ID, guestSessionKey(session.ID))
+	}
+	if err == errMachineInUse {
+		utils.GetError(err, http.StatusConflict, response)
+		return
+	}
+	if err != nil {
+		utils.GetError(errors.New("could not start guest session"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("guest session started", models.GuestSessionStarted{Token: token, Session: session}, response)
+}
+
+// GuestSessionGet is a function for a guest to see the balance of their session
+func GuestSessionGet(response http.ResponseWriter, request *http.Request) {
+	session, rerr := guestSession(request)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	utils.GetSuccess("guest session retreived successfully", session, response)
+}
+
+// GuestDeposit is a function for a guest to deposit a coin into the machine of their session
+func GuestDeposit(response http.ResponseWriter, request *http.Request) {
+	session, rerr := guestSession(request)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	machine, rerr := activeMachine(session.MachineID)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var depositRequest models.GuestDepositRequest
+	utils.ParseJSONFromRequest(request, &depositRequest)
+
+	coins, acceptor, rerr := insertedCoins(machine.ID, guestSessionKey(session.ID), depositRequest.Amount)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	if rerr := fireMachine(machine, guestSessionKey(session.ID), hardware.EventCoin); rerr != nil {
+		if acceptor != nil {
+			acceptor.Return(coins)
+		}
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if session, err = lockGuestSession(tx, session.ID); err != nil {
+			return err
+		}
+
+		amount := 0
+		for _, coin := range coins {
+			if err := addMachineCoin(tx, machine.ID, coin); err != nil {
+				return err
+			}
+			amount += coin
+		}
+
+		session.Balance += amount
+		session.Deposited += amount
+		session.LastActivityAt = time.Now().Unix()
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"balance":          session.Balance,
+			"deposited":        session.Deposited,
+			"last_activity_at": session.LastActivityAt,
+		}).Error
+	})
+	if err != nil {
+		if acceptor != nil {
+			acceptor.Return(coins)
+		}
+		if err == errGuestSessionInvalid {
+			utils.GetError(err, http.StatusUnauthorized, response)
+			return
+		}
+		utils.GetError(fmt.Errorf("deposit failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("deposit successful", map[string]interface{}{"machine_id": machine.ID, "coins": coins, "balance": session.Balance}, response)
+}
+
+// GuestBuy is a function for a guest to buy from the machine of their session with its balance.
+// Vouchers and loyalty points need an account, and products only a verified buyer can buy are refused.
+// Daily limits count what was bought earlier in the session.
+func GuestBuy(response http.ResponseWriter, request *http.Request) {
+	session, rerr := guestSession(request)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var buyRequest models.BuyRequest
+	utils.ParseJSONFromRequest(request, &buyRequest)
+
+	if buyRequest.VoucherCode != "" || buyRequest.Points != 0 {
+		utils.GetError(errors.New("vouchers and loyalty points need an account"), http.StatusBadRequest, response)
+		return
+	}
+	buyRequest.MachineID = session.MachineID
+
+	items, err := buyItems(buyRequest)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	machine, rerr := activeMachine(session.MachineID)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	if items, rerr = resolveSlotItems(machine.ID, items); rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	now := time.Now()
+
+	lines, rerr := loadPurchaseLines(items, now)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	restricted, err := checkRestrictions(utils.Db, models.User{}, session.ID, lines, now)
+	if err != nil {
+		utils.GetError(fmt.Errorf("purchase failed, try again latyer"), http.StatusInternalServerError, response)
+		return
+	}
+	if restricted != nil {
+		data := map[string]interface{}{"code": restricted.code, "product_id": restricted.productID}
+		utils.GetDetailedError(restricted.message, http.StatusForbidden, data, response)
+		return
+	}
+
+	discounts, err := purchaseDiscounts(lines, now)
+	if err != nil {
+		utils.GetError(fmt.Errorf("purchase failed, try again latyer"), http.StatusInternalServerError, response)
+		return
+	}
+
+	buyResponse := newBuyResponse(lines, discounts)
+	buyResponse.MachineID = machine.ID
+
+	if rerr := fireMachine(machine, guestSessionKey(session.ID), hardware.EventSelect); rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var balance int
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		balance, err = completeGuestPurchase(tx, session.ID, lines, &buyResponse, now)
+		return err
+	})
+
+	switch {
+	case err != nil:
+		settleMachine(machine, guestSessionKey(session.ID), hardware.EventVendAborted)
+	case balance == 0:
+		settleMachine(machine, guestSessionKey(session.ID), hardware.EventVended, hardware.EventSessionEnd)
+	default:
+		settleMachine(machine, guestSessionKey(session.ID), hardware.EventVended)
+	}
+
+	var restrictedErr *restrictionError
+	if errors.As(err, &restrictedErr) {
+		data := map[string]interface{}{"code": restrictedErr.code, "product_id": restrictedErr.productID}
+		utils.GetDetailedError(restrictedErr.message, http.StatusForbidden, data, response)
+		return
+	}
+	if err == errGuestSessionInvalid {
+		utils.GetError(err, http.StatusUnauthorized, response)
+		return
+	}
+	if err == errInsufficientFunds {
+		utils.GetError(fmt.Errorf("insufficient funds"), http.StatusNotAcceptable, response)
+		return
+	}
+	if err == errOutOfStock {
+		utils.GetError(err, http.StatusNotAcceptable, response)
+		return
+	}
+	if err != nil {
+		utils.GetError(fmt.Errorf("purchase failed, try again latyer"), http.StatusInternalServerError, response)
+		return
+	}
+
+	buyResponse.Change = balance
+
+	productIDs := make([]uint, 0, len(lines))
+	for _, line := range lines {
+		productIDs = append(productIDs, line.product.ID)
+	}
+	checkSlotLevels(machine.ID, productIDs...)
+
+	utils.GetSuccess("purchase successful", buyResponse, response)
+}
+
+// GuestSessionEnd is a function for a guest to end their session and get its balance back as change
+func GuestSessionEnd(response http.ResponseWriter, request *http.Request) {
+	session, rerr := guestSession(request)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var machine models.Machine
+	if tx := utils.GetItemByPrimaryKey(&machine, session.MachineID); tx.RowsAffected < 1 {
+		utils.GetError(errMachineNotFound, http.StatusNotFound, response)
+		return
+	}
+
+	reset, rerr := endGuestSession(session.ID, machine, models.GuestEndedByGuest)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	utils.GetSuccess("guest session ended", reset, response)
+}
+
+// MachineGuestSessions is a function for operators to list the guest sessions at a
+// machine, including ended sessions holding credit the machine could not pay out.
+func MachineGuestSessions(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	query := utils.Db.Model(&models.GuestSession{}).Where("machine_id = ?", machine.ID)
+	if status := request.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	sessions := []models.GuestSession{}
+	if err := query.Order("id desc").Offset(pagination.Offset()).Limit(pagination.Limit).Find(&sessions).Error; err != nil {
+		utils.GetError(errors.New("error fetching guest sessions"), http.StatusInternalServerError, response)
+		return
+	}
+
+	respse := map[string]interface{}{
+		"sessions": sessions,
+		"meta":     models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("guest sessions retreived successfully", respse, response)
+}
+
+// ExpireGuestSessions ends the guest sessions idle for longer than idle, paying their
+// balance out as change, and returns how many it ended. A session busy with a request
+// of its guest is left for the next run.
+func ExpireGuestSessions(idle time.Duration) (int, error) {
+	cutoff := time.Now().Add(-idle).Unix()
+
+	var sessions []models.GuestSession
+	err := utils.Db.Where("status = ? AND last_activity_at < ?", models.GuestSessionOpen, cutoff).Find(&sessions).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, session := range sessions {
+		var machine models.Machine
+		if tx := utils.GetItemByPrimaryKey(&machine, session.MachineID); tx.RowsAffected < 1 {
+			continue
+		}
+
+		_, rerr := endGuestSession(session.ID, machine, models.GuestTimedOut)
+		if rerr != nil {
+			if rerr.err != errGuestSessionInvalid && rerr.err != errMachineBusy {
+				log.Printf("Error ending guest session %d: %v", session.ID, rerr.err)
+			}
+			continue
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// guestSession returns the open guest session of the token in the request.
+func guestSession(request *http.Request) (models.GuestSession, *requestError) {
+	var session models.GuestSession
+
+	token := request.Header.Get(guestSessionHeader)
+	if token == "" {
+		return session, &requestError{errGuestSessionInvalid, http.StatusUnauthorized}
+	}
+
+	tx := utils.Db.Where("token_hash = ? AND status = ?", hashToken(token), models.GuestSessionOpen).Limit(1).Find(&session)
+	if tx.RowsAffected < 1 {
+		return session, &requestError{errGuestSessionInvalid, http.StatusUnauthorized}
+	}
+
+	return session, nil
+}
+
+// lockGuestSession locks a guest session inside tx, which must still be open.
+func lockGuestSession(tx *gorm.DB, sessionID uint) (models.GuestSession, error) {
+	var session models.GuestSession
+
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND status = ?", sessionID, models.GuestSessionOpen).
+		Limit(1).
+		Find(&session)
+	if result.Error != nil {
+		return session, result.Error
+	}
+	if result.RowsAffected < 1 {
+		return session, errGuestSessionInvalid
+	}
+
+	return session, nil
+}
+
+// completeGuestPurchase charges a guest session for lines inside tx, taking the items
+// out of the slots of its machine and recording the order against the session. It
+// returns the balance left in the session. Restrictions are checked again with the
+// session locked.
+func completeGuestPurchase(tx *gorm.DB, sessionID uint, lines []purchaseLine, buyResponse *models.BuyResponse, at time.Time) (int, error) {
+	// the session stays locked until the order is recorded, so concurrent purchases
+	// count against each other's daily limits
+	session, err := lockGuestSession(tx, sessionID)
+	if err != nil {
+		return 0, err
+	}
+	restricted, err := checkRestrictions(tx, models.User{}, session.ID, lines, at)
+	if err != nil {
+		return 0, err
+	}
+	if restricted != nil {
+		return 0, restricted
+	}
+	if session.Balance < buyResponse.AmountSpent {
+		return 0, errInsufficientFunds
+	}
+
+	if err := reserveLines(tx, session.MachineID, lines, buyResponse, at); err != nil {
+		return 0, err
+	}
+
+	order := newOrder(0, session.MachineID, lines, *buyResponse)
+	order.GuestSessionID = &session.ID
+	if err := recordOrder(tx, &order, buyResponse); err != nil {
+		return 0, err
+	}
+
+	session.Balance -= buyResponse.AmountSpent
+	session.Spent += buyResponse.AmountSpent
+	err = tx.Model(&session).Updates(map[string]interface{}{
+		"balance":          session.Balance,
+		"spent":            session.Spent,
+		"last_activity_at": at.Unix(),
+	}).Error
+
+	return session.Balance, err
+}
+
+// endGuestSession ends a guest session and pays its balance out in change. A guest has
+// no account to refund to, so change is paid out even when the machine is not in
+// service. What the machine cannot pay out stays as the balance of the ended session.
+func endGuestSession(sessionID uint, machine models.Machine, reason string) (models.ResetResponse, *requestError) {
+	reset := models.ResetResponse{MachineID: machine.ID, Coins: map[int]int{}}
+
+	active := machine.Status == models.MachineActive
+	if active {
+		if rerr := fireMachine(machine, guestSessionKey(sessionID), hardware.EventCancel); rerr != nil {
+			return reset, rerr
+		}
+	}
+
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		session, err := lockGuestSession(tx, sessionID)
+		if err != nil {
+			return err
+		}
+
+		if session.Balance > 0 {
+			change, paid, err := takeChange(tx, machine.ID, session.Balance)
+			if err != nil {
+				return err
+			}
+			reset.Coins = change
+			reset.Returned = paid
+			reset.Remaining = session.Balance - paid
+		}
+
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"status":     models.GuestSessionEnded,
+			"end_reason": reason,
+			"balance":    reset.Remaining,
+			"returned":   reset.Returned,
+			"ended_at":   time.Now().Unix(),
+		}).Error
+	})
+	if err == nil {
+		reset, err = dispenseChange(machine, reset, func(tx *gorm.DB, unpaid int) error {
+			return tx.Model(&models.GuestSession{}).Where("id = ?", sessionID).Updates(map[string]interface{}{
+				"balance":  gorm.Expr("balance + ?", unpaid),
+				"returned": gorm.Expr("returned - ?", unpaid),
+			}).Error
+		})
+	}
+
+	if active {
+		settleMachine(machine, guestSessionKey(sessionID), hardware.EventChangeDispensed)
+	}
+	if err == nil {
+		closeCoinSession(machine.ID, guestSessionKey(sessionID))
+	}
+
+	if err == errGuestSessionInvalid {
+		return reset, &requestError{err, http.StatusUnauthorized}
+	}
+	if err != nil {
+		return reset, &requestError{errors.New("ending guest session failed"), http.StatusInternalServerError}
+	}
+
+	return reset, nil
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/femibiwoye/go-test/device"
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+)
+
+// TestGuestSessions tests guest sessions are only replaced without a balance and their
+// balance is paid out when they end
+func TestGuestSessions(t *testing.T) {
+	machine := models.Machine{Name: "Guest test machine", Status: models.MachineActive}
+	if result := utils.CreateItem(&machine); result.RowsAffected < 1 {
+		t.Fatal("machine not created")
+	}
+
+	key, err := generateMachineKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := utils.CreateItem(&models.MachineKey{MachineID: machine.ID, KeyHash: hashToken(key), Prefix: key[:8]}); result.RowsAffected < 1 {
+		t.Fatal("machine key not created")
+	}
+
+	startSession := func() (int, models.GuestSession) {
+		t.Helper()
+		r := getRouter()
+		r.HandleFunc("/v1/guest/sessions", GuestSessionStart).Methods("POST")
+		req, _ := http.NewRequest("POST", "/v1/guest/sessions", nil)
+		req.Header.Add(machineKeyHeader, key)
+
+		response := getHTTPResponse(t, r, req)
+
+		var session models.GuestSession
+		utils.Db.Where("machine_id = ?", machine.ID).Order("id desc").Limit(1).Find(&session)
+		return response.Code, session
+	}
+
+	// fund gives a session a balance and the machine the coins to pay it out
+	fund := func(session models.GuestSession, balance int, machineCoins map[int]int) {
+		t.Helper()
+		utils.Db.Model(&session).Updates(map[string]interface{}{"balance": balance, "deposited": balance})
+		for denomination, count := range machineCoins {
+			utils.Db.Where("machine_id = ? AND denomination = ?", machine.ID, denomination).Delete(&models.MachineCoin{})
+			if result := utils.CreateItem(&models.MachineCoin{MachineID: machine.ID, Denomination: denomination, Count: count}); result.RowsAffected < 1 {
+				t.Fatal("machine coins not created")
+			}
+		}
+	}
+
+	coinCount := func(denomination int) int {
+		var coin models.MachineCoin
+		utils.Db.Where("machine_id = ? AND denomination = ?", machine.ID, denomination).First(&coin)
+		return coin.Count
+	}
+
+	code, first := startSession()
+	assertStatusCode(t, code, http.StatusOK)
+
+	t.Run("test a session holding a balance is not replaced", func(t *testing.T) {
+		fund(first, 20, nil)
+
+		code, latest := startSession()
+		assertStatusCode(t, code, http.StatusConflict)
+
+		if latest.ID != first.ID {
+			t.Errorf("got a new session %d expected none", latest.ID)
+		}
+		var session models.GuestSession
+		utils.Db.First(&session, first.ID)
+		if session.Status != models.GuestSessionOpen || session.Balance != 20 {
+			t.Errorf("got session %+v expected it open with 20", session)
+		}
+	})
+
+	t.Run("test an idle session is paid out when it times out", func(t *testing.T) {
+		fund(first, 70, map[int]int{50: 1, 10: 2})
+		utils.Db.Model(&first).Update("last_activity_at", time.Now().Add(-time.Hour).Unix())
+
+		expired, err := ExpireGuestSessions(10 * time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expired < 1 {
+			t.Fatalf("got %d sessions expired expected at least 1", expired)
+		}
+
+		var session models.GuestSession
+		utils.Db.First(&session, first.ID)
+		if session.Status != models.GuestSessionEnded || session.EndReason != models.GuestTimedOut {
+			t.Errorf("got session %s %s expected it timed out", session.Status, session.EndReason)
+		}
+		if session.Balance != 0 || session.Returned != 70 {
+			t.Errorf("got balance %d returned %d expected 0 and 70", session.Balance, session.Returned)
+		}
+		if coinCount(50) != 0 || coinCount(10) != 0 {
+			t.Errorf("got %d 50s and %d 10s left expected none", coinCount(50), coinCount(10))
+		}
+	})
+
+	t.Run("test change the coin mechanism cannot pay out stays in the session", func(t *testing.T) {
+		// the tubes are missing the 10s the machine believes it holds
+		mech := device.NewFake(possibleDepositAmounts)
+		mech.Fill(50, 1)
+		if err := AttachCoinMech(machine.ID, mech); err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			coinMechsMu.Lock()
+			coinMechs[machine.ID].Stop()
+			delete(coinMechs, machine.ID)
+			coinMechsMu.Unlock()
+		}()
+
+		code, session := startSession()
+		assertStatusCode(t, code, http.StatusOK)
+		fund(session, 70, map[int]int{50: 1, 10: 2})
+
+		reset, rerr := endGuestSession(session.ID, machine, models.GuestEndedByGuest)
+		if rerr != nil {
+			t.Fatalf("unexpected error %v", rerr.err)
+		}
+		if reset.Returned != 50 || reset.Remaining != 20 || reset.Coins[50] != 1 || reset.Coins[10] != 0 {
+			t.Errorf("got %+v expected 50 paid in a 50 and 20 remaining", reset)
+		}
+		if dispensed := mech.Dispensed(); dispensed[50] != 1 || dispensed[10] != 0 {
+			t.Errorf("got %v dispensed expected a 50", dispensed)
+		}
+
+		utils.Db.First(&session, session.ID)
+		if session.Status != models.GuestSessionEnded || session.Balance != 20 || session.Returned != 50 {
+			t.Errorf("got session %+v expected it ended with 20 left and 50 returned", session)
+		}
+		if coinCount(50) != 0 || coinCount(10) != 2 {
+			t.Errorf("got %d 50s and %d 10s expected the 10s put back", coinCount(50), coinCount(10))
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	hardware "github.com/femibiwoye/go-test/machine"
+	"github.com/femibiwoye/go-test/models"
+)
+
+var (
+	// fleet follows the hardware state of every machine the API is a frontend to.
+	fleet = hardware.NewFleet(possibleDepositAmounts)
+
+	errMachineBusy = errors.New("machine is busy, try again shortly")
+)
+
+// machineUnit returns the hardware state machine of machine.
+func machineUnit(machine models.Machine) *hardware.Machine {
+	return fleet.Machine(machine.ID, machine.Status == models.MachineActive)
+}
+
+// userSession and guestSessionKey name the hardware session of a buyer at a machine.
+func userSession(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func guestSessionKey(sessionID uint) string {
+	return fmt.Sprintf("guest:%d", sessionID)
+}
+
+// fireMachine moves the hardware session of a buyer at machine through event. Events the
+// session cannot handle mean the machine is out of service or busy with another request
+// of the same buyer.
+func fireMachine(machine models.Machine, session string, event hardware.Event) *requestError {
+	state, err := fleet.FireSession(machine.ID, session, machine.Status == models.MachineActive, event)
+	if err != nil && state == hardware.OutOfService {
+		return &requestError{machineStatusError(machine), http.StatusNotAcceptable}
+	}
+	if err != nil {
+		return &requestError{errMachineBusy, http.StatusConflict}
+	}
+	return nil
+}
+
+// settleMachine moves the hardware session of a buyer through events once a sale or
+// payout is committed. The buyer has already been charged or paid, so an event the
+// session refuses is logged and the session is started again from idle.
+func settleMachine(machine models.Machine, session string, events ...hardware.Event) {
+	for _, event := range events {
+		if rerr := fireMachine(machine, session, event); rerr != nil {
+			log.Printf("Error settling %s at machine %d after %s: %v", session, machine.ID, event, rerr.err)
+			fleet.EndSession(machine.ID, session)
+			return
+		}
+	}
+}
+
+// setMachineInService takes the hardware of machine out of service or puts it back.
+// Sessions open at the machine are dropped when it is taken out of service.
+func setMachineInService(machine models.Machine, inService bool) *requestError {
+	unit := machineUnit(machine)
+	if (unit.State() == hardware.OutOfService) != inService {
+		return nil
+	}
+
+	if inService {
+		if _, err := unit.Fire(hardware.EventService); err != nil {
+			return &requestError{errMachineBusy, http.StatusConflict}
+		}
+		return nil
+	}
+
+	if _, err := unit.Fire(hardware.EventShutdown); err != nil {
+		return &requestError{errMachineBusy, http.StatusConflict}
+	}
+	fleet.Reset(machine.ID)
+	return nil
+}
+
+// machineState is the hardware state of machine as shown by the API. A machine in
+// service is accepting coins while any buyer has a session open at it.
+func machineState(machine models.Machine) string {
+	state := machineUnit(machine).State()
+	if state == hardware.Idle && len(fleet.Sessions(machine.ID)) > 0 {
+		state = hardware.AcceptingCoins
+	}
+	return string(state)
+}
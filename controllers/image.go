@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/storage"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxImageSize   = 5 << 20
+	maxImagePixels = 25000000
+	thumbnailSize  = 200
+)
+
+// ImageStore is where product images and thumbnails are stored. It is set up by main.go.
+var ImageStore storage.BlobStore
+
+// allowedImageTypes maps the accepted image content types to their file extension.
+var allowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ProductImageUpload uploads the image of a product as multipart form field "image"
+// and generates its thumbnail. Only the seller who created the product can upload it.
+func ProductImageUpload(response http.ResponseWriter, request *http.Request) {
+	productID := mux.Vars(request)["product_id"]
+
+	product, rerr := sellerProduct(request, productID)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	request.Body = http.MaxBytesReader(response, request.Body, maxImageSize+1<<20)
+	file, _, err := request.FormFile("image")
+	if err != nil {
+		utils.GetError(errors.New("image file is required and must be at most 5MB"), http.StatusBadRequest, response)
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		utils.GetError(errors.New("error reading image"), http.StatusBadRequest, response)
+		return
+	}
+	if len(content) > maxImageSize {
+		utils.GetError(errors.New("image must be at most 5MB"), http.StatusRequestEntityTooLarge, response)
+		return
+	}
+
+	contentType := http.DetectContentType(content)
+	extension, ok := allowedImageTypes[contentType]
+	if !ok {
+		utils.GetError(errors.New("image must be a jpeg, png or gif"), http.StatusUnsupportedMediaType, response)
+		return
+	}
+
+	// check the dimensions before decoding so huge images cannot exhaust memory
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || config.Width*config.Height > maxImagePixels {
+		utils.GetError(errors.New("invalid or too large image"), http.StatusBadRequest, response)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		utils.GetError(errors.New("invalid image"), http.StatusBadRequest, response)
+		return
+	}
+
+	var thumbnail bytes.Buffer
+	if err := png.Encode(&thumbnail, utils.Thumbnail(img, thumbnailSize)); err != nil {
+		utils.GetError(errors.New("error generating thumbnail"), http.StatusInternalServerError, response)
+		return
+	}
+
+	version := strconv.FormatInt(time.Now().UnixNano(), 10)
+	imageKey := fmt.Sprintf("products/%d/%s%s", product.ID, version, extension)
+	thumbnailKey := fmt.Sprintf("products/%d/%s-thumb.png", product.ID, version)
+
+	if err := ImageStore.Put(imageKey, bytes.NewReader(content)); err != nil {
+		utils.GetError(errors.New("error storing image"), http.StatusInternalServerError, response)
+		return
+	}
+	if err := ImageStore.Put(thumbnailKey, &thumbnail); err != nil {
+		ImageStore.Delete(imageKey)
+		utils.GetError(errors.New("error storing image"), http.StatusInternalServerError, response)
+		return
+	}
+
+	updateMap := map[string]interface{}{
+		"image_key":     imageKey,
+		"thumbnail_key": thumbnailKey,
+	}
+
+	if result := utils.Db.Table("products").Where("id = ?", product.ID).Updates(updateMap); result.Error != nil {
+		ImageStore.Delete(imageKey)
+		ImageStore.Delete(thumbnailKey)
+		utils.GetError(errors.New("error storing image"), http.StatusInternalServerError, response)
+		return
+	}
+
+	deleteProductImages(product)
+
+	respse := map[string]interface{}{
+		"image_url":     ImageStore.URL(imageKey),
+		"thumbnail_url": ImageStore.URL(thumbnailKey),
+	}
+
+	utils.GetSuccess("product image uploaded successfully", respse, response)
+}
+
+// ProductImageDelete removes the image of a product. Only the seller who created the product can remove it.
+func ProductImageDelete(response http.ResponseWriter, request *http.Request) {
+	productID := mux.Vars(request)["product_id"]
+
+	product, rerr := sellerProduct(request, productID)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	if product.ImageKey == "" {
+		utils.GetError(errors.New("product has no image"), http.StatusNotFound, response)
+		return
+	}
+
+	updateMap := map[string]interface{}{
+		"image_key":     "",
+		"thumbnail_key": "",
+	}
+
+	if result := utils.Db.Table("products").Where("id = ?", product.ID).Updates(updateMap); result.Error != nil {
+		utils.GetError(errors.New("product image delete failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	deleteProductImages(product)
+
+	utils.GetSuccess("product image successfully deleted", nil, response)
+}
+
+// MediaGet serves a stored blob such as a product image.
+func MediaGet(response http.ResponseWriter, request *http.Request) {
+	key := mux.Vars(request)["key"]
+
+	blob, err := ImageStore.Get(key)
+	if err != nil {
+		utils.GetError(errors.New("file not found"), http.StatusNotFound, response)
+		return
+	}
+	defer blob.Close()
+
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		response.Header().Set("Content-Type", contentType)
+	}
+	response.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	if _, err := io.Copy(response, blob); err != nil {
+		log.Printf("Error sending file: %v", err)
+	}
+}
+
+// setProductImageURLs fills in the image URLs of products that have an image.
+func setProductImageURLs(products []models.Product) {
+	for i := range products {
+		if products[i].ImageKey != "" {
+			products[i].ImageURL = ImageStore.URL(products[i].ImageKey)
+		}
+		if products[i].ThumbnailKey != "" {
+			products[i].ThumbnailURL = ImageStore.URL(products[i].ThumbnailKey)
+		}
+	}
+}
+
+// deleteProductImages removes the stored image and thumbnail of a product.
+func deleteProductImages(product models.Product) {
+	for _, key := range []string{product.ImageKey, product.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := ImageStore.Delete(key); err != nil {
+			log.Printf("Error deleting product image %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	importFormatCSV  = "csv"
+	importFormatJSON = "json"
+
+	importModeTransactional = "transactional"
+	importModeBestEffort    = "best_effort"
+
+	maxImportRows  = 1000
+	maxImportBytes = 5 << 20
+)
+
+// importColumns are the CSV columns of an import or export file. Tags are
+// separated by | and attributes are a JSON object.
+var importColumns = []string{"product_name", "cost", "amount_available", "reorder_threshold", "category_id", "tags", "attributes"}
+
+// importRow is a parsed row of an import file together with its problems.
+type importRow struct {
+	number     int
+	row        models.ProductImportRow
+	tags       []string
+	attributes []models.ProductAttribute
+	errors     []string
+}
+
+// ProductImport is a function for sellers to create many products from a CSV or JSON file.
+// format=csv|json picks the file format (a text/csv body is read as CSV), dry_run=true only
+// validates the file, and mode=transactional (the default) creates every row or none while
+// mode=best_effort creates the valid rows and reports the rest.
+func ProductImport(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "seller" {
+		utils.GetError(fmt.Errorf("user is not a seller"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	format := request.URL.Query().Get("format")
+	if format == "" {
+		format = importFormatJSON
+		if strings.Contains(request.Header.Get("Content-Type"), "csv") {
+			format = importFormatCSV
+		}
+	}
+	if format != importFormatCSV && format != importFormatJSON {
+		utils.GetError(errors.New("format must be csv or json"), http.StatusBadRequest, response)
+		return
+	}
+
+	mode := request.URL.Query().Get("mode")
+	if mode == "" {
+		mode = importModeTransactional
+	}
+	if mode != importModeTransactional && mode != importModeBestEffort {
+		utils.GetError(errors.New("mode must be transactional or best_effort"), http.StatusBadRequest, response)
+		return
+	}
+
+	dryRun := false
+	if value := request.URL.Query().Get("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			utils.GetError(errors.New("invalid dry_run"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(response, request.Body, maxImportBytes)
+
+	var rows []*importRow
+	if format == importFormatCSV {
+		rows, err = parseImportCSV(body)
+	} else {
+		rows, err = parseImportJSON(body)
+	}
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if len(rows) == 0 {
+		utils.GetError(errors.New("import file has no products"), http.StatusBadRequest, response)
+		return
+	}
+	if len(rows) > maxImportRows {
+		utils.GetError(fmt.Errorf("an import can have at most %d products", maxImportRows), http.StatusBadRequest, response)
+		return
+	}
+
+	categories, err := loadCategories()
+	if err != nil {
+		utils.GetError(errors.New("error validating import"), http.StatusInternalServerError, response)
+		return
+	}
+
+	report := models.ImportReport{
+		Format:     format,
+		Mode:       mode,
+		DryRun:     dryRun,
+		Total:      len(rows),
+		ProductIDs: []uint{},
+		Errors:     []models.ImportRowError{},
+	}
+
+	for _, row := range rows {
+		validateImportRow(row, categories)
+		if len(row.errors) == 0 {
+			report.Valid++
+		}
+	}
+
+	if dryRun {
+		importRowErrors(&report, rows)
+		utils.GetSuccess("import validated successfully", report, response)
+		return
+	}
+
+	if mode == importModeTransactional {
+		if report.Valid < report.Total {
+			importRowErrors(&report, rows)
+			utils.GetDetailedError("import failed, no products were created", http.StatusBadRequest, report, response)
+			return
+		}
+
+		products := make([]models.Product, 0, len(rows))
+		err := utils.Db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				product := importProduct(row.row, user.ID)
+				if err := createProduct(tx, &product, row.tags, row.attributes); err != nil {
+					return err
+				}
+				products = append(products, product)
+			}
+			return nil
+		})
+		if err != nil {
+			utils.GetError(errors.New("import failed, no products were created"), http.StatusInternalServerError, response)
+			return
+		}
+
+		for _, product := range products {
+			productIndex.Put(product.ID, product.ProductName)
+			report.ProductIDs = append(report.ProductIDs, product.ID)
+		}
+		report.Created = len(products)
+	} else {
+		for _, row := range rows {
+			if len(row.errors) > 0 {
+				continue
+			}
+
+			product := importProduct(row.row, user.ID)
+			err := utils.Db.Transaction(func(tx *gorm.DB) error {
+				return createProduct(tx, &product, row.tags, row.attributes)
+			})
+			if err != nil {
+				row.errors = append(row.errors, "error adding product")
+				continue
+			}
+
+			productIndex.Put(product.ID, product.ProductName)
+			report.ProductIDs = append(report.ProductIDs, product.ID)
+			report.Created++
+		}
+	}
+
+	importRowErrors(&report, rows)
+
+	utils.GetSuccess("products imported successfully", report, response)
+}
+
+// ProductExport is a function for sellers to download their catalogue as CSV or JSON
+// (format=csv|json, json by default) in the format ProductImport reads.
+func ProductExport(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "seller" {
+		utils.GetError(fmt.Errorf("user is not a seller"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	format := request.URL.Query().Get("format")
+	if format == "" {
+		format = importFormatJSON
+	}
+	if format != importFormatCSV && format != importFormatJSON {
+		utils.GetError(errors.New("format must be csv or json"), http.StatusBadRequest, response)
+		return
+	}
+
+	var products []models.Product
+	if err := utils.Db.Where("seller_id = ?", user.ID).Order("id asc").Find(&products).Error; err != nil {
+		utils.GetError(errors.New("error fetching products"), http.StatusInternalServerError, response)
+		return
+	}
+	if err := loadProductDetails(products); err != nil {
+		utils.GetError(errors.New("error fetching products"), http.StatusInternalServerError, response)
+		return
+	}
+
+	rows := make([]models.ProductImportRow, 0, len(products))
+	for _, product := range products {
+		rows = append(rows, models.ProductImportRow{
+			ProductName:      product.ProductName,
+			Cost:             product.Cost,
+			AmountAvailable:  product.AmountAvailable,
+			ReorderThreshold: product.ReorderThreshold,
+			CategoryID:       product.CategoryID,
+			Tags:             product.Tags,
+			Attributes:       product.Attributes,
+		})
+	}
+
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=products.%s", format))
+
+	if format == importFormatJSON {
+		response.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(response).Encode(rows)
+		return
+	}
+
+	response.Header().Set("Content-Type", "text/csv")
+	writer := csv.NewWriter(response)
+	writer.Write(importColumns)
+	for _, row := range rows {
+		category := ""
+		if row.CategoryID != nil {
+			category = strconv.FormatUint(uint64(*row.CategoryID), 10)
+		}
+		attributes := ""
+		if len(row.Attributes) > 0 {
+			encoded, _ := json.Marshal(row.Attributes)
+			attributes = string(encoded)
+		}
+
+		writer.Write([]string{
+			row.ProductName,
+			strconv.Itoa(row.Cost),
+			strconv.Itoa(row.AmountAvailable),
+			strconv.Itoa(row.ReorderThreshold),
+			category,
+			strings.Join(row.Tags, "|"),
+			attributes,
+		})
+	}
+	writer.Flush()
+}
+
+// parseImportJSON reads an import file holding a JSON array of products.
+func parseImportJSON(r io.Reader) ([]*importRow, error) {
+	var parsed []models.ProductImportRow
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("invalid json import file: %v", err)
+	}
+
+	rows := make([]*importRow, 0, len(parsed))
+	for i, row := range parsed {
+		rows = append(rows, &importRow{number: i + 1, row: row})
+	}
+
+	return rows, nil
+}
+
+// parseImportCSV reads an import file in CSV with a header naming its columns.
+// Values that cannot be parsed are reported against their row.
+func parseImportCSV(r io.Reader) ([]*importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv import file: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, column := range importColumns {
+			known = known || column == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown csv column: %s", name)
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"product_name", "cost"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv column %s is required", required)
+		}
+	}
+
+	var rows []*importRow
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		row := &importRow{number: number}
+		rows = append(rows, row)
+
+		if err != nil {
+			if parseErr, ok := err.(*csv.ParseError); ok && parseErr.Err == csv.ErrFieldCount {
+				row.errors = append(row.errors, fmt.Sprintf("expected %d columns, got %d", len(header), len(record)))
+				continue
+			}
+			return nil, fmt.Errorf("invalid csv import file: %v", err)
+		}
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		wholeNumber := func(column string) int {
+			text := value(column)
+			if text == "" {
+				return 0
+			}
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				row.errors = append(row.errors, fmt.Sprintf("%s must be a whole number", column))
+			}
+			return n
+		}
+
+		row.row.ProductName = value("product_name")
+		row.row.Cost = wholeNumber("cost")
+		row.row.AmountAvailable = wholeNumber("amount_available")
+		row.row.ReorderThreshold = wholeNumber("reorder_threshold")
+
+		if text := value("category_id"); text != "" {
+			categoryID, err := strconv.ParseUint(text, 10, 64)
+			if err != nil {
+				row.errors = append(row.errors, "category_id must be a whole number")
+			} else {
+				id := uint(categoryID)
+				row.row.CategoryID = &id
+			}
+		}
+
+		if text := value("tags"); text != "" {
+			row.row.Tags = strings.Split(text, "|")
+		}
+
+		if text := value("attributes"); text != "" {
+			if err := json.Unmarshal([]byte(text), &row.row.Attributes); err != nil {
+				row.errors = append(row.errors, "attributes must be a json object")
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// validateImportRow checks a row the way ProductCreate checks a product.
+func validateImportRow(row *importRow, categories map[uint]models.Category) {
+	if strings.TrimSpace(row.row.ProductName) == "" {
+		row.errors = append(row.errors, "product_name is required")
+	}
+	if row.row.Cost < 1 {
+		row.errors = append(row.errors, "cost must be greater than zero")
+	}
+	if row.row.AmountAvailable < 0 {
+		row.errors = append(row.errors, "amount available cannot be negative")
+	}
+	if row.row.ReorderThreshold < 0 {
+		row.errors = append(row.errors, "reorder threshold cannot be negative")
+	}
+	if row.row.CategoryID != nil {
+		if _, ok := categories[*row.row.CategoryID]; !ok {
+			row.errors = append(row.errors, "category not found")
+		}
+	}
+
+	var err error
+	if row.tags, err = normalizeTags(row.row.Tags); err != nil {
+		row.errors = append(row.errors, err.Error())
+	}
+	if row.attributes, err = parseAttributes(row.row.Attributes); err != nil {
+		row.errors = append(row.errors, err.Error())
+	}
+}
+
+// importProduct is the product an import row creates for a seller.
+func importProduct(row models.ProductImportRow, sellerID uint) models.Product {
+	return models.Product{
+		ProductName:      strings.TrimSpace(row.ProductName),
+		Cost:             row.Cost,
+		AmountAvailable:  row.AmountAvailable,
+		ReorderThreshold: row.ReorderThreshold,
+		CategoryID:       row.CategoryID,
+		SellerId:         sellerID,
+		Status:           models.ProductDraft,
+	}
+}
+
+// importRowErrors adds the problems with rows to report.
+func importRowErrors(report *models.ImportReport, rows []*importRow) {
+	for _, row := range rows {
+		if len(row.errors) > 0 {
+			report.Errors = append(report.Errors, models.ImportRowError{Row: row.number, Errors: row.errors})
+		}
+	}
+	report.Failed = len(report.Errors)
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+// TestParseImportCSV tests rows are read by their header and bad values are reported per row
+func TestParseImportCSV(t *testing.T) {
+	category := uint(3)
+
+	tests := []struct {
+		name     string
+		file     string
+		expected []models.ProductImportRow
+		errors   [][]string
+		err      string
+	}{
+		{
+			name:     "empty file",
+			file:     "",
+			expected: nil,
+		},
+		{
+			name: "every column",
+			file: "product_name,cost,amount_available,reorder_threshold,category_id,tags,attributes\n" +
+				`Cola, 150, 20, 5, 3, cold|fizzy,"{""size"":""330ml""}"` + "\n",
+			expected: []models.ProductImportRow{{
+				ProductName:      "Cola",
+				Cost:             150,
+				AmountAvailable:  20,
+				ReorderThreshold: 5,
+				CategoryID:       &category,
+				Tags:             []string{"cold", "fizzy"},
+				Attributes:       map[string]interface{}{"size": "330ml"},
+			}},
+			errors: [][]string{nil},
+		},
+		{
+			name:     "columns in any order and case",
+			file:     "Cost, Product_Name\n100,Water\n",
+			expected: []models.ProductImportRow{{ProductName: "Water", Cost: 100}},
+			errors:   [][]string{nil},
+		},
+		{
+			name: "bad values are reported against their row",
+			file: "product_name,cost,amount_available,category_id,attributes\n" +
+				"Cola,1.50,x,three,[1]\n" +
+				"Water,100,2,,\n",
+			expected: []models.ProductImportRow{
+				{ProductName: "Cola"},
+				{ProductName: "Water", Cost: 100, AmountAvailable: 2},
+			},
+			errors: [][]string{
+				{"cost must be a whole number", "amount_available must be a whole number", "category_id must be a whole number", "attributes must be a json object"},
+				nil,
+			},
+		},
+		{
+			name:     "wrong number of columns",
+			file:     "product_name,cost\nCola\n",
+			expected: []models.ProductImportRow{{}},
+			errors:   [][]string{{"expected 2 columns, got 1"}},
+		},
+		{
+			name: "unknown column",
+			file: "product_name,cost,colour\n",
+			err:  "unknown csv column: colour",
+		},
+		{
+			name: "missing required column",
+			file: "product_name,amount_available\n",
+			err:  "csv column cost is required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := parseImportCSV(strings.NewReader(test.file))
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("got error %v expected %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(rows) != len(test.expected) {
+				t.Fatalf("got %d rows expected %d", len(rows), len(test.expected))
+			}
+			for i, row := range rows {
+				if row.number != i+1 {
+					t.Errorf("row %d: got number %d", i+1, row.number)
+				}
+				if !reflect.DeepEqual(row.row, test.expected[i]) {
+					t.Errorf("row %d: got %+v expected %+v", i+1, row.row, test.expected[i])
+				}
+				if !reflect.DeepEqual(row.errors, test.errors[i]) {
+					t.Errorf("row %d: got errors %q expected %q", i+1, row.errors, test.errors[i])
+				}
+			}
+		})
+	}
+}
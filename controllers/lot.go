@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultExpiryDays = 7
+	maxExpiryDays     = 365
+
+	// openingLotCode is the code of the lot holding the stock a product had before its first lot
+	openingLotCode = "opening"
+)
+
+// StockLotCreate is a function for the seller of a product to receive a lot of stock.
+// The lot quantity is added to the amount available, which while the product has lots with
+// stock left is the sum of them.
+func StockLotCreate(response http.ResponseWriter, request *http.Request) {
+	product, rerr := sellerProduct(request, mux.Vars(request)["product_id"])
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var lotRequest models.StockLotRequest
+	if err := utils.ParseJSONFromRequest(request, &lotRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if lotRequest.Quantity < 1 {
+		utils.GetError(errors.New("quantity must be greater than zero"), http.StatusBadRequest, response)
+		return
+	}
+
+	if lotRequest.ExpiresAt != 0 && lotRequest.ExpiresAt <= time.Now().Unix() {
+		utils.GetError(errors.New("expires_at must be in the future"), http.StatusBadRequest, response)
+		return
+	}
+
+	lot := models.StockLot{
+		ProductID: product.ID,
+		LotCode:   strings.TrimSpace(lotRequest.LotCode),
+		Quantity:  lotRequest.Quantity,
+		Remaining: lotRequest.Quantity,
+		ExpiresAt: lotRequest.ExpiresAt,
+		CreatedBy: product.SellerId,
+	}
+
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		var locked models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, product.ID).Error; err != nil {
+			return err
+		}
+
+		// while a product has lots with stock left its stock is the sum of them, so stock
+		// it has outside its lots, from before its first lot or set by hand once its lots
+		// ran out, becomes an opening lot without an expiry
+		var inLots int
+		if err := tx.Model(&models.StockLot{}).Where("product_id = ? AND remaining > 0", product.ID).
+			Select("COALESCE(SUM(remaining), 0)").Scan(&inLots).Error; err != nil {
+			return err
+		}
+		if outside := locked.AmountAvailable - inLots; outside > 0 {
+			opening := models.StockLot{
+				ProductID: product.ID,
+				LotCode:   openingLotCode,
+				Quantity:  outside,
+				Remaining: outside,
+				CreatedBy: product.SellerId,
+			}
+			if err := tx.Create(&opening).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&lot).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Product{}).Where("id = ?", product.ID).
+			Update("amount_available", gorm.Expr("amount_available + ?", lot.Quantity)).Error
+	})
+	if err != nil {
+		utils.GetError(errors.New("error adding stock lot"), http.StatusInternalServerError, response)
+		return
+	}
+
+	checkStockLevels(product.ID)
+
+	utils.GetSuccess("stock lot added successfully", lot, response)
+}
+
+// StockLotGetAll is a function for the seller of a product to list its stock lots
+func StockLotGetAll(response http.ResponseWriter, request *http.Request) {
+	product, rerr := sellerProduct(request, mux.Vars(request)["product_id"])
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	lots := []models.StockLot{}
+	if err := utils.Db.Where("product_id = ?", product.ID).Order("id asc").Find(&lots).Error; err != nil {
+		utils.GetError(errors.New("error fetching stock lots"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("stock lots retreived successfully", lots, response)
+}
+
+// StockExpiryReport is a function for sellers to list their stock expiring in the next days (default 7)
+func StockExpiryReport(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "seller" {
+		utils.GetError(fmt.Errorf("user is not a seller"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	days := defaultExpiryDays
+	if value := request.URL.Query().Get("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > maxExpiryDays {
+			utils.GetError(fmt.Errorf("days must be between 1 and %d", maxExpiryDays), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	now := time.Now()
+	until := now.Add(time.Duration(days) * 24 * time.Hour).Unix()
+
+	report := models.ExpiryReport{Days: days, Until: until, Lots: []models.ExpiringStock{}}
+
+	result := utils.Db.Table("stock_lots").
+		Select("stock_lots.product_id, products.product_name, stock_lots.id AS lot_id, stock_lots.lot_code, stock_lots.remaining, stock_lots.expires_at").
+		Joins("JOIN products ON products.id = stock_lots.product_id").
+		Where("products.seller_id = ? AND products.deleted_at IS NULL", user.ID).
+		Where("stock_lots.remaining > 0 AND stock_lots.expires_at > ? AND stock_lots.expires_at <= ?", now.Unix(), until).
+		Order("stock_lots.expires_at asc, stock_lots.id asc").
+		Scan(&report.Lots)
+	if result.Error != nil {
+		utils.GetError(errors.New("error fetching expiring stock"), http.StatusInternalServerError, response)
+		return
+	}
+
+	for _, lot := range report.Lots {
+		report.Units += lot.Remaining
+	}
+
+	utils.GetSuccess("expiring stock retreived successfully", report, response)
+}
+
+// PullExpiredLots takes the remaining units of expired lots off sale and
+// returns the number of lots pulled.
+func PullExpiredLots() (int, error) {
+	var expired []models.StockLot
+
+	now := time.Now().Unix()
+	result := utils.Db.Where("remaining > 0 AND expires_at <> 0 AND expires_at <= ?", now).Find(&expired)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	pulled := 0
+	for _, lot := range expired {
+		err := utils.Db.Transaction(func(tx *gorm.DB) error {
+			// a purchase may have taken units since the lot was loaded
+			update := tx.Model(&models.StockLot{}).
+				Where("id = ? AND remaining = ?", lot.ID, lot.Remaining).
+				Updates(map[string]interface{}{
+					"remaining": 0,
+					"pulled":    gorm.Expr("pulled + ?", lot.Remaining),
+					"pulled_at": now,
+				})
+			if update.Error != nil || update.RowsAffected < 1 {
+				return update.Error
+			}
+
+			return tx.Model(&models.Product{}).Where("id = ?", lot.ProductID).
+				Update("amount_available", gorm.Expr("GREATEST(amount_available - ?, 0)", lot.Remaining)).Error
+		})
+		if err != nil {
+			return pulled, err
+		}
+		pulled++
+
+		checkStockLevels(lot.ProductID)
+	}
+
+	return pulled, nil
+}
+
+// hasStockLots reports whether a product has lots with stock left, so its amount
+// available is the sum of them and cannot be set by hand.
+func hasStockLots(productID uint) bool {
+	var count int64
+	utils.Db.Model(&models.StockLot{}).Where("product_id = ? AND remaining > 0", productID).Count(&count)
+	return count > 0
+}
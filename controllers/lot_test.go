@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+)
+
+// TestStockLotCreate tests stock outside the lots of a product becomes an opening lot
+func TestStockLotCreate(t *testing.T) {
+	var seller models.User
+	if result := utils.GetItemsByField(&seller, "email", TestsellerEmail); result.RowsAffected < 1 {
+		t.Fatal("seller does not exist")
+	}
+
+	product := models.Product{Cost: 50, ProductName: "Lot test product", SellerId: seller.ID, AmountAvailable: 5}
+	if result := utils.CreateItem(&product); result.RowsAffected < 1 {
+		t.Fatal("product not created")
+	}
+
+	addLot := func(quantity int) {
+		t.Helper()
+		buf := new(bytes.Buffer)
+		json.NewEncoder(buf).Encode(models.StockLotRequest{LotCode: "L1", Quantity: quantity})
+
+		r := getRouter()
+		r.HandleFunc("/v1/products/{product_id}/lots", StockLotCreate).Methods("POST")
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/v1/products/%d/lots", product.ID), buf)
+		req.Header.Add("Authorization", "Bearer "+TestSToken)
+
+		response := getHTTPResponse(t, r, req)
+		assertStatusCode(t, response.Code, http.StatusOK)
+	}
+
+	// stock checks the amount available is the sum of the remaining lots
+	stock := func(expected int) {
+		t.Helper()
+		var amount, inLots int
+		utils.Db.Model(&models.Product{}).Where("id = ?", product.ID).Select("amount_available").Scan(&amount)
+		utils.Db.Model(&models.StockLot{}).Where("product_id = ?", product.ID).Select("COALESCE(SUM(remaining), 0)").Scan(&inLots)
+		if amount != expected || inLots != expected {
+			t.Errorf("got %d available and %d in lots expected %d", amount, inLots, expected)
+		}
+	}
+
+	openingLots := func() int64 {
+		var count int64
+		utils.Db.Model(&models.StockLot{}).Where("product_id = ? AND lot_code = ?", product.ID, openingLotCode).Count(&count)
+		return count
+	}
+
+	t.Run("test the stock before the first lot becomes an opening lot", func(t *testing.T) {
+		addLot(3)
+		stock(8)
+		if count := openingLots(); count != 1 {
+			t.Errorf("got %d opening lots expected 1", count)
+		}
+	})
+
+	t.Run("test no opening lot while the lots hold the stock", func(t *testing.T) {
+		addLot(2)
+		stock(10)
+		if count := openingLots(); count != 1 {
+			t.Errorf("got %d opening lots expected 1", count)
+		}
+	})
+
+	t.Run("test stock set by hand after the lots ran out becomes an opening lot", func(t *testing.T) {
+		utils.Db.Model(&models.StockLot{}).Where("product_id = ?", product.ID).Update("remaining", 0)
+		if hasStockLots(product.ID) {
+			t.Fatal("expected no lots with stock left")
+		}
+		utils.Db.Model(&models.Product{}).Where("id = ?", product.ID).Update("amount_available", 4)
+
+		addLot(2)
+		stock(6)
+		if count := openingLots(); count != 2 {
+			t.Errorf("got %d opening lots expected 2", count)
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInsufficientPoints = errors.New("insufficient loyalty points")
+
+// pointValue is the deposit credit in cents a loyalty point is worth.
+func pointValue() int {
+	if value := utils.EnvInt("LOYALTY_POINT_VALUE", 1); value > 0 {
+		return value
+	}
+	return 1
+}
+
+// LoyaltyGet is a function for buyers to get their points balance and points history
+func LoyaltyGet(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "buyer" {
+		utils.GetError(fmt.Errorf("user is not a buyer"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var account models.PointsAccount
+	utils.GetItemsByField(&account, "user_id", user.ID)
+
+	var total int64
+	history := []models.PointsTransaction{}
+	utils.Db.Model(&models.PointsTransaction{}).Where("user_id = ?", user.ID).Count(&total)
+	result := utils.Db.Where("user_id = ?", user.ID).
+		Order("id desc").
+		Offset(pagination.Offset()).
+		Limit(pagination.Limit).
+		Find(&history)
+	if result.Error != nil {
+		utils.GetError(errors.New("error fetching points history"), http.StatusInternalServerError, response)
+		return
+	}
+
+	summary := models.LoyaltySummary{
+		Balance:    account.Balance,
+		PointValue: pointValue(),
+		History:    history,
+		Meta:       models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("loyalty points retreived successfully", summary, response)
+}
+
+// LoyaltyRedeem is a function for buyers to redeem loyalty points into deposit credit
+func LoyaltyRedeem(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "buyer" {
+		utils.GetError(fmt.Errorf("user is not a buyer"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	var redeemRequest models.PointsRedeemRequest
+	if err := utils.ParseJSONFromRequest(request, &redeemRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if redeemRequest.Points < 1 {
+		utils.GetError(errors.New("points must be greater than zero"), http.StatusBadRequest, response)
+		return
+	}
+
+	credit := redeemRequest.Points * pointValue()
+
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		if err := debitPoints(tx, user.ID, redeemRequest.Points, nil, models.PointsRedeemedCredit); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Update("deposit", gorm.Expr("deposit + ?", credit)).Error
+	})
+
+	if err == errInsufficientPoints {
+		utils.GetError(err, http.StatusNotAcceptable, response)
+		return
+	}
+	if err != nil {
+		utils.GetError(errors.New("points redemption failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("points redeemed successfully", map[string]interface{}{"credit": credit}, response)
+}
+
+// EarningRuleCreate is a function for admins to add a loyalty points earning rule
+func EarningRuleCreate(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "admin" {
+		utils.GetError(fmt.Errorf("user is not an admin"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	var rule models.EarningRule
+	if err := utils.ParseJSONFromRequest(request, &rule); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if strings.TrimSpace(rule.Name) == "" {
+		utils.GetError(errors.New("rule name is required"), http.StatusBadRequest, response)
+		return
+	}
+
+	if rule.SpendUnit < 1 || rule.Points < 1 {
+		utils.GetError(errors.New("spend_unit and points must be greater than zero"), http.StatusBadRequest, response)
+		return
+	}
+
+	if rule.EndsAt != 0 && rule.EndsAt <= rule.StartsAt {
+		utils.GetError(errors.New("ends_at must be after starts_at"), http.StatusBadRequest, response)
+		return
+	}
+
+	if rule.ProductID != 0 {
+		var product models.Product
+		if tx := utils.GetItemByPrimaryKey(&product, rule.ProductID); tx.RowsAffected < 1 {
+			utils.GetError(errors.New("product not found"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	rule.ID = 0
+	rule.Active = true
+
+	if res := utils.CreateItem(&rule); res.RowsAffected < 1 {
+		utils.GetError(errors.New("error adding earning rule"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("earning rule added successfully", rule, response)
+}
+
+// EarningRuleGetAll is a function to list the loyalty points earning rules
+func EarningRuleGetAll(response http.ResponseWriter, request *http.Request) {
+	_, err := TokenValid(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	rules := []models.EarningRule{}
+	if err := utils.Db.Order("id asc").Find(&rules).Error; err != nil {
+		utils.GetError(errors.New("error fetching earning rules"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("earning rules retreived successfully", rules, response)
+}
+
+// EarningRuleDelete is a function for admins to delete a loyalty points earning rule
+func EarningRuleDelete(response http.ResponseWriter, request *http.Request) {
+	ruleID := mux.Vars(request)["rule_id"]
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "admin" {
+		utils.GetError(fmt.Errorf("user is not an admin"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	uintRuleID, _ := strconv.ParseUint(ruleID, 10, 64)
+
+	if result := utils.Db.Delete(models.EarningRule{}, "id = ?", uint(uintRuleID)); result.RowsAffected < 1 {
+		utils.GetError(errors.New("earning rule not found"), http.StatusNotFound, response)
+		return
+	}
+
+	utils.GetSuccess("earning rule successfully deleted", nil, response)
+}
+
+// creditPoints adds points to the account of a buyer and records it in their history.
+func creditPoints(tx *gorm.DB, userID uint, points int, orderID *uint, reason string) error {
+	if points == 0 {
+		return nil
+	}
+
+	account := models.PointsAccount{UserID: userID, Balance: points}
+	result := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"balance": gorm.Expr("balance + ?", points)}),
+	}).Create(&account)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return tx.Create(&models.PointsTransaction{UserID: userID, OrderID: orderID, Points: points, Reason: reason}).Error
+}
+
+// debitPoints takes points from the account of a buyer and records it in their history.
+// It fails with errInsufficientPoints if the balance is too low.
+func debitPoints(tx *gorm.DB, userID uint, points int, orderID *uint, reason string) error {
+	result := tx.Model(&models.PointsAccount{}).
+		Where("user_id = ? AND balance >= ?", userID, points).
+		Update("balance", gorm.Expr("balance - ?", points))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return errInsufficientPoints
+	}
+
+	return tx.Create(&models.PointsTransaction{UserID: userID, OrderID: orderID, Points: -points, Reason: reason}).Error
+}
@@ -0,0 +1,503 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/femibiwoye/go-test/coins"
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errMachineNotFound = errors.New("machine not found")
+
+// isOperator reports whether user can manage machines.
+func isOperator(user models.User) bool {
+	role := strings.ToLower(user.Role)
+	return role == "operator" || role == "admin"
+}
+
+// MachineCreate is a function for operators to add a vending machine
+func MachineCreate(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	var machine models.Machine
+	if err := utils.ParseJSONFromRequest(request, &machine); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	machine.Name = strings.TrimSpace(machine.Name)
+	if machine.Name == "" {
+		utils.GetError(errors.New("machine name is required"), http.StatusBadRequest, response)
+		return
+	}
+
+	if err := validateCoordinates(machine.Latitude, machine.Longitude); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	machine.ID = 0
+	machine.Status = models.MachineActive
+	machine.Coins = nil
+	machine.Slots = nil
+
+	if res := utils.CreateItem(&machine); res.RowsAffected < 1 {
+		utils.GetError(errors.New("error adding machine"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("machine added successfully", machine, response)
+}
+
+// MachineGetAll is a function to list vending machines, optionally filtered by status
+func MachineGetAll(response http.ResponseWriter, request *http.Request) {
+	_, err := TokenValid(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	query := utils.Db.Model(&models.Machine{})
+	if status := request.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	machines := []models.Machine{}
+	if err := query.Order("id asc").Offset(pagination.Offset()).Limit(pagination.Limit).Find(&machines).Error; err != nil {
+		utils.GetError(errors.New("error fetching machines"), http.StatusInternalServerError, response)
+		return
+	}
+
+	for i := range machines {
+		machines[i].State = machineState(machines[i])
+	}
+
+	respse := map[string]interface{}{
+		"machines": machines,
+		"meta":     models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("machines retreived successfully", respse, response)
+}
+
+// MachineGet is a function to get a vending machine with its slots. Operators also see its coins.
+func MachineGet(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	query := utils.Db.Preload("Slots", func(db *gorm.DB) *gorm.DB { return db.Order("code asc") })
+	if isOperator(user) {
+		query = query.Preload("Coins", func(db *gorm.DB) *gorm.DB { return db.Order("denomination asc") })
+	}
+	if err := query.First(&machine, machine.ID).Error; err != nil {
+		utils.GetError(errors.New("error fetching machine"), http.StatusInternalServerError, response)
+		return
+	}
+	machine.State = machineState(machine)
+
+	utils.GetSuccess("machine retreived successfully", machine, response)
+}
+
+// MachineUpdate is a function for operators to update the details or status of a machine
+func MachineUpdate(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	var updateRequest models.MachineUpdate
+	if err := utils.ParseJSONFromRequest(request, &updateRequest); err != nil {
+		utils.GetError(errors.New("bad update data"), http.StatusBadRequest, response)
+		return
+	}
+
+	updateMap := map[string]interface{}{}
+
+	if name := strings.TrimSpace(updateRequest.Name); name != "" {
+		updateMap["name"] = name
+	}
+	if location := strings.TrimSpace(updateRequest.Location); location != "" {
+		updateMap["location"] = location
+	}
+	if updateRequest.Latitude != nil || updateRequest.Longitude != nil {
+		latitude, longitude := machine.Latitude, machine.Longitude
+		if updateRequest.Latitude != nil {
+			latitude = *updateRequest.Latitude
+		}
+		if updateRequest.Longitude != nil {
+			longitude = *updateRequest.Longitude
+		}
+		if err := validateCoordinates(latitude, longitude); err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+		updateMap["latitude"] = latitude
+		updateMap["longitude"] = longitude
+	}
+	if updateRequest.Status != "" && !validMachineStatus(updateRequest.Status) {
+		utils.GetError(errors.New("status must be active, inactive, maintenance or out_of_service"), http.StatusBadRequest, response)
+		return
+	}
+
+	if len(updateMap) == 0 && updateRequest.Status == "" {
+		utils.GetError(errors.New("empty/invalid user input data"), http.StatusBadRequest, response)
+		return
+	}
+
+	if len(updateMap) > 0 {
+		if result := utils.Db.Table("machines").Where("id = ?", machine.ID).Updates(updateMap); result.Error != nil {
+			utils.GetError(errors.New("machine update failed"), http.StatusInternalServerError, response)
+			return
+		}
+	}
+
+	if updateRequest.Status != "" {
+		if rerr := setMachineStatus(machine, updateRequest.Status, updateRequest.StatusReason, false); rerr != nil {
+			utils.GetError(rerr.err, rerr.status, response)
+			return
+		}
+	}
+
+	utils.GetSuccess("machine successfully updated", nil, response)
+}
+
+// MachineCoinsSet is a function for operators to record the coins in a machine after a collection or float top up
+func MachineCoinsSet(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	var coinRequest models.CoinInventoryRequest
+	if err := utils.ParseJSONFromRequest(request, &coinRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if len(coinRequest.Coins) == 0 {
+		utils.GetError(errors.New("coins are required"), http.StatusBadRequest, response)
+		return
+	}
+
+	for denomination, count := range coinRequest.Coins {
+		if !Contains(denomination, possibleDepositAmounts) {
+			utils.GetError(fmt.Errorf("invalid coin denomination: %d", denomination), http.StatusBadRequest, response)
+			return
+		}
+		if count < 0 {
+			utils.GetError(errors.New("coin count cannot be negative"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		for denomination, count := range coinRequest.Coins {
+			coin := models.MachineCoin{MachineID: machine.ID, Denomination: denomination, Count: count}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&coin).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.GetError(errors.New("error saving coins"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("machine coins successfully updated", nil, response)
+}
+
+// MachineProducts is a function to list the published products on sale in a machine and how many are left
+func MachineProducts(response http.ResponseWriter, request *http.Request) {
+	_, err := TokenValid(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	var slots []models.MachineSlot
+	if err := utils.Db.Where("machine_id = ?", machine.ID).Order("code asc").Find(&slots).Error; err != nil {
+		utils.GetError(errors.New("error fetching machine products"), http.StatusInternalServerError, response)
+		return
+	}
+
+	ids := make([]uint, 0, len(slots))
+	for _, slot := range slots {
+		ids = append(ids, slot.ProductID)
+	}
+
+	var products []models.Product
+	if len(ids) > 0 {
+		if err := utils.Db.Where("id IN ? AND status = ?", ids, models.ProductPublished).Find(&products).Error; err != nil {
+			utils.GetError(errors.New("error fetching machine products"), http.StatusInternalServerError, response)
+			return
+		}
+	}
+	if err := loadProductDetails(products); err != nil {
+		utils.GetError(errors.New("error fetching machine products"), http.StatusInternalServerError, response)
+		return
+	}
+
+	byID := make(map[uint]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	machineProducts := []models.MachineProduct{}
+	for _, slot := range slots {
+		if product, ok := byID[slot.ProductID]; ok {
+			machineProducts = append(machineProducts, models.MachineProduct{Product: product, SlotCode: slot.Code, Quantity: slot.Quantity})
+		}
+	}
+
+	utils.GetSuccess("machine products retreived successfully", machineProducts, response)
+}
+
+// loadMachine loads the machine with the id in the request path.
+func loadMachine(machineID string) (models.Machine, error) {
+	var machine models.Machine
+
+	uintMachineID, _ := strconv.ParseUint(machineID, 10, 64)
+	if tx := utils.GetItemByPrimaryKey(&machine, uint(uintMachineID)); tx.RowsAffected < 1 {
+		return machine, errMachineNotFound
+	}
+
+	return machine, nil
+}
+
+// activeMachine loads a machine a buyer is using, which must be in service.
+func activeMachine(machineID uint) (models.Machine, *requestError) {
+	var machine models.Machine
+
+	if tx := utils.GetItemByPrimaryKey(&machine, machineID); tx.RowsAffected < 1 {
+		return machine, &requestError{errMachineNotFound, http.StatusNotFound}
+	}
+
+	if machine.Status != models.MachineActive {
+		return machine, &requestError{machineStatusError(machine), http.StatusNotAcceptable}
+	}
+
+	return machine, nil
+}
+
+func validateCoordinates(latitude, longitude float64) error {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
+	}
+	return nil
+}
+
+// depositIntoMachine credits a buyer in a machine with a coin and adds the coin to the machine.
+func depositIntoMachine(tx *gorm.DB, userID, machineID uint, amount int) (int, error) {
+	deposit := models.MachineDeposit{UserID: userID, MachineID: machineID, Amount: amount}
+	result := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"amount": gorm.Expr("amount + ?", amount)}),
+	}).Create(&deposit)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if err := addMachineCoin(tx, machineID, amount); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Where("user_id = ? AND machine_id = ?", userID, machineID).First(&deposit).Error; err != nil {
+		return 0, err
+	}
+
+	return deposit.Amount, nil
+}
+
+// addMachineCoin adds a coin to the coins held by a machine.
+func addMachineCoin(tx *gorm.DB, machineID uint, denomination int) error {
+	coin := models.MachineCoin{MachineID: machineID, Denomination: denomination, Count: 1}
+	return tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("count + 1")}),
+	}).Create(&coin).Error
+}
+
+// debitMachineDeposit takes amount from the credit of a buyer in a machine.
+func debitMachineDeposit(tx *gorm.DB, userID, machineID uint, amount int) error {
+	if amount == 0 {
+		return nil
+	}
+
+	result := tx.Model(&models.MachineDeposit{}).
+		Where("user_id = ? AND machine_id = ? AND amount >= ?", userID, machineID, amount).
+		Update("amount", gorm.Expr("amount - ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return errInsufficientFunds
+	}
+
+	return nil
+}
+
+// reserveSlotStock takes the units of line out of a slot in a machine: the slot the
+// buyer picked, or else the fullest slot selling the product.
+func reserveSlotStock(tx *gorm.DB, machineID uint, line purchaseLine) error {
+	code := line.slotCode
+	if code == "" {
+		var slot models.MachineSlot
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("machine_id = ? AND product_id = ? AND quantity >= ?", machineID, line.product.ID, line.quantity).
+			Order("quantity desc, code asc").
+			Limit(1).
+			Find(&slot)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return errOutOfStock
+		}
+		code = slot.Code
+	}
+
+	result := tx.Model(&models.MachineSlot{}).
+		Where("machine_id = ? AND code = ? AND product_id = ? AND quantity >= ?", machineID, code, line.product.ID, line.quantity).
+		Update("quantity", gorm.Expr("quantity - ?", line.quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return errOutOfStock
+	}
+
+	return nil
+}
+
+// machineCredit is the credit a buyer has left in a machine.
+func machineCredit(db *gorm.DB, userID, machineID uint) (int, error) {
+	var deposit models.MachineDeposit
+	err := db.Where("user_id = ? AND machine_id = ?", userID, machineID).Limit(1).Find(&deposit).Error
+	return deposit.Amount, err
+}
+
+// returnChange pays out the credit of a buyer in a machine in coins. Credit the
+// machine cannot pay out exactly stays in the machine for the buyer.
+func returnChange(tx *gorm.DB, userID, machineID uint) (models.ResetResponse, error) {
+	reset := models.ResetResponse{MachineID: machineID, Coins: map[int]int{}}
+
+	var deposit models.MachineDeposit
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND machine_id = ?", userID, machineID).
+		Limit(1).
+		Find(&deposit)
+	if result.Error != nil || deposit.Amount == 0 {
+		return reset, result.Error
+	}
+
+	change, paid, err := takeChange(tx, machineID, deposit.Amount)
+	if err != nil {
+		return reset, err
+	}
+
+	if paid > 0 {
+		err := tx.Model(&models.MachineDeposit{}).
+			Where("user_id = ? AND machine_id = ?", userID, machineID).
+			Update("amount", deposit.Amount-paid).Error
+		if err != nil {
+			return reset, err
+		}
+	}
+
+	reset.Returned = paid
+	reset.Coins = change
+	reset.Remaining = deposit.Amount - paid
+
+	return reset, nil
+}
+
+// takeChange takes the coins to pay out amount from the coins held by a machine
+// and returns them with the amount they add up to, which is less than amount when
+// the machine cannot pay it out exactly.
+func takeChange(tx *gorm.DB, machineID uint, amount int) (map[int]int, int, error) {
+	var machineCoins []models.MachineCoin
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("machine_id = ?", machineID).Find(&machineCoins).Error; err != nil {
+		return nil, 0, err
+	}
+
+	inventory := map[int]int{}
+	for _, coin := range machineCoins {
+		inventory[coin.Denomination] = coin.Count
+	}
+
+	change, paid := coins.MakeChange(amount, inventory)
+	for denomination, count := range change {
+		err := tx.Model(&models.MachineCoin{}).
+			Where("machine_id = ? AND denomination = ?", machineID, denomination).
+			Update("count", gorm.Expr("count - ?", count)).Error
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return change, paid, nil
+}
@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// doorOpenReason is the reason a machine is put in maintenance when its door is opened.
+const doorOpenReason = "door open"
+
+// MachineStatusSet is a function for operators to put a machine in maintenance or out of
+// service, or back in service. Buyer credit in the machine can be refunded at the same time.
+func MachineStatusSet(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	var statusRequest models.MachineStatusRequest
+	if err := utils.ParseJSONFromRequest(request, &statusRequest); err != nil {
+		utils.GetError(errors.New("bad status data"), http.StatusBadRequest, response)
+		return
+	}
+
+	if err := validate.Struct(statusRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if statusRequest.Refund && statusRequest.Status == models.MachineActive {
+		utils.GetError(errors.New("credit can only be refunded from a machine that is not in service"), http.StatusBadRequest, response)
+		return
+	}
+
+	if rerr := setMachineStatus(machine, statusRequest.Status, statusRequest.Reason, false); rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var report *models.RefundReport
+	if statusRequest.Refund {
+		refunds, err := refundMachine(machine.ID)
+		if err != nil {
+			utils.GetError(errors.New("refund failed"), http.StatusInternalServerError, response)
+			return
+		}
+		report = &refunds
+	}
+
+	machine, _ = loadMachine(fmt.Sprint(machine.ID))
+	machine.State = machineState(machine)
+
+	respse := map[string]interface{}{
+		"machine": machine,
+		"refunds": report,
+	}
+
+	utils.GetSuccess("machine status updated", respse, response)
+}
+
+// MachineRefund is a function for operators to move the credit buyers have in a machine
+// that is not in service to their account deposits.
+func MachineRefund(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	if machine.Status == models.MachineActive {
+		utils.GetError(errors.New("machine must be taken out of service before refunding"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	report, err := refundMachine(machine.ID)
+	if err != nil {
+		utils.GetError(errors.New("refund failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("machine credit refunded", report, response)
+}
+
+// validMachineStatus reports whether status is a status a machine can have.
+func validMachineStatus(status string) bool {
+	switch status {
+	case models.MachineActive, models.MachineInactive, models.MachineMaintenance, models.MachineOutOfService:
+		return true
+	}
+	return false
+}
+
+// machineStatusError explains to a buyer why a machine cannot be used.
+func machineStatusError(machine models.Machine) error {
+	var message string
+	switch machine.Status {
+	case models.MachineMaintenance:
+		message = "machine is in maintenance"
+	case models.MachineOutOfService:
+		message = "machine is out of service"
+	default:
+		message = "machine is not in service"
+	}
+
+	if machine.StatusReason != "" {
+		message += ": " + machine.StatusReason
+	}
+	return errors.New(message)
+}
+
+// setMachineStatus changes the status of machine and takes its hardware out of service
+// or puts it back. auto marks a status set from the telemetry of the machine.
+func setMachineStatus(machine models.Machine, status, reason string, auto bool) *requestError {
+	if !validMachineStatus(status) {
+		return &requestError{errors.New("status must be active, inactive, maintenance or out_of_service"), http.StatusBadRequest}
+	}
+
+	reason = strings.TrimSpace(reason)
+	if status == models.MachineActive {
+		reason = ""
+	}
+
+	updateMap := map[string]interface{}{
+		"status":            status,
+		"status_reason":     reason,
+		"status_auto":       auto,
+		"status_changed_at": time.Now().Unix(),
+	}
+	if result := utils.Db.Table("machines").Where("id = ?", machine.ID).Updates(updateMap); result.Error != nil {
+		return &requestError{errors.New("machine update failed"), http.StatusInternalServerError}
+	}
+
+	machine.Status, machine.StatusReason, machine.StatusAuto = status, reason, auto
+	return setMachineInService(machine, status == models.MachineActive)
+}
+
+// refundMachine moves the credit of every buyer in a machine to their account deposits.
+func refundMachine(machineID uint) (models.RefundReport, error) {
+	report := models.RefundReport{MachineID: machineID, Refunds: []models.MachineRefund{}}
+
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		report.Refunds, err = refundMachineCredit(tx, machineID, 0)
+		return err
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, refund := range report.Refunds {
+		report.Total += refund.Amount
+	}
+	return report, nil
+}
+
+// refundMachineCredit moves the credit buyers have in a machine to their account
+// deposits: the credit of userID, or of every buyer when userID is 0.
+func refundMachineCredit(tx *gorm.DB, machineID, userID uint) ([]models.MachineRefund, error) {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("machine_id = ? AND amount > 0", machineID)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var deposits []models.MachineDeposit
+	if err := query.Order("user_id asc").Find(&deposits).Error; err != nil {
+		return nil, err
+	}
+
+	refunds := []models.MachineRefund{}
+	for _, deposit := range deposits {
+		err := tx.Table("users").Where("id = ?", deposit.UserID).
+			Update("deposit", gorm.Expr("deposit + ?", deposit.Amount)).Error
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Model(&models.MachineDeposit{}).
+			Where("user_id = ? AND machine_id = ?", deposit.UserID, machineID).
+			Update("amount", 0).Error
+		if err != nil {
+			return nil, err
+		}
+
+		refunds = append(refunds, models.MachineRefund{UserID: deposit.UserID, Amount: deposit.Amount})
+	}
+
+	return refunds, nil
+}
+
+// applyTelemetryStatus takes a machine out of service when its telemetry reports a jam
+// or a temperature above MACHINE_MAX_TEMPERATURE, and puts it in maintenance while its
+// door is open. A status set by an operator is never changed.
+func applyTelemetryStatus(machine models.Machine, events []models.TelemetryEvent, latest models.MachineStatus) *requestError {
+	status, reason, ok := telemetryMachineStatus(machine, events, latest, utils.EnvInt("MACHINE_MAX_TEMPERATURE", 0))
+	if !ok {
+		return nil
+	}
+	return setMachineStatus(machine, status, reason, true)
+}
+
+// telemetryMachineStatus is the status telemetry events put machine in, if they change
+// it. latest is the state of the machine after the events. maxTemperature 0 disables
+// the temperature check.
+func telemetryMachineStatus(machine models.Machine, events []models.TelemetryEvent, latest models.MachineStatus, maxTemperature int) (string, string, bool) {
+	if machine.Status != models.MachineActive && !machine.StatusAuto {
+		return "", "", false
+	}
+
+	sorted := append([]models.TelemetryEvent{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].RecordedAt < sorted[j].RecordedAt })
+
+	var fault string
+	var doorReported bool
+	for _, event := range sorted {
+		switch event.Kind {
+		case models.TelemetryJam:
+			fault = "jam"
+			if description := jamDescription(event); description != "" {
+				fault += " in " + description
+			}
+		case models.TelemetryTemperature:
+			if maxTemperature > 0 && event.Temperature != nil && *event.Temperature > float64(maxTemperature) {
+				fault = fmt.Sprintf("temperature %.1f above %d", *event.Temperature, maxTemperature)
+			}
+		case models.TelemetryDoorOpen, models.TelemetryDoorClosed:
+			doorReported = true
+		}
+	}
+
+	switch {
+	case fault != "" && machine.Status != models.MachineOutOfService:
+		return models.MachineOutOfService, fault, true
+	case !doorReported:
+		return "", "", false
+	case latest.DoorOpen && machine.Status == models.MachineActive:
+		return models.MachineMaintenance, doorOpenReason, true
+	case !latest.DoorOpen && machine.Status == models.MachineMaintenance && machine.StatusReason == doorOpenReason:
+		return models.MachineActive, "", true
+	}
+	return "", "", false
+}
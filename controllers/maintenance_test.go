@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+// TestTelemetryMachineStatus tests which telemetry changes the status of a machine
+func TestTelemetryMachineStatus(t *testing.T) {
+	temperature := func(v float64) *float64 { return &v }
+
+	active := models.Machine{Status: models.MachineActive}
+	doorOpened := models.Machine{Status: models.MachineMaintenance, StatusReason: doorOpenReason, StatusAuto: true}
+	jammed := models.Machine{Status: models.MachineOutOfService, StatusReason: "jam in A1", StatusAuto: true}
+
+	tests := []struct {
+		name           string
+		machine        models.Machine
+		events         []models.TelemetryEvent
+		latest         models.MachineStatus
+		maxTemperature int
+		status         string
+		reason         string
+		changed        bool
+	}{
+		{
+			name:    "jam in a slot",
+			machine: active,
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryJam, Slot: "A1", Detail: "stuck", RecordedAt: 10}},
+			status:  models.MachineOutOfService,
+			reason:  "jam in A1: stuck",
+			changed: true,
+		},
+		{
+			name:    "jam of a machine already out of service",
+			machine: jammed,
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryJam, Slot: "B2", RecordedAt: 10}},
+		},
+		{
+			name:           "over temperature",
+			machine:        active,
+			events:         []models.TelemetryEvent{{Kind: models.TelemetryTemperature, Temperature: temperature(9.5), RecordedAt: 10}},
+			maxTemperature: 8,
+			status:         models.MachineOutOfService,
+			reason:         "temperature 9.5 above 8",
+			changed:        true,
+		},
+		{
+			name:           "temperature at the limit",
+			machine:        active,
+			events:         []models.TelemetryEvent{{Kind: models.TelemetryTemperature, Temperature: temperature(8), RecordedAt: 10}},
+			maxTemperature: 8,
+		},
+		{
+			name:    "temperature check disabled",
+			machine: active,
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryTemperature, Temperature: temperature(40), RecordedAt: 10}},
+		},
+		{
+			name:           "the last fault of a batch is the reason",
+			machine:        active,
+			events:         []models.TelemetryEvent{{Kind: models.TelemetryTemperature, Temperature: temperature(12), RecordedAt: 20}, {Kind: models.TelemetryJam, Detail: "coin jam", RecordedAt: 10}},
+			maxTemperature: 8,
+			status:         models.MachineOutOfService,
+			reason:         "temperature 12.0 above 8",
+			changed:        true,
+		},
+		{
+			name:    "door opened",
+			machine: active,
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryDoorOpen, RecordedAt: 10}},
+			latest:  models.MachineStatus{DoorOpen: true},
+			status:  models.MachineMaintenance,
+			reason:  doorOpenReason,
+			changed: true,
+		},
+		{
+			name:    "door closed after opening it",
+			machine: doorOpened,
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryDoorClosed, RecordedAt: 10}},
+			status:  models.MachineActive,
+			changed: true,
+		},
+		{
+			name:    "late door closed with the door still open",
+			machine: doorOpened,
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryDoorClosed, RecordedAt: 10}},
+			latest:  models.MachineStatus{DoorOpen: true},
+		},
+		{
+			name:    "door closed on a jammed machine",
+			machine: jammed,
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryDoorClosed, RecordedAt: 10}},
+		},
+		{
+			name:    "door readings without a door event",
+			machine: active,
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryCoinTubes, RecordedAt: 10}},
+			latest:  models.MachineStatus{DoorOpen: true},
+		},
+		{
+			name:    "operator set maintenance is kept when the door closes",
+			machine: models.Machine{Status: models.MachineMaintenance, StatusReason: "cleaning"},
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryDoorClosed, RecordedAt: 10}},
+		},
+		{
+			name:    "operator set maintenance is kept on a jam",
+			machine: models.Machine{Status: models.MachineMaintenance, StatusReason: "cleaning"},
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryJam, Slot: "A1", RecordedAt: 10}},
+		},
+		{
+			name:    "operator set inactive is kept when the door opens",
+			machine: models.Machine{Status: models.MachineInactive},
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryDoorOpen, RecordedAt: 10}},
+			latest:  models.MachineStatus{DoorOpen: true},
+		},
+		{
+			name:    "operator set door open reason is not an automatic status",
+			machine: models.Machine{Status: models.MachineMaintenance, StatusReason: doorOpenReason},
+			events:  []models.TelemetryEvent{{Kind: models.TelemetryDoorClosed, RecordedAt: 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, reason, changed := telemetryMachineStatus(test.machine, test.events, test.latest, test.maxTemperature)
+			if changed != test.changed || status != test.status || reason != test.reason {
+				t.Errorf("got %q %q %v expected %q %q %v", status, reason, changed, test.status, test.reason, test.changed)
+			}
+		})
+	}
+}
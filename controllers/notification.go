@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/notifier"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StockNotifier delivers low stock and sold out alerts to sellers. It is set up in main.
+var StockNotifier notifier.Notifier = notifier.Multi{InboxNotifier()}
+
+// InboxNotifier returns a notifier saving notifications to the in-app inbox.
+func InboxNotifier() notifier.Notifier {
+	return notifier.Inbox{Save: func(n notifier.Notification) error {
+		message := models.InboxMessage{
+			UserID:    n.UserID,
+			Kind:      n.Kind,
+			ProductID: n.ProductID,
+			Subject:   n.Subject,
+			Body:      n.Body,
+		}
+		return utils.Db.Create(&message).Error
+	}}
+}
+
+// InboxGet is a function to list the inbox messages of a user, newest first.
+// unread=true lists only unread messages.
+func InboxGet(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	query := utils.Db.Model(&models.InboxMessage{}).Where("user_id = ?", user.ID)
+	if unread := request.URL.Query().Get("unread"); unread != "" {
+		value, err := strconv.ParseBool(unread)
+		if err != nil {
+			utils.GetError(errors.New("invalid unread"), http.StatusBadRequest, response)
+			return
+		}
+		if value {
+			query = query.Where("is_read = ?", false)
+		}
+	}
+
+	inbox := models.InboxList{Messages: []models.InboxMessage{}}
+
+	var total int64
+	query.Count(&total)
+	utils.Db.Model(&models.InboxMessage{}).Where("user_id = ? AND is_read = ?", user.ID, false).Count(&inbox.Unread)
+
+	result := query.Order("id desc").Offset(pagination.Offset()).Limit(pagination.Limit).Find(&inbox.Messages)
+	if result.Error != nil {
+		utils.GetError(errors.New("error fetching inbox"), http.StatusInternalServerError, response)
+		return
+	}
+	inbox.Meta = models.NewPageMeta(pagination, total)
+
+	utils.GetSuccess("inbox retreived successfully", inbox, response)
+}
+
+// InboxMarkRead is a function to mark an inbox message as read
+func InboxMarkRead(response http.ResponseWriter, request *http.Request) {
+	messageID := mux.Vars(request)["message_id"]
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	uintMessageID, _ := strconv.ParseUint(messageID, 10, 64)
+
+	var message models.InboxMessage
+	result := utils.Db.Where("id = ? AND user_id = ?", uint(uintMessageID), user.ID).Limit(1).Find(&message)
+	if result.RowsAffected < 1 {
+		utils.GetError(errors.New("message not found"), http.StatusNotFound, response)
+		return
+	}
+
+	if result := utils.Db.Model(&message).Update("is_read", true); result.Error != nil {
+		utils.GetError(errors.New("error updating message"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("message marked as read", nil, response)
+}
+
+// stockLevel is the alert level of a product, empty when its stock is healthy.
+func stockLevel(product models.Product) string {
+	if product.AmountAvailable <= 0 {
+		return models.StockSoldOut
+	}
+	if product.ReorderThreshold > 0 && product.AmountAvailable <= product.ReorderThreshold {
+		return models.StockLow
+	}
+	return ""
+}
+
+// checkStockLevels alerts the sellers of products whose stock has dropped to
+// their reorder threshold or sold out. A seller is alerted once per level until
+// the product is restocked, so repeated sales of a low product stay quiet.
+func checkStockLevels(productIDs ...uint) {
+	for _, productID := range productIDs {
+		var notification *notifier.Notification
+
+		err := utils.Db.Transaction(func(tx *gorm.DB) error {
+			var product models.Product
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", productID).Limit(1).Find(&product)
+			if result.Error != nil || result.RowsAffected < 1 {
+				return result.Error
+			}
+
+			var alert models.StockAlert
+			if err := tx.Where("product_id = ?", productID).Limit(1).Find(&alert).Error; err != nil {
+				return err
+			}
+
+			level, previous := stockLevel(product), alert.Level
+			if level == previous {
+				return nil
+			}
+			if level == "" {
+				return tx.Delete(&models.StockAlert{}, "product_id = ?", productID).Error
+			}
+
+			alert = models.StockAlert{ProductID: productID, Level: level}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&alert).Error; err != nil {
+				return err
+			}
+
+			// going from sold out back to low stock is a restock, not news
+			if level == models.StockLow && previous == models.StockSoldOut {
+				return nil
+			}
+
+			var seller models.User
+			utils.GetItemByPrimaryKey(&seller, product.SellerId)
+			notification = stockNotification(product, seller, level)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error checking stock level of product %d: %v", productID, err)
+			continue
+		}
+
+		if notification != nil {
+			go func(n notifier.Notification) {
+				if err := StockNotifier.Notify(n); err != nil {
+					log.Printf("Error sending stock alert for product %d: %v", n.ProductID, err)
+				}
+			}(*notification)
+		}
+	}
+}
+
+// slotLevel is the alert level of a slot in a machine, empty when its stock is healthy.
+func slotLevel(slot models.MachineSlot) string {
+	if slot.Quantity <= 0 {
+		return models.StockSoldOut
+	}
+	if slot.ParLevel > 0 && slot.Quantity <= slot.ParLevel {
+		return models.StockLow
+	}
+	return ""
+}
+
+// checkSlotLevels alerts operators about the slots of a machine selling the given
+// products that have dropped to their par level or sold out. Machine sales take
+// stock from slots, not from the amount available of the product, so they are
+// checked here rather than by checkStockLevels. Without products every slot is checked.
+func checkSlotLevels(machineID uint, productIDs ...uint) {
+	var notifications []notifier.Notification
+
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("machine_id = ?", machineID)
+		if len(productIDs) > 0 {
+			query = query.Where("product_id IN ?", productIDs)
+		}
+		var slots []models.MachineSlot
+		if err := query.Order("code asc").Find(&slots).Error; err != nil {
+			return err
+		}
+
+		var alerts []models.SlotAlert
+		if err := tx.Where("machine_id = ?", machineID).Find(&alerts).Error; err != nil {
+			return err
+		}
+		previous := map[string]string{}
+		for _, alert := range alerts {
+			previous[alert.Code] = alert.Level
+		}
+
+		var changed []models.MachineSlot
+		for _, slot := range slots {
+			level := slotLevel(slot)
+			if level == previous[slot.Code] {
+				continue
+			}
+			if level == "" {
+				if err := tx.Delete(&models.SlotAlert{}, "machine_id = ? AND code = ?", machineID, slot.Code).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			alert := models.SlotAlert{MachineID: machineID, Code: slot.Code, Level: level}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&alert).Error; err != nil {
+				return err
+			}
+			// going from sold out back to low stock is a restock, not news
+			if !(level == models.StockLow && previous[slot.Code] == models.StockSoldOut) {
+				changed = append(changed, slot)
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+
+		var machine models.Machine
+		if err := tx.First(&machine, machineID).Error; err != nil {
+			return err
+		}
+		var operators []models.User
+		if err := tx.Where("LOWER(role) = ?", "operator").Find(&operators).Error; err != nil {
+			return err
+		}
+		for _, slot := range changed {
+			for _, operator := range operators {
+				notifications = append(notifications, slotNotification(machine, slot, operator, slotLevel(slot)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error checking slot stock of machine %d: %v", machineID, err)
+		return
+	}
+
+	for _, n := range notifications {
+		go func(n notifier.Notification) {
+			if err := StockNotifier.Notify(n); err != nil {
+				log.Printf("Error sending slot alert for machine %d: %v", machineID, err)
+			}
+		}(n)
+	}
+}
+
+func slotNotification(machine models.Machine, slot models.MachineSlot, operator models.User, level string) notifier.Notification {
+	n := notifier.Notification{
+		UserID:    operator.ID,
+		Email:     operator.Email,
+		Kind:      level,
+		ProductID: slot.ProductID,
+	}
+
+	if level == models.StockSoldOut {
+		n.Subject = fmt.Sprintf("Slot %s in %s has sold out", slot.Code, machine.Name)
+		n.Body = fmt.Sprintf("Slot %s in %s (machine %d) has sold out. Plan a restock visit to keep it selling.", slot.Code, machine.Name, machine.ID)
+	} else {
+		n.Subject = fmt.Sprintf("Slot %s in %s is running low", slot.Code, machine.Name)
+		n.Body = fmt.Sprintf("Slot %s in %s (machine %d) has %d left, at or below its par level of %d.",
+			slot.Code, machine.Name, machine.ID, slot.Quantity, slot.ParLevel)
+	}
+
+	return n
+}
+
+func stockNotification(product models.Product, seller models.User, level string) *notifier.Notification {
+	n := notifier.Notification{
+		UserID:    seller.ID,
+		Email:     seller.Email,
+		Kind:      level,
+		ProductID: product.ID,
+	}
+
+	if level == models.StockSoldOut {
+		n.Subject = fmt.Sprintf("%s has sold out", product.ProductName)
+		n.Body = fmt.Sprintf("%s (product %d) has sold out. Restock it to keep selling.", product.ProductName, product.ID)
+	} else {
+		n.Subject = fmt.Sprintf("%s is running low", product.ProductName)
+		n.Body = fmt.Sprintf("%s (product %d) has %d left, at or below its reorder threshold of %d.",
+			product.ProductName, product.ID, product.AmountAvailable, product.ReorderThreshold)
+	}
+
+	return &n
+}
@@ -0,0 +1,367 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const maxMachineSlots = 120
+
+var errSlotOverCapacity = errors.New("quantity cannot exceed capacity")
+
+// slotCodePattern matches slot codes such as A1 or F12: a row letter and a column number.
+var slotCodePattern = regexp.MustCompile(`^[A-Z][1-9][0-9]?$`)
+
+// MachinePlanogramGet is a function to get the slot layout of a machine
+func MachinePlanogramGet(response http.ResponseWriter, request *http.Request) {
+	_, err := TokenValid(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	slots := []models.MachineSlot{}
+	if err := utils.Db.Where("machine_id = ?", machine.ID).Order("code asc").Find(&slots).Error; err != nil {
+		utils.GetError(errors.New("error fetching planogram"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("planogram retreived successfully", slots, response)
+}
+
+// MachinePlanogramSet is a function for operators to replace the whole slot layout of a machine.
+// Slots left out of the request are removed.
+func MachinePlanogramSet(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	var planogram models.PlanogramRequest
+	if err := utils.ParseJSONFromRequest(request, &planogram); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if len(planogram.Slots) > maxMachineSlots {
+		utils.GetError(fmt.Errorf("a machine can have at most %d slots", maxMachineSlots), http.StatusBadRequest, response)
+		return
+	}
+
+	seen := map[string]bool{}
+	for i := range planogram.Slots {
+		planogram.Slots[i].Code = strings.ToUpper(strings.TrimSpace(planogram.Slots[i].Code))
+		code := planogram.Slots[i].Code
+		if seen[code] {
+			utils.GetError(fmt.Errorf("slot %s is listed more than once", code), http.StatusBadRequest, response)
+			return
+		}
+		seen[code] = true
+
+		if err := validateSlot(planogram.Slots[i]); err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+		if _, err := slotProduct(planogram.Slots[i].ProductID); err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	var slots []models.MachineSlot
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		var existing []models.MachineSlot
+		if err := tx.Where("machine_id = ?", machine.ID).Find(&existing).Error; err != nil {
+			return err
+		}
+		byCode := map[string]models.MachineSlot{}
+		for _, slot := range existing {
+			byCode[slot.Code] = slot
+		}
+
+		if err := tx.Where("machine_id = ?", machine.ID).Delete(&models.MachineSlot{}).Error; err != nil {
+			return err
+		}
+
+		for _, slotRequest := range planogram.Slots {
+			current, ok := byCode[slotRequest.Code]
+			slot, err := newSlot(machine.ID, slotRequest, current, ok)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&slot).Error; err != nil {
+				return err
+			}
+			slots = append(slots, slot)
+		}
+		return nil
+	})
+	if errors.Is(err, errSlotOverCapacity) {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+	if err != nil {
+		utils.GetError(errors.New("error saving planogram"), http.StatusInternalServerError, response)
+		return
+	}
+
+	checkSlotLevels(machine.ID)
+
+	utils.GetSuccess("planogram successfully updated", slots, response)
+}
+
+// MachineSlotSet is a function to place a product in a slot of a machine. Operators can set any
+// slot. Sellers can place their own products in empty slots or slots already selling their products,
+// setting the capacity and par level but not the quantity.
+func MachineSlotSet(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	role := strings.ToLower(user.Role)
+	if !isOperator(user) && role != "seller" {
+		utils.GetError(fmt.Errorf("user is not a seller or an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	var slotRequest models.SlotRequest
+	if err := utils.ParseJSONFromRequest(request, &slotRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+	slotRequest.Code = strings.ToUpper(mux.Vars(request)["slot_code"])
+
+	if err := validateSlot(slotRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	product, err := slotProduct(slotRequest.ProductID)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var current models.MachineSlot
+	found := utils.Db.Where("machine_id = ? AND code = ?", machine.ID, slotRequest.Code).Limit(1).Find(&current).RowsAffected > 0
+
+	if !isOperator(user) {
+		if product.SellerId != user.ID {
+			utils.GetError(fmt.Errorf("user not authorized to place this product"), http.StatusUnauthorized, response)
+			return
+		}
+		if found && !ownsSlot(user, current) {
+			utils.GetError(fmt.Errorf("slot %s sells another seller's product", current.Code), http.StatusUnauthorized, response)
+			return
+		}
+		// the stock in a slot changes when an operator loads it or a buyer buys from it
+		if slotRequest.Quantity != nil {
+			utils.GetError(fmt.Errorf("only operators can set the quantity of a slot"), http.StatusUnauthorized, response)
+			return
+		}
+	}
+
+	slot, err := newSlot(machine.ID, slotRequest, current, found)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if found {
+		slot.ID = current.ID
+		err = utils.Db.Save(&slot).Error
+	} else {
+		var count int64
+		utils.Db.Model(&models.MachineSlot{}).Where("machine_id = ?", machine.ID).Count(&count)
+		if count >= maxMachineSlots {
+			utils.GetError(fmt.Errorf("a machine can have at most %d slots", maxMachineSlots), http.StatusBadRequest, response)
+			return
+		}
+		err = utils.Db.Create(&slot).Error
+	}
+	if err != nil {
+		utils.GetError(errors.New("error saving slot"), http.StatusInternalServerError, response)
+		return
+	}
+
+	checkSlotLevels(machine.ID)
+
+	utils.GetSuccess("machine slot successfully updated", slot, response)
+}
+
+// MachineSlotDelete is a function to remove a slot from a machine. Sellers can only remove slots selling their products.
+func MachineSlotDelete(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	role := strings.ToLower(user.Role)
+	if !isOperator(user) && role != "seller" {
+		utils.GetError(fmt.Errorf("user is not a seller or an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	code := strings.ToUpper(mux.Vars(request)["slot_code"])
+
+	var slot models.MachineSlot
+	if tx := utils.Db.Where("machine_id = ? AND code = ?", machine.ID, code).Limit(1).Find(&slot); tx.RowsAffected < 1 {
+		utils.GetError(errors.New("slot not found"), http.StatusNotFound, response)
+		return
+	}
+
+	if !isOperator(user) && !ownsSlot(user, slot) {
+		utils.GetError(fmt.Errorf("slot %s sells another seller's product", slot.Code), http.StatusUnauthorized, response)
+		return
+	}
+
+	if result := utils.Db.Delete(&slot); result.RowsAffected < 1 {
+		utils.GetError(errors.New("slot not found"), http.StatusNotFound, response)
+		return
+	}
+
+	utils.GetSuccess("machine slot successfully deleted", nil, response)
+}
+
+// validateSlot checks the code, capacity and par level of a slot.
+func validateSlot(slotRequest models.SlotRequest) error {
+	if !slotCodePattern.MatchString(slotRequest.Code) {
+		return fmt.Errorf("invalid slot code %q, expected a row letter and column number such as A1", slotRequest.Code)
+	}
+	if slotRequest.Capacity < 1 {
+		return fmt.Errorf("slot %s: capacity must be greater than zero", slotRequest.Code)
+	}
+	if slotRequest.ParLevel < 0 || slotRequest.ParLevel > slotRequest.Capacity {
+		return fmt.Errorf("slot %s: par_level must be between 0 and capacity", slotRequest.Code)
+	}
+	if slotRequest.Quantity != nil && *slotRequest.Quantity < 0 {
+		return fmt.Errorf("slot %s: quantity cannot be negative", slotRequest.Code)
+	}
+	return nil
+}
+
+// slotProduct loads a product that can be placed in a slot. Products with
+// variants are placed through their variants.
+func slotProduct(productID uint) (models.Product, error) {
+	var product models.Product
+	if tx := utils.GetItemByPrimaryKey(&product, productID); tx.RowsAffected < 1 {
+		return product, fmt.Errorf("product %d not found", productID)
+	}
+
+	var variants int64
+	utils.Db.Model(&models.Product{}).Where("parent_id = ?", product.ID).Count(&variants)
+	if variants > 0 {
+		return product, fmt.Errorf("product %d has variants, place a variant instead", product.ID)
+	}
+
+	return product, nil
+}
+
+// newSlot builds the slot for slotRequest. A slot keeps the stock of current when it
+// still sells the same product and the request does not set a quantity.
+func newSlot(machineID uint, slotRequest models.SlotRequest, current models.MachineSlot, found bool) (models.MachineSlot, error) {
+	slot := models.MachineSlot{
+		MachineID: machineID,
+		Code:      slotRequest.Code,
+		ProductID: slotRequest.ProductID,
+		Capacity:  slotRequest.Capacity,
+		ParLevel:  slotRequest.ParLevel,
+	}
+
+	switch {
+	case slotRequest.Quantity != nil:
+		slot.Quantity = *slotRequest.Quantity
+	case found && current.ProductID == slotRequest.ProductID:
+		slot.Quantity = current.Quantity
+	}
+
+	if slot.Quantity > slot.Capacity {
+		return slot, fmt.Errorf("slot %s: %w", slot.Code, errSlotOverCapacity)
+	}
+
+	return slot, nil
+}
+
+// ownsSlot reports whether slot sells a product of the seller user.
+func ownsSlot(user models.User, slot models.MachineSlot) bool {
+	var product models.Product
+	if tx := utils.GetItemByPrimaryKey(&product, slot.ProductID); tx.RowsAffected < 1 {
+		return false
+	}
+	return product.SellerId == user.ID
+}
+
+// resolveSlotItems replaces the slot codes of items with the products the slots
+// sell in a machine, so they are bought like any other item.
+func resolveSlotItems(machineID uint, items []models.BuyItem) ([]models.BuyItem, *requestError) {
+	resolved := make([]models.BuyItem, 0, len(items))
+
+	for _, item := range items {
+		if item.SlotCode == "" {
+			resolved = append(resolved, item)
+			continue
+		}
+
+		item.SlotCode = strings.ToUpper(item.SlotCode)
+
+		var slot models.MachineSlot
+		if tx := utils.Db.Where("machine_id = ? AND code = ?", machineID, item.SlotCode).Limit(1).Find(&slot); tx.RowsAffected < 1 {
+			return nil, &requestError{fmt.Errorf("slot %s not found", item.SlotCode), http.StatusNotFound}
+		}
+
+		var product models.Product
+		if tx := utils.GetItemByPrimaryKey(&product, slot.ProductID); tx.RowsAffected < 1 {
+			return nil, &requestError{fmt.Errorf("product not found"), http.StatusUnauthorized}
+		}
+
+		item.ProductID, item.VariantID = int(product.ID), 0
+		if product.ParentID != nil {
+			item.ProductID, item.VariantID = int(*product.ParentID), int(product.ID)
+		}
+
+		resolved = append(resolved, item)
+	}
+
+	return resolved, nil
+}
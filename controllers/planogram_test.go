@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+)
+
+// TestValidateSlot tests slot codes, capacities, par levels and quantities are checked
+func TestValidateSlot(t *testing.T) {
+	quantity := func(v int) *int { return &v }
+
+	tests := []struct {
+		name string
+		slot models.SlotRequest
+		err  string
+	}{
+		{"valid", models.SlotRequest{Code: "A1", Capacity: 10, ParLevel: 3, Quantity: quantity(5)}, ""},
+		{"two digit column", models.SlotRequest{Code: "F12", Capacity: 10}, ""},
+		{"par level at capacity", models.SlotRequest{Code: "B2", Capacity: 10, ParLevel: 10}, ""},
+		{"lower case code", models.SlotRequest{Code: "a1", Capacity: 10}, `invalid slot code "a1", expected a row letter and column number such as A1`},
+		{"column zero", models.SlotRequest{Code: "A0", Capacity: 10}, `invalid slot code "A0", expected a row letter and column number such as A1`},
+		{"no capacity", models.SlotRequest{Code: "A1"}, "slot A1: capacity must be greater than zero"},
+		{"negative par level", models.SlotRequest{Code: "A1", Capacity: 10, ParLevel: -1}, "slot A1: par_level must be between 0 and capacity"},
+		{"par level over capacity", models.SlotRequest{Code: "A1", Capacity: 10, ParLevel: 11}, "slot A1: par_level must be between 0 and capacity"},
+		{"negative quantity", models.SlotRequest{Code: "A1", Capacity: 10, Quantity: quantity(-1)}, "slot A1: quantity cannot be negative"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateSlot(test.slot)
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Errorf("got error %v expected %q", err, test.err)
+			}
+		})
+	}
+}
+
+// TestNewSlot tests a slot keeps its stock only while it sells the same product
+func TestNewSlot(t *testing.T) {
+	quantity := func(v int) *int { return &v }
+	current := models.MachineSlot{ID: 4, MachineID: 1, Code: "A1", ProductID: 7, Quantity: 6, Capacity: 10}
+
+	tests := []struct {
+		name     string
+		slot     models.SlotRequest
+		found    bool
+		expected int
+		err      error
+	}{
+		{"new slot starts empty", models.SlotRequest{Code: "A1", ProductID: 7, Capacity: 10}, false, 0, nil},
+		{"same product keeps its stock", models.SlotRequest{Code: "A1", ProductID: 7, Capacity: 12}, true, 6, nil},
+		{"another product starts empty", models.SlotRequest{Code: "A1", ProductID: 8, Capacity: 10}, true, 0, nil},
+		{"quantity is set", models.SlotRequest{Code: "A1", ProductID: 8, Capacity: 10, Quantity: quantity(3)}, true, 3, nil},
+		{"quantity over capacity", models.SlotRequest{Code: "A1", ProductID: 7, Capacity: 10, Quantity: quantity(11)}, true, 11, errSlotOverCapacity},
+		{"kept stock over a smaller capacity", models.SlotRequest{Code: "A1", ProductID: 7, Capacity: 5}, true, 6, errSlotOverCapacity},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slot, err := newSlot(1, test.slot, current, test.found)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v expected %v", err, test.err)
+			}
+			if slot.Quantity != test.expected {
+				t.Errorf("got quantity %d expected %d", slot.Quantity, test.expected)
+			}
+			if slot.ID != 0 || slot.MachineID != 1 || slot.ProductID != test.slot.ProductID || slot.Capacity != test.slot.Capacity {
+				t.Errorf("got slot %+v for request %+v", slot, test.slot)
+			}
+		})
+	}
+}
+
+// TestResolveSlotItems tests slot codes are replaced by the products and variants they sell
+func TestResolveSlotItems(t *testing.T) {
+	var seller models.User
+	if result := utils.GetItemsByField(&seller, "email", TestsellerEmail); result.RowsAffected < 1 {
+		t.Fatal("seller does not exist")
+	}
+
+	machine := models.Machine{Name: "Slot test machine"}
+	if result := utils.CreateItem(&machine); result.RowsAffected < 1 {
+		t.Fatal("machine not created")
+	}
+
+	parent := models.Product{Cost: 80, ProductName: "Slot test soda", SellerId: seller.ID}
+	if result := utils.CreateItem(&parent); result.RowsAffected < 1 {
+		t.Fatal("product not created")
+	}
+	variant := models.Product{Cost: 80, ProductName: "Slot test soda", SellerId: seller.ID, ParentID: &parent.ID, VariantName: "Cherry"}
+	if result := utils.CreateItem(&variant); result.RowsAffected < 1 {
+		t.Fatal("variant not created")
+	}
+	defer utils.Db.Unscoped().Delete(&models.Product{}, []uint{variant.ID, parent.ID})
+
+	slots := []models.MachineSlot{
+		{MachineID: machine.ID, Code: "A1", ProductID: TestProductId, Quantity: 5, Capacity: 10},
+		{MachineID: machine.ID, Code: "A2", ProductID: variant.ID, Quantity: 5, Capacity: 10},
+	}
+	if result := utils.CreateItem(&slots); result.RowsAffected < 2 {
+		t.Fatal("slots not created")
+	}
+
+	t.Run("test slots resolve to their products", func(t *testing.T) {
+		items := []models.BuyItem{
+			{SlotCode: "a1", Quantity: 1},
+			{SlotCode: "A2", Quantity: 2},
+			{ProductID: int(TestProductId), Quantity: 3},
+		}
+
+		resolved, rerr := resolveSlotItems(machine.ID, items)
+		if rerr != nil {
+			t.Fatalf("unexpected error %v", rerr.err)
+		}
+
+		expected := []models.BuyItem{
+			{ProductID: int(TestProductId), SlotCode: "A1", Quantity: 1},
+			{ProductID: int(parent.ID), VariantID: int(variant.ID), SlotCode: "A2", Quantity: 2},
+			{ProductID: int(TestProductId), Quantity: 3},
+		}
+		if len(resolved) != len(expected) {
+			t.Fatalf("got %d items expected %d", len(resolved), len(expected))
+		}
+		for i := range expected {
+			if resolved[i] != expected[i] {
+				t.Errorf("item %d: got %+v expected %+v", i, resolved[i], expected[i])
+			}
+		}
+	})
+
+	t.Run("test unknown slot", func(t *testing.T) {
+		_, rerr := resolveSlotItems(machine.ID, []models.BuyItem{{SlotCode: "B9", Quantity: 1}})
+		if rerr == nil {
+			t.Fatal("expected an error")
+		}
+		assertStatusCode(t, rerr.status, http.StatusNotFound)
+		assertResponseMessage(t, rerr.err.Error(), "slot B9 not found")
+	})
+
+	t.Run("test slot of another machine", func(t *testing.T) {
+		_, rerr := resolveSlotItems(machine.ID+1, []models.BuyItem{{SlotCode: "A1", Quantity: 1}})
+		if rerr == nil || rerr.status != http.StatusNotFound {
+			t.Errorf("got %v expected slot not found", rerr)
+		}
+	})
+}
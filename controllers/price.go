@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var (
+	errPriceNotFound = errors.New("scheduled price not found")
+	errPriceOverlap  = errors.New("another temporary price is scheduled in that time")
+)
+
+// ProductPriceHistory is a function to get the past and scheduled prices of a product
+func ProductPriceHistory(response http.ResponseWriter, request *http.Request) {
+	productID := mux.Vars(request)["product_id"]
+
+	_, err := TokenValid(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	uintProductID, _ := strconv.ParseUint(productID, 10, 64)
+
+	var product models.Product
+	if tx := utils.GetItemByPrimaryKey(&product, uint(uintProductID)); tx.RowsAffected < 1 {
+		utils.GetError(errors.New("product not found"), http.StatusNotFound, response)
+		return
+	}
+
+	changes := []models.PriceChange{}
+	result := utils.Db.Where("product_id = ?", product.ID).Order("effective_from asc, id asc").Find(&changes)
+	if result.Error != nil {
+		utils.GetError(errors.New("error fetching price history"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("price history retreived successfully", changes, response)
+}
+
+// ProductPriceSchedule is a function to schedule a future price change for a product.
+// Only the seller who created the product can schedule its prices.
+func ProductPriceSchedule(response http.ResponseWriter, request *http.Request) {
+	productID := mux.Vars(request)["product_id"]
+
+	product, rerr := sellerProduct(request, productID)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var scheduleRequest models.PriceScheduleRequest
+	if err := utils.ParseJSONFromRequest(request, &scheduleRequest); err != nil {
+		utils.GetError(errors.New("bad price data"), http.StatusBadRequest, response)
+		return
+	}
+
+	if err := validate.Struct(scheduleRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	now := time.Now().Unix()
+
+	if scheduleRequest.Cost <= 0 {
+		utils.GetError(errors.New("cost must be greater than zero"), http.StatusBadRequest, response)
+		return
+	}
+
+	if scheduleRequest.EffectiveFrom <= now {
+		utils.GetError(errors.New("effective_from must be in the future, update the product to change its price now"), http.StatusBadRequest, response)
+		return
+	}
+
+	if scheduleRequest.EffectiveUntil != 0 && scheduleRequest.EffectiveUntil <= scheduleRequest.EffectiveFrom {
+		utils.GetError(errors.New("effective_until must be after effective_from"), http.StatusBadRequest, response)
+		return
+	}
+
+	var scheduled []models.PriceChange
+
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		change := models.PriceChange{
+			ProductID:      product.ID,
+			Cost:           scheduleRequest.Cost,
+			EffectiveFrom:  scheduleRequest.EffectiveFrom,
+			EffectiveUntil: scheduleRequest.EffectiveUntil,
+			CreatedBy:      product.SellerId,
+		}
+
+		if scheduleRequest.EffectiveUntil == 0 {
+			scheduled = append(scheduled, change)
+			return tx.Create(&scheduled).Error
+		}
+
+		var overlapping int64
+		err := tx.Model(&models.PriceChange{}).
+			Where("product_id = ? AND effective_until > ? AND effective_from < ?", product.ID, scheduleRequest.EffectiveFrom, scheduleRequest.EffectiveUntil).
+			Count(&overlapping).Error
+		if err != nil {
+			return err
+		}
+		if overlapping > 0 {
+			return errPriceOverlap
+		}
+
+		if err := tx.Create(&change).Error; err != nil {
+			return err
+		}
+
+		// the revert holds today's base price until it takes effect and resolves its own
+		revertCost, err := basePrice(tx, product.ID, scheduleRequest.EffectiveUntil, product.Cost)
+		if err != nil {
+			return err
+		}
+
+		revert := models.PriceChange{
+			ProductID:     product.ID,
+			Cost:          revertCost,
+			EffectiveFrom: scheduleRequest.EffectiveUntil,
+			RevertOf:      &change.ID,
+			CreatedBy:     product.SellerId,
+		}
+		if err := tx.Create(&revert).Error; err != nil {
+			return err
+		}
+
+		scheduled = append(scheduled, change, revert)
+		return nil
+	})
+
+	if err == errPriceOverlap {
+		utils.GetError(err, http.StatusConflict, response)
+		return
+	}
+	if err != nil {
+		utils.GetError(errors.New("error scheduling price"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("price scheduled successfully", scheduled, response)
+}
+
+// ProductPriceCancel is a function to cancel a scheduled price change that has not been applied yet.
+func ProductPriceCancel(response http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+
+	product, rerr := sellerProduct(request, vars["product_id"])
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	priceID, _ := strconv.ParseUint(vars["price_id"], 10, 64)
+	now := time.Now().Unix()
+
+	// a temporary price and its revert are cancelled together, or not at all
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		var change models.PriceChange
+		if result := tx.Where("id = ? AND product_id = ?", uint(priceID), product.ID).Limit(1).Find(&change); result.RowsAffected < 1 {
+			return errPriceNotFound
+		}
+
+		ids := []uint{change.ID}
+		if change.RevertOf != nil {
+			ids = append(ids, *change.RevertOf)
+		} else if change.EffectiveUntil != 0 {
+			var reverts []uint
+			if err := tx.Model(&models.PriceChange{}).Where("revert_of = ?", change.ID).Pluck("id", &reverts).Error; err != nil {
+				return err
+			}
+			ids = append(ids, reverts...)
+		}
+
+		result := tx.Where("id IN ? AND product_id = ? AND applied = ? AND effective_from > ?", ids, product.ID, false, now).
+			Delete(&models.PriceChange{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < int64(len(ids)) {
+			return errPriceNotFound
+		}
+		return nil
+	})
+
+	if err == errPriceNotFound {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+	if err != nil {
+		utils.GetError(errors.New("error cancelling price"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("scheduled price cancelled", nil, response)
+}
+
+// ApplyScheduledPrices copies due scheduled prices onto their products so listings
+// show the current price. It returns the number of products updated.
+func ApplyScheduledPrices() (int, error) {
+	var due []models.PriceChange
+
+	result := utils.Db.Where("applied = ? AND effective_from <= ?", false, time.Now().Unix()).
+		Order("product_id asc, effective_from asc, id asc").
+		Find(&due)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	// the last due change of each product is its current price
+	latest := map[uint]models.PriceChange{}
+	ids := map[uint][]uint{}
+	for _, change := range due {
+		latest[change.ProductID] = change
+		ids[change.ProductID] = append(ids[change.ProductID], change.ID)
+	}
+
+	updated := 0
+	for productID, change := range latest {
+		change := change
+		err := utils.Db.Transaction(func(tx *gorm.DB) error {
+			cost, err := changeCost(tx, change)
+			if err != nil {
+				return err
+			}
+			if change.RevertOf != nil {
+				// record the base price the revert went back to
+				if err := tx.Model(&change).Update("cost", cost).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&models.Product{}).Where("id = ?", productID).Update("cost", cost).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.PriceChange{}).Where("id IN ?", ids[productID]).Update("applied", true).Error
+		})
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, nil
+}
+
+// effectivePrice returns the cost of a product at the given time. Purchases are
+// charged this price so a late scheduler run never over- or under-charges.
+func effectivePrice(db *gorm.DB, product models.Product, at time.Time) (int, error) {
+	var changes []models.PriceChange
+
+	result := db.Where("product_id = ? AND effective_from <= ?", product.ID, at.Unix()).
+		Order("effective_from desc, id desc").
+		Limit(1).
+		Find(&changes)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if len(changes) == 0 {
+		return product.Cost, nil
+	}
+
+	return changeCost(db, changes[0])
+}
+
+// changeCost returns the cost a price change sets, resolving a revert to the base
+// price at the time it takes effect.
+func changeCost(db *gorm.DB, change models.PriceChange) (int, error) {
+	if change.RevertOf == nil {
+		return change.Cost, nil
+	}
+	return basePrice(db, change.ProductID, change.EffectiveFrom, change.Cost)
+}
+
+// basePrice returns the cost of a product at the given unix time leaving out temporary
+// prices, or fallback when it has no other price change by then.
+func basePrice(db *gorm.DB, productID uint, at int64, fallback int) (int, error) {
+	var changes []models.PriceChange
+
+	result := db.Where("product_id = ? AND effective_from <= ? AND effective_until = ? AND revert_of IS NULL", productID, at, 0).
+		Order("effective_from desc, id desc").
+		Limit(1).
+		Find(&changes)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if len(changes) == 0 {
+		return fallback, nil
+	}
+
+	return changes[0].Cost, nil
+}
+
+// recordPriceChange stores a price change that takes effect immediately.
+func recordPriceChange(tx *gorm.DB, productID uint, cost int, userID uint) error {
+	change := models.PriceChange{
+		ProductID:     productID,
+		Cost:          cost,
+		EffectiveFrom: time.Now().Unix(),
+		Applied:       true,
+		CreatedBy:     userID,
+	}
+
+	return tx.Create(&change).Error
+}
@@ -4,12 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/femibiwoye/go-test/models"
 	"github.com/femibiwoye/go-test/utils"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 // ProductCreate is a function to create a new product
@@ -30,6 +33,16 @@ func ProductCreate(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	if product.AmountAvailable < 0 {
+		utils.GetError(errors.New("amount available cannot be negative"), http.StatusBadRequest, response)
+		return
+	}
+
+	if product.ReorderThreshold < 0 {
+		utils.GetError(errors.New("reorder threshold cannot be negative"), http.StatusBadRequest, response)
+		return
+	}
+
 	var user models.User
 
 	// GetItemByPrimaryKey is a function to get a user by primary key
@@ -41,47 +54,303 @@ func ProductCreate(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	product.SellerId = uint(uintID)
+	if product.CategoryID != nil {
+		var category models.Category
+		if tx := utils.GetItemByPrimaryKey(&category, *product.CategoryID); tx.RowsAffected < 1 {
+			utils.GetError(errors.New("category not found"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	tags, err := normalizeTags(product.Tags)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	attributes, err := parseAttributes(product.Attributes)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
 
-	res := utils.CreateItem(&product)
+	product.SellerId = uint(uintID)
+	// new products are drafts until they are submitted and approved
+	product.Status = models.ProductDraft
+	product.PendingProductName = ""
+	product.ReviewNote = ""
+	// variants are added through their parent and deletion has its own endpoint
+	product.ID = 0
+	product.ParentID = nil
+	product.VariantName = ""
+	product.Variants = nil
+	product.DeletedAt = gorm.DeletedAt{}
+
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		return createProduct(tx, &product, tags, attributes)
+	})
 
-	if res.RowsAffected < 1 {
+	if err != nil {
 		utils.GetError(fmt.Errorf("error adding product"), http.StatusInternalServerError, response)
 		return
 	}
 
+	productIndex.Put(product.ID, product.ProductName)
+
 	respse := map[string]interface{}{
 		"product_id": product.ID,
+		"status":     product.Status,
 	}
 
 	utils.GetSuccess("product added successfully", respse, response)
 
 }
 
-// ProductGetALL is a function to get all products
+// createProduct saves a new product with its opening price, tags and attributes.
+func createProduct(tx *gorm.DB, product *models.Product, tags []string, attributes []models.ProductAttribute) error {
+	if err := tx.Create(product).Error; err != nil {
+		return err
+	}
+	if err := recordPriceChange(tx, product.ID, product.Cost, product.SellerId); err != nil {
+		return err
+	}
+	if err := saveProductTags(tx, product.ID, tags); err != nil {
+		return err
+	}
+	return saveProductAttributes(tx, product.ID, attributes)
+}
+
+// ProductGetALL is a function to get all products. Variants are listed under their product.
+// It supports page/limit pagination, filtering by seller_id, min_cost, max_cost,
+// in_stock, q (product name search), category_id (including sub-categories),
+// tag and attribute=<name>:<value>, and sorting with sort=<field> or sort=-<field>.
+// Sellers can pass include_deleted=true to list their own products including deleted ones.
 func ProductGetALL(response http.ResponseWriter, request *http.Request) {
-	_, err := TokenValid(request)
+	user, err := AuthenticatedUser(request)
 	if err != nil {
 		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
 		return
 	}
-	var products []models.Product
 
-	result := utils.Db.Find(&products)
-	if result.RowsAffected < 1 {
-		utils.GetError(errors.New("no products found"), http.StatusNotFound, response)
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	filters, err := productFilters(request.URL.Query())
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	// sellers can include their own deleted products for reporting
+	if includeDeleted, _ := strconv.ParseBool(request.URL.Query().Get("include_deleted")); includeDeleted {
+		if strings.ToLower(user.Role) != "seller" {
+			utils.GetError(fmt.Errorf("user is not a seller"), http.StatusNotAcceptable, response)
+			return
+		}
+
+		filters = withDeletedSellerProducts(filters, user.ID)
+	}
+
+	order, err := productOrder(request.URL.Query().Get("sort"))
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var total int64
+	if err := utils.Db.Model(&models.Product{}).Scopes(filters, visibleProducts(user)).Count(&total).Error; err != nil {
+		utils.GetError(errors.New("error fetching products"), http.StatusInternalServerError, response)
 		return
 	}
 
-	utils.GetSuccess("products retreived successfully", products, response)
+	products := []models.Product{}
+	result := utils.Db.Scopes(filters, visibleProducts(user)).
+		Order(order).
+		Offset(pagination.Offset()).
+		Limit(pagination.Limit).
+		Find(&products)
+	if result.Error != nil {
+		utils.GetError(errors.New("error fetching products"), http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := loadProductDetails(products); err != nil {
+		utils.GetError(errors.New("error fetching products"), http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := loadVariants(products, user); err != nil {
+		utils.GetError(errors.New("error fetching products"), http.StatusInternalServerError, response)
+		return
+	}
+
+	productList := models.ProductList{
+		Products: products,
+		Meta:     models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("products retreived successfully", productList, response)
 
 }
 
-// ProductGet is a function to get a product by product_id
+// productSortFields maps the sort keys accepted by ProductGetALL to columns.
+var productSortFields = map[string]string{
+	"id":               "id",
+	"cost":             "cost",
+	"product_name":     "product_name",
+	"amount_available": "amount_available",
+}
+
+// likeEscaper escapes the wildcard characters of a LIKE pattern.
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+// productFilters builds a query scope from the product list filters in the query string.
+// Only top level products are matched, their variants are loaded with them.
+func productFilters(query url.Values) (func(*gorm.DB) *gorm.DB, error) {
+	conditions := []func(*gorm.DB) *gorm.DB{
+		func(db *gorm.DB) *gorm.DB {
+			return db.Where("parent_id IS NULL")
+		},
+	}
+
+	if sellerID := query.Get("seller_id"); sellerID != "" {
+		value, err := strconv.ParseUint(sellerID, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid seller_id")
+		}
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			return db.Where("seller_id = ?", uint(value))
+		})
+	}
+
+	if minCost := query.Get("min_cost"); minCost != "" {
+		value, err := strconv.Atoi(minCost)
+		if err != nil {
+			return nil, errors.New("invalid min_cost")
+		}
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			return db.Where("cost >= ?", value)
+		})
+	}
+
+	if maxCost := query.Get("max_cost"); maxCost != "" {
+		value, err := strconv.Atoi(maxCost)
+		if err != nil {
+			return nil, errors.New("invalid max_cost")
+		}
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			return db.Where("cost <= ?", value)
+		})
+	}
+
+	if inStock := query.Get("in_stock"); inStock != "" {
+		value, err := strconv.ParseBool(inStock)
+		if err != nil {
+			return nil, errors.New("invalid in_stock")
+		}
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			if value {
+				return db.Where("amount_available > 0")
+			}
+			return db.Where("amount_available <= 0")
+		})
+	}
+
+	if name := strings.TrimSpace(query.Get("q")); name != "" {
+		pattern := "%" + likeEscaper.Replace(name) + "%"
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			return db.Where("product_name LIKE ?", pattern)
+		})
+	}
+
+	if categoryID := query.Get("category_id"); categoryID != "" {
+		value, err := strconv.ParseUint(categoryID, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid category_id")
+		}
+		categories, err := loadCategories()
+		if err != nil {
+			return nil, err
+		}
+		ids := categoryDescendants(categories, uint(value))
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			return db.Where("category_id IN ?", ids)
+		})
+	}
+
+	for _, tag := range query["tag"] {
+		tag := strings.ToLower(strings.TrimSpace(tag))
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			return db.Where("id IN (?)", utils.Db.Model(&models.ProductTag{}).Select("product_id").Where("tag = ?", tag))
+		})
+	}
+
+	for _, attribute := range query["attribute"] {
+		parts := strings.SplitN(attribute, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("attribute filter must be in the form name:value")
+		}
+		attributeType, ok := productAttributeTypes[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown product attribute: %s", parts[0])
+		}
+		name, value := parts[0], strings.TrimSpace(parts[1])
+		if attributeType == attributeList {
+			value = strings.ToLower(value)
+		}
+		conditions = append(conditions, func(db *gorm.DB) *gorm.DB {
+			return db.Where("id IN (?)", utils.Db.Model(&models.ProductAttribute{}).Select("product_id").Where("name = ? AND value = ?", name, value))
+		})
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		for _, condition := range conditions {
+			db = condition(db)
+		}
+		return db
+	}, nil
+}
+
+// withDeletedSellerProducts extends filters to the products of sellerID, including deleted ones.
+func withDeletedSellerProducts(filters func(*gorm.DB) *gorm.DB, sellerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return filters(db.Unscoped().Where("seller_id = ?", sellerID))
+	}
+}
+
+// productOrder converts a sort key such as "cost" or "-cost" into an ORDER BY clause.
+// Results are always ordered by id last so pages are stable.
+func productOrder(sort string) (string, error) {
+	if sort == "" {
+		return "id asc", nil
+	}
+
+	direction := "asc"
+	if strings.HasPrefix(sort, "-") {
+		direction = "desc"
+		sort = strings.TrimPrefix(sort, "-")
+	}
+
+	column, ok := productSortFields[sort]
+	if !ok {
+		return "", fmt.Errorf("invalid sort field: %s", sort)
+	}
+
+	if column == "id" {
+		return "id " + direction, nil
+	}
+
+	return column + " " + direction + ", id asc", nil
+}
+
+// ProductGet is a function to get a product by product_id. Buyers can only get published products.
 func ProductGet(response http.ResponseWriter, request *http.Request) {
 	productID := mux.Vars(request)["product_id"]
 
-	_, err := TokenValid(request)
+	user, err := AuthenticatedUser(request)
 	if err != nil {
 		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
 		return
@@ -90,14 +359,24 @@ func ProductGet(response http.ResponseWriter, request *http.Request) {
 	uintProductID, _ := (strconv.ParseUint(productID, 10, 64))
 	var product models.Product
 
-	// GetItemByPrimaryKey is a function to get a product by primary key
-	result := utils.GetItemsByField(&product, "id", uint(uintProductID))
+	result := utils.Db.Scopes(visibleProducts(user)).Where("id = ?", uint(uintProductID)).Limit(1).Find(&product)
 	if result.RowsAffected < 1 {
 		utils.GetError(errors.New("product not found"), http.StatusNotFound, response)
 		return
 	}
 
-	utils.GetSuccess("product retreived successfully", product, response)
+	products := []models.Product{product}
+	if err := loadProductDetails(products); err != nil {
+		utils.GetError(errors.New("error fetching product"), http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := loadVariants(products, user); err != nil {
+		utils.GetError(errors.New("error fetching product"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("product retreived successfully", products[0], response)
 
 }
 
@@ -140,17 +419,169 @@ func ProductDelete(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	result := utils.Db.Delete(models.Product{}, "id = ?", product.ID)
+	var variants []models.Product
+	utils.Db.Where("parent_id = ?", product.ID).Find(&variants)
+
+	// products are soft deleted so they stay available for history and
+	// seller reports until PurgeDeletedProducts removes them. Variants go with their product.
+	result := utils.Db.Delete(models.Product{}, "id = ? OR parent_id = ?", product.ID, product.ID)
 
 	if result.RowsAffected < 1 {
 		utils.GetError(fmt.Errorf("product delete failed"), http.StatusInternalServerError, response)
 		return
 	}
 
+	productIndex.Remove(product.ID)
+	for _, variant := range variants {
+		productIndex.Remove(variant.ID)
+	}
+
 	utils.GetSuccess("product successfully deleted", nil, response)
 
 }
 
+// ProductRestore is a function to restore a deleted product by product_id
+func ProductRestore(response http.ResponseWriter, request *http.Request) {
+	productID := mux.Vars(request)["product_id"]
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "seller" {
+		utils.GetError(fmt.Errorf("user is not a seller"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	uintProductID, _ := strconv.ParseUint(productID, 10, 64)
+
+	var product models.Product
+	tx := utils.Db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", uint(uintProductID)).Find(&product)
+	if tx.RowsAffected < 1 {
+		utils.GetError(fmt.Errorf("deleted product not found"), http.StatusNotFound, response)
+		return
+	}
+
+	if user.ID != product.SellerId {
+		utils.GetError(fmt.Errorf("user not authorized to restore product"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if product.ParentID != nil {
+		var parent models.Product
+		if tx := utils.GetItemByPrimaryKey(&parent, *product.ParentID); tx.RowsAffected < 1 {
+			utils.GetError(fmt.Errorf("restore the parent product first"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	// variants deleted together with their product are restored with it
+	var variants []models.Product
+	utils.Db.Unscoped().Where("parent_id = ? AND deleted_at = ?", product.ID, product.DeletedAt.Time).Find(&variants)
+
+	ids := []uint{product.ID}
+	for _, variant := range variants {
+		ids = append(ids, variant.ID)
+	}
+
+	result := utils.Db.Unscoped().Model(&models.Product{}).Where("id IN ?", ids).Update("deleted_at", nil)
+	if result.RowsAffected < 1 {
+		utils.GetError(fmt.Errorf("product restore failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	productIndex.Put(product.ID, product.ProductName)
+	for _, variant := range variants {
+		productIndex.Put(variant.ID, variant.ProductName)
+	}
+
+	utils.GetSuccess("product successfully restored", nil, response)
+}
+
+// productReferences are the columns of other tables that point at a product: its
+// order history and the machines, promotions, earning rules and variants using it.
+var productReferences = []struct{ table, column string }{
+	{"order_items", "product_id"},
+	{"order_lots", "product_id"},
+	{"offline_transactions", "product_id"},
+	{"restock_items", "product_id"},
+	{"machine_slots", "product_id"},
+	{"promotions", "product_id"},
+	{"promotions", "bundle_product_id"},
+	{"earning_rules", "product_id"},
+	{"products", "parent_id"},
+}
+
+// productOwnedTables hold rows that belong to a single product and are purged with it.
+var productOwnedTables = []interface{}{
+	&models.PriceChange{}, &models.ProductRestriction{}, &models.StockLot{}, &models.StockAlert{},
+}
+
+// PurgeDeletedProducts permanently removes products that were deleted more than
+// retention ago, together with their tags, attributes, prices, lots and images.
+// A product that is still referenced, by an order or a machine slot for example,
+// stays soft-deleted so history keeps pointing at it.
+func PurgeDeletedProducts(retention time.Duration) (int, error) {
+	var products []models.Product
+	cutoff := time.Now().Add(-retention)
+
+	result := utils.Db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&products)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	purged := 0
+	for _, product := range products {
+		referenced := false
+		err := utils.Db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if referenced, err = productReferenced(tx, product.ID); err != nil || referenced {
+				return err
+			}
+
+			if err := saveProductTags(tx, product.ID, nil); err != nil {
+				return err
+			}
+			if err := saveProductAttributes(tx, product.ID, nil); err != nil {
+				return err
+			}
+			for _, owned := range productOwnedTables {
+				if err := tx.Where("product_id = ?", product.ID).Delete(owned).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Unscoped().Delete(models.Product{}, "id = ?", product.ID).Error
+		})
+		if err != nil {
+			return purged, err
+		}
+		if referenced {
+			continue
+		}
+
+		deleteProductImages(product)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// productReferenced reports whether another table still points at a product.
+func productReferenced(tx *gorm.DB, productID uint) (bool, error) {
+	for _, reference := range productReferences {
+		var count int64
+		if err := tx.Table(reference.table).Where(reference.column+" = ?", productID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // ProductUpdate is a function to update a product by product_id
 func ProductUpdate(response http.ResponseWriter, request *http.Request) {
 	productID := mux.Vars(request)["product_id"]
@@ -200,22 +631,131 @@ func ProductUpdate(response http.ResponseWriter, request *http.Request) {
 
 	if updateRequest.Cost != 0 {
 		updateMap["cost"] = updateRequest.Cost
-	} else if updateRequest.ProductName != "" {
-		updateMap["product_name"] = updateRequest.ProductName
+	}
+	if updateRequest.ProductName != "" {
+		// renaming a published product needs review, it keeps its name until then
+		if product.Status == models.ProductPublished {
+			updateMap["pending_product_name"] = updateRequest.ProductName
+		} else {
+			updateMap["product_name"] = updateRequest.ProductName
+		}
+	}
+	if updateRequest.AmountAvailable != nil {
+		if *updateRequest.AmountAvailable < 0 {
+			utils.GetError(errors.New("amount available cannot be negative"), http.StatusBadRequest, response)
+			return
+		}
+		if hasStockLots(product.ID) {
+			utils.GetError(errors.New("amount available of a product with stock lots is set by its lots"), http.StatusBadRequest, response)
+			return
+		}
+		updateMap["amount_available"] = *updateRequest.AmountAvailable
+	}
+	if updateRequest.ReorderThreshold != nil {
+		if *updateRequest.ReorderThreshold < 0 {
+			utils.GetError(errors.New("reorder threshold cannot be negative"), http.StatusBadRequest, response)
+			return
+		}
+		updateMap["reorder_threshold"] = *updateRequest.ReorderThreshold
+	}
+	if updateRequest.CategoryID != nil {
+		if *updateRequest.CategoryID == 0 {
+			updateMap["category_id"] = nil
+		} else {
+			var category models.Category
+			if tx := utils.GetItemByPrimaryKey(&category, *updateRequest.CategoryID); tx.RowsAffected < 1 {
+				utils.GetError(errors.New("category not found"), http.StatusBadRequest, response)
+				return
+			}
+			updateMap["category_id"] = *updateRequest.CategoryID
+		}
+	}
+
+	tags, err := normalizeTags(updateRequest.Tags)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
 	}
 
-	if len(updateMap) == 0 {
+	attributes, err := parseAttributes(updateRequest.Attributes)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if len(updateMap) == 0 && updateRequest.Tags == nil && updateRequest.Attributes == nil {
 		utils.GetError(errors.New("empty/invalid user input data"), http.StatusBadRequest, response)
 		return
 	}
 
-	result := utils.Db.Table("products").Where("id = ?", product.ID).Updates(updateMap)
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		if len(updateMap) > 0 {
+			if err := tx.Table("products").Where("id = ?", product.ID).Updates(updateMap).Error; err != nil {
+				return err
+			}
+		}
+		if updateRequest.Cost != 0 && updateRequest.Cost != product.Cost {
+			if err := recordPriceChange(tx, product.ID, updateRequest.Cost, user.ID); err != nil {
+				return err
+			}
+		}
+		if updateRequest.Tags != nil {
+			if err := saveProductTags(tx, product.ID, tags); err != nil {
+				return err
+			}
+		}
+		if updateRequest.Attributes != nil {
+			return saveProductAttributes(tx, product.ID, attributes)
+		}
+		return nil
+	})
 
-	if result.RowsAffected < 1 {
+	if err != nil {
 		utils.GetError(fmt.Errorf("product update failed"), http.StatusInternalServerError, response)
 		return
 	}
 
+	if _, ok := updateMap["product_name"]; ok {
+		productIndex.Put(product.ID, updateRequest.ProductName)
+	}
+
+	if updateRequest.AmountAvailable != nil || updateRequest.ReorderThreshold != nil {
+		checkStockLevels(product.ID)
+	}
+
 	utils.GetSuccess("product successfully updated", nil, response)
 
 }
+
+// requestError is an error together with the HTTP status it should be reported with.
+type requestError struct {
+	err    error
+	status int
+}
+
+// sellerProduct loads a product for the seller making the request, checking
+// that the user is a seller and owns the product.
+func sellerProduct(request *http.Request, productID string) (models.Product, *requestError) {
+	var product models.Product
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		return product, &requestError{fmt.Errorf("token Invalid"), http.StatusUnauthorized}
+	}
+
+	uintProductID, _ := strconv.ParseUint(productID, 10, 64)
+
+	if tx := utils.GetItemByPrimaryKey(&product, uint(uintProductID)); tx.RowsAffected < 1 {
+		return product, &requestError{fmt.Errorf("product not found"), http.StatusNotFound}
+	}
+
+	if strings.ToLower(user.Role) != "seller" {
+		return product, &requestError{fmt.Errorf("user is not a seller"), http.StatusNotAcceptable}
+	}
+
+	if user.ID != product.SellerId {
+		return product, &requestError{fmt.Errorf("user not authorized to update product"), http.StatusUnauthorized}
+	}
+
+	return product, nil
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestProductGetAll tests listing products with pagination, filters and sorting
+func TestProductGetAll(t *testing.T) {
+
+	t.Run("test no user token", func(t *testing.T) {
+		r := getRouter()
+		r.HandleFunc("/v1/products", ProductGetALL).Methods("GET")
+		req, _ := http.NewRequest("GET", "/v1/products", nil)
+
+		response := getHTTPResponse(t, r, req)
+
+		assertStatusCode(t, response.Code, http.StatusUnauthorized)
+		assertResponseMessage(t, parseResponse(response)["message"].(string), "token Invalid")
+	})
+
+	t.Run("test invalid limit", func(t *testing.T) {
+		r := getRouter()
+		r.HandleFunc("/v1/products", ProductGetALL).Methods("GET")
+		req, _ := http.NewRequest("GET", "/v1/products?limit=1000", nil)
+		req.Header.Add("Authorization", "Bearer "+TestToken)
+
+		response := getHTTPResponse(t, r, req)
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		assertResponseMessage(t, parseResponse(response)["message"].(string), "limit must be between 1 and 100")
+	})
+
+	t.Run("test invalid sort field", func(t *testing.T) {
+		r := getRouter()
+		r.HandleFunc("/v1/products", ProductGetALL).Methods("GET")
+		req, _ := http.NewRequest("GET", "/v1/products?sort=-password", nil)
+		req.Header.Add("Authorization", "Bearer "+TestToken)
+
+		response := getHTTPResponse(t, r, req)
+
+		assertStatusCode(t, response.Code, http.StatusBadRequest)
+		assertResponseMessage(t, parseResponse(response)["message"].(string), "invalid sort field: password")
+	})
+
+	t.Run("test empty result is not an error", func(t *testing.T) {
+		r := getRouter()
+		r.HandleFunc("/v1/products", ProductGetALL).Methods("GET")
+		req, _ := http.NewRequest("GET", "/v1/products?min_cost=100000", nil)
+		req.Header.Add("Authorization", "Bearer "+TestToken)
+
+		response := getHTTPResponse(t, r, req)
+		data := parseResponse(response)["data"].(map[string]interface{})
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		if products := data["products"].([]interface{}); len(products) != 0 {
+			t.Errorf("got %d products expected none", len(products))
+		}
+	})
+
+	t.Run("test paginated result", func(t *testing.T) {
+		r := getRouter()
+		r.HandleFunc("/v1/products", ProductGetALL).Methods("GET")
+		req, _ := http.NewRequest("GET", "/v1/products?limit=1&sort=-cost", nil)
+		req.Header.Add("Authorization", "Bearer "+TestToken)
+
+		response := getHTTPResponse(t, r, req)
+		data := parseResponse(response)["data"].(map[string]interface{})
+		meta := data["meta"].(map[string]interface{})
+
+		assertStatusCode(t, response.Code, http.StatusOK)
+		if products := data["products"].([]interface{}); len(products) != 1 {
+			t.Errorf("got %d products expected 1", len(products))
+		}
+		if meta["limit"].(float64) != 1 || meta["page"].(float64) != 1 {
+			t.Errorf("unexpected page metadata %v", meta)
+		}
+	})
+
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+)
+
+// PromotionCreate is a function to create a promotion on products owned by the seller
+func PromotionCreate(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "seller" {
+		utils.GetError(fmt.Errorf("user is not a seller"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	var promotion models.Promotion
+	if err := utils.ParseJSONFromRequest(request, &promotion); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if err := validatePromotion(promotion); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	productIDs := []uint{promotion.ProductID}
+	if promotion.Type == models.PromotionBundle {
+		productIDs = append(productIDs, promotion.BundleProductID)
+	}
+
+	for _, productID := range productIDs {
+		var product models.Product
+		if tx := utils.GetItemByPrimaryKey(&product, productID); tx.RowsAffected < 1 {
+			utils.GetError(fmt.Errorf("product %d not found", productID), http.StatusBadRequest, response)
+			return
+		}
+		if product.SellerId != user.ID {
+			utils.GetError(fmt.Errorf("user not authorized to promote product %d", productID), http.StatusUnauthorized, response)
+			return
+		}
+	}
+
+	promotion.ID = 0
+	promotion.SellerId = user.ID
+	promotion.Active = true
+
+	if res := utils.CreateItem(&promotion); res.RowsAffected < 1 {
+		utils.GetError(errors.New("error adding promotion"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("promotion added successfully", map[string]interface{}{"promotion_id": promotion.ID}, response)
+}
+
+// PromotionGetAll is a function to list promotions, optionally filtered by product_id, seller_id and active
+func PromotionGetAll(response http.ResponseWriter, request *http.Request) {
+	_, err := TokenValid(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	query := utils.Db.Order("id asc")
+
+	if productID := request.URL.Query().Get("product_id"); productID != "" {
+		value, err := strconv.ParseUint(productID, 10, 64)
+		if err != nil {
+			utils.GetError(errors.New("invalid product_id"), http.StatusBadRequest, response)
+			return
+		}
+		query = query.Where("product_id = ? OR bundle_product_id = ?", uint(value), uint(value))
+	}
+
+	if sellerID := request.URL.Query().Get("seller_id"); sellerID != "" {
+		value, err := strconv.ParseUint(sellerID, 10, 64)
+		if err != nil {
+			utils.GetError(errors.New("invalid seller_id"), http.StatusBadRequest, response)
+			return
+		}
+		query = query.Where("seller_id = ?", uint(value))
+	}
+
+	if active := request.URL.Query().Get("active"); active != "" {
+		value, err := strconv.ParseBool(active)
+		if err != nil {
+			utils.GetError(errors.New("invalid active"), http.StatusBadRequest, response)
+			return
+		}
+		now := time.Now().Unix()
+		if value {
+			query = query.Where("active = ? AND (starts_at = 0 OR starts_at <= ?) AND (ends_at = 0 OR ends_at > ?)", true, now, now)
+		} else {
+			query = query.Where("active = ? OR (starts_at <> 0 AND starts_at > ?) OR (ends_at <> 0 AND ends_at <= ?)", false, now, now)
+		}
+	}
+
+	promotions := []models.Promotion{}
+	if err := query.Find(&promotions).Error; err != nil {
+		utils.GetError(errors.New("error fetching promotions"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("promotions retreived successfully", promotions, response)
+}
+
+// PromotionUpdate is a function to rename, reschedule, enable or disable a promotion
+func PromotionUpdate(response http.ResponseWriter, request *http.Request) {
+	promotion, rerr := sellerPromotion(request)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var updateRequest models.PromotionUpdate
+	if err := utils.ParseJSONFromRequest(request, &updateRequest); err != nil {
+		utils.GetError(errors.New("bad update data"), http.StatusBadRequest, response)
+		return
+	}
+
+	updateMap := map[string]interface{}{}
+
+	if name := strings.TrimSpace(updateRequest.Name); name != "" {
+		updateMap["name"] = name
+		promotion.Name = name
+	}
+	if updateRequest.StartsAt != nil {
+		updateMap["starts_at"] = *updateRequest.StartsAt
+		promotion.StartsAt = *updateRequest.StartsAt
+	}
+	if updateRequest.EndsAt != nil {
+		updateMap["ends_at"] = *updateRequest.EndsAt
+		promotion.EndsAt = *updateRequest.EndsAt
+	}
+	if updateRequest.Active != nil {
+		updateMap["active"] = *updateRequest.Active
+	}
+
+	if len(updateMap) == 0 {
+		utils.GetError(errors.New("empty/invalid user input data"), http.StatusBadRequest, response)
+		return
+	}
+
+	if err := validatePromotion(promotion); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if result := utils.Db.Table("promotions").Where("id = ?", promotion.ID).Updates(updateMap); result.Error != nil {
+		utils.GetError(errors.New("promotion update failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("promotion successfully updated", nil, response)
+}
+
+// PromotionDelete is a function to delete a promotion
+func PromotionDelete(response http.ResponseWriter, request *http.Request) {
+	promotion, rerr := sellerPromotion(request)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	if result := utils.Db.Delete(models.Promotion{}, "id = ?", promotion.ID); result.RowsAffected < 1 {
+		utils.GetError(errors.New("promotion delete failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("promotion successfully deleted", nil, response)
+}
+
+// sellerPromotion loads the promotion in the request path for the seller who created it.
+func sellerPromotion(request *http.Request) (models.Promotion, *requestError) {
+	var promotion models.Promotion
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		return promotion, &requestError{fmt.Errorf("token Invalid"), http.StatusUnauthorized}
+	}
+
+	promotionID, _ := strconv.ParseUint(mux.Vars(request)["promotion_id"], 10, 64)
+
+	if tx := utils.GetItemByPrimaryKey(&promotion, uint(promotionID)); tx.RowsAffected < 1 {
+		return promotion, &requestError{errors.New("promotion not found"), http.StatusNotFound}
+	}
+
+	if promotion.SellerId != user.ID {
+		return promotion, &requestError{errors.New("user not authorized to update promotion"), http.StatusUnauthorized}
+	}
+
+	return promotion, nil
+}
+
+// validatePromotion checks that a promotion has the fields its type needs.
+func validatePromotion(promotion models.Promotion) error {
+	if strings.TrimSpace(promotion.Name) == "" {
+		return errors.New("promotion name is required")
+	}
+
+	if promotion.ProductID == 0 {
+		return errors.New("product_id is required")
+	}
+
+	switch promotion.Type {
+	case models.PromotionMultiBuy:
+		if promotion.BuyQuantity < 1 || promotion.FreeQuantity < 1 {
+			return errors.New("buy_quantity and free_quantity must be at least 1")
+		}
+	case models.PromotionPercentage:
+		if promotion.Percent < 1 || promotion.Percent > 100 {
+			return errors.New("percent must be between 1 and 100")
+		}
+	case models.PromotionBundle:
+		if promotion.BundleProductID == 0 {
+			return errors.New("bundle_product_id is required")
+		}
+		if promotion.BundlePrice < 1 {
+			return errors.New("bundle_price must be greater than zero")
+		}
+	default:
+		return errors.New("type must be one of multi_buy, percentage or bundle")
+	}
+
+	if promotion.EndsAt != 0 && promotion.EndsAt <= promotion.StartsAt {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	return nil
+}
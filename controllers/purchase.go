@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/femibiwoye/go-test/inventory"
+	"github.com/femibiwoye/go-test/loyalty"
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/pricing"
+	"github.com/femibiwoye/go-test/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxBuyItems = 20
+
+var (
+	errInsufficientFunds = errors.New("insufficient funds")
+	errOutOfStock        = errors.New("not enough stock available")
+)
+
+// purchaseLine is a product being bought and the unit price it is charged at.
+// slotCode is the machine slot the buyer picked it from, if any.
+type purchaseLine struct {
+	product   models.Product
+	quantity  int
+	unitPrice int
+	slotCode  string
+}
+
+func (l purchaseLine) subtotal() int {
+	return l.unitPrice * l.quantity
+}
+
+// buyItems returns the items of a buy request. A request without items buys
+// Quantity of ProductID.
+func buyItems(buyRequest models.BuyRequest) ([]models.BuyItem, error) {
+	items := buyRequest.Items
+	if len(items) == 0 {
+		items = []models.BuyItem{{ProductID: buyRequest.ProductID, VariantID: buyRequest.VariantID, SlotCode: buyRequest.SlotCode, Quantity: buyRequest.Quantity}}
+	}
+
+	if buyRequest.Points < 0 {
+		return nil, errors.New("points cannot be negative")
+	}
+
+	if len(items) > maxBuyItems {
+		return nil, fmt.Errorf("a purchase can have at most %d items", maxBuyItems)
+	}
+
+	for _, item := range items {
+		if item.Quantity < 1 {
+			return nil, errors.New("quantity must be greater than zero")
+		}
+		if item.SlotCode != "" && buyRequest.MachineID == 0 {
+			return nil, errors.New("slot_code can only be used with machine_id")
+		}
+	}
+
+	return items, nil
+}
+
+// loadPurchaseLines loads the products of items and the price each is charged at.
+// Only published products can be bought and products with variants are bought
+// through one of their variants.
+func loadPurchaseLines(items []models.BuyItem, at time.Time) ([]purchaseLine, *requestError) {
+	lines := make([]purchaseLine, 0, len(items))
+
+	for _, item := range items {
+		var product models.Product
+
+		tx := utils.Db.Where("id = ? AND status = ?", uint(item.ProductID), models.ProductPublished).Limit(1).Find(&product)
+		if tx.RowsAffected < 1 {
+			return nil, &requestError{fmt.Errorf("product not found"), http.StatusUnauthorized}
+		}
+
+		if item.VariantID != 0 {
+			tx := utils.Db.Where("id = ? AND parent_id = ? AND status = ?", uint(item.VariantID), product.ID, models.ProductPublished).Limit(1).Find(&product)
+			if tx.RowsAffected < 1 {
+				return nil, &requestError{fmt.Errorf("variant %d not found", item.VariantID), http.StatusBadRequest}
+			}
+		} else {
+			var variants int64
+			utils.Db.Model(&models.Product{}).Where("parent_id = ? AND status = ?", product.ID, models.ProductPublished).Count(&variants)
+			if variants > 0 {
+				return nil, &requestError{fmt.Errorf("product %d has variants, variant_id is required", product.ID), http.StatusBadRequest}
+			}
+		}
+
+		unitPrice, err := effectivePrice(utils.Db, product, at)
+		if err != nil {
+			return nil, &requestError{fmt.Errorf("purchase failed, try again latyer"), http.StatusInternalServerError}
+		}
+
+		lines = append(lines, purchaseLine{product: product, quantity: item.Quantity, unitPrice: unitPrice, slotCode: item.SlotCode})
+	}
+
+	return lines, nil
+}
+
+// purchaseDiscounts evaluates the promotions on the products of lines.
+func purchaseDiscounts(lines []purchaseLine, at time.Time) ([]models.AppliedDiscount, error) {
+	productIDs := make([]uint, 0, len(lines))
+	pricingLines := make([]pricing.Line, 0, len(lines))
+	for _, line := range lines {
+		pricingLine := pricing.Line{
+			ProductID: line.product.ID,
+			Quantity:  line.quantity,
+			UnitPrice: line.unitPrice,
+		}
+		// promotions on a parent product apply to its variants
+		productIDs = append(productIDs, line.product.ID)
+		if line.product.ParentID != nil {
+			pricingLine.ParentID = *line.product.ParentID
+			productIDs = append(productIDs, *line.product.ParentID)
+		}
+		pricingLines = append(pricingLines, pricingLine)
+	}
+
+	var promotions []models.Promotion
+	result := utils.Db.Where("active = ? AND product_id IN ?", true, productIDs).Find(&promotions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return pricing.ApplyPromotions(pricingLines, promotions, at.Unix()), nil
+}
+
+// debitDeposit takes amount from the deposit of a buyer. The balance check and the
+// update are a single statement so concurrent purchases cannot overdraw it.
+func debitDeposit(tx *gorm.DB, userID uint, amount int) error {
+	if amount == 0 {
+		return nil
+	}
+
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND deposit >= ?", userID, amount).
+		Update("deposit", gorm.Expr("deposit - ?", amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return errInsufficientFunds
+	}
+
+	return nil
+}
+
+// reserveStock takes the units of line out of stock. Products tracked in lots
+// are sold from their earliest expiring lots and the allocations are returned.
+// The lots of a product are its stock and amount_available is kept as their total,
+// so both are taken from here; a product only has untracked stock until its first lot.
+func reserveStock(tx *gorm.DB, line purchaseLine, at time.Time) ([]models.LotAllocation, error) {
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND amount_available >= ?", line.product.ID, line.quantity).
+		Update("amount_available", gorm.Expr("amount_available - ?", line.quantity))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected < 1 {
+		return nil, errOutOfStock
+	}
+
+	var lots []models.StockLot
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND remaining > 0", line.product.ID).
+		Find(&lots).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(lots) == 0 {
+		return nil, nil
+	}
+
+	allocations, err := inventory.Allocate(lots, line.quantity, at.Unix())
+	if err == inventory.ErrInsufficientStock {
+		return nil, errOutOfStock
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, allocation := range allocations {
+		err := tx.Model(&models.StockLot{}).
+			Where("id = ?", allocation.LotID).
+			Update("remaining", gorm.Expr("remaining - ?", allocation.Quantity)).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return allocations, nil
+}
+
+// completePurchase charges a buyer for lines inside tx. It applies the voucher and
+// loyalty points in the request, debits the deposit, takes the items out of stock,
+// records the order and credits the points it earns, updating buyResponse with the outcome.
+// Restrictions are checked again with the buyer locked.
+// A purchase from a machine is paid from the credit in the machine and its slots.
+func completePurchase(tx *gorm.DB, userID uint, buyRequest models.BuyRequest, lines []purchaseLine, rules []models.EarningRule, buyResponse *models.BuyResponse, at time.Time) error {
+	// the buyer stays locked until the order is recorded, so concurrent purchases
+	// count against each other's daily limits
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return err
+	}
+	restricted, err := checkRestrictions(tx, user, 0, lines, at)
+	if err != nil {
+		return err
+	}
+	if restricted != nil {
+		return restricted
+	}
+
+	if buyRequest.VoucherCode != "" {
+		voucher, err := lockVoucher(tx, buyRequest.VoucherCode, userID)
+		if err != nil {
+			return err
+		}
+
+		amount := voucherDiscount(voucher, buyResponse.AmountSpent)
+		if err := useVoucher(tx, voucher, userID, amount, models.VoucherModePurchase); err != nil {
+			return err
+		}
+
+		buyResponse.Voucher = &models.AppliedVoucher{Code: voucher.Code, Amount: amount}
+		buyResponse.AmountSpent -= amount
+	}
+
+	// never redeem more points than the purchase is worth
+	pointsRedeemed := buyRequest.Points
+	if max := buyResponse.AmountSpent / pointValue(); pointsRedeemed > max {
+		pointsRedeemed = max
+	}
+	buyResponse.PointsRedeemed = pointsRedeemed
+	buyResponse.AmountSpent -= pointsRedeemed * pointValue()
+
+	if buyRequest.MachineID != 0 {
+		err = debitMachineDeposit(tx, userID, buyRequest.MachineID, buyResponse.AmountSpent)
+	} else {
+		err = debitDeposit(tx, userID, buyResponse.AmountSpent)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := reserveLines(tx, buyRequest.MachineID, lines, buyResponse, at); err != nil {
+		return err
+	}
+
+	loyaltyLines := make([]loyalty.Line, 0, len(lines))
+	for _, line := range lines {
+		loyaltyLines = append(loyaltyLines, loyalty.Line{ProductID: line.product.ID, Spent: line.subtotal()})
+	}
+	buyResponse.PointsEarned = loyalty.PointsForOrder(rules, buyResponse.AmountSpent, loyaltyLines, at.Unix())
+
+	order := newOrder(userID, buyRequest.MachineID, lines, *buyResponse)
+	if err := recordOrder(tx, &order, buyResponse); err != nil {
+		return err
+	}
+
+	if pointsRedeemed > 0 {
+		if err := debitPoints(tx, userID, pointsRedeemed, &order.ID, models.PointsRedeemedPurchase); err != nil {
+			return err
+		}
+	}
+
+	return creditPoints(tx, userID, buyResponse.PointsEarned, &order.ID, models.PointsEarned)
+}
+
+// reserveLines takes the items of lines out of stock inside tx: out of the slots of
+// machineID, or out of central stock, oldest lot first, when machineID is 0. The lots
+// taken from are set on the items of buyResponse.
+func reserveLines(tx *gorm.DB, machineID uint, lines []purchaseLine, buyResponse *models.BuyResponse, at time.Time) error {
+	for i, line := range lines {
+		if machineID != 0 {
+			if err := reserveSlotStock(tx, machineID, line); err != nil {
+				return err
+			}
+			continue
+		}
+
+		allocations, err := reserveStock(tx, line, at)
+		if err != nil {
+			return err
+		}
+		buyResponse.Items[i].Lots = allocations
+	}
+
+	return nil
+}
+
+// recordOrder creates order inside tx with the lots its items were taken from, and
+// sets its id on buyResponse.
+func recordOrder(tx *gorm.DB, order *models.Order, buyResponse *models.BuyResponse) error {
+	if err := tx.Create(order).Error; err != nil {
+		return err
+	}
+	buyResponse.OrderID = order.ID
+
+	for _, item := range buyResponse.Items {
+		for _, allocation := range item.Lots {
+			orderLot := models.OrderLot{
+				OrderID:   order.ID,
+				ProductID: uint(item.ProductID),
+				LotID:     allocation.LotID,
+				Quantity:  allocation.Quantity,
+			}
+			if err := tx.Create(&orderLot).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// newOrder builds the order of a purchase of lines from buyResponse. machineID is
+// the machine it was bought from, 0 for none.
+func newOrder(userID, machineID uint, lines []purchaseLine, buyResponse models.BuyResponse) models.Order {
+	order := models.Order{
+		UserID:         userID,
+		Subtotal:       buyResponse.Subtotal,
+		Discount:       buyResponse.Subtotal - buyResponse.AmountSpent,
+		AmountPaid:     buyResponse.AmountSpent,
+		PointsRedeemed: buyResponse.PointsRedeemed,
+		PointsEarned:   buyResponse.PointsEarned,
+	}
+	if machineID != 0 {
+		order.MachineID = &machineID
+	}
+	if buyResponse.Voucher != nil {
+		order.VoucherCode = buyResponse.Voucher.Code
+	}
+	for _, line := range lines {
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID: line.product.ID,
+			Quantity:  line.quantity,
+			UnitPrice: line.unitPrice,
+			Subtotal:  line.subtotal(),
+		})
+	}
+
+	return order
+}
+
+// newBuyResponse itemises a completed purchase.
+func newBuyResponse(lines []purchaseLine, discounts []models.AppliedDiscount) models.BuyResponse {
+	buyResponse := models.BuyResponse{
+		Items:     make([]models.BuyResponseItem, 0, len(lines)),
+		Discounts: discounts,
+	}
+
+	for _, line := range lines {
+		item := models.BuyResponseItem{
+			ProductID: int(line.product.ID),
+			Quantity:  line.quantity,
+			UnitPrice: line.unitPrice,
+			Subtotal:  line.subtotal(),
+		}
+		if line.product.ParentID != nil {
+			item.ParentID = *line.product.ParentID
+		}
+		buyResponse.Items = append(buyResponse.Items, item)
+		buyResponse.Subtotal += line.subtotal()
+		buyResponse.QuantityPurchased += line.quantity
+	}
+
+	if len(lines) == 1 {
+		buyResponse.ProductID = int(lines[0].product.ID)
+	}
+
+	buyResponse.AmountSpent = buyResponse.Subtotal - pricing.TotalDiscount(discounts)
+
+	return buyResponse
+}
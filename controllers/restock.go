@@ -0,0 +1,533 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/femibiwoye/go-test/coins"
+	"github.com/femibiwoye/go-test/inventory"
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/routing"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errVisitNotFound  = errors.New("restock visit not found")
+	errVisitCompleted = errors.New("restock visit is already completed")
+	errCoinsShort     = errors.New("cannot collect more coins than the machine holds")
+)
+
+// MachinePickList is a function for operators to see what to take to a machine to restock it
+func MachinePickList(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	pickList, err := machinePickList(machine.ID)
+	if err != nil {
+		utils.GetError(errors.New("error building pick list"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("pick list retreived successfully", pickList, response)
+}
+
+// RestockVisitCreate is a function for operators to plan a visit to a machine. The visit
+// starts with the pick list of the machine.
+func RestockVisitCreate(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	pickList, err := machinePickList(machine.ID)
+	if err != nil {
+		utils.GetError(errors.New("error building pick list"), http.StatusInternalServerError, response)
+		return
+	}
+
+	visit := models.RestockVisit{
+		MachineID:  machine.ID,
+		OperatorID: user.ID,
+		Status:     models.VisitPlanned,
+		Items:      pickList.Items,
+	}
+	if err := utils.Db.Create(&visit).Error; err != nil {
+		utils.GetError(errors.New("error planning visit"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("restock visit planned", visit, response)
+}
+
+// RestockVisitGetAll is a function for operators to list restock visits, optionally
+// filtered by machine_id and status
+func RestockVisitGetAll(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	query := utils.Db.Model(&models.RestockVisit{})
+
+	params := request.URL.Query()
+	if machineID := params.Get("machine_id"); machineID != "" {
+		id, err := strconv.ParseUint(machineID, 10, 64)
+		if err != nil {
+			utils.GetError(errors.New("machine_id must be a number"), http.StatusBadRequest, response)
+			return
+		}
+		query = query.Where("machine_id = ?", id)
+	}
+	if status := params.Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	visits := []models.RestockVisit{}
+	if err := query.Order("id desc").Offset(pagination.Offset()).Limit(pagination.Limit).Find(&visits).Error; err != nil {
+		utils.GetError(errors.New("error fetching visits"), http.StatusInternalServerError, response)
+		return
+	}
+
+	for i := range visits {
+		visits[i].Coins = decodeTubes(visits[i].CoinsJSON)
+	}
+
+	respse := map[string]interface{}{
+		"visits": visits,
+		"meta":   models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("visits retreived successfully", respse, response)
+}
+
+// RestockVisitGet is a function for operators to get a restock visit and its items
+func RestockVisitGet(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	visit, err := loadVisit(utils.Db, mux.Vars(request)["visit_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	utils.GetSuccess("visit retreived successfully", visit, response)
+}
+
+// RestockVisitComplete is a function for operators to record a visit: the units loaded into
+// each slot and the coins collected. Slot stock, central stock and the coins in the machine are updated.
+func RestockVisitComplete(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	visit, err := loadVisit(utils.Db, mux.Vars(request)["visit_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	var completeRequest models.RestockCompleteRequest
+	if err := utils.ParseJSONFromRequest(request, &completeRequest); err != nil {
+		utils.GetError(errors.New("bad visit data"), http.StatusBadRequest, response)
+		return
+	}
+
+	loaded := map[string]int{}
+	for code, units := range completeRequest.Loaded {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if units < 0 {
+			utils.GetError(fmt.Errorf("slot %s: loaded units cannot be negative", code), http.StatusBadRequest, response)
+			return
+		}
+		if units > 0 {
+			loaded[code] += units
+		}
+	}
+
+	for denomination, count := range completeRequest.Coins {
+		if !Contains(denomination, possibleDepositAmounts) {
+			utils.GetError(fmt.Errorf("invalid coin denomination: %d", denomination), http.StatusBadRequest, response)
+			return
+		}
+		if count < 0 {
+			utils.GetError(errors.New("coin count cannot be negative"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	var slots []models.MachineSlot
+	if err := utils.Db.Where("machine_id = ?", visit.MachineID).Find(&slots).Error; err != nil {
+		utils.GetError(errors.New("error completing visit"), http.StatusInternalServerError, response)
+		return
+	}
+	slotsByCode := map[string]models.MachineSlot{}
+	for _, slot := range slots {
+		slotsByCode[slot.Code] = slot
+	}
+	for code := range loaded {
+		if _, ok := slotsByCode[code]; !ok {
+			utils.GetError(fmt.Errorf("machine has no slot %s", code), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		visit, err = completeVisit(tx, visit.ID, loaded, slotsByCode, completeRequest)
+		return err
+	})
+	if errors.Is(err, errVisitCompleted) {
+		utils.GetError(err, http.StatusConflict, response)
+		return
+	}
+	if errors.Is(err, errSlotOverCapacity) || errors.Is(err, errCoinsShort) || errors.Is(err, errOutOfStock) {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+	if err != nil {
+		utils.GetError(errors.New("error completing visit"), http.StatusInternalServerError, response)
+		return
+	}
+
+	if completed, err := loadVisit(utils.Db, fmt.Sprint(visit.ID)); err == nil {
+		visit = completed
+	}
+	checkSlotLevels(visit.MachineID)
+
+	productIDs := make([]uint, 0, len(loaded))
+	for code := range loaded {
+		productIDs = append(productIDs, slotsByCode[code].ProductID)
+	}
+	checkStockLevels(productIDs...)
+
+	utils.GetSuccess("restock visit completed", visit, response)
+}
+
+// RoutePlan is a function for operators to plan the order to visit the machines needing a
+// restock in. Sold out machines come first, then those mostly below par. The route starts
+// from the latitude and longitude in the query, when given, and goes nearest first.
+// Machines without coordinates are left out of the route and listed as unrouted.
+func RoutePlan(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	start, err := routeStart(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var machines []models.Machine
+	if err := utils.Db.Where("status <> ?", models.MachineInactive).Preload("Slots").Find(&machines).Error; err != nil {
+		utils.GetError(errors.New("error planning route"), http.StatusInternalServerError, response)
+		return
+	}
+
+	machinesByID := map[uint]models.Machine{}
+	units := map[uint]int{}
+	var stops []routing.Stop
+	unrouted := []models.RouteStop{}
+	for _, machine := range machines {
+		stocked, belowPar, empty := 0, 0, 0
+		for _, slot := range machine.Slots {
+			if slot.ProductID == 0 {
+				continue
+			}
+			stocked++
+			if need := inventory.Need(slot); need > 0 {
+				belowPar++
+				units[machine.ID] += need
+			}
+			if slot.Quantity == 0 {
+				empty++
+			}
+		}
+
+		priority := routing.SlotPriority(stocked, belowPar, empty)
+		if priority == 0 {
+			continue
+		}
+		// a machine with no coordinates would be routed to 0,0
+		if machine.Latitude == 0 && machine.Longitude == 0 {
+			unrouted = append(unrouted, models.RouteStop{
+				MachineID: machine.ID,
+				Name:      machine.Name,
+				Location:  machine.Location,
+				Priority:  priority.String(),
+				Units:     units[machine.ID],
+			})
+			continue
+		}
+		machinesByID[machine.ID] = machine
+		stops = append(stops, routing.Stop{
+			ID:       machine.ID,
+			Location: routing.Point{Latitude: machine.Latitude, Longitude: machine.Longitude},
+			Priority: priority,
+		})
+	}
+
+	legs := routing.Plan(start, stops)
+
+	plan := models.RoutePlan{Stops: []models.RouteStop{}, Distance: roundHundredths(routing.Total(legs)), Unrouted: unrouted}
+	for _, leg := range legs {
+		machine := machinesByID[leg.Stop.ID]
+		plan.Stops = append(plan.Stops, models.RouteStop{
+			MachineID: machine.ID,
+			Name:      machine.Name,
+			Location:  machine.Location,
+			Latitude:  machine.Latitude,
+			Longitude: machine.Longitude,
+			Priority:  leg.Stop.Priority.String(),
+			Units:     units[machine.ID],
+			Distance:  roundHundredths(leg.Distance),
+		})
+	}
+
+	utils.GetSuccess("route planned successfully", plan, response)
+}
+
+// machinePickList builds the pick list of a machine from the stock in its slots.
+func machinePickList(machineID uint) (models.PickList, error) {
+	pickList := models.PickList{MachineID: machineID}
+
+	var slots []models.MachineSlot
+	if err := utils.Db.Where("machine_id = ?", machineID).Find(&slots).Error; err != nil {
+		return pickList, err
+	}
+
+	pickList.Items = inventory.PickList(slots)
+	pickList.Products = inventory.PickTotals(pickList.Items)
+
+	productIDs := make([]uint, 0, len(pickList.Products))
+	for _, total := range pickList.Products {
+		productIDs = append(productIDs, total.ProductID)
+		pickList.Units += total.Units
+	}
+
+	names, err := productNames(productIDs)
+	if err != nil {
+		return pickList, err
+	}
+	for i := range pickList.Products {
+		pickList.Products[i].ProductName = names[pickList.Products[i].ProductID]
+	}
+
+	return pickList, nil
+}
+
+// loadVisit loads the restock visit with the id in the request path and its items.
+func loadVisit(db *gorm.DB, visitID string) (models.RestockVisit, error) {
+	var visit models.RestockVisit
+
+	uintVisitID, _ := strconv.ParseUint(visitID, 10, 64)
+	result := db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("slot_code asc")
+	}).Where("id = ?", uintVisitID).Limit(1).Find(&visit)
+	if result.RowsAffected < 1 {
+		return visit, errVisitNotFound
+	}
+
+	visit.Coins = decodeTubes(visit.CoinsJSON)
+	return visit, nil
+}
+
+// completeVisit loads the units in loaded into the slots of the machine visited, takes
+// the coins collected out of it and marks the visit completed. Loaded units leave
+// central stock, earliest expiring lots first, as they would for a sale.
+func completeVisit(tx *gorm.DB, visitID uint, loaded map[string]int, slots map[string]models.MachineSlot, completeRequest models.RestockCompleteRequest) (models.RestockVisit, error) {
+	var visit models.RestockVisit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&visit, visitID).Error; err != nil {
+		return visit, err
+	}
+	if visit.Status != models.VisitPlanned {
+		return visit, errVisitCompleted
+	}
+
+	items := map[string]int{}
+	for i, item := range visit.Items {
+		items[item.SlotCode] = i
+	}
+
+	now := time.Now()
+	totalLoaded := 0
+	for code, units := range loaded {
+		slot := slots[code]
+		result := tx.Model(&models.MachineSlot{}).
+			Where("machine_id = ? AND code = ? AND product_id = ? AND quantity + ? <= capacity", visit.MachineID, code, slot.ProductID, units).
+			Update("quantity", gorm.Expr("quantity + ?", units))
+		if result.Error != nil {
+			return visit, result.Error
+		}
+		if result.RowsAffected < 1 {
+			return visit, fmt.Errorf("slot %s: %w", code, errSlotOverCapacity)
+		}
+
+		line := purchaseLine{product: models.Product{ID: slot.ProductID}, quantity: units}
+		if _, err := reserveStock(tx, line, now); err != nil {
+			if err == errOutOfStock {
+				return visit, fmt.Errorf("slot %s: %w", code, errOutOfStock)
+			}
+			return visit, err
+		}
+
+		i, ok := items[code]
+		if !ok {
+			newItem := models.RestockItem{
+				VisitID:   visit.ID,
+				SlotCode:  code,
+				ProductID: slot.ProductID,
+				Quantity:  slot.Quantity,
+				ParLevel:  slot.ParLevel,
+				Capacity:  slot.Capacity,
+			}
+			if err := tx.Create(&newItem).Error; err != nil {
+				return visit, err
+			}
+			visit.Items = append(visit.Items, newItem)
+			i = len(visit.Items) - 1
+		}
+
+		visit.Items[i].Loaded = units
+		if err := tx.Model(&models.RestockItem{}).Where("id = ?", visit.Items[i].ID).Update("loaded", units).Error; err != nil {
+			return visit, err
+		}
+		totalLoaded += units
+	}
+
+	collected := map[int]int{}
+	for denomination, count := range completeRequest.Coins {
+		if count == 0 {
+			continue
+		}
+		result := tx.Model(&models.MachineCoin{}).
+			Where("machine_id = ? AND denomination = ? AND count >= ?", visit.MachineID, denomination, count).
+			Update("count", gorm.Expr("count - ?", count))
+		if result.Error != nil {
+			return visit, result.Error
+		}
+		if result.RowsAffected < 1 {
+			return visit, fmt.Errorf("%w: %d coins of %d", errCoinsShort, count, denomination)
+		}
+		collected[denomination] = count
+	}
+	coinsJSON, _ := json.Marshal(collected)
+
+	visit.Status = models.VisitCompleted
+	visit.Notes = strings.TrimSpace(completeRequest.Notes)
+	visit.Loaded = totalLoaded
+	visit.Coins = collected
+	visit.CoinsJSON = string(coinsJSON)
+	visit.CoinsTotal = coins.Total(collected)
+	visit.CompletedAt = now.Unix()
+
+	err := tx.Model(&models.RestockVisit{}).Where("id = ?", visit.ID).Updates(map[string]interface{}{
+		"status":       visit.Status,
+		"notes":        visit.Notes,
+		"loaded":       visit.Loaded,
+		"coins":        visit.CoinsJSON,
+		"coins_total":  visit.CoinsTotal,
+		"completed_at": visit.CompletedAt,
+	}).Error
+	return visit, err
+}
+
+// routeStart reads the optional start of a route from the latitude and longitude in the query.
+func routeStart(request *http.Request) (*routing.Point, error) {
+	params := request.URL.Query()
+	if params.Get("latitude") == "" && params.Get("longitude") == "" {
+		return nil, nil
+	}
+
+	latitude, err := strconv.ParseFloat(params.Get("latitude"), 64)
+	if err != nil {
+		return nil, errors.New("latitude and longitude must both be numbers")
+	}
+	longitude, err := strconv.ParseFloat(params.Get("longitude"), 64)
+	if err != nil {
+		return nil, errors.New("latitude and longitude must both be numbers")
+	}
+	if err := validateCoordinates(latitude, longitude); err != nil {
+		return nil, err
+	}
+
+	return &routing.Point{Latitude: latitude, Longitude: longitude}, nil
+}
+
+// roundHundredths rounds value to two decimal places, for distances in kilometres and demand in units.
+func roundHundredths(value float64) float64 {
+	return math.Round(value*100) / 100
+}
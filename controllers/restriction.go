@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const dateOfBirthLayout = "2006-01-02"
+
+// Error codes returned when a purchase breaks a product restriction
+const (
+	RestrictionAgeVerificationRequired = "age_verification_required"
+	RestrictionAgeRestricted           = "age_restricted"
+	RestrictionTimeRestricted          = "time_restricted"
+	RestrictionDailyLimitExceeded      = "daily_limit_exceeded"
+)
+
+// restrictionError is a purchase refused by a product restriction.
+type restrictionError struct {
+	code      string
+	productID uint
+	message   string
+}
+
+func (e *restrictionError) Error() string {
+	return e.message
+}
+
+// ProductRestrictionGet is a function to get the purchase restrictions of a product
+func ProductRestrictionGet(response http.ResponseWriter, request *http.Request) {
+	productID := mux.Vars(request)["product_id"]
+
+	_, err := TokenValid(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	uintProductID, _ := strconv.ParseUint(productID, 10, 64)
+
+	var restriction models.ProductRestriction
+	if tx := utils.GetItemsByField(&restriction, "product_id", uint(uintProductID)); tx.RowsAffected < 1 {
+		utils.GetError(errors.New("product has no restrictions"), http.StatusNotFound, response)
+		return
+	}
+
+	utils.GetSuccess("product restrictions retreived successfully", restriction, response)
+}
+
+// ProductRestrictionSet is a function for the seller of a product to set its purchase restrictions
+func ProductRestrictionSet(response http.ResponseWriter, request *http.Request) {
+	product, rerr := sellerProduct(request, mux.Vars(request)["product_id"])
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	var restriction models.ProductRestriction
+	if err := utils.ParseJSONFromRequest(request, &restriction); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if restriction.MinAge < 0 || restriction.DailyLimit < 0 {
+		utils.GetError(errors.New("min_age and daily_limit cannot be negative"), http.StatusBadRequest, response)
+		return
+	}
+
+	if (restriction.AllowedFrom == "") != (restriction.AllowedUntil == "") {
+		utils.GetError(errors.New("allowed_from and allowed_until must be set together"), http.StatusBadRequest, response)
+		return
+	}
+
+	if restriction.AllowedFrom != "" {
+		from, err := parseClockTime(restriction.AllowedFrom)
+		if err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+		until, err := parseClockTime(restriction.AllowedUntil)
+		if err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+		if from == until {
+			utils.GetError(errors.New("allowed_from and allowed_until cannot be the same"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	restriction.ProductID = product.ID
+
+	result := utils.Db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&restriction)
+	if result.Error != nil {
+		utils.GetError(errors.New("error saving product restrictions"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("product restrictions saved successfully", restriction, response)
+}
+
+// ProductRestrictionDelete is a function for the seller of a product to remove its purchase restrictions
+func ProductRestrictionDelete(response http.ResponseWriter, request *http.Request) {
+	product, rerr := sellerProduct(request, mux.Vars(request)["product_id"])
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	if result := utils.Db.Delete(models.ProductRestriction{}, "product_id = ?", product.ID); result.RowsAffected < 1 {
+		utils.GetError(errors.New("product has no restrictions"), http.StatusNotFound, response)
+		return
+	}
+
+	utils.GetSuccess("product restrictions successfully deleted", nil, response)
+}
+
+// UserVerifyDateOfBirth is a function for admins to mark the date of birth of a user as verified
+func UserVerifyDateOfBirth(response http.ResponseWriter, request *http.Request) {
+	userID := mux.Vars(request)["user_id"]
+
+	admin, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(admin.Role) != "admin" {
+		utils.GetError(fmt.Errorf("user is not an admin"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	uintUserID, _ := strconv.ParseUint(userID, 10, 64)
+
+	var user models.User
+	if tx := utils.GetItemByPrimaryKey(&user, uint(uintUserID)); tx.RowsAffected < 1 {
+		utils.GetError(ErrUserNotFound, http.StatusNotFound, response)
+		return
+	}
+
+	if user.DateOfBirth == "" {
+		utils.GetError(errors.New("user has no date of birth"), http.StatusBadRequest, response)
+		return
+	}
+
+	if result := utils.Db.Table("users").Where("id = ?", user.ID).Update("date_of_birth_verified", true); result.Error != nil {
+		utils.GetError(errors.New("date of birth verification failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("date of birth successfully verified", nil, response)
+}
+
+// checkRestrictions returns the first restriction broken by user buying lines at the given time.
+// A guest is passed as an empty user with the id of their session, whose purchases count
+// towards daily limits.
+// Variants without restrictions of their own follow the restrictions of their parent product,
+// and count towards its daily limit together.
+func checkRestrictions(db *gorm.DB, user models.User, guestSessionID uint, lines []purchaseLine, at time.Time) (*restrictionError, error) {
+	productIDs := make([]uint, 0, len(lines))
+	lookupIDs := make([]uint, 0, len(lines))
+	parents := map[uint]uint{}
+	quantities := map[uint]int{}
+	for _, line := range lines {
+		if _, ok := quantities[line.product.ID]; !ok {
+			productIDs = append(productIDs, line.product.ID)
+			lookupIDs = append(lookupIDs, line.product.ID)
+			if line.product.ParentID != nil {
+				parents[line.product.ID] = *line.product.ParentID
+				lookupIDs = append(lookupIDs, *line.product.ParentID)
+			}
+		}
+		quantities[line.product.ID] += line.quantity
+	}
+
+	var restrictions []models.ProductRestriction
+	if err := db.Where("product_id IN ?", lookupIDs).Find(&restrictions).Error; err != nil {
+		return nil, err
+	}
+
+	byProduct := map[uint]models.ProductRestriction{}
+	for _, restriction := range restrictions {
+		byProduct[restriction.ProductID] = restriction
+	}
+
+	for _, productID := range productIDs {
+		restriction, ok := byProduct[productID]
+		if !ok {
+			restriction, ok = byProduct[parents[productID]]
+		}
+		if !ok {
+			continue
+		}
+
+		if restriction.MinAge > 0 {
+			if user.DateOfBirth == "" || !user.DateOfBirthVerified {
+				return &restrictionError{RestrictionAgeVerificationRequired, productID, "a verified date of birth is required to buy this product"}, nil
+			}
+			born, err := parseDateOfBirth(user.DateOfBirth)
+			if err != nil {
+				return nil, err
+			}
+			if ageAt(born, at) < restriction.MinAge {
+				return &restrictionError{RestrictionAgeRestricted, productID, fmt.Sprintf("you must be at least %d to buy this product", restriction.MinAge)}, nil
+			}
+		}
+
+		if restriction.AllowedFrom != "" && !withinWindow(restriction.AllowedFrom, restriction.AllowedUntil, at) {
+			return &restrictionError{RestrictionTimeRestricted, productID, fmt.Sprintf("this product can only be bought between %s and %s", restriction.AllowedFrom, restriction.AllowedUntil)}, nil
+		}
+
+		if restriction.DailyLimit > 0 {
+			// a limit on a parent product covers its variants together
+			limited, err := restrictedProducts(db, restriction.ProductID)
+			if err != nil {
+				return nil, err
+			}
+			quantity := 0
+			for _, id := range limited {
+				quantity += quantities[id]
+			}
+
+			bought, err := boughtToday(db, user.ID, guestSessionID, limited, at)
+			if err != nil {
+				return nil, err
+			}
+			if bought+quantity > restriction.DailyLimit {
+				return &restrictionError{RestrictionDailyLimitExceeded, productID, fmt.Sprintf("you can buy at most %d of this product a day", restriction.DailyLimit)}, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// hasRestrictions reports whether a product, or the parent product of a variant, has
+// purchase restrictions.
+func hasRestrictions(product models.Product) (bool, error) {
+	productIDs := []uint{product.ID}
+	if product.ParentID != nil {
+		productIDs = append(productIDs, *product.ParentID)
+	}
+
+	var count int64
+	err := utils.Db.Model(&models.ProductRestriction{}).Where("product_id IN ?", productIDs).Count(&count).Error
+	return count > 0, err
+}
+
+// restrictedProducts returns the products a restriction applies to: its product and the
+// variants of it without restrictions of their own.
+func restrictedProducts(db *gorm.DB, productID uint) ([]uint, error) {
+	var variantIDs []uint
+	err := db.Unscoped().Model(&models.Product{}).
+		Where("parent_id = ? AND id NOT IN (?)", productID, db.Model(&models.ProductRestriction{}).Select("product_id")).
+		Pluck("id", &variantIDs).Error
+
+	return append([]uint{productID}, variantIDs...), err
+}
+
+// boughtToday counts the units of products a user has bought since local midnight. A
+// guest, with no user id, has only the purchases of their session to count.
+func boughtToday(db *gorm.DB, userID, guestSessionID uint, productIDs []uint, at time.Time) (int, error) {
+	if userID == 0 && guestSessionID == 0 {
+		return 0, nil
+	}
+
+	midnight := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+
+	query := db.Table("order_items").
+		Select("COALESCE(SUM(order_items.quantity), 0)").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("order_items.product_id IN ? AND orders.created_at >= ?", productIDs, midnight.Unix())
+	if userID != 0 {
+		query = query.Where("orders.user_id = ?", userID)
+	} else {
+		query = query.Where("orders.guest_session_id = ?", guestSessionID)
+	}
+
+	var bought int
+	err := query.Scan(&bought).Error
+	return bought, err
+}
+
+// parseDateOfBirth parses a YYYY-MM-DD date of birth, rejecting dates in the future.
+func parseDateOfBirth(value string) (time.Time, error) {
+	born, err := time.Parse(dateOfBirthLayout, value)
+	if err != nil {
+		return born, errors.New("date_of_birth must be in the format YYYY-MM-DD")
+	}
+	if born.After(time.Now()) {
+		return born, errors.New("date_of_birth cannot be in the future")
+	}
+	return born, nil
+}
+
+// ageAt is the age in whole years of someone born on born at the given time.
+func ageAt(born time.Time, at time.Time) int {
+	age := at.Year() - born.Year()
+	if at.Month() < born.Month() || (at.Month() == born.Month() && at.Day() < born.Day()) {
+		age--
+	}
+	return age
+}
+
+// parseClockTime parses an HH:MM time of day into minutes after midnight.
+func parseClockTime(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// withinWindow reports whether at falls in the daily window from-until. A
+// window ending before it starts wraps past midnight.
+func withinWindow(from, until string, at time.Time) bool {
+	start, err := parseClockTime(from)
+	if err != nil {
+		return false
+	}
+	end, err := parseClockTime(until)
+	if err != nil {
+		return false
+	}
+
+	now := at.Hour()*60 + at.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+)
+
+// TestAgeAt tests ages count whole years, turning over on the birthday
+func TestAgeAt(t *testing.T) {
+	born := time.Date(2006, time.March, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		at       time.Time
+		expected int
+	}{
+		{time.Date(2024, time.March, 14, 23, 0, 0, 0, time.UTC), 17},
+		{time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC), 18},
+		{time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC), 17},
+		{time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC), 18},
+	}
+
+	for _, test := range tests {
+		if got := ageAt(born, test.at); got != test.expected {
+			t.Errorf("age at %s: got %d expected %d", test.at.Format(dateOfBirthLayout), got, test.expected)
+		}
+	}
+
+	t.Run("test born on a leap day", func(t *testing.T) {
+		leap := time.Date(2004, time.February, 29, 0, 0, 0, 0, time.UTC)
+		if got := ageAt(leap, time.Date(2022, time.February, 28, 0, 0, 0, 0, time.UTC)); got != 17 {
+			t.Errorf("got %d expected 17", got)
+		}
+		if got := ageAt(leap, time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC)); got != 18 {
+			t.Errorf("got %d expected 18", got)
+		}
+	})
+}
+
+// TestWithinWindow tests daily time windows, including ones past midnight
+func TestWithinWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.June, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name        string
+		from, until string
+		at          time.Time
+		expected    bool
+	}{
+		{"inside", "09:00", "17:00", at(12, 0), true},
+		{"at the start", "09:00", "17:00", at(9, 0), true},
+		{"at the end", "09:00", "17:00", at(17, 0), false},
+		{"before", "09:00", "17:00", at(8, 59), false},
+		{"wraps, late evening", "22:00", "06:00", at(23, 30), true},
+		{"wraps, early morning", "22:00", "06:00", at(5, 59), true},
+		{"wraps, daytime", "22:00", "06:00", at(12, 0), false},
+		{"invalid from", "9am", "17:00", at(12, 0), false},
+		{"invalid until", "09:00", "25:00", at(12, 0), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := withinWindow(test.from, test.until, test.at); got != test.expected {
+				t.Errorf("got %v expected %v", got, test.expected)
+			}
+		})
+	}
+}
+
+// TestParseDateOfBirth tests dates of birth must be past YYYY-MM-DD dates
+func TestParseDateOfBirth(t *testing.T) {
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{"2000-01-31", ""},
+		{"31/01/2000", "date_of_birth must be in the format YYYY-MM-DD"},
+		{"2000-02-30", "date_of_birth must be in the format YYYY-MM-DD"},
+		{time.Now().AddDate(1, 0, 0).Format(dateOfBirthLayout), "date_of_birth cannot be in the future"},
+	}
+
+	for _, test := range tests {
+		_, err := parseDateOfBirth(test.value)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.value, err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: got error %v expected %q", test.value, err, test.err)
+		}
+	}
+}
+
+// TestCheckRestrictionsVariants tests variants share the daily limit of their parent product
+func TestCheckRestrictionsVariants(t *testing.T) {
+	var buyer, seller models.User
+	if result := utils.GetItemsByField(&buyer, "email", TestBuyerEmail); result.RowsAffected < 1 {
+		t.Fatal("buyer does not exist")
+	}
+	if result := utils.GetItemsByField(&seller, "email", TestsellerEmail); result.RowsAffected < 1 {
+		t.Fatal("seller does not exist")
+	}
+
+	parent := models.Product{Cost: 50, ProductName: "Limited test drink", SellerId: seller.ID}
+	if result := utils.CreateItem(&parent); result.RowsAffected < 1 {
+		t.Fatal("product not created")
+	}
+	variants := []models.Product{
+		{Cost: 50, ProductName: "Limited test drink", SellerId: seller.ID, ParentID: &parent.ID, VariantName: "Lemon"},
+		{Cost: 50, ProductName: "Limited test drink", SellerId: seller.ID, ParentID: &parent.ID, VariantName: "Lime"},
+	}
+	if result := utils.CreateItem(&variants); result.RowsAffected < 2 {
+		t.Fatal("variants not created")
+	}
+	if result := utils.CreateItem(&models.ProductRestriction{ProductID: parent.ID, DailyLimit: 2}); result.RowsAffected < 1 {
+		t.Fatal("restriction not created")
+	}
+
+	now := time.Now()
+	lemon, lime := variants[0], variants[1]
+
+	t.Run("test variants in one cart count together", func(t *testing.T) {
+		restricted, err := checkRestrictions(utils.Db, buyer, 0, []purchaseLine{{product: lemon, quantity: 1}, {product: lime, quantity: 2}}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restricted == nil || restricted.code != RestrictionDailyLimitExceeded {
+			t.Errorf("got %v expected the daily limit exceeded", restricted)
+		}
+
+		restricted, err = checkRestrictions(utils.Db, buyer, 0, []purchaseLine{{product: lemon, quantity: 1}, {product: lime, quantity: 1}}, now)
+		if err != nil || restricted != nil {
+			t.Errorf("got %v %v expected two variants within the limit", restricted, err)
+		}
+	})
+
+	t.Run("test earlier purchases of another variant count", func(t *testing.T) {
+		order := models.Order{
+			UserID:   buyer.ID,
+			Subtotal: 100,
+			Items:    []models.OrderItem{{ProductID: lemon.ID, Quantity: 2, UnitPrice: 50, Subtotal: 100}},
+		}
+		if result := utils.CreateItem(&order); result.RowsAffected < 1 {
+			t.Fatal("order not created")
+		}
+
+		restricted, err := checkRestrictions(utils.Db, buyer, 0, []purchaseLine{{product: lime, quantity: 1}}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restricted == nil || restricted.code != RestrictionDailyLimitExceeded || restricted.productID != lime.ID {
+			t.Errorf("got %v expected the daily limit exceeded for the lime variant", restricted)
+		}
+	})
+}
+
+// TestCheckRestrictionsGuests tests the purchases of a guest session count towards daily limits
+func TestCheckRestrictionsGuests(t *testing.T) {
+	var seller models.User
+	if result := utils.GetItemsByField(&seller, "email", TestsellerEmail); result.RowsAffected < 1 {
+		t.Fatal("seller does not exist")
+	}
+
+	product := models.Product{Cost: 50, ProductName: "Guest limited test drink", SellerId: seller.ID}
+	if result := utils.CreateItem(&product); result.RowsAffected < 1 {
+		t.Fatal("product not created")
+	}
+	if result := utils.CreateItem(&models.ProductRestriction{ProductID: product.ID, DailyLimit: 1}); result.RowsAffected < 1 {
+		t.Fatal("restriction not created")
+	}
+
+	sessions := []models.GuestSession{
+		{TokenHash: hashToken("vgs_limit_test_1"), Status: models.GuestSessionOpen},
+		{TokenHash: hashToken("vgs_limit_test_2"), Status: models.GuestSessionOpen},
+	}
+	if result := utils.CreateItem(&sessions); result.RowsAffected < 2 {
+		t.Fatal("guest sessions not created")
+	}
+
+	order := models.Order{
+		GuestSessionID: &sessions[0].ID,
+		Subtotal:       50,
+		Items:          []models.OrderItem{{ProductID: product.ID, Quantity: 1, UnitPrice: 50, Subtotal: 50}},
+	}
+	if result := utils.CreateItem(&order); result.RowsAffected < 1 {
+		t.Fatal("order not created")
+	}
+
+	lines := []purchaseLine{{product: product, quantity: 1}}
+	now := time.Now()
+
+	t.Run("test an earlier purchase in the session counts", func(t *testing.T) {
+		restricted, err := checkRestrictions(utils.Db, models.User{}, sessions[0].ID, lines, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restricted == nil || restricted.code != RestrictionDailyLimitExceeded {
+			t.Errorf("got %v expected the daily limit exceeded", restricted)
+		}
+	})
+
+	t.Run("test purchases of another session do not count", func(t *testing.T) {
+		restricted, err := checkRestrictions(utils.Db, models.User{}, sessions[1].ID, lines, now)
+		if err != nil || restricted != nil {
+			t.Errorf("got %v %v expected the purchase within the limit", restricted, err)
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Actions that move a product between review statuses
+const (
+	reviewSubmit  = "submit"
+	reviewApprove = "approve"
+	reviewReject  = "reject"
+)
+
+// productTransitions lists the status each action moves a product to, by the status it starts in.
+var productTransitions = map[string]map[string]string{
+	models.ProductDraft:         {reviewSubmit: models.ProductPendingReview},
+	models.ProductRejected:      {reviewSubmit: models.ProductPendingReview},
+	models.ProductPendingReview: {reviewApprove: models.ProductPublished, reviewReject: models.ProductRejected},
+}
+
+// nextProductStatus returns the status action moves a product in status to.
+func nextProductStatus(status, action string) (string, error) {
+	next, ok := productTransitions[status][action]
+	if !ok {
+		return "", fmt.Errorf("cannot %s a product that is %s", action, strings.Replace(status, "_", " ", -1))
+	}
+	return next, nil
+}
+
+// ProductSubmit is a function for the seller of a draft or rejected product to submit it for review
+func ProductSubmit(response http.ResponseWriter, request *http.Request) {
+	product, rerr := sellerProduct(request, mux.Vars(request)["product_id"])
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	status, err := nextProductStatus(product.Status, reviewSubmit)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	result := utils.Db.Model(&models.Product{}).
+		Where("id = ? AND status = ?", product.ID, product.Status).
+		Updates(map[string]interface{}{"status": status, "review_note": ""})
+	if result.Error != nil || result.RowsAffected < 1 {
+		utils.GetError(errors.New("product submit failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("product submitted for review", map[string]interface{}{"status": status}, response)
+}
+
+// ReviewQueue is a function for admins to list the products waiting for review, oldest first.
+// It includes new products and published products with a pending name change.
+func ReviewQueue(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "admin" {
+		utils.GetError(fmt.Errorf("user is not an admin"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	pending := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? OR pending_product_name <> ''", models.ProductPendingReview)
+	}
+
+	var total int64
+	if err := utils.Db.Model(&models.Product{}).Scopes(pending).Count(&total).Error; err != nil {
+		utils.GetError(errors.New("error fetching review queue"), http.StatusInternalServerError, response)
+		return
+	}
+
+	products := []models.Product{}
+	result := utils.Db.Scopes(pending).Order("id asc").Offset(pagination.Offset()).Limit(pagination.Limit).Find(&products)
+	if result.Error != nil {
+		utils.GetError(errors.New("error fetching review queue"), http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := loadProductDetails(products); err != nil {
+		utils.GetError(errors.New("error fetching review queue"), http.StatusInternalServerError, response)
+		return
+	}
+
+	productList := models.ProductList{
+		Products: products,
+		Meta:     models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("review queue retreived successfully", productList, response)
+}
+
+// ReviewDecide is a function for admins to approve or reject a product waiting for review.
+// For a published product this decides its pending name change.
+func ReviewDecide(response http.ResponseWriter, request *http.Request) {
+	productID := mux.Vars(request)["product_id"]
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "admin" {
+		utils.GetError(fmt.Errorf("user is not an admin"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	var decision models.ReviewDecision
+	if err := utils.ParseJSONFromRequest(request, &decision); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if err := validate.Struct(decision); err != nil {
+		utils.GetError(errors.New("decision must be approve or reject"), http.StatusBadRequest, response)
+		return
+	}
+
+	uintProductID, _ := strconv.ParseUint(productID, 10, 64)
+
+	var product models.Product
+	if tx := utils.GetItemByPrimaryKey(&product, uint(uintProductID)); tx.RowsAffected < 1 {
+		utils.GetError(errors.New("product not found"), http.StatusNotFound, response)
+		return
+	}
+
+	updateMap := map[string]interface{}{"review_note": strings.TrimSpace(decision.Note)}
+	name, status := product.ProductName, product.Status
+
+	if product.Status == models.ProductPublished {
+		if product.PendingProductName == "" {
+			utils.GetError(errors.New("product has no changes waiting for review"), http.StatusBadRequest, response)
+			return
+		}
+		if decision.Decision == reviewApprove {
+			name = product.PendingProductName
+			updateMap["product_name"] = name
+		}
+		updateMap["pending_product_name"] = ""
+	} else {
+		status, err = nextProductStatus(product.Status, decision.Decision)
+		if err != nil {
+			utils.GetError(err, http.StatusBadRequest, response)
+			return
+		}
+		updateMap["status"] = status
+	}
+
+	result := utils.Db.Model(&models.Product{}).
+		Where("id = ? AND status = ? AND pending_product_name = ?", product.ID, product.Status, product.PendingProductName).
+		Updates(updateMap)
+	if result.Error != nil || result.RowsAffected < 1 {
+		utils.GetError(errors.New("product review failed, try again"), http.StatusConflict, response)
+		return
+	}
+
+	productIndex.Put(product.ID, name)
+
+	respse := map[string]interface{}{
+		"product_id":   product.ID,
+		"product_name": name,
+		"status":       status,
+	}
+
+	utils.GetSuccess("product review saved", respse, response)
+}
+
+// visibleProducts limits a product query to what user may see: buyers see
+// published products, sellers also see their own and admins see everything.
+func visibleProducts(user models.User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch strings.ToLower(user.Role) {
+		case "admin":
+			return db
+		case "seller":
+			return db.Where("(status = ? OR seller_id = ?)", models.ProductPublished, user.ID)
+		default:
+			return db.Where("status = ?", models.ProductPublished)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+// TestNextProductStatus tests the review actions allowed from each product status
+func TestNextProductStatus(t *testing.T) {
+	tests := []struct {
+		status   string
+		action   string
+		expected string
+		err      string
+	}{
+		{models.ProductDraft, reviewSubmit, models.ProductPendingReview, ""},
+		{models.ProductRejected, reviewSubmit, models.ProductPendingReview, ""},
+		{models.ProductPendingReview, reviewApprove, models.ProductPublished, ""},
+		{models.ProductPendingReview, reviewReject, models.ProductRejected, ""},
+		{models.ProductDraft, reviewApprove, "", "cannot approve a product that is draft"},
+		{models.ProductPendingReview, reviewSubmit, "", "cannot submit a product that is pending review"},
+		{models.ProductPublished, reviewSubmit, "", "cannot submit a product that is published"},
+		{models.ProductPublished, reviewReject, "", "cannot reject a product that is published"},
+		{models.ProductRejected, reviewApprove, "", "cannot approve a product that is rejected"},
+		{"archived", reviewSubmit, "", "cannot submit a product that is archived"},
+	}
+
+	for _, test := range tests {
+		got, err := nextProductStatus(test.status, test.action)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s %s: got error %v expected %q", test.action, test.status, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: unexpected error %v", test.action, test.status, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("%s %s: got %q expected %q", test.action, test.status, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/search"
+	"github.com/femibiwoye/go-test/utils"
+)
+
+const defaultSearchLimit = 20
+
+// productIndex is the in-process search index over product names.
+var productIndex = search.NewIndex()
+
+// RebuildProductIndex loads all products into the search index. It is called on startup.
+func RebuildProductIndex() error {
+	var products []models.Product
+	if err := utils.Db.Select("id", "product_name").Find(&products).Error; err != nil {
+		return err
+	}
+
+	docs := make(map[uint]string, len(products))
+	for _, product := range products {
+		docs[product.ID] = product.ProductName
+	}
+	productIndex.Rebuild(docs)
+
+	return nil
+}
+
+// ProductSearch searches products by name. It accepts partial and misspelled
+// names and returns the products ordered by relevance.
+func ProductSearch(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	query := request.URL.Query().Get("q")
+	if query == "" {
+		utils.GetError(errors.New("search query is required"), http.StatusBadRequest, response)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := request.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > utils.MaxPageLimit {
+			utils.GetError(errors.New("limit must be between 1 and 100"), http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	// the index also holds products hidden from the user, so matches are checked a
+	// page at a time until limit products they can see are found
+	matches := productIndex.Search(query, 0)
+
+	var products []models.Product
+	var scores []float64
+	for start := 0; start < len(matches) && len(products) < limit; start += limit {
+		end := start + limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		page := matches[start:end]
+
+		ids := make([]uint, 0, len(page))
+		for _, match := range page {
+			ids = append(ids, match.ID)
+		}
+
+		var found []models.Product
+		if err := utils.Db.Scopes(visibleProducts(user)).Find(&found, ids).Error; err != nil {
+			utils.GetError(errors.New("error fetching products"), http.StatusInternalServerError, response)
+			return
+		}
+
+		byID := make(map[uint]models.Product, len(found))
+		for _, product := range found {
+			byID[product.ID] = product
+		}
+		for _, match := range page {
+			if product, ok := byID[match.ID]; ok && len(products) < limit {
+				products = append(products, product)
+				scores = append(scores, match.Score)
+			}
+		}
+	}
+
+	if err := loadProductDetails(products); err != nil {
+		utils.GetError(errors.New("error fetching products"), http.StatusInternalServerError, response)
+		return
+	}
+
+	results := make([]models.ProductSearchResult, 0, len(products))
+	for i, product := range products {
+		results = append(results, models.ProductSearchResult{Product: product, Score: scores[i]})
+	}
+
+	utils.GetSuccess("products retreived successfully", results, response)
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+)
+
+// TestProductSearch tests products hidden from the buyer do not use up the limit
+func TestProductSearch(t *testing.T) {
+	var seller models.User
+	if result := utils.GetItemsByField(&seller, "email", TestsellerEmail); result.RowsAffected < 1 {
+		t.Fatal("seller does not exist")
+	}
+
+	// hidden products are created first so they rank above the published one on ties
+	products := []models.Product{
+		{Cost: 50, ProductName: "Zorblax", SellerId: seller.ID, Status: models.ProductDraft},
+		{Cost: 50, ProductName: "Zorblax", SellerId: seller.ID, Status: models.ProductPendingReview},
+		{Cost: 50, ProductName: "Zorblax", SellerId: seller.ID, Status: models.ProductRejected},
+		{Cost: 50, ProductName: "Zorblax", SellerId: seller.ID, Status: models.ProductPublished},
+	}
+	if result := utils.CreateItem(&products); result.RowsAffected < int64(len(products)) {
+		t.Fatal("products not created")
+	}
+	for _, product := range products {
+		productIndex.Put(product.ID, product.ProductName)
+	}
+	published := products[len(products)-1]
+
+	search := func(token string) []interface{} {
+		t.Helper()
+		r := getRouter()
+		r.HandleFunc("/v1/products/search", ProductSearch).Methods("GET")
+		req, _ := http.NewRequest("GET", "/v1/products/search?q=zorblax&limit=2", nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+
+		response := getHTTPResponse(t, r, req)
+		assertStatusCode(t, response.Code, http.StatusOK)
+		return parseResponse(response)["data"].([]interface{})
+	}
+
+	t.Run("test a buyer finds the published product behind hidden matches", func(t *testing.T) {
+		results := search(TestToken)
+		if len(results) != 1 {
+			t.Fatalf("got %d results expected 1", len(results))
+		}
+		if id := uint(results[0].(map[string]interface{})["id"].(float64)); id != published.ID {
+			t.Errorf("got product %d expected %d", id, published.ID)
+		}
+	})
+
+	t.Run("test the seller sees their own products up to the limit", func(t *testing.T) {
+		if results := search(TestSToken); len(results) != 2 {
+			t.Errorf("got %d results expected 2", len(results))
+		}
+	})
+}
@@ -0,0 +1,445 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/offline"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxSyncBatch = 1000
+
+var errNoSigningKey = errors.New("machine has no signing key, issue one first")
+
+// MachineSigningKeyIssue is a function for operators to issue a machine the secret it signs
+// offline transactions with. Issuing a new secret replaces the previous one, so transactions
+// still queued on the machine must be synced first. The secret is only shown in this response.
+func MachineSigningKeyIssue(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		utils.GetError(errors.New("error issuing signing key"), http.StatusInternalServerError, response)
+		return
+	}
+
+	signingKey := models.MachineSigningKey{MachineID: machine.ID, Secret: hex.EncodeToString(buf)}
+	if err := utils.Db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&signingKey).Error; err != nil {
+		utils.GetError(errors.New("error issuing signing key"), http.StatusInternalServerError, response)
+		return
+	}
+
+	respse := map[string]interface{}{
+		"machine_id": machine.ID,
+		"secret":     signingKey.Secret,
+	}
+
+	utils.GetSuccess("signing key issued, store it now as it will not be shown again", respse, response)
+}
+
+// SyncSnapshot is a function for machines to fetch the state they sell against while
+// offline. Machines authenticate with the key in the X-Machine-Key header.
+func SyncSnapshot(response http.ResponseWriter, request *http.Request) {
+	machine, err := authenticateMachine(request)
+	if err != nil {
+		utils.GetError(err, http.StatusUnauthorized, response)
+		return
+	}
+
+	snapshot, err := machineSnapshot(machine.ID)
+	if err != nil {
+		utils.GetError(errors.New("error fetching snapshot"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("snapshot retreived successfully", snapshot, response)
+}
+
+// SyncTransactions is a function for machines to replay the transactions they made offline.
+// Transactions are applied once each, in the order the machine made them, at the price the
+// machine charged. Sales the server no longer has the stock or buyer credit for still stand
+// and are reported as adjusted. The response carries a fresh snapshot for the machine.
+func SyncTransactions(response http.ResponseWriter, request *http.Request) {
+	machine, err := authenticateMachine(request)
+	if err != nil {
+		utils.GetError(err, http.StatusUnauthorized, response)
+		return
+	}
+
+	var signingKey models.MachineSigningKey
+	if tx := utils.Db.Where("machine_id = ?", machine.ID).Limit(1).Find(&signingKey); tx.RowsAffected < 1 {
+		utils.GetError(errNoSigningKey, http.StatusConflict, response)
+		return
+	}
+
+	var syncRequest offline.SyncRequest
+	if err := utils.ParseJSONFromRequest(request, &syncRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if len(syncRequest.Transactions) > maxSyncBatch {
+		utils.GetError(fmt.Errorf("a sync can have at most %d transactions", maxSyncBatch), http.StatusBadRequest, response)
+		return
+	}
+
+	report := offline.SyncReport{Rejected: []offline.Rejection{}, Adjusted: []offline.Outcome{}, Processed: []uint64{}}
+
+	var transactions []offline.Transaction
+	seen := map[uint64]bool{}
+	for _, transaction := range syncRequest.Transactions {
+		if seen[transaction.Seq] {
+			report.Duplicates++
+			continue
+		}
+		seen[transaction.Seq] = true
+		report.Processed = append(report.Processed, transaction.Seq)
+
+		err := offline.Verify([]byte(signingKey.Secret), transaction)
+		if err == nil && transaction.MachineID != machine.ID {
+			err = errors.New("transaction is for another machine")
+		}
+		if err == nil {
+			err = offline.Validate(transaction, possibleDepositAmounts)
+		}
+		if err != nil {
+			report.Rejected = append(report.Rejected, offline.Rejection{Seq: transaction.Seq, Reason: err.Error()})
+			continue
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].Seq < transactions[j].Seq })
+	sort.Slice(report.Processed, func(i, j int) bool { return report.Processed[i] < report.Processed[j] })
+
+	if len(transactions) > 0 {
+		err = utils.Db.Transaction(func(tx *gorm.DB) error {
+			return applyOfflineTransactions(tx, machine.ID, transactions, &report)
+		})
+		if err != nil {
+			utils.GetError(errors.New("error syncing transactions"), http.StatusInternalServerError, response)
+			return
+		}
+		checkSlotLevels(machine.ID)
+	}
+
+	report.Snapshot, err = machineSnapshot(machine.ID)
+	if err != nil {
+		utils.GetError(errors.New("error fetching snapshot"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("transactions synced", report, response)
+}
+
+// MachineOfflineTransactions is a function for operators to list the transactions a machine
+// synced, optionally only those with a status of applied or adjusted
+func MachineOfflineTransactions(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	query := utils.Db.Model(&models.OfflineTransaction{}).Where("machine_id = ?", machine.ID)
+	if status := request.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	transactions := []models.OfflineTransaction{}
+	if err := query.Order("seq desc").Offset(pagination.Offset()).Limit(pagination.Limit).Find(&transactions).Error; err != nil {
+		utils.GetError(errors.New("error fetching transactions"), http.StatusInternalServerError, response)
+		return
+	}
+
+	respse := map[string]interface{}{
+		"transactions": transactions,
+		"meta":         models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("transactions retreived successfully", respse, response)
+}
+
+// applyOfflineTransactions applies the transactions of a machine not applied before, in
+// order, to its slots, coins and buyer credit, settling conflicts with offline.Apply.
+// Purchases are recorded as orders.
+func applyOfflineTransactions(tx *gorm.DB, machineID uint, transactions []offline.Transaction, report *offline.SyncReport) error {
+	seqs := make([]uint64, 0, len(transactions))
+	for _, transaction := range transactions {
+		seqs = append(seqs, transaction.Seq)
+	}
+
+	var applied []uint64
+	if err := tx.Model(&models.OfflineTransaction{}).Where("machine_id = ? AND seq IN ?", machineID, seqs).Pluck("seq", &applied).Error; err != nil {
+		return err
+	}
+	done := map[uint64]bool{}
+	for _, seq := range applied {
+		done[seq] = true
+	}
+
+	userIDs := []uint{}
+	for _, transaction := range transactions {
+		userIDs = append(userIDs, transaction.UserID)
+	}
+
+	var users []models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "deposit").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return err
+	}
+
+	var slots []models.MachineSlot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("machine_id = ?", machineID).Find(&slots).Error; err != nil {
+		return err
+	}
+
+	var deposits []models.MachineDeposit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("machine_id = ? AND user_id IN ?", machineID, userIDs).Find(&deposits).Error; err != nil {
+		return err
+	}
+
+	var machineCoins []models.MachineCoin
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("machine_id = ?", machineID).Find(&machineCoins).Error; err != nil {
+		return err
+	}
+
+	state := offline.NewState(offline.Snapshot{})
+	for _, user := range users {
+		state.Accounts[user.ID] = user.Deposit
+	}
+	for _, slot := range slots {
+		state.Slots[slot.Code] = offline.Slot{Code: slot.Code, ProductID: slot.ProductID, Quantity: slot.Quantity}
+	}
+	for _, deposit := range deposits {
+		state.Balances[deposit.UserID] = deposit.Amount
+	}
+	for _, coin := range machineCoins {
+		state.Coins[coin.Denomination] = coin.Count
+	}
+
+	for _, transaction := range transactions {
+		if done[transaction.Seq] {
+			report.Duplicates++
+			continue
+		}
+		if _, ok := state.Accounts[transaction.UserID]; !ok {
+			report.Rejected = append(report.Rejected, offline.Rejection{Seq: transaction.Seq, Reason: "user not found"})
+			continue
+		}
+
+		outcome := state.Apply(transaction)
+		report.Applied++
+		if outcome.Status != offline.Applied {
+			report.Adjusted = append(report.Adjusted, outcome)
+		}
+
+		record := models.OfflineTransaction{
+			MachineID:   machineID,
+			Seq:         transaction.Seq,
+			Kind:        string(transaction.Kind),
+			UserID:      transaction.UserID,
+			SlotCode:    transaction.SlotCode,
+			ProductID:   transaction.ProductID,
+			Quantity:    transaction.Quantity,
+			Price:       transaction.Price,
+			Amount:      transaction.Amount,
+			Status:      outcome.Status,
+			Short:       outcome.Short,
+			FromAccount: outcome.FromAccount,
+			Unpaid:      outcome.Unpaid,
+			RecordedAt:  transaction.At,
+		}
+		if len(transaction.Coins) > 0 {
+			coinsJSON, _ := json.Marshal(transaction.Coins)
+			record.CoinsJSON = string(coinsJSON)
+		}
+
+		if transaction.Kind == offline.Purchase {
+			// what could not be collected from the buyer is written off as a discount
+			order := models.Order{
+				UserID:     transaction.UserID,
+				MachineID:  &machineID,
+				Subtotal:   transaction.Amount,
+				Discount:   outcome.Unpaid,
+				AmountPaid: transaction.Amount - outcome.Unpaid,
+				CreatedAt:  transaction.At,
+				Items: []models.OrderItem{{
+					ProductID: transaction.ProductID,
+					Quantity:  transaction.Quantity,
+					UnitPrice: transaction.Price,
+					Subtotal:  transaction.Amount,
+				}},
+			}
+			if err := tx.Create(&order).Error; err != nil {
+				return err
+			}
+			record.OrderID = &order.ID
+		}
+
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, slot := range slots {
+		if quantity := state.Slots[slot.Code].Quantity; quantity != slot.Quantity {
+			if err := tx.Model(&models.MachineSlot{}).Where("id = ?", slot.ID).Update("quantity", quantity).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, user := range users {
+		if deposit := state.Accounts[user.ID]; deposit != user.Deposit {
+			if err := tx.Table("users").Where("id = ?", user.ID).Update("deposit", deposit).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	for userID, amount := range state.Balances {
+		deposit := models.MachineDeposit{UserID: userID, MachineID: machineID, Amount: amount}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&deposit).Error; err != nil {
+			return err
+		}
+	}
+
+	for denomination, count := range state.Coins {
+		coin := models.MachineCoin{MachineID: machineID, Denomination: denomination, Count: count}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&coin).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// machineSnapshot is the state of a machine for it to sell against offline: its slots
+// selling published products at their current prices, buyer credit and coins. Products
+// with purchase restrictions are left out, as the machine cannot check a buyer's age or
+// daily purchases while offline.
+func machineSnapshot(machineID uint) (offline.Snapshot, error) {
+	now := time.Now()
+	snapshot := offline.Snapshot{
+		MachineID:     machineID,
+		Slots:         []offline.Slot{},
+		Balances:      map[uint]int{},
+		Coins:         map[int]int{},
+		Denominations: possibleDepositAmounts,
+		TakenAt:       now.Unix(),
+	}
+
+	var slots []models.MachineSlot
+	if err := utils.Db.Where("machine_id = ? AND product_id <> 0", machineID).Order("code asc").Find(&slots).Error; err != nil {
+		return snapshot, err
+	}
+
+	prices := map[uint]int{}
+	for _, slot := range slots {
+		if _, ok := prices[slot.ProductID]; ok {
+			continue
+		}
+
+		var product models.Product
+		if tx := utils.Db.Where("id = ? AND status = ?", slot.ProductID, models.ProductPublished).Limit(1).Find(&product); tx.RowsAffected < 1 {
+			prices[slot.ProductID] = -1
+			continue
+		}
+
+		restricted, err := hasRestrictions(product)
+		if err != nil {
+			return snapshot, err
+		}
+		if restricted {
+			prices[slot.ProductID] = -1
+			continue
+		}
+
+		price, err := effectivePrice(utils.Db, product, now)
+		if err != nil {
+			return snapshot, err
+		}
+		prices[slot.ProductID] = price
+	}
+
+	for _, slot := range slots {
+		if prices[slot.ProductID] < 0 {
+			continue
+		}
+		snapshot.Slots = append(snapshot.Slots, offline.Slot{
+			Code:      slot.Code,
+			ProductID: slot.ProductID,
+			Price:     prices[slot.ProductID],
+			Quantity:  slot.Quantity,
+		})
+	}
+
+	var deposits []models.MachineDeposit
+	if err := utils.Db.Where("machine_id = ? AND amount > 0", machineID).Find(&deposits).Error; err != nil {
+		return snapshot, err
+	}
+	for _, deposit := range deposits {
+		snapshot.Balances[deposit.UserID] = deposit.Amount
+	}
+
+	var machineCoins []models.MachineCoin
+	if err := utils.Db.Where("machine_id = ?", machineID).Find(&machineCoins).Error; err != nil {
+		return snapshot, err
+	}
+	for _, coin := range machineCoins {
+		snapshot.Coins[coin.Denomination] = coin.Count
+	}
+
+	err := utils.Db.Model(&models.OfflineTransaction{}).
+		Where("machine_id = ?", machineID).
+		Select("COALESCE(MAX(seq), 0)").
+		Scan(&snapshot.LastSeq).Error
+	return snapshot, err
+}
@@ -0,0 +1,400 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	machineKeyHeader      = "X-Machine-Key"
+	maxTelemetryBatch     = 500
+	maxTelemetryClockSkew = 5 * time.Minute
+)
+
+var (
+	errMachineKeyInvalid = errors.New("machine key invalid")
+
+	telemetryKinds = map[string]bool{
+		models.TelemetryTemperature: true,
+		models.TelemetryDoorOpen:    true,
+		models.TelemetryDoorClosed:  true,
+		models.TelemetryJam:         true,
+		models.TelemetryCoinTubes:   true,
+	}
+)
+
+// MachineKeyIssue is a function for operators to issue a machine the API key it sends telemetry
+// with. Issuing a new key revokes the previous one. The key is only shown in this response.
+func MachineKeyIssue(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	key, err := generateMachineKey()
+	if err != nil {
+		utils.GetError(errors.New("error issuing machine key"), http.StatusInternalServerError, response)
+		return
+	}
+
+	machineKey := models.MachineKey{MachineID: machine.ID, KeyHash: hashToken(key), Prefix: key[:8]}
+	if err := utils.Db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&machineKey).Error; err != nil {
+		utils.GetError(errors.New("error issuing machine key"), http.StatusInternalServerError, response)
+		return
+	}
+
+	respse := map[string]interface{}{
+		"machine_id": machine.ID,
+		"key":        key,
+		"prefix":     machineKey.Prefix,
+	}
+
+	utils.GetSuccess("machine key issued, store it now as it will not be shown again", respse, response)
+}
+
+// TelemetryIngest is a function for machines to report a batch of telemetry events. Machines
+// authenticate with the key in the X-Machine-Key header. Valid events are stored and invalid
+// ones are listed in the response, so a machine only resends what was rejected. Jams, high
+// temperatures and an open door change the status of the machine.
+func TelemetryIngest(response http.ResponseWriter, request *http.Request) {
+	machine, err := authenticateMachine(request)
+	if err != nil {
+		utils.GetError(err, http.StatusUnauthorized, response)
+		return
+	}
+
+	var batch models.TelemetryBatch
+	if err := utils.ParseJSONFromRequest(request, &batch); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if len(batch.Events) == 0 {
+		utils.GetError(errors.New("events are required"), http.StatusBadRequest, response)
+		return
+	}
+
+	if len(batch.Events) > maxTelemetryBatch {
+		utils.GetError(fmt.Errorf("a batch can have at most %d events", maxTelemetryBatch), http.StatusBadRequest, response)
+		return
+	}
+
+	now := time.Now()
+	report := models.TelemetryReport{Rejected: []models.TelemetryEventError{}}
+
+	var events []models.TelemetryEvent
+	for i, event := range batch.Events {
+		if err := validateTelemetry(event, now); err != nil {
+			report.Rejected = append(report.Rejected, models.TelemetryEventError{Index: i, Reason: err.Error()})
+			continue
+		}
+
+		event.ID = 0
+		event.MachineID = machine.ID
+		event.ReceivedAt = 0
+		if event.Kind == models.TelemetryCoinTubes {
+			tubes, _ := json.Marshal(event.Tubes)
+			event.TubesJSON = string(tubes)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) > 0 {
+		if err := recordTelemetry(machine, events, now); err != nil {
+			utils.GetError(errors.New("error saving telemetry"), http.StatusInternalServerError, response)
+			return
+		}
+	}
+
+	report.Accepted = len(events)
+
+	utils.GetSuccess("telemetry received", report, response)
+}
+
+// MachineTelemetryHistory is a function for operators to page through the telemetry of a machine,
+// newest first, optionally filtered by kind and a from/to range of unix times.
+func MachineTelemetryHistory(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	query := utils.Db.Model(&models.TelemetryEvent{}).Where("machine_id = ?", machine.ID)
+
+	params := request.URL.Query()
+	if kind := params.Get("kind"); kind != "" {
+		if !telemetryKinds[kind] {
+			utils.GetError(fmt.Errorf("unknown telemetry kind %q", kind), http.StatusBadRequest, response)
+			return
+		}
+		query = query.Where("kind = ?", kind)
+	}
+	for param, condition := range map[string]string{"from": "recorded_at >= ?", "to": "recorded_at <= ?"} {
+		if value := params.Get(param); value != "" {
+			at, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				utils.GetError(fmt.Errorf("%s must be a unix time", param), http.StatusBadRequest, response)
+				return
+			}
+			query = query.Where(condition, at)
+		}
+	}
+
+	var total int64
+	query.Count(&total)
+
+	events := []models.TelemetryEvent{}
+	if err := query.Order("recorded_at desc, id desc").Offset(pagination.Offset()).Limit(pagination.Limit).Find(&events).Error; err != nil {
+		utils.GetError(errors.New("error fetching telemetry"), http.StatusInternalServerError, response)
+		return
+	}
+
+	for i := range events {
+		events[i].Tubes = decodeTubes(events[i].TubesJSON)
+	}
+
+	respse := map[string]interface{}{
+		"events": events,
+		"meta":   models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("telemetry retreived successfully", respse, response)
+}
+
+// MachineTelemetryLatest is a function for operators to get the latest reported state of a machine
+func MachineTelemetryLatest(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if !isOperator(user) {
+		utils.GetError(fmt.Errorf("user is not an operator"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	machine, err := loadMachine(mux.Vars(request)["machine_id"])
+	if err != nil {
+		utils.GetError(err, http.StatusNotFound, response)
+		return
+	}
+
+	var status models.MachineStatus
+	if tx := utils.Db.Where("machine_id = ?", machine.ID).Limit(1).Find(&status); tx.RowsAffected < 1 {
+		utils.GetError(errors.New("machine has not reported any telemetry"), http.StatusNotFound, response)
+		return
+	}
+	status.Tubes = decodeTubes(status.TubesJSON)
+
+	utils.GetSuccess("machine status retreived successfully", status, response)
+}
+
+// PurgeTelemetry deletes telemetry received longer ago than retention and returns how many events it deleted.
+func PurgeTelemetry(retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention).Unix()
+	result := utils.Db.Where("received_at < ?", cutoff).Delete(&models.TelemetryEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// authenticateMachine returns the machine the key in the request belongs to.
+func authenticateMachine(request *http.Request) (models.Machine, error) {
+	var machine models.Machine
+
+	key := request.Header.Get(machineKeyHeader)
+	if key == "" {
+		return machine, errMachineKeyInvalid
+	}
+
+	var machineKey models.MachineKey
+	if tx := utils.Db.Where("key_hash = ?", hashToken(key)).Limit(1).Find(&machineKey); tx.RowsAffected < 1 {
+		return machine, errMachineKeyInvalid
+	}
+
+	if tx := utils.GetItemByPrimaryKey(&machine, machineKey.MachineID); tx.RowsAffected < 1 {
+		return machine, errMachineKeyInvalid
+	}
+
+	return machine, nil
+}
+
+// generateMachineKey returns a random machine API key.
+func generateMachineKey() (string, error) {
+	return generateToken("vmk_")
+}
+
+// generateToken returns a random token starting with prefix.
+func generateToken(prefix string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(buf), nil
+}
+
+// hashToken hashes a machine key or guest session token for storage. Tokens are
+// random, so a plain SHA-256 is enough and lets them be looked up by their hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// recordTelemetry stores events of machine and applies them to its latest state and status.
+func recordTelemetry(machine models.Machine, events []models.TelemetryEvent, now time.Time) error {
+	var latest models.MachineStatus
+	err := utils.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(&events, 100).Error; err != nil {
+			return err
+		}
+		var err error
+		latest, err = updateMachineStatus(tx, machine.ID, events, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if rerr := applyTelemetryStatus(machine, events, latest); rerr != nil {
+		log.Printf("Error setting status of machine %d from telemetry: %v", machine.ID, rerr.err)
+	}
+	return nil
+}
+
+// validateTelemetry checks an event has the readings its kind needs.
+func validateTelemetry(event models.TelemetryEvent, now time.Time) error {
+	if !telemetryKinds[event.Kind] {
+		return fmt.Errorf("unknown kind %q", event.Kind)
+	}
+	if event.RecordedAt <= 0 {
+		return errors.New("recorded_at is required")
+	}
+	if event.RecordedAt > now.Add(maxTelemetryClockSkew).Unix() {
+		return errors.New("recorded_at is in the future")
+	}
+
+	switch event.Kind {
+	case models.TelemetryTemperature:
+		if event.Temperature == nil {
+			return errors.New("temperature is required")
+		}
+		if *event.Temperature < -50 || *event.Temperature > 100 {
+			return errors.New("temperature must be between -50 and 100")
+		}
+	case models.TelemetryJam:
+		if event.Slot == "" && event.Detail == "" {
+			return errors.New("a jam needs a slot or detail")
+		}
+	case models.TelemetryCoinTubes:
+		if len(event.Tubes) == 0 {
+			return errors.New("tubes are required")
+		}
+		for denomination, count := range event.Tubes {
+			if !Contains(denomination, possibleDepositAmounts) || count < 0 {
+				return fmt.Errorf("invalid tube %d: %d", denomination, count)
+			}
+		}
+	}
+
+	return nil
+}
+
+// updateMachineStatus applies events to the latest state of a machine. Each reading
+// only replaces one recorded earlier, so batches arriving out of order are safe. It
+// returns the state after the events.
+func updateMachineStatus(tx *gorm.DB, machineID uint, events []models.TelemetryEvent, now time.Time) (models.MachineStatus, error) {
+	var status models.MachineStatus
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("machine_id = ?", machineID).Limit(1).Find(&status)
+	if result.Error != nil {
+		return status, result.Error
+	}
+	status.MachineID = machineID
+	status.LastSeenAt = now.Unix()
+
+	for _, event := range events {
+		switch event.Kind {
+		case models.TelemetryTemperature:
+			if event.RecordedAt >= status.TemperatureAt {
+				status.Temperature, status.TemperatureAt = event.Temperature, event.RecordedAt
+			}
+		case models.TelemetryDoorOpen, models.TelemetryDoorClosed:
+			if event.RecordedAt >= status.DoorAt {
+				status.DoorOpen, status.DoorAt = event.Kind == models.TelemetryDoorOpen, event.RecordedAt
+			}
+		case models.TelemetryJam:
+			if event.RecordedAt >= status.JamAt {
+				status.LastJam, status.JamAt = jamDescription(event), event.RecordedAt
+			}
+		case models.TelemetryCoinTubes:
+			if event.RecordedAt >= status.TubesAt {
+				status.TubesJSON, status.TubesAt = event.TubesJSON, event.RecordedAt
+			}
+		}
+	}
+
+	return status, tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&status).Error
+}
+
+// jamDescription describes a jam by its slot and detail.
+func jamDescription(event models.TelemetryEvent) string {
+	switch {
+	case event.Slot == "":
+		return event.Detail
+	case event.Detail == "":
+		return event.Slot
+	}
+	return event.Slot + ": " + event.Detail
+}
+
+// decodeTubes decodes coin tube levels stored as JSON.
+func decodeTubes(value string) map[int]int {
+	if value == "" {
+		return nil
+	}
+	tubes := map[int]int{}
+	json.Unmarshal([]byte(value), &tubes)
+	return tubes
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"gorm.io/gorm"
+)
+
+// TestValidateTelemetry tests events are refused without the readings their kind needs
+func TestValidateTelemetry(t *testing.T) {
+	now := time.Now()
+	at := now.Add(-time.Minute).Unix()
+	temperature := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name  string
+		event models.TelemetryEvent
+		err   string
+	}{
+		{"temperature", models.TelemetryEvent{Kind: models.TelemetryTemperature, Temperature: temperature(4.5), RecordedAt: at}, ""},
+		{"door open", models.TelemetryEvent{Kind: models.TelemetryDoorOpen, RecordedAt: at}, ""},
+		{"jam in a slot", models.TelemetryEvent{Kind: models.TelemetryJam, Slot: "A1", RecordedAt: at}, ""},
+		{"coin tubes", models.TelemetryEvent{Kind: models.TelemetryCoinTubes, Tubes: map[int]int{5: 10, 100: 0}, RecordedAt: at}, ""},
+		{"within the clock skew", models.TelemetryEvent{Kind: models.TelemetryDoorClosed, RecordedAt: now.Add(maxTelemetryClockSkew).Unix()}, ""},
+		{"unknown kind", models.TelemetryEvent{Kind: "humidity", RecordedAt: at}, `unknown kind "humidity"`},
+		{"empty kind", models.TelemetryEvent{RecordedAt: at}, `unknown kind ""`},
+		{"no time", models.TelemetryEvent{Kind: models.TelemetryDoorOpen}, "recorded_at is required"},
+		{"in the future", models.TelemetryEvent{Kind: models.TelemetryDoorOpen, RecordedAt: now.Add(maxTelemetryClockSkew + time.Minute).Unix()}, "recorded_at is in the future"},
+		{"no temperature", models.TelemetryEvent{Kind: models.TelemetryTemperature, RecordedAt: at}, "temperature is required"},
+		{"too cold", models.TelemetryEvent{Kind: models.TelemetryTemperature, Temperature: temperature(-50.5), RecordedAt: at}, "temperature must be between -50 and 100"},
+		{"too hot", models.TelemetryEvent{Kind: models.TelemetryTemperature, Temperature: temperature(101), RecordedAt: at}, "temperature must be between -50 and 100"},
+		{"jam without a slot or detail", models.TelemetryEvent{Kind: models.TelemetryJam, RecordedAt: at}, "a jam needs a slot or detail"},
+		{"no tubes", models.TelemetryEvent{Kind: models.TelemetryCoinTubes, RecordedAt: at}, "tubes are required"},
+		{"unknown denomination", models.TelemetryEvent{Kind: models.TelemetryCoinTubes, Tubes: map[int]int{25: 3}, RecordedAt: at}, "invalid tube 25: 3"},
+		{"negative count", models.TelemetryEvent{Kind: models.TelemetryCoinTubes, Tubes: map[int]int{10: -1}, RecordedAt: at}, "invalid tube 10: -1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateTelemetry(test.event, now)
+			if test.err == "" && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Errorf("got error %v expected %q", err, test.err)
+			}
+		})
+	}
+}
+
+// TestUpdateMachineStatus tests readings only replace ones recorded earlier
+func TestUpdateMachineStatus(t *testing.T) {
+	machine := models.Machine{Name: "Telemetry test machine"}
+	if result := utils.CreateItem(&machine); result.RowsAffected < 1 {
+		t.Fatal("machine not created")
+	}
+
+	now := time.Now()
+	temperature := func(v float64) *float64 { return &v }
+
+	update := func(events ...models.TelemetryEvent) models.MachineStatus {
+		t.Helper()
+		var status models.MachineStatus
+		err := utils.Db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			status, err = updateMachineStatus(tx, machine.ID, events, now)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	status := update(
+		models.TelemetryEvent{Kind: models.TelemetryTemperature, Temperature: temperature(5), RecordedAt: 200},
+		models.TelemetryEvent{Kind: models.TelemetryTemperature, Temperature: temperature(3), RecordedAt: 100},
+		models.TelemetryEvent{Kind: models.TelemetryDoorOpen, RecordedAt: 150},
+		models.TelemetryEvent{Kind: models.TelemetryJam, Slot: "A1", Detail: "stuck", RecordedAt: 120},
+	)
+
+	t.Run("test the latest reading of a batch wins", func(t *testing.T) {
+		if status.Temperature == nil || *status.Temperature != 5 || status.TemperatureAt != 200 {
+			t.Errorf("got temperature %v at %d expected 5 at 200", status.Temperature, status.TemperatureAt)
+		}
+		if !status.DoorOpen || status.DoorAt != 150 {
+			t.Errorf("got door open %v at %d expected open at 150", status.DoorOpen, status.DoorAt)
+		}
+		if status.LastJam != "A1: stuck" || status.LastSeenAt != now.Unix() {
+			t.Errorf("got jam %q seen at %d", status.LastJam, status.LastSeenAt)
+		}
+	})
+
+	t.Run("test a late batch does not replace newer readings", func(t *testing.T) {
+		status := update(
+			models.TelemetryEvent{Kind: models.TelemetryTemperature, Temperature: temperature(9), RecordedAt: 180},
+			models.TelemetryEvent{Kind: models.TelemetryDoorClosed, RecordedAt: 140},
+			models.TelemetryEvent{Kind: models.TelemetryJam, Detail: "coin jam", RecordedAt: 110},
+		)
+		if *status.Temperature != 5 || status.DoorAt != 150 || !status.DoorOpen || status.LastJam != "A1: stuck" {
+			t.Errorf("got %+v expected the earlier readings kept", status)
+		}
+	})
+
+	t.Run("test a newer batch replaces the readings", func(t *testing.T) {
+		status := update(
+			models.TelemetryEvent{Kind: models.TelemetryDoorClosed, RecordedAt: 300},
+			models.TelemetryEvent{Kind: models.TelemetryTemperature, Temperature: temperature(4), RecordedAt: 300},
+		)
+		if status.DoorOpen || status.DoorAt != 300 || *status.Temperature != 4 {
+			t.Errorf("got %+v expected the door closed at 4 degrees", status)
+		}
+
+		var stored models.MachineStatus
+		utils.Db.Where("machine_id = ?", machine.ID).First(&stored)
+		if stored.DoorOpen || stored.DoorAt != 300 || stored.JamAt != 120 {
+			t.Errorf("got stored %+v expected the status saved", stored)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const maxVariantNameLength = 64
+
+// ProductVariantCreate is a function for the seller of a product to add a variant such as a size
+// or flavour. Each variant has its own cost and stock and shares the category and tags of its product.
+func ProductVariantCreate(response http.ResponseWriter, request *http.Request) {
+	parent, rerr := sellerProduct(request, mux.Vars(request)["product_id"])
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	if parent.ParentID != nil {
+		utils.GetError(errors.New("variants cannot have variants"), http.StatusBadRequest, response)
+		return
+	}
+
+	var variantRequest models.VariantRequest
+	if err := utils.ParseJSONFromRequest(request, &variantRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	variantName := strings.TrimSpace(variantRequest.VariantName)
+	if variantName == "" || len(variantName) > maxVariantNameLength {
+		utils.GetError(fmt.Errorf("variant_name is required and at most %d characters", maxVariantNameLength), http.StatusBadRequest, response)
+		return
+	}
+
+	if variantRequest.Cost < 1 {
+		utils.GetError(errors.New("cost must be greater than zero"), http.StatusBadRequest, response)
+		return
+	}
+
+	if variantRequest.AmountAvailable < 0 {
+		utils.GetError(errors.New("amount available cannot be negative"), http.StatusBadRequest, response)
+		return
+	}
+
+	if variantRequest.ReorderThreshold < 0 {
+		utils.GetError(errors.New("reorder threshold cannot be negative"), http.StatusBadRequest, response)
+		return
+	}
+
+	var existing int64
+	utils.Db.Model(&models.Product{}).Where("parent_id = ? AND variant_name = ?", parent.ID, variantName).Count(&existing)
+	if existing > 0 {
+		utils.GetError(fmt.Errorf("variant %s already exists", variantName), http.StatusBadRequest, response)
+		return
+	}
+
+	attributes, err := parseAttributes(variantRequest.Attributes)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var parentTags []models.ProductTag
+	if err := utils.Db.Where("product_id = ?", parent.ID).Find(&parentTags).Error; err != nil {
+		utils.GetError(errors.New("error adding variant"), http.StatusInternalServerError, response)
+		return
+	}
+	tags := make([]string, 0, len(parentTags))
+	for _, tag := range parentTags {
+		tags = append(tags, tag.Tag)
+	}
+
+	variant := models.Product{
+		ProductName:      parent.ProductName + " " + variantName,
+		VariantName:      variantName,
+		ParentID:         &parent.ID,
+		Cost:             variantRequest.Cost,
+		AmountAvailable:  variantRequest.AmountAvailable,
+		ReorderThreshold: variantRequest.ReorderThreshold,
+		CategoryID:       parent.CategoryID,
+		SellerId:         parent.SellerId,
+		Status:           models.ProductDraft,
+	}
+
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		return createProduct(tx, &variant, tags, attributes)
+	})
+	if err != nil {
+		utils.GetError(errors.New("error adding variant"), http.StatusInternalServerError, response)
+		return
+	}
+
+	productIndex.Put(variant.ID, variant.ProductName)
+
+	utils.GetSuccess("variant added successfully", map[string]interface{}{"product_id": parent.ID, "variant_id": variant.ID}, response)
+}
+
+// ProductVariantGetAll is a function to list the variants of a product
+func ProductVariantGetAll(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	uintProductID, _ := strconv.ParseUint(mux.Vars(request)["product_id"], 10, 64)
+
+	var parent models.Product
+	if tx := utils.Db.Scopes(visibleProducts(user)).Where("id = ?", uint(uintProductID)).Limit(1).Find(&parent); tx.RowsAffected < 1 {
+		utils.GetError(errors.New("product not found"), http.StatusNotFound, response)
+		return
+	}
+
+	products := []models.Product{parent}
+	if err := loadVariants(products, user); err != nil {
+		utils.GetError(errors.New("error fetching variants"), http.StatusInternalServerError, response)
+		return
+	}
+
+	variants := products[0].Variants
+	if variants == nil {
+		variants = []models.Product{}
+	}
+
+	utils.GetSuccess("variants retreived successfully", variants, response)
+}
+
+// loadVariants sets the variants of products that viewer may see, with their details,
+// so listings show each product once with its sizes or flavours grouped under it.
+func loadVariants(products []models.Product, viewer models.User) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+
+	var variants []models.Product
+	if err := utils.Db.Scopes(visibleProducts(viewer)).Where("parent_id IN ?", ids).Order("id asc").Find(&variants).Error; err != nil {
+		return err
+	}
+	if err := loadProductDetails(variants); err != nil {
+		return err
+	}
+
+	byParent := map[uint][]models.Product{}
+	for _, variant := range variants {
+		byParent[*variant.ParentID] = append(byParent[*variant.ParentID], variant)
+	}
+
+	for i := range products {
+		products[i].Variants = byParent[products[i].ID]
+	}
+
+	return nil
+}
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	hardware "github.com/femibiwoye/go-test/machine"
 	"github.com/femibiwoye/go-test/models"
 	"github.com/femibiwoye/go-test/utils"
+	"gorm.io/gorm"
 )
 
 var (
@@ -16,6 +19,8 @@ var (
 )
 
 // Deposit handles the deposit request. It checks if the user has enough money to buy the product.
+// At a machine with a coin mechanism the coins the mechanism accepted are credited, once the
+// machine has opened it for the buyer.
 func Deposit(response http.ResponseWriter, request *http.Request) {
 	userID, err := TokenValid(request)
 	if err != nil {
@@ -37,6 +42,49 @@ func Deposit(response http.ResponseWriter, request *http.Request) {
 	var depositRequest models.DepositRequest
 	utils.ParseJSONFromRequest(request, &depositRequest)
 
+	if depositRequest.MachineID != 0 {
+		machine, rerr := activeMachine(depositRequest.MachineID)
+		if rerr != nil {
+			utils.GetError(rerr.err, rerr.status, response)
+			return
+		}
+
+		coins, acceptor, rerr := insertedCoins(machine.ID, userSession(user.ID), depositRequest.Amount)
+		if rerr != nil {
+			utils.GetError(rerr.err, rerr.status, response)
+			return
+		}
+
+		if rerr := fireMachine(machine, userSession(user.ID), hardware.EventCoin); rerr != nil {
+			if acceptor != nil {
+				acceptor.Return(coins)
+			}
+			utils.GetError(rerr.err, rerr.status, response)
+			return
+		}
+
+		var balance int
+		err := utils.Db.Transaction(func(tx *gorm.DB) error {
+			for _, coin := range coins {
+				var err error
+				if balance, err = depositIntoMachine(tx, user.ID, machine.ID, coin); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if acceptor != nil {
+				acceptor.Return(coins)
+			}
+			utils.GetError(fmt.Errorf("deposit failed"), http.StatusInternalServerError, response)
+			return
+		}
+
+		utils.GetSuccess("deposit successful", map[string]interface{}{"machine_id": machine.ID, "coins": coins, "deposit": balance}, response)
+		return
+	}
+
 	if !Contains(depositRequest.Amount, possibleDepositAmounts) {
 		utils.GetError(errors.New("you can only deposit, 5, 10, 20, 50, 100 coins"), http.StatusBadRequest, response)
 		return
@@ -55,7 +103,10 @@ func Deposit(response http.ResponseWriter, request *http.Request) {
 	utils.GetSuccess("deposit successful", nil, response)
 }
 
-// DepositReset handles the reset request.
+// DepositReset handles the reset request. With a machine_id the credit in that machine
+// is paid out in coins from the machine, fewest coins first, and its coin mechanism is
+// closed to the buyer. A machine that is not in
+// service cannot pay out, so the credit is refunded to the account deposit instead.
 func DepositReset(response http.ResponseWriter, request *http.Request) {
 	userID, err := TokenValid(request)
 	if err != nil {
@@ -78,6 +129,59 @@ func DepositReset(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	var resetRequest models.ResetRequest
+	utils.ParseJSONFromRequest(request, &resetRequest)
+
+	if resetRequest.MachineID != 0 {
+		var machine models.Machine
+		if tx := utils.GetItemByPrimaryKey(&machine, resetRequest.MachineID); tx.RowsAffected < 1 {
+			utils.GetError(errMachineNotFound, http.StatusNotFound, response)
+			return
+		}
+
+		if machine.Status != models.MachineActive {
+			reset := models.ResetResponse{MachineID: machine.ID, Coins: map[int]int{}}
+			err := utils.Db.Transaction(func(tx *gorm.DB) error {
+				refunds, err := refundMachineCredit(tx, machine.ID, user.ID)
+				for _, refund := range refunds {
+					reset.Refunded += refund.Amount
+				}
+				return err
+			})
+			if err != nil {
+				utils.GetError(fmt.Errorf("reset failed"), http.StatusInternalServerError, response)
+				return
+			}
+
+			utils.GetSuccess("Reset successful, machine credit refunded to your deposit", reset, response)
+			return
+		}
+
+		if rerr := fireMachine(machine, userSession(user.ID), hardware.EventCancel); rerr != nil {
+			utils.GetError(rerr.err, rerr.status, response)
+			return
+		}
+
+		var reset models.ResetResponse
+		err := utils.Db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			reset, err = returnChange(tx, user.ID, machine.ID)
+			return err
+		})
+		if err == nil {
+			reset, err = payOutChange(machine, user.ID, reset)
+		}
+		settleMachine(machine, userSession(user.ID), hardware.EventChangeDispensed)
+		closeCoinSession(machine.ID, userSession(user.ID))
+		if err != nil {
+			utils.GetError(fmt.Errorf("reset failed"), http.StatusInternalServerError, response)
+			return
+		}
+
+		utils.GetSuccess("Reset successful", reset, response)
+		return
+	}
+
 	updateMap := map[string]interface{}{}
 	updateMap["deposit"] = 0
 
@@ -92,8 +196,10 @@ func DepositReset(response http.ResponseWriter, request *http.Request) {
 }
 
 // BuyProduct handles the buy product request. It checks if the user has enough money to buy the product.
-// TODO: add validation
-// TODO: add transaction
+// Seller promotions, an optional voucher code and loyalty points are applied to the purchase and itemised
+// in the response. The purchase is recorded as an order and earns loyalty points. Products with age,
+// time of day or daily limit restrictions are refused with a restriction code. With a machine_id the
+// purchase is paid from the credit in that machine and taken from its slots, and items can be picked by slot code.
 func BuyProduct(response http.ResponseWriter, request *http.Request) {
 	userID, err := TokenValid(request)
 	if err != nil {
@@ -115,38 +221,130 @@ func BuyProduct(response http.ResponseWriter, request *http.Request) {
 	var buyRequest models.BuyRequest
 	utils.ParseJSONFromRequest(request, &buyRequest)
 
-	var product models.Product
+	items, err := buyItems(buyRequest)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var machine models.Machine
+	if buyRequest.MachineID != 0 {
+		var rerr *requestError
+		if machine, rerr = activeMachine(buyRequest.MachineID); rerr != nil {
+			utils.GetError(rerr.err, rerr.status, response)
+			return
+		}
 
-	tx := utils.GetItemByPrimaryKey(&product, uint(buyRequest.ProductID))
-	if tx.RowsAffected < 1 {
-		utils.GetError(fmt.Errorf("product not found"), http.StatusUnauthorized, response)
+		if items, rerr = resolveSlotItems(buyRequest.MachineID, items); rerr != nil {
+			utils.GetError(rerr.err, rerr.status, response)
+			return
+		}
+	}
+
+	now := time.Now()
+
+	lines, rerr := loadPurchaseLines(items, now)
+	if rerr != nil {
+		utils.GetError(rerr.err, rerr.status, response)
+		return
+	}
+
+	restricted, err := checkRestrictions(utils.Db, user, 0, lines, now)
+	if err != nil {
+		utils.GetError(fmt.Errorf("purchase failed, try again latyer"), http.StatusInternalServerError, response)
+		return
+	}
+	if restricted != nil {
+		data := map[string]interface{}{"code": restricted.code, "product_id": restricted.productID}
+		utils.GetDetailedError(restricted.message, http.StatusForbidden, data, response)
 		return
 	}
 
-	totalCost := product.Cost * buyRequest.Quantity
+	discounts, err := purchaseDiscounts(lines, now)
+	if err != nil {
+		utils.GetError(fmt.Errorf("purchase failed, try again latyer"), http.StatusInternalServerError, response)
+		return
+	}
 
-	if totalCost > user.Deposit {
-		utils.GetError(fmt.Errorf("insufficient funds"), http.StatusNotAcceptable, response)
+	var rules []models.EarningRule
+	if err := utils.Db.Where("active = ?", true).Find(&rules).Error; err != nil {
+		utils.GetError(fmt.Errorf("purchase failed, try again latyer"), http.StatusInternalServerError, response)
 		return
 	}
 
-	newBalance := user.Deposit - totalCost
+	buyResponse := newBuyResponse(lines, discounts)
+	buyResponse.MachineID = buyRequest.MachineID
 
-	updateMap := map[string]interface{}{}
-	updateMap["deposit"] = newBalance
+	if machine.ID != 0 {
+		if rerr := fireMachine(machine, userSession(user.ID), hardware.EventSelect); rerr != nil {
+			utils.GetError(rerr.err, rerr.status, response)
+			return
+		}
+	}
 
-	result := utils.Db.Table("users").Where("id = ?", uint(uintID)).Updates(updateMap)
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		if err := completePurchase(tx, user.ID, buyRequest, lines, rules, &buyResponse, now); err != nil {
+			return err
+		}
 
-	if result.RowsAffected < 1 {
+		if buyRequest.MachineID != 0 {
+			credit, err := machineCredit(tx, user.ID, buyRequest.MachineID)
+			user.Deposit = credit
+			return err
+		}
+
+		return tx.Select("deposit").First(&user, user.ID).Error
+	})
+
+	// the machine goes back to taking coins, or to idle once the buyer has spent their credit
+	if machine.ID != 0 {
+		switch {
+		case err != nil:
+			settleMachine(machine, userSession(user.ID), hardware.EventVendAborted)
+		case user.Deposit == 0:
+			settleMachine(machine, userSession(user.ID), hardware.EventVended, hardware.EventSessionEnd)
+		default:
+			settleMachine(machine, userSession(user.ID), hardware.EventVended)
+		}
+	}
+
+	var restrictedErr *restrictionError
+	if errors.As(err, &restrictedErr) {
+		data := map[string]interface{}{"code": restrictedErr.code, "product_id": restrictedErr.productID}
+		utils.GetDetailedError(restrictedErr.message, http.StatusForbidden, data, response)
+		return
+	}
+	if err == errInsufficientFunds {
+		utils.GetError(fmt.Errorf("insufficient funds"), http.StatusNotAcceptable, response)
+		return
+	}
+	if err == errOutOfStock {
+		utils.GetError(err, http.StatusNotAcceptable, response)
+		return
+	}
+	if err == errInsufficientPoints {
+		utils.GetError(err, http.StatusNotAcceptable, response)
+		return
+	}
+	if isVoucherError(err) {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+	if err != nil {
 		utils.GetError(fmt.Errorf("purchase failed, try again latyer"), http.StatusInternalServerError, response)
 		return
 	}
 
-	buyResponse := models.BuyResponse{
-		ProductID:         buyRequest.ProductID,
-		QuantityPurchased: buyRequest.Quantity,
-		AmountSpent:       totalCost,
-		Change:            newBalance,
+	buyResponse.Change = user.Deposit
+
+	productIDs := make([]uint, 0, len(lines))
+	for _, line := range lines {
+		productIDs = append(productIDs, line.product.ID)
+	}
+	if machine.ID != 0 {
+		checkSlotLevels(machine.ID, productIDs...)
+	} else {
+		checkStockLevels(productIDs...)
 	}
 
 	utils.GetSuccess("purchase successful", buyResponse, response)
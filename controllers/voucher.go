@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/femibiwoye/go-test/models"
+	"github.com/femibiwoye/go-test/utils"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errVoucherNotFound  = errors.New("voucher not found")
+	errVoucherExpired   = errors.New("voucher has expired")
+	errVoucherUsedUp    = errors.New("voucher has been fully redeemed")
+	errVoucherUserLimit = errors.New("you have reached the redemption limit for this voucher")
+	errVoucherNotCredit = errors.New("only fixed value vouchers can be redeemed into credit")
+)
+
+// isVoucherError reports whether err should be shown to the buyer as a bad request.
+func isVoucherError(err error) bool {
+	switch err {
+	case errVoucherNotFound, errVoucherExpired, errVoucherUsedUp, errVoucherUserLimit, errVoucherNotCredit:
+		return true
+	}
+	return false
+}
+
+// VoucherCreate is a function for admins to create a voucher code. A code is generated when none is given.
+func VoucherCreate(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "admin" {
+		utils.GetError(fmt.Errorf("user is not an admin"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	var voucher models.Voucher
+	if err := utils.ParseJSONFromRequest(request, &voucher); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	voucher.Code = normalizeVoucherCode(voucher.Code)
+	if voucher.Code == "" {
+		voucher.Code, err = generateVoucherCode()
+		if err != nil {
+			utils.GetError(errors.New("error generating voucher code"), http.StatusInternalServerError, response)
+			return
+		}
+	}
+
+	switch voucher.Type {
+	case models.VoucherFixed:
+		if voucher.Value < 1 {
+			utils.GetError(errors.New("value must be greater than zero"), http.StatusBadRequest, response)
+			return
+		}
+	case models.VoucherPercentage:
+		if voucher.Value < 1 || voucher.Value > 100 {
+			utils.GetError(errors.New("value must be between 1 and 100"), http.StatusBadRequest, response)
+			return
+		}
+	default:
+		utils.GetError(errors.New("type must be fixed or percentage"), http.StatusBadRequest, response)
+		return
+	}
+
+	if voucher.MaxUses < 0 || voucher.PerUserLimit < 0 {
+		utils.GetError(errors.New("max_uses and per_user_limit cannot be negative"), http.StatusBadRequest, response)
+		return
+	}
+
+	var existing models.Voucher
+	if result := utils.GetItemsByField(&existing, "code", voucher.Code); result.RowsAffected > 0 {
+		utils.GetError(fmt.Errorf("voucher with code: %s already exists", voucher.Code), http.StatusBadRequest, response)
+		return
+	}
+
+	voucher.ID = 0
+	voucher.Uses = 0
+	voucher.Active = true
+	voucher.CreatedBy = user.ID
+
+	if res := utils.CreateItem(&voucher); res.RowsAffected < 1 {
+		utils.GetError(errors.New("error adding voucher"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("voucher added successfully", voucher, response)
+}
+
+// VoucherGetAll is a function for admins to list vouchers
+func VoucherGetAll(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "admin" {
+		utils.GetError(fmt.Errorf("user is not an admin"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	pagination, err := utils.ParsePagination(request)
+	if err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var total int64
+	vouchers := []models.Voucher{}
+	utils.Db.Model(&models.Voucher{}).Count(&total)
+	result := utils.Db.Order("id desc").Offset(pagination.Offset()).Limit(pagination.Limit).Find(&vouchers)
+	if result.Error != nil {
+		utils.GetError(errors.New("error fetching vouchers"), http.StatusInternalServerError, response)
+		return
+	}
+
+	respse := map[string]interface{}{
+		"vouchers": vouchers,
+		"meta":     models.NewPageMeta(pagination, total),
+	}
+
+	utils.GetSuccess("vouchers retreived successfully", respse, response)
+}
+
+// VoucherUpdate is a function for admins to change the limits of a voucher or disable it
+func VoucherUpdate(response http.ResponseWriter, request *http.Request) {
+	voucherID := mux.Vars(request)["voucher_id"]
+
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "admin" {
+		utils.GetError(fmt.Errorf("user is not an admin"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	uintVoucherID, _ := strconv.ParseUint(voucherID, 10, 64)
+
+	var voucher models.Voucher
+	if tx := utils.GetItemByPrimaryKey(&voucher, uint(uintVoucherID)); tx.RowsAffected < 1 {
+		utils.GetError(errVoucherNotFound, http.StatusNotFound, response)
+		return
+	}
+
+	var updateRequest models.VoucherUpdate
+	if err := utils.ParseJSONFromRequest(request, &updateRequest); err != nil {
+		utils.GetError(errors.New("bad update data"), http.StatusBadRequest, response)
+		return
+	}
+
+	updateMap := map[string]interface{}{}
+
+	if updateRequest.MaxUses != nil {
+		if *updateRequest.MaxUses < 0 {
+			utils.GetError(errors.New("max_uses cannot be negative"), http.StatusBadRequest, response)
+			return
+		}
+		updateMap["max_uses"] = *updateRequest.MaxUses
+	}
+	if updateRequest.ExpiresAt != nil {
+		updateMap["expires_at"] = *updateRequest.ExpiresAt
+	}
+	if updateRequest.Active != nil {
+		updateMap["active"] = *updateRequest.Active
+	}
+
+	if len(updateMap) == 0 {
+		utils.GetError(errors.New("empty/invalid user input data"), http.StatusBadRequest, response)
+		return
+	}
+
+	if result := utils.Db.Table("vouchers").Where("id = ?", voucher.ID).Updates(updateMap); result.Error != nil {
+		utils.GetError(errors.New("voucher update failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("voucher successfully updated", nil, response)
+}
+
+// VoucherRedeem is a function for buyers to redeem a fixed value voucher into deposit credit
+func VoucherRedeem(response http.ResponseWriter, request *http.Request) {
+	user, err := AuthenticatedUser(request)
+	if err != nil {
+		utils.GetError(fmt.Errorf("token Invalid"), http.StatusUnauthorized, response)
+		return
+	}
+
+	if strings.ToLower(user.Role) != "buyer" {
+		utils.GetError(fmt.Errorf("user is not a buyer"), http.StatusNotAcceptable, response)
+		return
+	}
+
+	var redeemRequest models.VoucherRedeemRequest
+	if err := utils.ParseJSONFromRequest(request, &redeemRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	if err := validate.Struct(redeemRequest); err != nil {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+
+	var credit int
+
+	err = utils.Db.Transaction(func(tx *gorm.DB) error {
+		voucher, err := lockVoucher(tx, redeemRequest.Code, user.ID)
+		if err != nil {
+			return err
+		}
+
+		if voucher.Type != models.VoucherFixed {
+			return errVoucherNotCredit
+		}
+
+		credit = voucher.Value
+		if err := useVoucher(tx, voucher, user.ID, credit, models.VoucherModeCredit); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Update("deposit", gorm.Expr("deposit + ?", credit)).Error
+	})
+
+	if isVoucherError(err) {
+		utils.GetError(err, http.StatusBadRequest, response)
+		return
+	}
+	if err != nil {
+		utils.GetError(errors.New("voucher redemption failed"), http.StatusInternalServerError, response)
+		return
+	}
+
+	utils.GetSuccess("voucher redeemed successfully", map[string]interface{}{"credit": credit}, response)
+}
+
+// lockVoucher loads a voucher for update and checks that userID can still use it.
+// The row lock serialises concurrent redemptions of the same voucher.
+func lockVoucher(tx *gorm.DB, code string, userID uint) (models.Voucher, error) {
+	var voucher models.Voucher
+
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ? AND active = ?", normalizeVoucherCode(code), true).
+		Limit(1).
+		Find(&voucher)
+	if result.Error != nil {
+		return voucher, result.Error
+	}
+	if result.RowsAffected < 1 {
+		return voucher, errVoucherNotFound
+	}
+
+	if voucher.ExpiresAt != 0 && time.Now().Unix() >= voucher.ExpiresAt {
+		return voucher, errVoucherExpired
+	}
+
+	if voucher.MaxUses != 0 && voucher.Uses >= voucher.MaxUses {
+		return voucher, errVoucherUsedUp
+	}
+
+	if voucher.PerUserLimit != 0 {
+		var redemptions int64
+		if err := tx.Model(&models.VoucherRedemption{}).Where("voucher_id = ? AND user_id = ?", voucher.ID, userID).Count(&redemptions).Error; err != nil {
+			return voucher, err
+		}
+		if int(redemptions) >= voucher.PerUserLimit {
+			return voucher, errVoucherUserLimit
+		}
+	}
+
+	return voucher, nil
+}
+
+// useVoucher counts a use of a voucher locked by lockVoucher and records the redemption.
+func useVoucher(tx *gorm.DB, voucher models.Voucher, userID uint, amount int, mode string) error {
+	result := tx.Model(&models.Voucher{}).
+		Where("id = ? AND (max_uses = 0 OR uses < max_uses)", voucher.ID).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return errVoucherUsedUp
+	}
+
+	redemption := models.VoucherRedemption{
+		VoucherID: voucher.ID,
+		UserID:    userID,
+		Amount:    amount,
+		Mode:      mode,
+	}
+
+	return tx.Create(&redemption).Error
+}
+
+// voucherDiscount is the amount a voucher takes off a purchase costing total.
+func voucherDiscount(voucher models.Voucher, total int) int {
+	if voucher.Type == models.VoucherPercentage {
+		return total * voucher.Value / 100
+	}
+
+	if voucher.Value > total {
+		return total
+	}
+	return voucher.Value
+}
+
+func normalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// generateVoucherCode returns a random 10 character voucher code.
+func generateVoucherCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.EncodeToString(buf)[:10], nil
+}
@@ -0,0 +1,241 @@
+// Package device drives the coin mechanism of a vending machine: the acceptor
+// that takes coins from buyers and the dispenser that pays out change.
+package device
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventKind is what a coin mechanism reports.
+type EventKind string
+
+// Coin mechanism events
+const (
+	// CoinAccepted is a coin taken from a buyer and credited.
+	CoinAccepted EventKind = "coin_accepted"
+	// CoinRejected is a coin returned to the buyer without credit.
+	CoinRejected EventKind = "coin_rejected"
+	// CoinsDispensed is coins paid out by hand from the tubes, by an engineer.
+	CoinsDispensed EventKind = "coins_dispensed"
+	// EscrowRequest is the buyer pressing the coin return lever.
+	EscrowRequest EventKind = "escrow_request"
+	// Fault is a problem reported by the mechanism, such as a jam.
+	Fault EventKind = "fault"
+	// JustReset is the mechanism reporting it has restarted and must be set up again.
+	JustReset EventKind = "just_reset"
+)
+
+// Event is something a coin mechanism reports when polled.
+type Event struct {
+	Kind  EventKind
+	Value int
+	Count int
+	// ToTube is set for accepted coins kept for change rather than sent to the cashbox.
+	ToTube bool
+	// Detail describes faults.
+	Detail string
+}
+
+// CoinMech is a coin acceptor and dispenser.
+type CoinMech interface {
+	// Reset restarts the mechanism and reads its configuration.
+	Reset() error
+	// Enable sets the coin values the mechanism accepts. Other coins are rejected.
+	Enable(values []int) error
+	// Poll returns what happened since the last poll.
+	Poll() ([]Event, error)
+	// Dispense pays out count coins of value from the tubes.
+	Dispense(value, count int) error
+	// Tubes returns the number of coins of each value held for change.
+	Tubes() (map[int]int, error)
+}
+
+var (
+	// ErrUnknownCoin is returned for a coin value the mechanism does not handle.
+	ErrUnknownCoin = errors.New("coin value not supported by the mechanism")
+	// ErrCoinsHeld is returned for opening a session while coins are held for another.
+	ErrCoinsHeld = errors.New("coins inserted are held for another session")
+	// ErrSessionNotOpen is returned for taking coins for a session that is not open.
+	ErrSessionNotOpen = errors.New("session is not open at the coin mechanism")
+)
+
+// Acceptor polls a coin mechanism in the background and holds the coins it
+// accepts for the session open at the machine, until they are taken to credit it.
+type Acceptor struct {
+	mech CoinMech
+
+	mu      sync.Mutex
+	values  []int
+	session string
+	pending []int
+	faults  []Event
+	err     error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAcceptor returns an acceptor for mech. Call Start to begin polling.
+func NewAcceptor(mech CoinMech) *Acceptor {
+	return &Acceptor{mech: mech}
+}
+
+// Setup resets the mechanism and enables the coin values it accepts. It is done
+// again whenever the mechanism reports it has been reset.
+func (a *Acceptor) Setup(values []int) error {
+	a.mu.Lock()
+	a.values = values
+	a.mu.Unlock()
+
+	if err := a.mech.Reset(); err != nil {
+		return err
+	}
+	return a.mech.Enable(values)
+}
+
+// Start polls the mechanism every interval until Stop is called.
+func (a *Acceptor) Start(interval time.Duration) {
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.stop:
+				return
+			case <-ticker.C:
+				a.PollOnce()
+			}
+		}
+	}()
+}
+
+// Stop stops polling and waits for the last poll to finish.
+func (a *Acceptor) Stop() {
+	if a.stop == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+	a.stop = nil
+}
+
+// PollOnce polls the mechanism once, holding the coins it accepted. A mechanism
+// that was reset is set up again with the values it accepted before.
+func (a *Acceptor) PollOnce() {
+	events, err := a.mech.Poll()
+
+	a.mu.Lock()
+	reset := false
+	for _, event := range events {
+		switch event.Kind {
+		case CoinAccepted:
+			a.pending = append(a.pending, event.Value)
+		case Fault:
+			a.faults = append(a.faults, event)
+		case JustReset:
+			reset = true
+		}
+	}
+	values := a.values
+	a.mu.Unlock()
+
+	if err == nil && reset {
+		if err = a.mech.Reset(); err == nil {
+			err = a.mech.Enable(values)
+		}
+	}
+
+	a.mu.Lock()
+	a.err = err
+	a.mu.Unlock()
+}
+
+// Open holds the coins accepted from now on for session. Coins accepted while no
+// session held any go to it as well. Opening fails while coins are held for
+// another session, until they are taken.
+func (a *Acceptor) Open(session string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.session != session && a.session != "" && len(a.pending) > 0 {
+		return ErrCoinsHeld
+	}
+	a.session = session
+	return nil
+}
+
+// Close ends session, if it is the one open. Coins still held for it go to the next session.
+func (a *Acceptor) Close(session string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.session == session {
+		a.session = ""
+	}
+}
+
+// Take returns the coins accepted for session since the last call, in the order they were inserted.
+func (a *Acceptor) Take(session string) ([]int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if session == "" || a.session != session {
+		return nil, ErrSessionNotOpen
+	}
+	coins := a.pending
+	a.pending = nil
+	return coins, nil
+}
+
+// Return puts coins taken back, ahead of any accepted since, for when they could not be credited.
+func (a *Acceptor) Return(coins []int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = append(append([]int{}, coins...), a.pending...)
+}
+
+// Faults returns the faults reported since the last call.
+func (a *Acceptor) Faults() []Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	faults := a.faults
+	a.faults = nil
+	return faults
+}
+
+// Err returns the error of the last poll, if it failed.
+func (a *Acceptor) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// PayOut dispenses change, a count of coins by value, from the mechanism, largest
+// coins first. It returns the coins it paid before any failure.
+func (a *Acceptor) PayOut(change map[int]int) (map[int]int, error) {
+	values := make([]int, 0, len(change))
+	for value, count := range change {
+		if count > 0 {
+			values = append(values, value)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(values)))
+
+	paid := map[int]int{}
+	for _, value := range values {
+		if err := a.mech.Dispense(value, change[value]); err != nil {
+			return paid, err
+		}
+		paid[value] = change[value]
+	}
+	return paid, nil
+}
@@ -0,0 +1,123 @@
+package device
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAcceptor(t *testing.T) {
+	t.Run("accepted coins are held until taken", func(t *testing.T) {
+		mech := NewFake([]int{5, 10, 20, 50, 100})
+		if err := mech.Enable([]int{10, 50}); err != nil {
+			t.Fatal(err)
+		}
+		acceptor := NewAcceptor(mech)
+		mustOpen(t, acceptor, "guest:1")
+
+		mech.Insert(50)
+		mech.Insert(20)
+		mech.Insert(10)
+		mech.Report(Event{Kind: Fault, Detail: "coin jam"})
+		acceptor.PollOnce()
+
+		if coins, err := acceptor.Take("guest:1"); err != nil || !reflect.DeepEqual(coins, []int{50, 10}) {
+			t.Errorf("expected 50 and 10, got %v and %v", coins, err)
+		}
+		if coins, _ := acceptor.Take("guest:1"); len(coins) != 0 {
+			t.Errorf("expected coins to be taken once, got %v", coins)
+		}
+		if faults := acceptor.Faults(); len(faults) != 1 || faults[0].Detail != "coin jam" {
+			t.Errorf("expected a coin jam, got %v", faults)
+		}
+	})
+
+	t.Run("coins are held for the open session only", func(t *testing.T) {
+		mech := NewFake([]int{10, 50})
+		acceptor := NewAcceptor(mech)
+		if err := acceptor.Setup([]int{10, 50}); err != nil {
+			t.Fatal(err)
+		}
+
+		mech.Insert(10)
+		acceptor.PollOnce()
+		if _, err := acceptor.Take("user:1"); !errors.Is(err, ErrSessionNotOpen) {
+			t.Errorf("expected coins with no session open to be refused, got %v", err)
+		}
+
+		mustOpen(t, acceptor, "guest:1")
+		mech.Insert(50)
+		acceptor.PollOnce()
+
+		if err := acceptor.Open("user:2"); !errors.Is(err, ErrCoinsHeld) {
+			t.Errorf("expected another session to wait for the coins held, got %v", err)
+		}
+		if _, err := acceptor.Take("user:2"); !errors.Is(err, ErrSessionNotOpen) {
+			t.Errorf("expected another session to be refused the coins, got %v", err)
+		}
+		if coins, err := acceptor.Take("guest:1"); err != nil || !reflect.DeepEqual(coins, []int{10, 50}) {
+			t.Errorf("expected 10 and 50 for the open session, got %v and %v", coins, err)
+		}
+
+		mustOpen(t, acceptor, "user:2")
+		acceptor.Close("guest:1")
+		if _, err := acceptor.Take("user:2"); err != nil {
+			t.Errorf("expected closing another session to leave the open one, got %v", err)
+		}
+	})
+
+	t.Run("a reset mechanism is set up again", func(t *testing.T) {
+		mech := NewFake([]int{10, 50})
+		acceptor := NewAcceptor(mech)
+		if err := acceptor.Setup([]int{10, 50}); err != nil {
+			t.Fatal(err)
+		}
+		mustOpen(t, acceptor, "guest:1")
+
+		mech.Reset()
+		mech.Report(Event{Kind: JustReset})
+		acceptor.PollOnce()
+
+		mech.Insert(50)
+		acceptor.PollOnce()
+		if coins, _ := acceptor.Take("guest:1"); !reflect.DeepEqual(coins, []int{50}) {
+			t.Errorf("expected the coin to be accepted after the reset, got %v", coins)
+		}
+		if err := acceptor.Err(); err != nil {
+			t.Errorf("expected no poll error, got %v", err)
+		}
+	})
+
+	t.Run("poll errors are kept", func(t *testing.T) {
+		mech := NewFake([]int{5})
+		mech.Err = errors.New("unplugged")
+		acceptor := NewAcceptor(mech)
+
+		acceptor.PollOnce()
+		if acceptor.Err() == nil {
+			t.Error("expected the poll error")
+		}
+	})
+
+	t.Run("change is paid out until the tubes run dry", func(t *testing.T) {
+		mech := NewFake([]int{5, 10, 20})
+		mech.Fill(20, 1)
+		mech.Fill(10, 3)
+		acceptor := NewAcceptor(mech)
+
+		paid, err := acceptor.PayOut(map[int]int{20: 1, 10: 2, 5: 1})
+		if err == nil {
+			t.Fatal("expected the empty 5 tube to fail")
+		}
+		if !reflect.DeepEqual(paid, map[int]int{20: 1, 10: 2}) || !reflect.DeepEqual(mech.Dispensed(), paid) {
+			t.Errorf("expected 20x1 10x2 paid, got %v", paid)
+		}
+	})
+}
+
+func mustOpen(t *testing.T, acceptor *Acceptor, session string) {
+	t.Helper()
+	if err := acceptor.Open(session); err != nil {
+		t.Fatal(err)
+	}
+}
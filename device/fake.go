@@ -0,0 +1,150 @@
+package device
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Fake is a coin mechanism in memory, for tests and machines without hardware.
+type Fake struct {
+	mu        sync.Mutex
+	values    map[int]bool
+	enabled   map[int]bool
+	tubes     map[int]int
+	events    []Event
+	dispensed map[int]int
+
+	// Err, when set, is returned by every call, as if the mechanism were unplugged.
+	Err error
+}
+
+// NewFake returns a mechanism that handles coins of values, with empty tubes.
+func NewFake(values []int) *Fake {
+	known := make(map[int]bool, len(values))
+	for _, value := range values {
+		known[value] = true
+	}
+
+	return &Fake{
+		values:    known,
+		enabled:   map[int]bool{},
+		tubes:     map[int]int{},
+		dispensed: map[int]int{},
+	}
+}
+
+// Insert is a buyer inserting a coin. Coins that are not enabled are rejected.
+func (f *Fake) Insert(value int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.enabled[value] {
+		f.events = append(f.events, Event{Kind: CoinRejected, Value: value, Count: 1})
+		return
+	}
+
+	f.tubes[value]++
+	f.events = append(f.events, Event{Kind: CoinAccepted, Value: value, Count: 1, ToTube: true})
+}
+
+// Report queues an event for the next poll, such as a fault.
+func (f *Fake) Report(event Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+// Fill puts count coins of value in the tubes.
+func (f *Fake) Fill(value, count int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tubes[value] += count
+}
+
+// Dispensed returns the coins paid out so far, by value.
+func (f *Fake) Dispensed() map[int]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dispensed := make(map[int]int, len(f.dispensed))
+	for value, count := range f.dispensed {
+		dispensed[value] = count
+	}
+	return dispensed
+}
+
+func (f *Fake) Reset() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.enabled = map[int]bool{}
+	f.events = nil
+	return nil
+}
+
+func (f *Fake) Enable(values []int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+
+	enabled := make(map[int]bool, len(values))
+	for _, value := range values {
+		if !f.values[value] {
+			return fmt.Errorf("%w: %d", ErrUnknownCoin, value)
+		}
+		enabled[value] = true
+	}
+	f.enabled = enabled
+	return nil
+}
+
+func (f *Fake) Poll() ([]Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	events := f.events
+	f.events = nil
+	return events, nil
+}
+
+func (f *Fake) Dispense(value, count int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	if !f.values[value] {
+		return fmt.Errorf("%w: %d", ErrUnknownCoin, value)
+	}
+	if f.tubes[value] < count {
+		return fmt.Errorf("not enough %d coins in the tubes", value)
+	}
+
+	f.tubes[value] -= count
+	f.dispensed[value] += count
+	return nil
+}
+
+func (f *Fake) Tubes() (map[int]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	tubes := make(map[int]int, len(f.tubes))
+	for value, count := range f.tubes {
+		tubes[value] = count
+	}
+	return tubes, nil
+}
@@ -0,0 +1,291 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MDB coin changer commands. The changer answers at address 0x08 and each
+// command is the address plus an offset.
+const (
+	mdbReset      = 0x08
+	mdbSetup      = 0x09
+	mdbTubeStatus = 0x0A
+	mdbPoll       = 0x0B
+	mdbCoinType   = 0x0C
+	mdbDispense   = 0x0D
+)
+
+// Frame bytes a changer sends without data.
+const (
+	mdbAck = 0x00
+	mdbNak = 0xFF
+)
+
+// mdbCoinTypes is the number of coin types an MDB changer describes.
+const mdbCoinTypes = 16
+
+var (
+	// ErrNak is returned when the changer refuses a command.
+	ErrNak = errors.New("coin changer refused the command")
+	// ErrChecksum is returned for a response that fails its checksum.
+	ErrChecksum = errors.New("coin changer response checksum mismatch")
+	errNotSetUp = errors.New("coin changer is not set up, reset it first")
+)
+
+// mdbStatus describes the single byte status codes a changer reports when polled.
+var mdbStatus = map[byte]string{
+	0x02: "changer payout busy",
+	0x03: "no credit",
+	0x04: "defective tube sensor",
+	0x05: "double arrival",
+	0x06: "acceptor unplugged",
+	0x07: "tube jam",
+	0x08: "rom checksum error",
+	0x09: "coin routing error",
+	0x0A: "changer busy",
+	0x0C: "coin jam",
+	0x0D: "possible credited coin removal",
+}
+
+// MDB is a coin changer speaking the MDB protocol over a serial link.
+//
+// A serial link has no MDB mode bit to mark the last byte of a frame, so every
+// frame the changer sends starts with a length byte instead. A length of 0x00 is
+// an ACK and 0xFF a NAK. Any other length is followed by that many data bytes
+// and a checksum, the sum of the data bytes modulo 256, which is acknowledged
+// with an ACK. Commands are the command byte, any data and a checksum of both.
+type MDB struct {
+	mu      sync.Mutex
+	rw      io.ReadWriter
+	scaling int
+	values  [mdbCoinTypes]int
+	setUp   bool
+}
+
+// NewMDB returns a coin changer on rw. Reset it before use.
+func NewMDB(rw io.ReadWriter) *MDB {
+	return &MDB{rw: rw}
+}
+
+// Reset restarts the changer and reads the value of each coin type from its setup.
+func (m *MDB) Reset() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.command(mdbReset); err != nil {
+		return err
+	}
+
+	setup, err := m.command(mdbSetup)
+	if err != nil {
+		return err
+	}
+	// feature level, country code (2), scaling factor, decimal places, coin type routing (2), coin credits
+	if len(setup) < 7 {
+		return fmt.Errorf("coin changer setup is %d bytes, expected at least 7", len(setup))
+	}
+
+	m.scaling = int(setup[3])
+	m.values = [mdbCoinTypes]int{}
+	for coinType, credit := range setup[7:] {
+		if coinType >= mdbCoinTypes {
+			break
+		}
+		m.values[coinType] = int(credit) * m.scaling
+	}
+	m.setUp = true
+
+	return nil
+}
+
+// Enable accepts coins of values and lets engineers pay them out by hand.
+func (m *MDB) Enable(values []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.setUp {
+		return errNotSetUp
+	}
+
+	var mask uint16
+	for _, value := range values {
+		coinType, err := m.coinType(value)
+		if err != nil {
+			return err
+		}
+		mask |= 1 << uint(coinType)
+	}
+
+	_, err := m.command(mdbCoinType, byte(mask>>8), byte(mask), byte(mask>>8), byte(mask))
+	return err
+}
+
+// Poll returns the coins deposited, coins paid out by hand and status reports
+// since the last poll.
+func (m *MDB) Poll() ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := m.command(mdbPoll)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b&0x80 != 0:
+			// 1yyyxxxx, tube count: y coins of type x dispensed by hand
+			if i+1 < len(data) {
+				i++
+			}
+			events = append(events, Event{Kind: CoinsDispensed, Value: m.values[b&0x0F], Count: int(b>>4) & 0x07})
+		case b&0xC0 == 0x40:
+			// 01yyxxxx, tube count: a coin of type x deposited and routed to y
+			if i+1 < len(data) {
+				i++
+			}
+			routing, value := (b>>4)&0x03, m.values[b&0x0F]
+			if routing == 0x03 {
+				events = append(events, Event{Kind: CoinRejected, Value: value, Count: 1})
+				continue
+			}
+			events = append(events, Event{Kind: CoinAccepted, Value: value, Count: 1, ToTube: routing == 0x01})
+		case b&0xE0 == 0x20:
+			// 001xxxxx: x slugs (unrecognised coins) returned
+			events = append(events, Event{Kind: CoinRejected, Count: int(b & 0x1F)})
+		case b == 0x01:
+			events = append(events, Event{Kind: EscrowRequest})
+		case b == 0x0B:
+			m.setUp = false
+			events = append(events, Event{Kind: JustReset})
+		default:
+			detail, ok := mdbStatus[b]
+			if !ok {
+				detail = fmt.Sprintf("unknown status 0x%02X", b)
+			}
+			events = append(events, Event{Kind: Fault, Detail: detail})
+		}
+	}
+
+	return events, nil
+}
+
+// Dispense pays out count coins of value. MDB dispenses at most 15 coins per
+// command, so larger payouts are split.
+func (m *MDB) Dispense(value, count int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.setUp {
+		return errNotSetUp
+	}
+
+	coinType, err := m.coinType(value)
+	if err != nil {
+		return err
+	}
+
+	for count > 0 {
+		n := count
+		if n > 15 {
+			n = 15
+		}
+		if _, err := m.command(mdbDispense, byte(n<<4)|byte(coinType)); err != nil {
+			return err
+		}
+		count -= n
+	}
+
+	return nil
+}
+
+// Tubes returns the number of coins of each value in the change tubes.
+func (m *MDB) Tubes() (map[int]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.setUp {
+		return nil, errNotSetUp
+	}
+
+	data, err := m.command(mdbTubeStatus)
+	if err != nil {
+		return nil, err
+	}
+	// tube full status (2), then a count for each coin type
+	if len(data) < 2 {
+		return nil, fmt.Errorf("coin changer tube status is %d bytes, expected at least 2", len(data))
+	}
+
+	tubes := map[int]int{}
+	for coinType, count := range data[2:] {
+		if coinType >= mdbCoinTypes || m.values[coinType] == 0 {
+			continue
+		}
+		tubes[m.values[coinType]] += int(count)
+	}
+	return tubes, nil
+}
+
+// coinType returns the coin type the changer uses for value.
+func (m *MDB) coinType(value int) (int, error) {
+	for coinType, typeValue := range m.values {
+		if typeValue == value && value > 0 {
+			return coinType, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %d", ErrUnknownCoin, value)
+}
+
+// command sends a command and returns the data the changer answers with,
+// nil when it only acknowledges the command.
+func (m *MDB) command(command byte, data ...byte) ([]byte, error) {
+	frame := append([]byte{command}, data...)
+	frame = append(frame, checksum(frame))
+	if _, err := m.rw.Write(frame); err != nil {
+		return nil, err
+	}
+
+	var length [1]byte
+	if _, err := io.ReadFull(m.rw, length[:]); err != nil {
+		return nil, err
+	}
+
+	switch length[0] {
+	case mdbAck:
+		return nil, nil
+	case mdbNak:
+		return nil, fmt.Errorf("%w: 0x%02X", ErrNak, command)
+	}
+
+	response := make([]byte, int(length[0])+1)
+	if _, err := io.ReadFull(m.rw, response); err != nil {
+		return nil, err
+	}
+
+	body, sum := response[:len(response)-1], response[len(response)-1]
+	if checksum(body) != sum {
+		m.rw.Write([]byte{mdbNak})
+		return nil, ErrChecksum
+	}
+
+	if _, err := m.rw.Write([]byte{mdbAck}); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// checksum is the sum of data modulo 256.
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
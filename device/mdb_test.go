@@ -0,0 +1,196 @@
+package device
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// changer is a coin changer on the other end of a serial link, answering MDB commands.
+type changer struct {
+	conn     net.Conn
+	poll     [][]byte
+	enabled  [2]byte
+	dispense []byte
+	tubes    []byte
+	corrupt  bool
+}
+
+// commandLengths is the number of data bytes each command carries.
+var commandLengths = map[byte]int{mdbReset: 0, mdbSetup: 0, mdbTubeStatus: 0, mdbPoll: 0, mdbCoinType: 4, mdbDispense: 1}
+
+func (c *changer) serve(t *testing.T) {
+	for {
+		header := make([]byte, 1)
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			return
+		}
+		length, ok := commandLengths[header[0]]
+		if !ok {
+			t.Errorf("unexpected command 0x%02X", header[0])
+			return
+		}
+		rest := make([]byte, length+1)
+		if _, err := io.ReadFull(c.conn, rest); err != nil {
+			return
+		}
+		if checksum(append(header, rest[:length]...)) != rest[length] {
+			c.conn.Write([]byte{mdbNak})
+			continue
+		}
+
+		data := rest[:length]
+		switch header[0] {
+		case mdbSetup:
+			// level 3, country 1978, scaling 5, 2 decimals, routing, credits 1 2 4 10 20
+			c.respond([]byte{3, 0x19, 0x78, 5, 2, 0x00, 0x1F, 1, 2, 4, 10, 20})
+		case mdbTubeStatus:
+			c.respond(c.tubes)
+		case mdbPoll:
+			if len(c.poll) == 0 {
+				c.conn.Write([]byte{mdbAck})
+				continue
+			}
+			c.respond(c.poll[0])
+			c.poll = c.poll[1:]
+		case mdbCoinType:
+			copy(c.enabled[:], data[:2])
+			c.conn.Write([]byte{mdbAck})
+		case mdbDispense:
+			c.dispense = append(c.dispense, data[0])
+			c.conn.Write([]byte{mdbAck})
+		default:
+			c.conn.Write([]byte{mdbAck})
+		}
+	}
+}
+
+// respond sends data and waits for the controller to acknowledge it.
+func (c *changer) respond(data []byte) {
+	sum := checksum(data)
+	if c.corrupt {
+		sum++
+	}
+	c.conn.Write(append(append([]byte{byte(len(data))}, data...), sum))
+	ack := make([]byte, 1)
+	io.ReadFull(c.conn, ack)
+}
+
+func newChanger(t *testing.T) (*MDB, *changer) {
+	controller, peripheral := net.Pipe()
+	c := &changer{conn: peripheral}
+	go c.serve(t)
+	t.Cleanup(func() {
+		controller.Close()
+		peripheral.Close()
+	})
+
+	mech := NewMDB(controller)
+	if err := mech.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	return mech, c
+}
+
+func TestMDB(t *testing.T) {
+	t.Run("enable sets the coin type mask", func(t *testing.T) {
+		mech, c := newChanger(t)
+
+		if err := mech.Enable([]int{5, 50, 100}); err != nil {
+			t.Fatal(err)
+		}
+		// types 0, 3 and 4
+		if c.enabled != [2]byte{0x00, 0x19} {
+			t.Errorf("expected mask 0019, got %02X%02X", c.enabled[0], c.enabled[1])
+		}
+
+		if err := mech.Enable([]int{25}); !errors.Is(err, ErrUnknownCoin) {
+			t.Errorf("expected an unknown coin error, got %v", err)
+		}
+	})
+
+	t.Run("poll decodes deposits, payouts and status", func(t *testing.T) {
+		mech, c := newChanger(t)
+		c.poll = [][]byte{{
+			0x53, 7, // 50 to the tubes
+			0x42, 0, // 20 to the cashbox
+			0x71, 0, // 10 rejected
+			0xA0, 3, // two 5 coins paid out by hand
+			0x22, // two slugs
+			0x01, // coin return lever
+			0x0C, // coin jam
+		}}
+
+		events, err := mech.Poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Event{
+			{Kind: CoinAccepted, Value: 50, Count: 1, ToTube: true},
+			{Kind: CoinAccepted, Value: 20, Count: 1},
+			{Kind: CoinRejected, Value: 10, Count: 1},
+			{Kind: CoinsDispensed, Value: 5, Count: 2},
+			{Kind: CoinRejected, Count: 2},
+			{Kind: EscrowRequest},
+			{Kind: Fault, Detail: "coin jam"},
+		}
+		if !reflect.DeepEqual(events, expected) {
+			t.Errorf("expected %+v, got %+v", expected, events)
+		}
+
+		events, err = mech.Poll()
+		if err != nil || len(events) != 0 {
+			t.Errorf("expected an empty poll, got %v %v", events, err)
+		}
+	})
+
+	t.Run("a changer that restarts must be reset", func(t *testing.T) {
+		mech, c := newChanger(t)
+		c.poll = [][]byte{{0x0B}}
+
+		events, err := mech.Poll()
+		if err != nil || len(events) != 1 || events[0].Kind != JustReset {
+			t.Fatalf("expected just reset, got %v %v", events, err)
+		}
+		if err := mech.Dispense(5, 1); err == nil {
+			t.Error("expected dispensing to need a reset")
+		}
+	})
+
+	t.Run("dispense splits large payouts", func(t *testing.T) {
+		mech, c := newChanger(t)
+
+		if err := mech.Dispense(10, 17); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c.dispense, []byte{0xF1, 0x21}) {
+			t.Errorf("expected F1 21, got % X", c.dispense)
+		}
+	})
+
+	t.Run("tubes are counted by value", func(t *testing.T) {
+		mech, c := newChanger(t)
+		c.tubes = []byte{0x00, 0x00, 12, 30, 8, 0, 0}
+
+		tubes, err := mech.Tubes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tubes, map[int]int{5: 12, 10: 30, 20: 8, 50: 0, 100: 0}) {
+			t.Errorf("unexpected tubes %v", tubes)
+		}
+	})
+
+	t.Run("corrupt responses are refused", func(t *testing.T) {
+		mech, c := newChanger(t)
+		c.corrupt = true
+		c.poll = [][]byte{{0x53, 7}}
+
+		if _, err := mech.Poll(); !errors.Is(err, ErrChecksum) {
+			t.Errorf("expected a checksum error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+// Package forecast estimates the daily demand for a product at a machine from
+// its sales history and suggests when to restock it and by how much.
+package forecast
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Method is how the level of demand is estimated from the sales history.
+type Method string
+
+// Forecasting methods
+const (
+	// MovingAverage averages the last Window days.
+	MovingAverage Method = "moving_average"
+	// ExponentialSmoothing weighs recent days more, by Alpha.
+	ExponentialSmoothing Method = "exponential_smoothing"
+)
+
+// Defaults for a zero Model.
+const (
+	DefaultAlpha  = 0.3
+	DefaultWindow = 7
+)
+
+// seasonalDays is the history needed before weekday seasonality is estimated:
+// two of each weekday.
+const seasonalDays = 14
+
+// ErrUnknownMethod is returned for a method other than MovingAverage or ExponentialSmoothing.
+var ErrUnknownMethod = errors.New("unknown forecasting method")
+
+// Model is a forecasting method and its parameters. The zero Model uses
+// exponential smoothing with DefaultAlpha.
+type Model struct {
+	Method Method
+	// Alpha is the weight of the most recent day in exponential smoothing, between 0 and 1.
+	Alpha float64
+	// Window is the number of days a moving average covers.
+	Window int
+}
+
+// Forecast is a fitted model: the underlying daily demand and how much each
+// weekday sells relative to it.
+type Forecast struct {
+	Level       float64
+	Seasonality [7]float64
+}
+
+// Demand is the expected sales on day.
+func (f Forecast) Demand(day time.Time) float64 {
+	return f.Level * f.Seasonality[day.Weekday()]
+}
+
+// Over is the expected sales over days days starting on from.
+func (f Forecast) Over(from time.Time, days int) float64 {
+	var total float64
+	for i := 0; i < days; i++ {
+		total += f.Demand(from.AddDate(0, 0, i))
+	}
+	return total
+}
+
+// Fit fits the model to history, the units sold on each day starting on start. Days
+// that are NaN, such as days the product sold out, are unknown and left out. Weekday
+// seasonality is only estimated from at least two weeks of known days.
+func (m Model) Fit(history []float64, start time.Time) (Forecast, error) {
+	forecast := Forecast{}
+	for i := range forecast.Seasonality {
+		forecast.Seasonality[i] = 1
+	}
+
+	method := m.Method
+	if method == "" {
+		method = ExponentialSmoothing
+	}
+	if method != MovingAverage && method != ExponentialSmoothing {
+		return forecast, ErrUnknownMethod
+	}
+
+	known := 0
+	for _, sold := range history {
+		if !math.IsNaN(sold) {
+			known++
+		}
+	}
+	if known == 0 {
+		return forecast, nil
+	}
+
+	if known >= seasonalDays {
+		forecast.Seasonality = seasonality(history, start)
+	}
+
+	// deseasonalise the history; weekdays that never sell say nothing about the level
+	var adjusted []float64
+	for i, sold := range history {
+		index := forecast.Seasonality[start.AddDate(0, 0, i).Weekday()]
+		if index > 0 && !math.IsNaN(sold) {
+			adjusted = append(adjusted, sold/index)
+		}
+	}
+	if len(adjusted) == 0 {
+		return forecast, nil
+	}
+
+	window := m.Window
+	if window < 1 {
+		window = DefaultWindow
+	}
+	if window > len(adjusted) {
+		window = len(adjusted)
+	}
+
+	switch method {
+	case MovingAverage:
+		forecast.Level = mean(adjusted[len(adjusted)-window:])
+	case ExponentialSmoothing:
+		alpha := m.Alpha
+		if alpha <= 0 || alpha > 1 {
+			alpha = DefaultAlpha
+		}
+		// start from the average of the first window so one odd day does not skew it
+		forecast.Level = mean(adjusted[:window])
+		for _, value := range adjusted[window:] {
+			forecast.Level = alpha*value + (1-alpha)*forecast.Level
+		}
+	}
+
+	return forecast, nil
+}
+
+// seasonality is how much each weekday sells relative to the average known day.
+func seasonality(history []float64, start time.Time) [7]float64 {
+	var sums [7]float64
+	var counts [7]int
+	var total float64
+	known := 0
+	for i, sold := range history {
+		if math.IsNaN(sold) {
+			continue
+		}
+		weekday := start.AddDate(0, 0, i).Weekday()
+		sums[weekday] += sold
+		counts[weekday]++
+		total += sold
+		known++
+	}
+
+	var indices [7]float64
+	average := total / float64(known)
+	for weekday := range indices {
+		indices[weekday] = 1
+		if average > 0 && counts[weekday] > 0 {
+			indices[weekday] = sums[weekday] / float64(counts[weekday]) / average
+		}
+	}
+	return indices
+}
+
+func mean(values []float64) float64 {
+	var total float64
+	for _, value := range values {
+		total += value
+	}
+	return total / float64(len(values))
+}
+
+// Sale is units of a product sold at a time.
+type Sale struct {
+	At       time.Time
+	Quantity int
+}
+
+// Daily totals sales into days days starting at midnight on from, in the location
+// of from. Sales outside those days are ignored.
+func Daily(sales []Sale, from time.Time, days int) []float64 {
+	start := Midnight(from)
+	history := make([]float64, days)
+	for _, sale := range sales {
+		day := daysBetween(start, Midnight(sale.At.In(start.Location())))
+		if day >= 0 && day < days {
+			history[day] += float64(sale.Quantity)
+		}
+	}
+	return history
+}
+
+// DropSoldOut marks the days of history the product sold out on, working back from
+// stock, the units left at the end of the last day, through the units sold and loaded
+// each day. What sold on those days is the stock there was rather than the demand, so
+// they are set to NaN for Fit to leave out.
+func DropSoldOut(sold, loaded []float64, stock int) []float64 {
+	history := append([]float64{}, sold...)
+
+	left := float64(stock)
+	for day := len(history) - 1; day >= 0; day-- {
+		if left <= 0 {
+			history[day] = math.NaN()
+		}
+		// the stock at the end of the day before
+		left += sold[day]
+		if day < len(loaded) {
+			left -= loaded[day]
+		}
+	}
+	return history
+}
+
+// Midnight is the start of the day of t.
+func Midnight(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// daysBetween counts calendar days from a to b, both midnights, allowing for
+// days made shorter or longer by daylight saving.
+func daysBetween(a, b time.Time) int {
+	return int(math.Round(b.Sub(a).Hours() / 24))
+}
+
+// Stock is the stock of a product in a machine.
+type Stock struct {
+	Quantity int
+	Capacity int
+	ParLevel int
+}
+
+// Suggestion is when to restock a product and how many units to load.
+type Suggestion struct {
+	// NeedsVisit is false when the stock lasts past the horizon.
+	NeedsVisit bool
+	// Days is the number of days from now until the stock is down to its par level.
+	Days      int
+	RestockBy time.Time
+	// Projected is the stock expected to be left on RestockBy.
+	Projected int
+	// Quantity is the units to load on RestockBy to last the cycle without
+	// dropping below the par level, as far as capacity allows.
+	Quantity int
+	// CycleDemand is the expected sales over the cycle after RestockBy.
+	CycleDemand float64
+}
+
+// Suggest works out when stock falls to its par level from today, looking up to horizon
+// days ahead, and how much to load then to cover the next cycle days of demand.
+func Suggest(f Forecast, stock Stock, today time.Time, horizon, cycle int) Suggestion {
+	day := Midnight(today)
+	remaining := float64(stock.Quantity)
+
+	days := 0
+	for ; days < horizon && remaining > float64(stock.ParLevel); days++ {
+		remaining -= f.Demand(day.AddDate(0, 0, days))
+	}
+	if remaining > float64(stock.ParLevel) {
+		return Suggestion{Days: horizon}
+	}
+
+	suggestion := Suggestion{
+		NeedsVisit: true,
+		Days:       days,
+		RestockBy:  day.AddDate(0, 0, days),
+		Projected:  int(math.Max(0, math.Floor(remaining))),
+	}
+	suggestion.CycleDemand = f.Over(suggestion.RestockBy, cycle)
+
+	target := int(math.Ceil(suggestion.CycleDemand)) + stock.ParLevel
+	if target > stock.Capacity {
+		target = stock.Capacity
+	}
+	if target > suggestion.Projected {
+		suggestion.Quantity = target - suggestion.Projected
+	}
+
+	return suggestion
+}
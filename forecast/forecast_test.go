@@ -0,0 +1,340 @@
+package forecast
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// monday is the first day of the synthetic histories.
+var monday = time.Date(2023, time.January, 2, 0, 0, 0, 0, time.UTC)
+
+// weekly builds weeks of history selling pattern[weekday] each day, starting on monday.
+func weekly(weeks int, pattern map[time.Weekday]float64) []float64 {
+	history := make([]float64, weeks*7)
+	for i := range history {
+		history[i] = pattern[monday.AddDate(0, 0, i).Weekday()]
+	}
+	return history
+}
+
+func constant(days int, value float64) []float64 {
+	history := make([]float64, days)
+	for i := range history {
+		history[i] = value
+	}
+	return history
+}
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestFit(t *testing.T) {
+	weekend := map[time.Weekday]float64{
+		time.Monday: 4, time.Tuesday: 4, time.Wednesday: 4, time.Thursday: 4, time.Friday: 4,
+		time.Saturday: 14, time.Sunday: 14,
+	}
+
+	tests := []struct {
+		name     string
+		model    Model
+		history  []float64
+		day      time.Time
+		expected float64
+	}{
+		{
+			name:     "no history forecasts nothing",
+			history:  nil,
+			day:      monday,
+			expected: 0,
+		},
+		{
+			name:     "steady sales forecast the same",
+			history:  constant(28, 6),
+			day:      monday.AddDate(0, 0, 28),
+			expected: 6,
+		},
+		{
+			name:     "moving average of steady sales",
+			model:    Model{Method: MovingAverage},
+			history:  constant(28, 6),
+			day:      monday.AddDate(0, 0, 28),
+			expected: 6,
+		},
+		{
+			name:     "weekend days sell more",
+			history:  weekly(8, weekend),
+			day:      monday.AddDate(0, 0, 61), // a saturday
+			expected: 14,
+		},
+		{
+			name:     "weekdays sell less",
+			model:    Model{Method: MovingAverage},
+			history:  weekly(8, weekend),
+			day:      monday.AddDate(0, 0, 58), // a wednesday
+			expected: 4,
+		},
+		{
+			name:     "a short history has no seasonality",
+			history:  weekly(1, weekend),
+			day:      monday.AddDate(0, 0, 12),
+			expected: 48.0 / 7,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			forecast, err := tc.model.Fit(tc.history, monday)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if demand := forecast.Demand(tc.day); !near(demand, tc.expected, 0.01) {
+				t.Errorf("expected %.2f on %s, got %.2f", tc.expected, tc.day.Weekday(), demand)
+			}
+		})
+	}
+
+	t.Run("unknown method", func(t *testing.T) {
+		if _, err := (Model{Method: "guess"}).Fit(constant(7, 1), monday); err != ErrUnknownMethod {
+			t.Errorf("expected ErrUnknownMethod, got %v", err)
+		}
+	})
+
+	t.Run("a week of demand adds up", func(t *testing.T) {
+		forecast, _ := Model{}.Fit(weekly(8, weekend), monday)
+		if total := forecast.Over(monday.AddDate(0, 0, 56), 7); !near(total, 48, 0.01) {
+			t.Errorf("expected 48 units over a week, got %.2f", total)
+		}
+	})
+}
+
+func TestFitFollowsChanges(t *testing.T) {
+	// four weeks at 10 a day, then a week at 20
+	history := append(constant(28, 10), constant(7, 20)...)
+
+	smoothed, _ := Model{Method: ExponentialSmoothing, Alpha: 0.5}.Fit(history, monday)
+	slow, _ := Model{Method: ExponentialSmoothing, Alpha: 0.05}.Fit(history, monday)
+	averaged, _ := Model{Method: MovingAverage, Window: 7}.Fit(history, monday)
+	longAveraged, _ := Model{Method: MovingAverage, Window: 35}.Fit(history, monday)
+
+	if !near(smoothed.Level, 20, 0.1) {
+		t.Errorf("expected a high alpha to follow the change to 20, got %.2f", smoothed.Level)
+	}
+	if slow.Level >= smoothed.Level || slow.Level <= 10 {
+		t.Errorf("expected a low alpha to lag between 10 and %.2f, got %.2f", smoothed.Level, slow.Level)
+	}
+	if !near(averaged.Level, 20, 0.01) {
+		t.Errorf("expected a week's moving average of 20, got %.2f", averaged.Level)
+	}
+	if !near(longAveraged.Level, 12, 0.01) {
+		t.Errorf("expected a five week moving average of 12, got %.2f", longAveraged.Level)
+	}
+}
+
+func TestFitNoisyHistory(t *testing.T) {
+	// eight weeks of sales around 10 a day on weekdays and 20 at weekends
+	random := rand.New(rand.NewSource(1))
+	history := weekly(8, map[time.Weekday]float64{
+		time.Monday: 10, time.Tuesday: 10, time.Wednesday: 10, time.Thursday: 10, time.Friday: 10,
+		time.Saturday: 20, time.Sunday: 20,
+	})
+	for i := range history {
+		history[i] += float64(random.Intn(5) - 2)
+	}
+
+	forecast, err := Model{}.Fit(history, monday)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	saturday := monday.AddDate(0, 0, 61)
+	tuesday := monday.AddDate(0, 0, 57)
+	if demand := forecast.Demand(saturday); !near(demand, 20, 2.5) {
+		t.Errorf("expected about 20 on a saturday, got %.2f", demand)
+	}
+	if demand := forecast.Demand(tuesday); !near(demand, 10, 1.5) {
+		t.Errorf("expected about 10 on a tuesday, got %.2f", demand)
+	}
+}
+
+func TestFitSkipsUnknownDays(t *testing.T) {
+	// steady sales of 10 a day, with days that sold out after 2 units
+	censored := constant(28, 10)
+	for _, day := range []int{5, 6, 12, 13, 19, 20, 26, 27} {
+		censored[day] = 2
+	}
+	dropped := append([]float64{}, censored...)
+	for _, day := range []int{5, 6, 12, 13, 19, 20, 26, 27} {
+		dropped[day] = math.NaN()
+	}
+
+	biased, _ := Model{Method: MovingAverage}.Fit(censored, monday)
+	fitted, err := Model{Method: MovingAverage}.Fit(dropped, monday)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	saturday := monday.AddDate(0, 0, 33)
+	if demand := biased.Demand(saturday); demand >= 5 {
+		t.Fatalf("expected sold out weekends to look quiet, got %.2f", demand)
+	}
+	if demand := fitted.Demand(saturday); !near(demand, 10, 0.01) {
+		t.Errorf("expected 10 on a saturday once sold out days are dropped, got %.2f", demand)
+	}
+
+	t.Run("only unknown days forecast nothing", func(t *testing.T) {
+		forecast, err := Model{}.Fit([]float64{math.NaN(), math.NaN()}, monday)
+		if err != nil || forecast.Level != 0 {
+			t.Errorf("expected no demand, got %.2f and %v", forecast.Level, err)
+		}
+	})
+}
+
+func TestDropSoldOut(t *testing.T) {
+	tests := []struct {
+		name    string
+		sold    []float64
+		loaded  []float64
+		stock   int
+		soldOut []bool
+	}{
+		{
+			name:    "stock left every day",
+			sold:    []float64{2, 3, 1},
+			loaded:  []float64{0, 0, 0},
+			stock:   4,
+			soldOut: []bool{false, false, false},
+		},
+		{
+			name:    "sold out on the last day",
+			sold:    []float64{2, 3, 1},
+			loaded:  []float64{0, 0, 0},
+			stock:   0,
+			soldOut: []bool{false, false, true},
+		},
+		{
+			name:    "sold out until a restock",
+			sold:    []float64{3, 0, 0, 4},
+			loaded:  []float64{0, 0, 10, 0},
+			stock:   6,
+			soldOut: []bool{true, true, false, false},
+		},
+		{
+			name:    "loads missing for older days",
+			sold:    []float64{1, 1},
+			loaded:  nil,
+			stock:   1,
+			soldOut: []bool{false, false},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			history := DropSoldOut(tc.sold, tc.loaded, tc.stock)
+			for day, soldOut := range tc.soldOut {
+				if math.IsNaN(history[day]) != soldOut {
+					t.Errorf("day %d: expected sold out %v, got %v", day, soldOut, history)
+				}
+				if !soldOut && history[day] != tc.sold[day] {
+					t.Errorf("day %d: expected %.0f sold, got %v", day, tc.sold[day], history[day])
+				}
+			}
+		})
+	}
+}
+
+func TestDaily(t *testing.T) {
+	lagos := time.FixedZone("WAT", 3600)
+	from := time.Date(2023, time.March, 1, 15, 0, 0, 0, lagos)
+	sales := []Sale{
+		{At: time.Date(2023, time.March, 1, 8, 0, 0, 0, lagos), Quantity: 2},
+		{At: time.Date(2023, time.March, 1, 23, 30, 0, 0, lagos), Quantity: 1},
+		{At: time.Date(2023, time.March, 1, 23, 30, 0, 0, time.UTC), Quantity: 4}, // 00:30 on the 2nd in lagos
+		{At: time.Date(2023, time.March, 3, 12, 0, 0, 0, lagos), Quantity: 3},
+		{At: time.Date(2023, time.February, 28, 12, 0, 0, 0, lagos), Quantity: 9},
+		{At: time.Date(2023, time.March, 4, 0, 0, 0, 0, lagos), Quantity: 9},
+	}
+
+	history := Daily(sales, from, 3)
+	expected := []float64{3, 4, 3}
+	for i := range expected {
+		if history[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, history)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	steady, _ := Model{}.Fit(constant(28, 5), monday)
+	today := monday.AddDate(0, 0, 28)
+
+	tests := []struct {
+		name       string
+		forecast   Forecast
+		stock      Stock
+		needsVisit bool
+		days       int
+		projected  int
+		quantity   int
+	}{
+		{
+			name:       "restock when stock reaches par",
+			forecast:   steady,
+			stock:      Stock{Quantity: 30, Capacity: 60, ParLevel: 10},
+			needsVisit: true,
+			days:       4,
+			projected:  10,
+			quantity:   35, // a week of 35 plus par, less the 10 left
+		},
+		{
+			name:       "load is capped by capacity",
+			forecast:   steady,
+			stock:      Stock{Quantity: 12, Capacity: 20, ParLevel: 2},
+			needsVisit: true,
+			days:       2,
+			projected:  2,
+			quantity:   18,
+		},
+		{
+			name:       "stock already at par needs a visit today",
+			forecast:   steady,
+			stock:      Stock{Quantity: 3, Capacity: 40, ParLevel: 3},
+			needsVisit: true,
+			days:       0,
+			projected:  3,
+			quantity:   35,
+		},
+		{
+			name:     "stock outlasting the horizon needs no visit",
+			forecast: steady,
+			stock:    Stock{Quantity: 200, Capacity: 200, ParLevel: 10},
+			days:     28,
+		},
+		{
+			name:     "a product that does not sell needs no visit",
+			forecast: Forecast{Seasonality: steady.Seasonality},
+			stock:    Stock{Quantity: 5, Capacity: 10, ParLevel: 2},
+			days:     28,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			suggestion := Suggest(tc.forecast, tc.stock, today.Add(9*time.Hour), 28, 7)
+			if suggestion.NeedsVisit != tc.needsVisit || suggestion.Days != tc.days {
+				t.Fatalf("expected visit %v in %d days, got %v in %d days", tc.needsVisit, tc.days, suggestion.NeedsVisit, suggestion.Days)
+			}
+			if !tc.needsVisit {
+				return
+			}
+			if !suggestion.RestockBy.Equal(today.AddDate(0, 0, tc.days)) {
+				t.Errorf("expected to restock by %s, got %s", today.AddDate(0, 0, tc.days), suggestion.RestockBy)
+			}
+			if suggestion.Projected != tc.projected || suggestion.Quantity != tc.quantity {
+				t.Errorf("expected %d left and %d to load, got %d and %d", tc.projected, tc.quantity, suggestion.Projected, suggestion.Quantity)
+			}
+		})
+	}
+}
@@ -5,19 +5,19 @@ go 1.17
 require (
 	github.com/go-playground/locales v0.12.1 // indirect
 	github.com/go-playground/universal-translator v0.16.0 // indirect
-	github.com/go-playground/validator v9.31.0+incompatible // indirect
+	github.com/go-playground/validator v9.31.0+incompatible
 	github.com/go-sql-driver/mysql v1.6.0 // indirect
-	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
+	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/gorilla/handlers v1.5.1
-	github.com/gorilla/mux v1.8.0 // indirect
+	github.com/gorilla/mux v1.8.0
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.3 // indirect
-	github.com/joho/godotenv v1.4.0 // indirect
+	github.com/joho/godotenv v1.4.0
 	github.com/leodido/go-urn v1.1.0 // indirect
-	github.com/rs/cors v1.8.0 // indirect
-	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871 // indirect
+	github.com/rs/cors v1.8.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	gorm.io/driver/mysql v1.2.0
-	gorm.io/gorm v1.22.3 // indirect
+	gorm.io/gorm v1.22.3
 )
 
 require github.com/felixge/httpsnoop v1.0.1 // indirect
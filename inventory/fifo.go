@@ -0,0 +1,66 @@
+// Package inventory decides which stock lots a sale is taken from and what a
+// machine needs to be restocked with.
+package inventory
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+// ErrInsufficientStock is returned when the sellable lots cannot cover a sale.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// Expired reports whether lot has expired at the given unix time.
+func Expired(lot models.StockLot, at int64) bool {
+	return lot.ExpiresAt != 0 && lot.ExpiresAt <= at
+}
+
+// Allocate takes quantity units from lots, earliest expiry first, at the given
+// unix time. Expired and empty lots are skipped and lots without an expiry are
+// used last. Lots expiring together are used in the order they were received.
+func Allocate(lots []models.StockLot, quantity int, at int64) ([]models.LotAllocation, error) {
+	sellable := make([]models.StockLot, 0, len(lots))
+	for _, lot := range lots {
+		if lot.Remaining > 0 && !Expired(lot, at) {
+			sellable = append(sellable, lot)
+		}
+	}
+
+	sort.SliceStable(sellable, func(i, j int) bool {
+		a, b := sellable[i], sellable[j]
+		if a.ExpiresAt != b.ExpiresAt {
+			if a.ExpiresAt == 0 || b.ExpiresAt == 0 {
+				return b.ExpiresAt == 0
+			}
+			return a.ExpiresAt < b.ExpiresAt
+		}
+		return a.ID < b.ID
+	})
+
+	var allocations []models.LotAllocation
+	for _, lot := range sellable {
+		if quantity == 0 {
+			break
+		}
+
+		take := lot.Remaining
+		if take > quantity {
+			take = quantity
+		}
+		allocations = append(allocations, models.LotAllocation{
+			LotID:     lot.ID,
+			LotCode:   lot.LotCode,
+			ExpiresAt: lot.ExpiresAt,
+			Quantity:  take,
+		})
+		quantity -= take
+	}
+
+	if quantity > 0 {
+		return nil, ErrInsufficientStock
+	}
+
+	return allocations, nil
+}
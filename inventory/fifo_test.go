@@ -0,0 +1,81 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+const now = 1700000000
+
+func TestAllocate(t *testing.T) {
+	lots := []models.StockLot{
+		{ID: 1, LotCode: "late", Remaining: 5, ExpiresAt: now + 300},
+		{ID: 2, LotCode: "never", Remaining: 5},
+		{ID: 3, LotCode: "early", Remaining: 2, ExpiresAt: now + 100},
+		{ID: 4, LotCode: "expired", Remaining: 9, ExpiresAt: now},
+		{ID: 5, LotCode: "empty", Remaining: 0, ExpiresAt: now + 50},
+		{ID: 6, LotCode: "late-second", Remaining: 1, ExpiresAt: now + 300},
+	}
+
+	tests := []struct {
+		name     string
+		quantity int
+		expected []models.LotAllocation
+		err      error
+	}{
+		{
+			name:     "earliest expiry is used first",
+			quantity: 1,
+			expected: []models.LotAllocation{{LotID: 3, LotCode: "early", ExpiresAt: now + 100, Quantity: 1}},
+		},
+		{
+			name:     "spills over into the next lot",
+			quantity: 4,
+			expected: []models.LotAllocation{
+				{LotID: 3, LotCode: "early", ExpiresAt: now + 100, Quantity: 2},
+				{LotID: 1, LotCode: "late", ExpiresAt: now + 300, Quantity: 2},
+			},
+		},
+		{
+			name:     "lots without expiry are used last",
+			quantity: 10,
+			expected: []models.LotAllocation{
+				{LotID: 3, LotCode: "early", ExpiresAt: now + 100, Quantity: 2},
+				{LotID: 1, LotCode: "late", ExpiresAt: now + 300, Quantity: 5},
+				{LotID: 6, LotCode: "late-second", ExpiresAt: now + 300, Quantity: 1},
+				{LotID: 2, LotCode: "never", Quantity: 2},
+			},
+		},
+		{
+			name:     "expired lots are not sold",
+			quantity: 14,
+			err:      ErrInsufficientStock,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			allocations, err := Allocate(lots, tc.quantity, now)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(allocations, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, allocations)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	if Expired(models.StockLot{}, now) {
+		t.Error("lot without expiry should never expire")
+	}
+	if !Expired(models.StockLot{ExpiresAt: now}, now) {
+		t.Error("lot should expire at its expiry time")
+	}
+	if Expired(models.StockLot{ExpiresAt: now + 1}, now) {
+		t.Error("lot should not expire before its expiry time")
+	}
+}
@@ -0,0 +1,56 @@
+package inventory
+
+import (
+	"sort"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+// Need is the number of units to load into slot to fill it. A slot is only
+// filled once it is down to its par level, so a par level of zero fills it when
+// it sells out. Slots without a product need nothing.
+func Need(slot models.MachineSlot) int {
+	if slot.ProductID == 0 || slot.Quantity > slot.ParLevel || slot.Quantity >= slot.Capacity {
+		return 0
+	}
+	return slot.Capacity - slot.Quantity
+}
+
+// PickList returns the slots that need restocking, in slot code order, with the
+// units to pick for each.
+func PickList(slots []models.MachineSlot) []models.RestockItem {
+	items := []models.RestockItem{}
+	for _, slot := range slots {
+		need := Need(slot)
+		if need == 0 {
+			continue
+		}
+		items = append(items, models.RestockItem{
+			SlotCode:  slot.Code,
+			ProductID: slot.ProductID,
+			Quantity:  slot.Quantity,
+			ParLevel:  slot.ParLevel,
+			Capacity:  slot.Capacity,
+			Pick:      need,
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].SlotCode < items[j].SlotCode })
+	return items
+}
+
+// PickTotals adds up the units to pick of each product across items, in product order.
+func PickTotals(items []models.RestockItem) []models.PickTotal {
+	units := map[uint]int{}
+	for _, item := range items {
+		units[item.ProductID] += item.Pick
+	}
+
+	totals := make([]models.PickTotal, 0, len(units))
+	for productID, count := range units {
+		totals = append(totals, models.PickTotal{ProductID: productID, Units: count})
+	}
+
+	sort.Slice(totals, func(i, j int) bool { return totals[i].ProductID < totals[j].ProductID })
+	return totals
+}
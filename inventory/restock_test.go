@@ -0,0 +1,87 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+func TestNeed(t *testing.T) {
+	tests := []struct {
+		name     string
+		slot     models.MachineSlot
+		expected int
+	}{
+		{
+			name:     "above par needs nothing",
+			slot:     models.MachineSlot{ProductID: 1, Quantity: 4, ParLevel: 3, Capacity: 10},
+			expected: 0,
+		},
+		{
+			name:     "at par is filled to capacity",
+			slot:     models.MachineSlot{ProductID: 1, Quantity: 3, ParLevel: 3, Capacity: 10},
+			expected: 7,
+		},
+		{
+			name:     "zero par is filled once sold out",
+			slot:     models.MachineSlot{ProductID: 1, Quantity: 0, ParLevel: 0, Capacity: 8},
+			expected: 8,
+		},
+		{
+			name:     "zero par with stock left needs nothing",
+			slot:     models.MachineSlot{ProductID: 1, Quantity: 1, ParLevel: 0, Capacity: 8},
+			expected: 0,
+		},
+		{
+			name:     "par at capacity when full needs nothing",
+			slot:     models.MachineSlot{ProductID: 1, Quantity: 5, ParLevel: 5, Capacity: 5},
+			expected: 0,
+		},
+		{
+			name:     "slot without a product needs nothing",
+			slot:     models.MachineSlot{Quantity: 0, ParLevel: 2, Capacity: 10},
+			expected: 0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if need := Need(tc.slot); need != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, need)
+			}
+		})
+	}
+}
+
+func TestPickList(t *testing.T) {
+	slots := []models.MachineSlot{
+		{Code: "B1", ProductID: 7, Quantity: 0, ParLevel: 2, Capacity: 6},
+		{Code: "A2", ProductID: 9, Quantity: 5, ParLevel: 2, Capacity: 6},
+		{Code: "A1", ProductID: 7, Quantity: 2, ParLevel: 2, Capacity: 10},
+		{Code: "C1", ProductID: 3, Quantity: 1, ParLevel: 1, Capacity: 4},
+	}
+
+	items := PickList(slots)
+	expected := []models.RestockItem{
+		{SlotCode: "A1", ProductID: 7, Quantity: 2, ParLevel: 2, Capacity: 10, Pick: 8},
+		{SlotCode: "B1", ProductID: 7, Quantity: 0, ParLevel: 2, Capacity: 6, Pick: 6},
+		{SlotCode: "C1", ProductID: 3, Quantity: 1, ParLevel: 1, Capacity: 4, Pick: 3},
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, items)
+	}
+
+	totals := PickTotals(items)
+	expectedTotals := []models.PickTotal{{ProductID: 3, Units: 3}, {ProductID: 7, Units: 14}}
+	if !reflect.DeepEqual(totals, expectedTotals) {
+		t.Errorf("expected %+v, got %+v", expectedTotals, totals)
+	}
+
+	t.Run("a full machine has an empty pick list", func(t *testing.T) {
+		items := PickList([]models.MachineSlot{{Code: "A1", ProductID: 1, Quantity: 6, ParLevel: 2, Capacity: 6}})
+		if len(items) != 0 || len(PickTotals(items)) != 0 {
+			t.Errorf("expected nothing to pick, got %+v", items)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Package loyalty computes the loyalty points a buyer earns on an order.
+package loyalty
+
+import "github.com/femibiwoye/go-test/models"
+
+// Line is the amount spent on a product in an order.
+type Line struct {
+	ProductID uint
+	Spent     int
+}
+
+// PointsForOrder returns the points earned on an order paying amountPaid
+// at the given unix time. Whole-order rules are applied to amountPaid and
+// product rules to what was spent on their product, capped at amountPaid.
+func PointsForOrder(rules []models.EarningRule, amountPaid int, lines []Line, at int64) int {
+	points := 0
+
+	for _, rule := range rules {
+		if !rule.ActiveAt(at) || rule.SpendUnit < 1 || rule.Points < 1 {
+			continue
+		}
+
+		if rule.ProductID == 0 {
+			points += amountPaid / rule.SpendUnit * rule.Points
+			continue
+		}
+
+		spent := 0
+		for _, line := range lines {
+			if line.ProductID == rule.ProductID {
+				spent += line.Spent
+			}
+		}
+		if spent > amountPaid {
+			spent = amountPaid
+		}
+		points += spent / rule.SpendUnit * rule.Points
+	}
+
+	return points
+}
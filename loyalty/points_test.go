@@ -0,0 +1,61 @@
+package loyalty
+
+import (
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+const now = 1700000000
+
+func TestPointsForOrder(t *testing.T) {
+	everyDollar := models.EarningRule{ID: 1, SpendUnit: 100, Points: 1, Active: true}
+	doubleOnCola := models.EarningRule{ID: 2, ProductID: 7, SpendUnit: 50, Points: 1, Active: true}
+
+	tests := []struct {
+		name       string
+		rules      []models.EarningRule
+		amountPaid int
+		lines      []Line
+		expected   int
+	}{
+		{
+			name:       "whole order rule rounds down",
+			rules:      []models.EarningRule{everyDollar},
+			amountPaid: 250,
+			expected:   2,
+		},
+		{
+			name:       "product rule adds a bonus",
+			rules:      []models.EarningRule{everyDollar, doubleOnCola},
+			amountPaid: 300,
+			lines:      []Line{{ProductID: 7, Spent: 100}, {ProductID: 8, Spent: 200}},
+			expected:   5,
+		},
+		{
+			name:       "product bonus is capped at the amount paid",
+			rules:      []models.EarningRule{doubleOnCola},
+			amountPaid: 50,
+			lines:      []Line{{ProductID: 7, Spent: 200}},
+			expected:   1,
+		},
+		{
+			name: "inactive and expired rules earn nothing",
+			rules: []models.EarningRule{
+				{SpendUnit: 1, Points: 1, Active: false},
+				{SpendUnit: 1, Points: 1, Active: true, EndsAt: now},
+				{SpendUnit: 1, Points: 1, Active: true, StartsAt: now + 1},
+			},
+			amountPaid: 100,
+			expected:   0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if points := PointsForOrder(test.rules, test.amountPaid, test.lines, now); points != test.expected {
+				t.Errorf("got %d points expected %d", points, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package machine
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Fleet holds a Machine for each machine of the operator, by id, and a Machine for
+// each buyer session open at it. Many buyers can hold credit in the same machine, so
+// the machine itself only follows whether it is in service and every sale runs
+// through the session of its buyer.
+type Fleet struct {
+	mu            sync.Mutex
+	denominations []int
+	machines      map[uint]*Machine
+	sessions      map[uint]map[string]*Machine
+}
+
+// NewFleet returns an empty fleet of machines accepting coins of the given denominations.
+func NewFleet(denominations []int) *Fleet {
+	return &Fleet{
+		denominations: denominations,
+		machines:      map[uint]*Machine{},
+		sessions:      map[uint]map[string]*Machine{},
+	}
+}
+
+// Machine returns the machine with id, starting it idle, or out of service
+// when inService is false, the first time it is used.
+func (f *Fleet) Machine(id uint, inService bool) *Machine {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.machine(id, inService)
+}
+
+func (f *Fleet) machine(id uint, inService bool) *Machine {
+	m, ok := f.machines[id]
+	if !ok {
+		m = New(f.denominations)
+		if !inService {
+			m.state = OutOfService
+		}
+		f.machines[id] = m
+	}
+	return m
+}
+
+// FireSession moves the session of a buyer at machine id through event. Sessions start
+// idle and are forgotten once they are idle again. Credit is kept by the frontend, so
+// a session lost on a restart starts idle and its buyer carries on from there. Events
+// are refused while the machine is out of service or broken.
+func (f *Fleet) FireSession(id uint, session string, inService bool, event Event) (State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if state := f.machine(id, inService).State(); state == OutOfService || state == Error {
+		return state, fmt.Errorf("%w: cannot %s while %s", ErrInvalidTransition, event, state)
+	}
+
+	if f.sessions[id] == nil {
+		f.sessions[id] = map[string]*Machine{}
+	}
+	m, ok := f.sessions[id][session]
+	if !ok {
+		m = New(f.denominations)
+		f.sessions[id][session] = m
+	}
+
+	state, err := m.Fire(event)
+	if state == Idle {
+		f.forget(id, session)
+	}
+	return state, err
+}
+
+// EndSession forgets the session of a buyer at machine id, whatever state it is in.
+func (f *Fleet) EndSession(id uint, session string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forget(id, session)
+}
+
+func (f *Fleet) forget(id uint, session string) {
+	delete(f.sessions[id], session)
+	if len(f.sessions[id]) == 0 {
+		delete(f.sessions, id)
+	}
+}
+
+// Reset forgets every session at machine id, e.g. when it is taken out of service.
+func (f *Fleet) Reset(id uint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sessions, id)
+}
+
+// Sessions returns the state of each session open at machine id, by session.
+func (f *Fleet) Sessions(id uint) map[string]State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	states := make(map[string]State, len(f.sessions[id]))
+	for session, m := range f.sessions[id] {
+		states[session] = m.State()
+	}
+	return states
+}
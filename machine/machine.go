@@ -0,0 +1,397 @@
+// Package machine models the hardware of a vending machine as a state machine.
+// The REST API and the simulator are both frontends driving it through events.
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/femibiwoye/go-test/coins"
+)
+
+// State is what the machine is doing.
+type State string
+
+// Machine states
+const (
+	Idle             State = "idle"
+	AcceptingCoins   State = "accepting_coins"
+	Vending          State = "vending"
+	DispensingChange State = "dispensing_change"
+	OutOfService     State = "out_of_service"
+	Error            State = "error"
+)
+
+// Event is something that happens to the machine.
+type Event string
+
+// Machine events
+const (
+	EventCoin            Event = "coin"
+	EventSelect          Event = "select"
+	EventVended          Event = "vended"
+	EventVendAborted     Event = "vend_aborted"
+	EventVendFailed      Event = "vend_failed"
+	EventSessionEnd      Event = "session_end"
+	EventCancel          Event = "cancel"
+	EventChangeDispensed Event = "change_dispensed"
+	EventFault           Event = "fault"
+	EventRepair          Event = "repair"
+	EventShutdown        Event = "shutdown"
+	EventService         Event = "service"
+)
+
+// transitions lists the state each event moves the machine to, by the state it starts in.
+// Buyers with credit already held for them can select or cancel straight from idle.
+var transitions = map[State]map[Event]State{
+	Idle: {
+		EventCoin:     AcceptingCoins,
+		EventSelect:   Vending,
+		EventCancel:   DispensingChange,
+		EventFault:    Error,
+		EventShutdown: OutOfService,
+	},
+	AcceptingCoins: {
+		EventCoin:       AcceptingCoins,
+		EventSelect:     Vending,
+		EventCancel:     DispensingChange,
+		EventSessionEnd: Idle,
+		EventFault:      Error,
+	},
+	Vending: {
+		EventVended:      AcceptingCoins,
+		EventVendAborted: AcceptingCoins,
+		EventVendFailed:  Error,
+		EventFault:       Error,
+	},
+	DispensingChange: {
+		EventChangeDispensed: Idle,
+		EventFault:           Error,
+	},
+	Error: {
+		EventRepair:   Idle,
+		EventShutdown: OutOfService,
+	},
+	OutOfService: {
+		EventService: Idle,
+	},
+}
+
+var (
+	// ErrInvalidTransition is returned for an event the machine cannot handle in its current state.
+	ErrInvalidTransition  = errors.New("invalid transition")
+	ErrCoinRejected       = errors.New("coin rejected")
+	ErrUnknownSlot        = errors.New("unknown slot")
+	ErrSoldOut            = errors.New("slot is sold out")
+	ErrInsufficientCredit = errors.New("insufficient credit")
+
+	errNoVend = fmt.Errorf("%w: no product is being vended", ErrInvalidTransition)
+)
+
+// Next returns the state event moves a machine in state to.
+func Next(state State, event Event) (State, error) {
+	next, ok := transitions[state][event]
+	if !ok {
+		return state, fmt.Errorf("%w: cannot %s while %s", ErrInvalidTransition, event, state)
+	}
+	return next, nil
+}
+
+// Transition is a change of state caused by an event.
+type Transition struct {
+	From  State
+	Event Event
+	To    State
+}
+
+// Slot is a slot of the machine with the price and number of the product in it.
+type Slot struct {
+	Price    int
+	Quantity int
+}
+
+// Vend is a product being dispensed.
+type Vend struct {
+	Slot  string
+	Price int
+}
+
+// Machine is a single vending machine. It is safe for concurrent use.
+type Machine struct {
+	mu      sync.Mutex
+	state   State
+	credit  int
+	fault   string
+	accepts map[int]bool
+	coins   map[int]int
+	slots   map[string]Slot
+	vend    *Vend
+
+	// OnTransition, when set, is called after every change of state.
+	OnTransition func(Transition)
+}
+
+// New returns an idle machine that accepts coins of the given denominations.
+func New(denominations []int) *Machine {
+	accepts := make(map[int]bool, len(denominations))
+	for _, denomination := range denominations {
+		accepts[denomination] = true
+	}
+
+	return &Machine{
+		state:   Idle,
+		accepts: accepts,
+		coins:   map[int]int{},
+		slots:   map[string]Slot{},
+	}
+}
+
+// State returns the current state of the machine.
+func (m *Machine) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Credit returns the credit held for the current buyer.
+func (m *Machine) Credit() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.credit
+}
+
+// Fault returns the reason for the last fault, if the machine is in the error state.
+func (m *Machine) Fault() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fault
+}
+
+// Coins returns the number of coins of each denomination in the machine.
+func (m *Machine) Coins() map[int]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inventory := make(map[int]int, len(m.coins))
+	for denomination, count := range m.coins {
+		inventory[denomination] = count
+	}
+	return inventory
+}
+
+// Slot returns the slot with the given code.
+func (m *Machine) Slot(code string) (Slot, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	slot, ok := m.slots[code]
+	return slot, ok
+}
+
+// Fire moves the machine through event without touching credit, coins or stock.
+// Frontends that keep those elsewhere use it to follow the state of the machine.
+func (m *Machine) Fire(event Event) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fire(event)
+}
+
+func (m *Machine) fire(event Event) (State, error) {
+	next, err := Next(m.state, event)
+	if err != nil {
+		return m.state, err
+	}
+
+	from := m.state
+	m.state = next
+	if next != Error {
+		m.fault = ""
+	}
+	if m.OnTransition != nil {
+		m.OnTransition(Transition{From: from, Event: event, To: next})
+	}
+
+	return next, nil
+}
+
+// Restock sets the price and stock of a slot.
+func (m *Machine) Restock(code string, price, quantity int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slots[code] = Slot{Price: price, Quantity: quantity}
+}
+
+// LoadCoins adds count coins of denomination to the machine, for change.
+func (m *Machine) LoadCoins(denomination, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.coins[denomination] += count
+}
+
+// InsertCoin credits the buyer with a coin. Coins the machine does not accept
+// are returned and leave the machine as it was.
+func (m *Machine) InsertCoin(coin int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := Next(m.state, EventCoin); err != nil {
+		return err
+	}
+	if !m.accepts[coin] {
+		return fmt.Errorf("%w: %d", ErrCoinRejected, coin)
+	}
+
+	m.credit += coin
+	m.coins[coin]++
+	_, err := m.fire(EventCoin)
+	return err
+}
+
+// Select starts vending the product in slot code, charging its price to the credit.
+func (m *Machine) Select(code string) (Vend, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := Next(m.state, EventSelect); err != nil {
+		return Vend{}, err
+	}
+
+	slot, ok := m.slots[code]
+	if !ok {
+		return Vend{}, fmt.Errorf("%w: %s", ErrUnknownSlot, code)
+	}
+	if slot.Quantity < 1 {
+		return Vend{}, fmt.Errorf("%w: %s", ErrSoldOut, code)
+	}
+	if m.credit < slot.Price {
+		return Vend{}, ErrInsufficientCredit
+	}
+
+	m.credit -= slot.Price
+	m.vend = &Vend{Slot: code, Price: slot.Price}
+	if _, err := m.fire(EventSelect); err != nil {
+		return Vend{}, err
+	}
+
+	return *m.vend, nil
+}
+
+// Dispensed records that the product being vended dropped. The session ends
+// once the buyer has no credit left.
+func (m *Machine) Dispensed() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.vend == nil {
+		return errNoVend
+	}
+	if _, err := m.fire(EventVended); err != nil {
+		return err
+	}
+
+	slot := m.slots[m.vend.Slot]
+	slot.Quantity--
+	m.slots[m.vend.Slot] = slot
+	m.vend = nil
+
+	if m.credit == 0 {
+		_, err := m.fire(EventSessionEnd)
+		return err
+	}
+	return nil
+}
+
+// Jam records that the product being vended did not drop. The buyer is refunded
+// and the machine stops in the error state until it is repaired.
+func (m *Machine) Jam(reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.vend == nil {
+		return errNoVend
+	}
+	if _, err := m.fire(EventVendFailed); err != nil {
+		return err
+	}
+
+	m.credit += m.vend.Price
+	m.vend = nil
+	m.fault = reason
+	return nil
+}
+
+// Cancel ends the session of the buyer so their credit is paid out.
+func (m *Machine) Cancel() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.fire(EventCancel)
+	return err
+}
+
+// DispenseChange pays out the credit in the fewest coins the machine holds and returns
+// to idle. Credit that cannot be paid out exactly stays with the machine and is returned.
+func (m *Machine) DispenseChange() (map[int]int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := Next(m.state, EventChangeDispensed); err != nil {
+		return nil, 0, err
+	}
+
+	change, paid := coins.MakeChange(m.credit, m.coins)
+	for denomination, count := range change {
+		m.coins[denomination] -= count
+	}
+	m.credit -= paid
+
+	if _, err := m.fire(EventChangeDispensed); err != nil {
+		return nil, 0, err
+	}
+	return change, m.credit, nil
+}
+
+// Break puts the machine in the error state, refunding any vend in progress.
+func (m *Machine) Break(reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.fire(EventFault); err != nil {
+		return err
+	}
+
+	if m.vend != nil {
+		m.credit += m.vend.Price
+		m.vend = nil
+	}
+	m.fault = reason
+	return nil
+}
+
+// Repair returns a machine in the error state to idle. Credit held for the
+// buyer stays in the machine for them to spend or cancel.
+func (m *Machine) Repair() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.fire(EventRepair)
+	return err
+}
+
+// Shutdown takes an idle or broken machine out of service.
+func (m *Machine) Shutdown() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.fire(EventShutdown)
+	return err
+}
+
+// Service puts a machine that is out of service back in service.
+func (m *Machine) Service() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.fire(EventService)
+	return err
+}
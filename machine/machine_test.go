@@ -0,0 +1,248 @@
+package machine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var denominations = []int{5, 10, 20, 50, 100}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    State
+		event    Event
+		expected State
+		err      error
+	}{
+		{name: "coin starts a session", state: Idle, event: EventCoin, expected: AcceptingCoins},
+		{name: "select vends", state: AcceptingCoins, event: EventSelect, expected: Vending},
+		{name: "vended returns to accepting coins", state: Vending, event: EventVended, expected: AcceptingCoins},
+		{name: "jam breaks the machine", state: Vending, event: EventVendFailed, expected: Error},
+		{name: "coins are refused while vending", state: Vending, event: EventCoin, expected: Vending, err: ErrInvalidTransition},
+		{name: "out of service refuses coins", state: OutOfService, event: EventCoin, expected: OutOfService, err: ErrInvalidTransition},
+		{name: "busy machines cannot be shut down", state: AcceptingCoins, event: EventShutdown, expected: AcceptingCoins, err: ErrInvalidTransition},
+		{name: "repair returns to idle", state: Error, event: EventRepair, expected: Idle},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			next, err := Next(tc.state, tc.event)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if next != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, next)
+			}
+		})
+	}
+}
+
+func TestMachine(t *testing.T) {
+	t.Run("a vend charges the price and pays out the rest as change", func(t *testing.T) {
+		m := New(denominations)
+		m.Restock("A1", 65, 3)
+		m.LoadCoins(5, 4)
+
+		var transitions []Transition
+		m.OnTransition = func(transition Transition) { transitions = append(transitions, transition) }
+
+		mustDo(t, m.InsertCoin(50))
+		mustDo(t, m.InsertCoin(20))
+		vend, err := m.Select("A1")
+		mustDo(t, err)
+		if vend.Price != 65 || m.Credit() != 5 {
+			t.Fatalf("expected a vend of 65 leaving 5 credit, got %+v and %d", vend, m.Credit())
+		}
+		mustDo(t, m.Dispensed())
+		mustDo(t, m.Cancel())
+
+		change, remaining, err := m.DispenseChange()
+		mustDo(t, err)
+		if !reflect.DeepEqual(change, map[int]int{5: 1}) || remaining != 0 {
+			t.Errorf("expected one 5 coin, got %v with %d held", change, remaining)
+		}
+		if slot, _ := m.Slot("A1"); slot.Quantity != 2 {
+			t.Errorf("expected 2 left in A1, got %d", slot.Quantity)
+		}
+		if m.State() != Idle {
+			t.Errorf("expected idle, got %s", m.State())
+		}
+
+		expected := []State{AcceptingCoins, AcceptingCoins, Vending, AcceptingCoins, DispensingChange, Idle}
+		if len(transitions) != len(expected) {
+			t.Fatalf("expected %d transitions, got %v", len(expected), transitions)
+		}
+		for i, state := range expected {
+			if transitions[i].To != state {
+				t.Errorf("transition %d: expected %s, got %s", i, state, transitions[i].To)
+			}
+		}
+	})
+
+	t.Run("spending all the credit ends the session", func(t *testing.T) {
+		m := New(denominations)
+		m.Restock("B2", 50, 1)
+
+		mustDo(t, m.InsertCoin(50))
+		_, err := m.Select("B2")
+		mustDo(t, err)
+		mustDo(t, m.Dispensed())
+
+		if m.State() != Idle {
+			t.Errorf("expected idle, got %s", m.State())
+		}
+	})
+
+	t.Run("selections the buyer cannot have leave the machine as it was", func(t *testing.T) {
+		m := New(denominations)
+		m.Restock("A1", 65, 1)
+		m.Restock("A2", 10, 0)
+		mustDo(t, m.InsertCoin(20))
+
+		for code, expected := range map[string]error{"A1": ErrInsufficientCredit, "A2": ErrSoldOut, "Z9": ErrUnknownSlot} {
+			if _, err := m.Select(code); !errors.Is(err, expected) {
+				t.Errorf("%s: expected %v, got %v", code, expected, err)
+			}
+		}
+		if m.State() != AcceptingCoins || m.Credit() != 20 {
+			t.Errorf("expected accepting coins with 20 credit, got %s with %d", m.State(), m.Credit())
+		}
+	})
+
+	t.Run("unknown coins are rejected", func(t *testing.T) {
+		m := New(denominations)
+
+		if err := m.InsertCoin(3); !errors.Is(err, ErrCoinRejected) {
+			t.Fatalf("expected the coin to be rejected, got %v", err)
+		}
+		if m.State() != Idle || m.Credit() != 0 || len(m.Coins()) != 0 {
+			t.Errorf("expected an untouched machine, got %s with %d credit", m.State(), m.Credit())
+		}
+	})
+
+	t.Run("a jam refunds the buyer and needs a repair", func(t *testing.T) {
+		m := New(denominations)
+		m.Restock("A1", 20, 1)
+		mustDo(t, m.InsertCoin(20))
+		_, err := m.Select("A1")
+		mustDo(t, err)
+		mustDo(t, m.Jam("motor stalled"))
+
+		if m.State() != Error || m.Fault() != "motor stalled" || m.Credit() != 20 {
+			t.Fatalf("expected an error with 20 refunded, got %s %q %d", m.State(), m.Fault(), m.Credit())
+		}
+		if err := m.InsertCoin(10); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("expected coins to be refused while broken, got %v", err)
+		}
+
+		mustDo(t, m.Repair())
+		if m.State() != Idle || m.Fault() != "" {
+			t.Errorf("expected idle without a fault, got %s %q", m.State(), m.Fault())
+		}
+		if slot, _ := m.Slot("A1"); slot.Quantity != 1 {
+			t.Errorf("expected the jammed product to stay in stock, got %d", slot.Quantity)
+		}
+	})
+
+	t.Run("change the machine cannot pay stays as credit", func(t *testing.T) {
+		m := New(denominations)
+		mustDo(t, m.InsertCoin(5))
+		mustDo(t, m.Cancel())
+		m.mu.Lock()
+		m.coins = map[int]int{}
+		m.credit = 15
+		m.mu.Unlock()
+
+		change, remaining, err := m.DispenseChange()
+		mustDo(t, err)
+		if len(change) != 0 || remaining != 15 || m.Credit() != 15 {
+			t.Errorf("expected nothing paid and 15 held, got %v and %d", change, remaining)
+		}
+	})
+
+	t.Run("fire follows state without touching money", func(t *testing.T) {
+		m := New(denominations)
+
+		state, err := m.Fire(EventCoin)
+		mustDo(t, err)
+		if state != AcceptingCoins || m.Credit() != 0 {
+			t.Errorf("expected accepting coins with no credit, got %s with %d", state, m.Credit())
+		}
+		if err := m.Dispensed(); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("expected dispensing without a vend to fail, got %v", err)
+		}
+	})
+}
+
+func TestFleet(t *testing.T) {
+	fleet := NewFleet(denominations)
+
+	if fleet.Machine(1, true) != fleet.Machine(1, false) {
+		t.Error("expected the same machine for the same id")
+	}
+	if state := fleet.Machine(2, false).State(); state != OutOfService {
+		t.Errorf("expected a machine not in service to start out of service, got %s", state)
+	}
+
+	t.Run("buyers at the same machine have their own sessions", func(t *testing.T) {
+		fleet := NewFleet(denominations)
+
+		mustFire := func(session string, event Event, expected State) {
+			t.Helper()
+			state, err := fleet.FireSession(1, session, true, event)
+			mustDo(t, err)
+			if state != expected {
+				t.Fatalf("expected %s after %s for %s, got %s", expected, event, session, state)
+			}
+		}
+
+		mustFire("user:1", EventCoin, AcceptingCoins)
+		mustFire("user:2", EventCoin, AcceptingCoins)
+		mustFire("user:2", EventSelect, Vending)
+		mustFire("user:1", EventSelect, Vending)
+
+		if _, err := fleet.FireSession(1, "user:1", true, EventCoin); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("expected a coin while vending to fail, got %v", err)
+		}
+
+		mustFire("user:1", EventVended, AcceptingCoins)
+		mustFire("user:1", EventSessionEnd, Idle)
+
+		expected := map[string]State{"user:2": Vending}
+		if sessions := fleet.Sessions(1); !reflect.DeepEqual(sessions, expected) {
+			t.Errorf("expected only the second buyer to be vending, got %v", sessions)
+		}
+	})
+
+	t.Run("sessions wait while the machine is out of service", func(t *testing.T) {
+		fleet := NewFleet(denominations)
+
+		if _, err := fleet.FireSession(1, "user:1", true, EventCoin); err != nil {
+			t.Fatal(err)
+		}
+		mustDo(t, fleet.Machine(1, true).Shutdown())
+		fleet.Reset(1)
+
+		state, err := fleet.FireSession(1, "user:1", true, EventSelect)
+		if !errors.Is(err, ErrInvalidTransition) || state != OutOfService {
+			t.Errorf("expected out of service, got %s and %v", state, err)
+		}
+		if sessions := fleet.Sessions(1); len(sessions) != 0 {
+			t.Errorf("expected no sessions after a reset, got %v", sessions)
+		}
+
+		mustDo(t, fleet.Machine(1, true).Service())
+		if state, err := fleet.FireSession(1, "user:1", true, EventSelect); err != nil || state != Vending {
+			t.Errorf("expected a new session to vend, got %s and %v", state, err)
+		}
+	})
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,246 @@
+package machine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Step is one line of a simulator script: a command and its arguments.
+type Step struct {
+	Line    int
+	Command string
+	Args    []string
+}
+
+// Result is the outcome of running a step.
+type Result struct {
+	Step   Step
+	State  State
+	Credit int
+	Output string
+	Err    error
+}
+
+// ExpectationError is returned when an expect step of a script does not hold.
+type ExpectationError struct {
+	Step     Step
+	Expected string
+	Actual   string
+}
+
+func (e *ExpectationError) Error() string {
+	return fmt.Sprintf("line %d: expected %s, got %s", e.Step.Line, e.Expected, e.Actual)
+}
+
+// commandArgs is the number of arguments each script command takes. A command
+// taking -1 takes the rest of the line as a single argument.
+var commandArgs = map[string]int{
+	"coin":          1,
+	"select":        1,
+	"dispense":      0,
+	"jam":           1,
+	"cancel":        0,
+	"change":        0,
+	"fault":         1,
+	"repair":        0,
+	"shutdown":      0,
+	"service":       0,
+	"restock":       3,
+	"float":         2,
+	"expect":        1,
+	"expect-credit": 1,
+	"expect-error":  -1,
+}
+
+// ParseScript reads a simulator script. Each line is a command followed by its
+// arguments, for example:
+//
+//	restock A1 65 10
+//	float 5 20
+//	coin 50
+//	coin 20
+//	select A1
+//	dispense
+//	cancel
+//	change
+//	expect idle
+//
+// Blank lines and lines starting with # are ignored.
+func ParseScript(r io.Reader) ([]Step, error) {
+	var steps []Step
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		command := strings.ToLower(fields[0])
+		args, ok := commandArgs[command]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown command %q", line, fields[0])
+		}
+		rest := fields[1:]
+		switch {
+		case args < 0 && len(rest) == 0:
+			return nil, fmt.Errorf("line %d: %s needs an argument", line, command)
+		case args < 0:
+			rest = []string{strings.Join(rest, " ")}
+		case len(rest) != args:
+			return nil, fmt.Errorf("line %d: %s takes %d arguments", line, command, args)
+		}
+
+		steps = append(steps, Step{Line: line, Command: command, Args: rest})
+	}
+
+	return steps, scanner.Err()
+}
+
+// Simulator drives a machine through scripted sessions without any hardware.
+type Simulator struct {
+	Machine *Machine
+}
+
+// NewSimulator returns a simulator for a new machine accepting the given denominations.
+func NewSimulator(denominations []int) *Simulator {
+	return &Simulator{Machine: New(denominations)}
+}
+
+// Run runs steps in order and returns the result of each. Commands the machine
+// refuses are recorded in their result and the script carries on, so scripts can
+// check the machine rejects them. Run stops at the first expectation that fails.
+func (s *Simulator) Run(steps []Step) ([]Result, error) {
+	results := make([]Result, 0, len(steps))
+
+	var last error
+	for _, step := range steps {
+		result := Result{Step: step}
+
+		switch step.Command {
+		case "expect":
+			if state := s.Machine.State(); string(state) != step.Args[0] {
+				return results, &ExpectationError{step, step.Args[0], string(state)}
+			}
+		case "expect-credit":
+			if credit := strconv.Itoa(s.Machine.Credit()); credit != step.Args[0] {
+				return results, &ExpectationError{step, "credit " + step.Args[0], "credit " + credit}
+			}
+		case "expect-error":
+			actual := "no error"
+			if last != nil {
+				actual = last.Error()
+			}
+			if !strings.Contains(actual, step.Args[0]) {
+				return results, &ExpectationError{step, "error containing " + step.Args[0], actual}
+			}
+		default:
+			result.Output, result.Err = s.step(step)
+			last = result.Err
+		}
+
+		result.State = s.Machine.State()
+		result.Credit = s.Machine.Credit()
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (s *Simulator) step(step Step) (string, error) {
+	number := func(i int) (int, error) {
+		n, err := strconv.Atoi(step.Args[i])
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %q is not a number", step.Line, step.Args[i])
+		}
+		return n, nil
+	}
+
+	switch step.Command {
+	case "coin":
+		coin, err := number(0)
+		if err != nil {
+			return "", err
+		}
+		return "", s.Machine.InsertCoin(coin)
+	case "select":
+		vend, err := s.Machine.Select(step.Args[0])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("vending %s for %d", vend.Slot, vend.Price), nil
+	case "dispense":
+		return "", s.Machine.Dispensed()
+	case "jam":
+		return "", s.Machine.Jam(step.Args[0])
+	case "cancel":
+		return "", s.Machine.Cancel()
+	case "change":
+		change, remaining, err := s.Machine.DispenseChange()
+		if err != nil {
+			return "", err
+		}
+		return formatChange(change, remaining), nil
+	case "fault":
+		return "", s.Machine.Break(step.Args[0])
+	case "repair":
+		return "", s.Machine.Repair()
+	case "shutdown":
+		return "", s.Machine.Shutdown()
+	case "service":
+		return "", s.Machine.Service()
+	case "restock":
+		price, err := number(1)
+		if err != nil {
+			return "", err
+		}
+		quantity, err := number(2)
+		if err != nil {
+			return "", err
+		}
+		s.Machine.Restock(step.Args[0], price, quantity)
+		return "", nil
+	case "float":
+		denomination, err := number(0)
+		if err != nil {
+			return "", err
+		}
+		count, err := number(1)
+		if err != nil {
+			return "", err
+		}
+		s.Machine.LoadCoins(denomination, count)
+		return "", nil
+	}
+
+	return "", fmt.Errorf("line %d: unknown command %q", step.Line, step.Command)
+}
+
+// formatChange describes coins paid out, largest first, such as "paid 50x1 20x2".
+func formatChange(change map[int]int, remaining int) string {
+	denominations := make([]int, 0, len(change))
+	for denomination, count := range change {
+		if count > 0 {
+			denominations = append(denominations, denomination)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(denominations)))
+
+	parts := make([]string, 0, len(denominations))
+	for _, denomination := range denominations {
+		parts = append(parts, fmt.Sprintf("%dx%d", denomination, change[denomination]))
+	}
+
+	out := "paid nothing"
+	if len(parts) > 0 {
+		out = "paid " + strings.Join(parts, " ")
+	}
+	if remaining > 0 {
+		out += fmt.Sprintf(", %d held", remaining)
+	}
+	return out
+}
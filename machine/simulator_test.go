@@ -0,0 +1,135 @@
+package machine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSimulator(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		output string
+		failAt int
+	}{
+		{
+			name: "a buyer buys two products and takes their change",
+			script: `
+				restock A1 65 5
+				restock B1 30 5
+				float 5 10
+				float 10 10
+				coin 100
+				select A1
+				dispense
+				expect-credit 35
+				select B1
+				dispense
+				expect accepting_coins
+				cancel
+				change
+				expect idle
+				expect-credit 0`,
+			output: "paid 5x1",
+		},
+		{
+			name: "a jam refunds the buyer",
+			script: `
+				restock A1 20 1
+				coin 20
+				select A1
+				jam stuck
+				expect error
+				expect-credit 20
+				coin 10
+				expect-error cannot coin while error
+				repair
+				cancel
+				change
+				expect-credit 0`,
+			output: "paid 20x1",
+		},
+		{
+			name: "an out of service machine refuses buyers",
+			script: `
+				shutdown
+				coin 50
+				expect-error invalid transition
+				expect out_of_service
+				service
+				expect idle`,
+		},
+		{
+			name: "a failed expectation stops the script",
+			script: `
+				coin 50
+				expect idle
+				cancel`,
+			failAt: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			steps, err := ParseScript(strings.NewReader(tc.script))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			results, err := NewSimulator(denominations).Run(steps)
+
+			var expectation *ExpectationError
+			if tc.failAt > 0 {
+				if !errors.As(err, &expectation) || expectation.Step.Line != tc.failAt {
+					t.Fatalf("expected line %d to fail, got %v", tc.failAt, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.output != "" {
+				found := false
+				for _, result := range results {
+					found = found || result.Output == tc.output
+				}
+				if !found {
+					t.Errorf("expected a step to output %q", tc.output)
+				}
+			}
+		})
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		steps  int
+		err    string
+	}{
+		{name: "comments and blank lines are skipped", script: "# top up\n\ncoin 50\nCANCEL\n", steps: 2},
+		{name: "unknown commands are refused", script: "kick", err: `line 1: unknown command "kick"`},
+		{name: "arguments are counted", script: "coin\n", err: "line 1: coin takes 1 arguments"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			steps, err := ParseScript(strings.NewReader(tc.script))
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("expected %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(steps) != tc.steps {
+				t.Errorf("expected %d steps, got %d", tc.steps, len(steps))
+			}
+		})
+	}
+}
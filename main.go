@@ -8,7 +8,11 @@ import (
 	"os"
 	"time"
 
+	"github.com/femibiwoye/go-test/controllers"
+	"github.com/femibiwoye/go-test/device"
+	"github.com/femibiwoye/go-test/notifier"
 	"github.com/femibiwoye/go-test/routes"
+	"github.com/femibiwoye/go-test/storage"
 	"github.com/femibiwoye/go-test/utils"
 	"github.com/gorilla/handlers"
 	"github.com/joho/godotenv"
@@ -28,6 +32,28 @@ func (app *App) Run() error {
 	fmt.Println("database connected")
 	utils.Migrate()
 
+	mediaRoot := os.Getenv("MEDIA_ROOT")
+	if mediaRoot == "" {
+		mediaRoot = "media"
+	}
+	imageStore, err := storage.NewLocalStore(mediaRoot, "/media")
+	if err != nil {
+		return fmt.Errorf("could not set up media storage: %v", err)
+	}
+	controllers.ImageStore = imageStore
+
+	if err := controllers.RebuildProductIndex(); err != nil {
+		return fmt.Errorf("could not build product search index: %v", err)
+	}
+
+	controllers.StockNotifier = stockNotifier()
+
+	if err := attachCoinMech(); err != nil {
+		return fmt.Errorf("could not set up the coin mechanism: %v", err)
+	}
+
+	startJobs()
+
 	handler := routes.NewHandler()
 	handler.SetupRoutes()
 
@@ -49,6 +75,117 @@ func (app *App) Run() error {
 	return nil
 }
 
+// stockNotifier sends stock alerts to the in-app inbox, and by email and
+// webhook when they are configured.
+func stockNotifier() notifier.Notifier {
+	notifiers := notifier.Multi{controllers.InboxNotifier()}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		notifiers = append(notifiers, notifier.NewEmail(
+			host,
+			utils.EnvInt("SMTP_PORT", 587),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("SMTP_FROM"),
+		))
+	}
+
+	if url := os.Getenv("STOCK_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, notifier.NewWebhook(url))
+	}
+
+	return notifiers
+}
+
+// attachCoinMech connects the MDB coin mechanism on the serial device in
+// COIN_MECH_DEVICE to the machine COIN_MECH_MACHINE_ID, when one is configured.
+// The serial port must already be set up, for example with stty.
+func attachCoinMech() error {
+	path := os.Getenv("COIN_MECH_DEVICE")
+	if path == "" {
+		return nil
+	}
+
+	machineID := utils.EnvInt("COIN_MECH_MACHINE_ID", 0)
+	if machineID < 1 {
+		return errors.New("COIN_MECH_MACHINE_ID must be set with COIN_MECH_DEVICE")
+	}
+
+	port, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	return controllers.AttachCoinMech(uint(machineID), device.NewMDB(port))
+}
+
+// startJobs starts the background maintenance jobs.
+func startJobs() {
+	retention := time.Duration(utils.EnvInt("PRODUCT_RETENTION_DAYS", 90)) * 24 * time.Hour
+	utils.RunEvery(time.Hour, func() {
+		purged, err := controllers.PurgeDeletedProducts(retention)
+		if err != nil {
+			log.Printf("Error purging deleted products: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("purged %d deleted products", purged)
+		}
+	})
+
+	utils.RunEvery(10*time.Second, func() {
+		reported, err := controllers.ReportCoinMechFaults()
+		if err != nil {
+			log.Printf("Error reporting coin mechanism faults: %v", err)
+			return
+		}
+		if reported > 0 {
+			log.Printf("reported %d coin mechanism faults", reported)
+		}
+	})
+
+	utils.RunEvery(time.Minute, func() {
+		if _, err := controllers.ApplyScheduledPrices(); err != nil {
+			log.Printf("Error applying scheduled prices: %v", err)
+		}
+	})
+
+	telemetryRetention := time.Duration(utils.EnvInt("TELEMETRY_RETENTION_DAYS", 30)) * 24 * time.Hour
+	utils.RunEvery(time.Hour, func() {
+		purged, err := controllers.PurgeTelemetry(telemetryRetention)
+		if err != nil {
+			log.Printf("Error purging machine telemetry: %v", err)
+			return
+		}
+		if purged > 0 {
+			log.Printf("purged %d machine telemetry events", purged)
+		}
+	})
+
+	utils.RunEvery(10*time.Minute, func() {
+		pulled, err := controllers.PullExpiredLots()
+		if err != nil {
+			log.Printf("Error pulling expired stock lots: %v", err)
+			return
+		}
+		if pulled > 0 {
+			log.Printf("pulled %d expired stock lots", pulled)
+		}
+	})
+
+	guestTimeout := time.Duration(utils.EnvInt("GUEST_SESSION_TIMEOUT_SECONDS", 120)) * time.Second
+	utils.RunEvery(15*time.Second, func() {
+		expired, err := controllers.ExpireGuestSessions(guestTimeout)
+		if err != nil {
+			log.Printf("Error expiring guest sessions: %v", err)
+			return
+		}
+		if expired > 0 {
+			log.Printf("ended %d idle guest sessions", expired)
+		}
+	})
+}
+
 func main() {
 
 	// load .env file if it exists
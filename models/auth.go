@@ -12,6 +12,10 @@ type User struct {
 	IsVerified bool   `json:"is_verified,omitempty"`
 	Role       string `json:"role,omitempty"`
 	Deposit    int    `json:"deposit"`
+	// DateOfBirth is formatted as YYYY-MM-DD. It is used for age restricted
+	// products once an admin has verified it.
+	DateOfBirth         string `json:"date_of_birth,omitempty"`
+	DateOfBirthVerified bool   `json:"date_of_birth_verified,omitempty"`
 }
 
 type Session struct {
@@ -25,7 +29,8 @@ type AuthCredentials struct {
 	Password string `json:"password" validate:"required"`
 }
 type UserUpdate struct {
-	FullName string `json:"full_name"`
-	Phone    string `json:"phone" `
-	Role     string `json:"role" `
+	FullName    string `json:"full_name"`
+	Phone       string `json:"phone" `
+	Role        string `json:"role" `
+	DateOfBirth string `json:"date_of_birth"`
 }
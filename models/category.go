@@ -0,0 +1,32 @@
+package models
+
+type Category struct {
+	ID        uint       `gorm:"primaryKey" json:"id,omitempty"`
+	Name      string     `json:"name" validate:"required"`
+	ParentID  *uint      `gorm:"index" json:"parent_id,omitempty"`
+	CreatedBy uint       `json:"created_by,omitempty"`
+	CreatedAt int64      `gorm:"autoCreateTime" json:"created_at,omitempty"`
+	Path      string     `gorm:"-" json:"path,omitempty"`
+	Children  []Category `gorm:"-" json:"children,omitempty"`
+}
+
+type CategoryUpdate struct {
+	Name     string `json:"name"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+// ProductTag is a free-form tag attached to a product.
+type ProductTag struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	ProductID uint   `gorm:"index" json:"product_id"`
+	Tag       string `gorm:"index;size:64" json:"tag"`
+}
+
+// ProductAttribute is a typed attribute of a product such as its size or
+// flavour. List attributes are stored as one row per value.
+type ProductAttribute struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	ProductID uint   `gorm:"index" json:"product_id"`
+	Name      string `gorm:"index;size:64" json:"name"`
+	Value     string `gorm:"size:255" json:"value"`
+}
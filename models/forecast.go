@@ -0,0 +1,31 @@
+package models
+
+// ProductForecast is the expected demand for a product at a machine and when to
+// restock it. RestockBy is the unix time of the start of the day the stock is
+// expected to reach its par level, zero when it lasts past the horizon.
+type ProductForecast struct {
+	ProductID   uint    `json:"product_id"`
+	ProductName string  `json:"product_name"`
+	Stock       int     `json:"stock"`
+	Capacity    int     `json:"capacity"`
+	ParLevel    int     `json:"par_level"`
+	DailyDemand float64 `json:"daily_demand"`
+	NeedsVisit  bool    `json:"needs_visit"`
+	RestockBy   int64   `json:"restock_by,omitempty"`
+	Days        int     `json:"days"`
+	Projected   int     `json:"projected"`
+	Quantity    int     `json:"quantity"`
+	CycleDemand float64 `json:"cycle_demand"`
+}
+
+// MachineForecast is the demand forecast for every product in a machine. NextVisit
+// is the earliest RestockBy of its products.
+type MachineForecast struct {
+	MachineID uint              `json:"machine_id"`
+	Method    string            `json:"method"`
+	History   int               `json:"history"`
+	Horizon   int               `json:"horizon"`
+	Cycle     int               `json:"cycle"`
+	NextVisit int64             `json:"next_visit,omitempty"`
+	Products  []ProductForecast `json:"products"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// Guest session statuses
+const (
+	GuestSessionOpen  = "open"
+	GuestSessionEnded = "ended"
+)
+
+// Reasons a guest session ended
+const (
+	GuestEndedByGuest = "ended"
+	GuestTimedOut     = "timeout"
+	GuestReplaced     = "replaced"
+)
+
+// GuestSession lets a customer without an account use a single machine. The machine
+// starts it and hands the token to the customer, who deposits coins into Balance and
+// buys from it. Ending the session, or leaving it idle, pays the balance out as change;
+// the balance of an ended session is credit the machine could not pay out.
+type GuestSession struct {
+	ID             uint   `gorm:"primaryKey" json:"id,omitempty"`
+	MachineID      uint   `gorm:"index" json:"machine_id"`
+	TokenHash      string `gorm:"size:64;uniqueIndex" json:"-"`
+	Status         string `gorm:"size:16;index" json:"status"`
+	Balance        int    `json:"balance"`
+	Deposited      int    `json:"deposited"`
+	Spent          int    `json:"spent"`
+	Returned       int    `json:"returned"`
+	EndReason      string `gorm:"size:16" json:"end_reason,omitempty"`
+	CreatedAt      int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+	LastActivityAt int64  `gorm:"index" json:"last_activity_at"`
+	EndedAt        int64  `json:"ended_at,omitempty"`
+}
+
+// GuestSessionStarted is a new guest session and its token, which is only shown once.
+type GuestSessionStarted struct {
+	Token   string       `json:"token"`
+	Session GuestSession `json:"session"`
+}
+
+// GuestDepositRequest deposits a coin into a guest session.
+type GuestDepositRequest struct {
+	Amount int `json:"amount"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// ProductImportRow is a product in a bulk import or export file.
+type ProductImportRow struct {
+	ProductName      string                 `json:"product_name"`
+	Cost             int                    `json:"cost"`
+	AmountAvailable  int                    `json:"amount_available"`
+	ReorderThreshold int                    `json:"reorder_threshold"`
+	CategoryID       *uint                  `json:"category_id,omitempty"`
+	Tags             []string               `json:"tags,omitempty"`
+	Attributes       map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// ImportRowError lists the problems with a row of an import file. Rows are
+// numbered from 1, not counting the CSV header.
+type ImportRowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// ImportReport is the outcome of a bulk product import.
+type ImportReport struct {
+	Format     string           `json:"format"`
+	Mode       string           `json:"mode"`
+	DryRun     bool             `json:"dry_run"`
+	Total      int              `json:"total"`
+	Valid      int              `json:"valid"`
+	Created    int              `json:"created"`
+	Failed     int              `json:"failed"`
+	ProductIDs []uint           `json:"product_ids"`
+	Errors     []ImportRowError `json:"errors"`
+}
@@ -0,0 +1,57 @@
+package models
+
+// StockLot is a batch of a product received together. Lots are sold earliest
+// expiry first and pulled from sale once they expire. ExpiresAt is a unix
+// time, zero for lots that do not expire.
+type StockLot struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	ProductID uint   `gorm:"index" json:"product_id"`
+	LotCode   string `gorm:"size:64" json:"lot_code"`
+	Quantity  int    `json:"quantity"`
+	Remaining int    `json:"remaining"`
+	ExpiresAt int64  `gorm:"index" json:"expires_at"`
+	Pulled    int    `json:"pulled"`
+	PulledAt  int64  `json:"pulled_at,omitempty"`
+	CreatedBy uint   `json:"created_by,omitempty"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+// OrderLot records how many units of an order came from a lot.
+type OrderLot struct {
+	ID        uint `gorm:"primaryKey" json:"id,omitempty"`
+	OrderID   uint `gorm:"index" json:"order_id"`
+	ProductID uint `json:"product_id"`
+	LotID     uint `gorm:"index" json:"lot_id"`
+	Quantity  int  `json:"quantity"`
+}
+
+type StockLotRequest struct {
+	LotCode   string `json:"lot_code"`
+	Quantity  int    `json:"quantity"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// LotAllocation is the part of a purchased item taken from one lot.
+type LotAllocation struct {
+	LotID     uint   `json:"lot_id"`
+	LotCode   string `json:"lot_code"`
+	ExpiresAt int64  `json:"expires_at"`
+	Quantity  int    `json:"quantity"`
+}
+
+// ExpiringStock is a lot of a seller's product that expires soon.
+type ExpiringStock struct {
+	ProductID   uint   `json:"product_id"`
+	ProductName string `json:"product_name"`
+	LotID       uint   `json:"lot_id"`
+	LotCode     string `json:"lot_code"`
+	Remaining   int    `json:"remaining"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+type ExpiryReport struct {
+	Days  int             `json:"days"`
+	Until int64           `json:"until"`
+	Units int             `json:"units"`
+	Lots  []ExpiringStock `json:"lots"`
+}
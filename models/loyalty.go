@@ -0,0 +1,57 @@
+package models
+
+const (
+	PointsEarned           = "earned"
+	PointsRedeemedPurchase = "redeemed_purchase"
+	PointsRedeemedCredit   = "redeemed_credit"
+)
+
+// PointsAccount holds the loyalty points balance of a buyer.
+type PointsAccount struct {
+	UserID    uint  `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	Balance   int   `json:"balance"`
+	UpdatedAt int64 `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
+}
+
+// PointsTransaction is an entry in the points history of a buyer. Points is
+// positive for points earned and negative for points redeemed.
+type PointsTransaction struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	OrderID   *uint  `gorm:"index" json:"order_id,omitempty"`
+	Points    int    `json:"points"`
+	Reason    string `json:"reason"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+// EarningRule awards Points for every SpendUnit cents paid. A rule with a
+// ProductID only counts what was spent on that product, on top of the
+// rules for the whole order. StartsAt and EndsAt of zero mean no limit.
+type EarningRule struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	Name      string `json:"name"`
+	ProductID uint   `json:"product_id,omitempty"`
+	SpendUnit int    `json:"spend_unit"`
+	Points    int    `json:"points"`
+	StartsAt  int64  `json:"starts_at"`
+	EndsAt    int64  `json:"ends_at"`
+	Active    bool   `json:"active"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+// ActiveAt reports whether the rule applies at the given unix time.
+func (r EarningRule) ActiveAt(at int64) bool {
+	return r.Active && (r.StartsAt == 0 || at >= r.StartsAt) && (r.EndsAt == 0 || at < r.EndsAt)
+}
+
+type PointsRedeemRequest struct {
+	Points int `json:"points" validate:"required"`
+}
+
+// LoyaltySummary is the points balance of a buyer and a page of their points history.
+type LoyaltySummary struct {
+	Balance    int                 `json:"balance"`
+	PointValue int                 `json:"point_value"`
+	History    []PointsTransaction `json:"history"`
+	Meta       PageMeta            `json:"meta"`
+}
@@ -0,0 +1,129 @@
+package models
+
+// Machine statuses. Buyers can only deposit and buy at active machines.
+const (
+	MachineActive       = "active"
+	MachineInactive     = "inactive"
+	MachineMaintenance  = "maintenance"
+	MachineOutOfService = "out_of_service"
+)
+
+// Machine is a vending machine at a location. Buyers deposit coins into and
+// buy products from a single machine. StatusAuto is set when the status was set from
+// the telemetry of the machine rather than by an operator. State is what its hardware is doing.
+type Machine struct {
+	ID              uint          `gorm:"primaryKey" json:"id,omitempty"`
+	Name            string        `json:"name"`
+	Location        string        `json:"location"`
+	Latitude        float64       `json:"latitude"`
+	Longitude       float64       `json:"longitude"`
+	Status          string        `gorm:"size:16;default:active;index" json:"status"`
+	StatusReason    string        `json:"status_reason,omitempty"`
+	StatusAuto      bool          `json:"status_auto"`
+	StatusChangedAt int64         `json:"status_changed_at,omitempty"`
+	State           string        `gorm:"-" json:"state,omitempty"`
+	CreatedAt       int64         `gorm:"autoCreateTime" json:"created_at,omitempty"`
+	Coins           []MachineCoin `gorm:"foreignKey:MachineID" json:"coins,omitempty"`
+	Slots           []MachineSlot `gorm:"foreignKey:MachineID" json:"slots,omitempty"`
+}
+
+// MachineCoin is the number of coins of a denomination held by a machine.
+type MachineCoin struct {
+	MachineID    uint `gorm:"primaryKey;autoIncrement:false" json:"machine_id"`
+	Denomination int  `gorm:"primaryKey;autoIncrement:false" json:"denomination"`
+	Count        int  `json:"count"`
+}
+
+// MachineSlot is a numbered slot in a machine such as A1 and the product it sells.
+// The planogram of a machine is its slots. Restocking fills a slot up to its par level.
+type MachineSlot struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	MachineID uint   `gorm:"uniqueIndex:idx_machine_slot" json:"machine_id"`
+	Code      string `gorm:"size:8;uniqueIndex:idx_machine_slot" json:"code"`
+	ProductID uint   `gorm:"index" json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Capacity  int    `json:"capacity"`
+	ParLevel  int    `json:"par_level"`
+}
+
+// MachineDeposit is the credit a buyer has in a machine.
+type MachineDeposit struct {
+	UserID    uint  `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	MachineID uint  `gorm:"primaryKey;autoIncrement:false" json:"machine_id"`
+	Amount    int   `json:"amount"`
+	UpdatedAt int64 `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
+}
+
+type MachineUpdate struct {
+	Name         string   `json:"name"`
+	Location     string   `json:"location"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	Status       string   `json:"status"`
+	StatusReason string   `json:"status_reason"`
+}
+
+// MachineStatusRequest changes the status of a machine. Refund moves the credit
+// buyers have in the machine to their account deposits.
+type MachineStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=active inactive maintenance out_of_service"`
+	Reason string `json:"reason"`
+	Refund bool   `json:"refund"`
+}
+
+// MachineRefund is credit a buyer had in a machine, moved to their account deposit.
+type MachineRefund struct {
+	UserID uint `json:"user_id"`
+	Amount int  `json:"amount"`
+}
+
+// RefundReport lists the buyers refunded from a machine.
+type RefundReport struct {
+	MachineID uint            `json:"machine_id"`
+	Refunds   []MachineRefund `json:"refunds"`
+	Total     int             `json:"total"`
+}
+
+// CoinInventoryRequest sets the number of coins of each denomination in a machine.
+type CoinInventoryRequest struct {
+	Coins map[int]int `json:"coins"`
+}
+
+// SlotRequest places a product in a slot. Without a quantity a slot keeps its
+// stock if it still holds the same product and is emptied otherwise.
+type SlotRequest struct {
+	Code      string `json:"code,omitempty"`
+	ProductID uint   `json:"product_id"`
+	Capacity  int    `json:"capacity"`
+	ParLevel  int    `json:"par_level"`
+	Quantity  *int   `json:"quantity,omitempty"`
+}
+
+// PlanogramRequest replaces the whole slot layout of a machine.
+type PlanogramRequest struct {
+	Slots []SlotRequest `json:"slots"`
+}
+
+// MachineProduct is a product on sale in a slot of a machine.
+type MachineProduct struct {
+	Product
+	SlotCode string `json:"slot_code"`
+	Quantity int    `json:"quantity"`
+}
+
+// ResetRequest ends a buyer's session at a machine. Without a machine the
+// account deposit is reset.
+type ResetRequest struct {
+	MachineID uint `json:"machine_id,omitempty"`
+}
+
+// ResetResponse is the change a machine paid out. Remaining is credit the
+// machine could not pay out in coins and still holds for the buyer. Refunded is
+// credit moved to the account deposit of the buyer because the machine is not in service.
+type ResetResponse struct {
+	MachineID uint        `json:"machine_id"`
+	Returned  int         `json:"returned"`
+	Coins     map[int]int `json:"coins"`
+	Remaining int         `json:"remaining"`
+	Refunded  int         `json:"refunded"`
+}
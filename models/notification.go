@@ -0,0 +1,43 @@
+package models
+
+// Stock alert levels
+const (
+	StockLow     = "low_stock"
+	StockSoldOut = "sold_out"
+)
+
+// InboxMessage is a notification in the in-app inbox of a user.
+type InboxMessage struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	Kind      string `gorm:"size:32" json:"kind"`
+	ProductID uint   `json:"product_id,omitempty"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	IsRead    bool   `json:"is_read"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+// StockAlert is the last stock level a seller was alerted about for a product.
+// It is cleared when the product is restocked above its reorder threshold.
+type StockAlert struct {
+	ProductID uint   `gorm:"primaryKey;autoIncrement:false" json:"product_id"`
+	Level     string `gorm:"size:16" json:"level"`
+	UpdatedAt int64  `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
+}
+
+// SlotAlert is the last stock level operators were alerted about for a slot in a
+// machine. It is cleared when the slot is restocked above its par level.
+type SlotAlert struct {
+	MachineID uint   `gorm:"primaryKey;autoIncrement:false" json:"machine_id"`
+	Code      string `gorm:"primaryKey;size:8" json:"code"`
+	Level     string `gorm:"size:16" json:"level"`
+	UpdatedAt int64  `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
+}
+
+// InboxList is a page of inbox messages together with its pagination metadata.
+type InboxList struct {
+	Messages []InboxMessage `json:"messages"`
+	Unread   int64          `json:"unread"`
+	Meta     PageMeta       `json:"meta"`
+}
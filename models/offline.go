@@ -0,0 +1,34 @@
+package models
+
+// MachineSigningKey is the secret a machine signs the transactions it makes offline
+// with. Unlike the machine key it is stored as is, as the server needs it to check
+// signatures; it is shown once when it is issued.
+type MachineSigningKey struct {
+	MachineID uint   `gorm:"primaryKey;autoIncrement:false" json:"machine_id"`
+	Secret    string `gorm:"size:64" json:"-"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+// OfflineTransaction is a transaction a machine made offline and synced later. Seq
+// numbers the transactions of a machine, so each is only applied once. Short,
+// FromAccount and Unpaid record how a conflict with the server was settled.
+type OfflineTransaction struct {
+	ID          uint   `gorm:"primaryKey" json:"id,omitempty"`
+	MachineID   uint   `gorm:"uniqueIndex:idx_offline_seq" json:"machine_id"`
+	Seq         uint64 `gorm:"uniqueIndex:idx_offline_seq" json:"seq"`
+	Kind        string `gorm:"size:16" json:"kind"`
+	UserID      uint   `gorm:"index" json:"user_id"`
+	SlotCode    string `gorm:"size:8" json:"slot_code,omitempty"`
+	ProductID   uint   `json:"product_id,omitempty"`
+	Quantity    int    `json:"quantity,omitempty"`
+	Price       int    `json:"price,omitempty"`
+	Amount      int    `json:"amount"`
+	CoinsJSON   string `gorm:"column:coins;type:text" json:"-"`
+	Status      string `gorm:"size:16" json:"status"`
+	Short       int    `json:"short"`
+	FromAccount int    `json:"from_account"`
+	Unpaid      int    `json:"unpaid"`
+	OrderID     *uint  `json:"order_id,omitempty"`
+	RecordedAt  int64  `json:"recorded_at"`
+	SyncedAt    int64  `gorm:"autoCreateTime" json:"synced_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+// Order records a completed purchase. An order paid from a guest session has no
+// user and records the session instead.
+type Order struct {
+	ID             uint        `gorm:"primaryKey" json:"id,omitempty"`
+	UserID         uint        `gorm:"index" json:"user_id"`
+	MachineID      *uint       `gorm:"index" json:"machine_id,omitempty"`
+	GuestSessionID *uint       `gorm:"index" json:"guest_session_id,omitempty"`
+	Subtotal       int         `json:"subtotal"`
+	Discount       int         `json:"discount"`
+	AmountPaid     int         `json:"amount_paid"`
+	VoucherCode    string      `json:"voucher_code,omitempty"`
+	PointsRedeemed int         `json:"points_redeemed"`
+	PointsEarned   int         `json:"points_earned"`
+	CreatedAt      int64       `gorm:"autoCreateTime;index" json:"created_at,omitempty"`
+	Items          []OrderItem `gorm:"foreignKey:OrderID" json:"items,omitempty"`
+}
+
+type OrderItem struct {
+	ID        uint `gorm:"primaryKey" json:"id,omitempty"`
+	OrderID   uint `gorm:"index" json:"order_id"`
+	ProductID uint `gorm:"index" json:"product_id"`
+	Quantity  int  `json:"quantity"`
+	UnitPrice int  `json:"unit_price"`
+	Subtotal  int  `json:"subtotal"`
+}
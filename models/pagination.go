@@ -0,0 +1,35 @@
+package models
+
+// Pagination is the page and limit requested by a client on list endpoints.
+type Pagination struct {
+	Page  int
+	Limit int
+}
+
+// Offset returns the number of rows to skip for the requested page.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// PageMeta is returned alongside paginated lists.
+type PageMeta struct {
+	Page       int   `json:"page"`
+	Limit      int   `json:"limit"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// NewPageMeta builds the response metadata for a page of a list with total items.
+func NewPageMeta(p Pagination, total int64) PageMeta {
+	totalPages := int(total) / p.Limit
+	if int(total)%p.Limit != 0 {
+		totalPages++
+	}
+
+	return PageMeta{
+		Page:       p.Page,
+		Limit:      p.Limit,
+		Total:      total,
+		TotalPages: totalPages,
+	}
+}
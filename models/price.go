@@ -0,0 +1,27 @@
+package models
+
+// PriceChange records the cost of a product from EffectiveFrom onwards.
+// Future changes are applied to Product.Cost by the price scheduler. A change with
+// EffectiveUntil is temporary and is paired with a revert change, RevertOf, that goes
+// back to the base price. The cost of a revert is resolved when it takes effect, so
+// price updates made in the meantime are kept; until then it holds the base price at
+// the time it was scheduled.
+type PriceChange struct {
+	ID             uint  `gorm:"primaryKey" json:"id,omitempty"`
+	ProductID      uint  `gorm:"index:idx_price_changes_product" json:"product_id"`
+	Cost           int   `json:"cost"`
+	EffectiveFrom  int64 `gorm:"index:idx_price_changes_product" json:"effective_from"`
+	EffectiveUntil int64 `gorm:"not null;default:0" json:"effective_until,omitempty"`
+	RevertOf       *uint `gorm:"index" json:"revert_of,omitempty"`
+	Applied        bool  `json:"applied"`
+	CreatedBy      uint  `json:"created_by,omitempty"`
+	CreatedAt      int64 `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+// PriceScheduleRequest schedules a future price. When EffectiveUntil is set the
+// price reverts to what it would otherwise have been at that time, e.g. for happy hours.
+type PriceScheduleRequest struct {
+	Cost           int   `json:"cost" validate:"required"`
+	EffectiveFrom  int64 `json:"effective_from" validate:"required"`
+	EffectiveUntil int64 `json:"effective_until"`
+}
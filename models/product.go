@@ -1,13 +1,73 @@
 package models
 
+import "gorm.io/gorm"
+
+// Product review statuses. New products start as drafts and only published
+// products are shown to buyers.
+const (
+	ProductDraft         = "draft"
+	ProductPendingReview = "pending_review"
+	ProductPublished     = "published"
+	ProductRejected      = "rejected"
+)
+
 type Product struct {
-	ID          uint   `gorm:"primaryKey" json:"id,omitempty"`
-	Cost        int    `json:"cost" validate:"required"`
-	ProductName string `json:"product_name" validate:"required"`
-	SellerId    uint   `json:"seller_id,omitempty"`
+	ID                 uint                   `gorm:"primaryKey" json:"id,omitempty"`
+	Cost               int                    `json:"cost" validate:"required"`
+	ProductName        string                 `json:"product_name" validate:"required"`
+	SellerId           uint                   `json:"seller_id,omitempty"`
+	AmountAvailable    int                    `json:"amount_available"`
+	ReorderThreshold   int                    `json:"reorder_threshold"`
+	ParentID           *uint                  `gorm:"index" json:"parent_id,omitempty"`
+	VariantName        string                 `gorm:"size:64" json:"variant_name,omitempty"`
+	Variants           []Product              `gorm:"-" json:"variants,omitempty"`
+	Status             string                 `gorm:"size:16;default:published;index" json:"status"`
+	PendingProductName string                 `json:"pending_product_name,omitempty"`
+	ReviewNote         string                 `json:"review_note,omitempty"`
+	CategoryID         *uint                  `gorm:"index" json:"category_id,omitempty"`
+	CategoryPath       string                 `gorm:"-" json:"category_path,omitempty"`
+	Tags               []string               `gorm:"-" json:"tags,omitempty"`
+	Attributes         map[string]interface{} `gorm:"-" json:"attributes,omitempty"`
+	ImageKey           string                 `json:"-"`
+	ThumbnailKey       string                 `json:"-"`
+	ImageURL           string                 `gorm:"-" json:"image_url,omitempty"`
+	ThumbnailURL       string                 `gorm:"-" json:"thumbnail_url,omitempty"`
+	DeletedAt          gorm.DeletedAt         `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 type ProductUpdate struct {
-	Cost        int    `json:"cost"`
-	ProductName string `json:"product_name"`
+	Cost             int                    `json:"cost"`
+	ProductName      string                 `json:"product_name"`
+	AmountAvailable  *int                   `json:"amount_available"`
+	ReorderThreshold *int                   `json:"reorder_threshold"`
+	CategoryID       *uint                  `json:"category_id"`
+	Tags             []string               `json:"tags"`
+	Attributes       map[string]interface{} `json:"attributes"`
+}
+
+// VariantRequest adds a variant such as a size or flavour to a product.
+type VariantRequest struct {
+	VariantName      string                 `json:"variant_name"`
+	Cost             int                    `json:"cost"`
+	AmountAvailable  int                    `json:"amount_available"`
+	ReorderThreshold int                    `json:"reorder_threshold"`
+	Attributes       map[string]interface{} `json:"attributes"`
+}
+
+// ReviewDecision is an admin decision on a product waiting for review.
+type ReviewDecision struct {
+	Decision string `json:"decision" validate:"required,oneof=approve reject"`
+	Note     string `json:"note"`
+}
+
+// ProductList is a page of products together with its pagination metadata.
+type ProductList struct {
+	Products []Product `json:"products"`
+	Meta     PageMeta  `json:"meta"`
+}
+
+// ProductSearchResult is a product matched by a search together with its relevance score.
+type ProductSearchResult struct {
+	Product
+	Score float64 `json:"score"`
 }
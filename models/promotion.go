@@ -0,0 +1,51 @@
+package models
+
+const (
+	PromotionMultiBuy   = "multi_buy"
+	PromotionPercentage = "percentage"
+	PromotionBundle     = "bundle"
+)
+
+// Promotion is a seller-defined deal evaluated when a buyer makes a purchase.
+//
+// A multi_buy promotion gives FreeQuantity units free for every BuyQuantity
+// units bought ("buy 2 get 1"). A percentage promotion takes Percent off the
+// product. A bundle promotion sells one ProductID and one BundleProductID
+// together for BundlePrice. StartsAt and EndsAt limit the promotion to a time
+// window; zero means no limit.
+type Promotion struct {
+	ID              uint   `gorm:"primaryKey" json:"id,omitempty"`
+	SellerId        uint   `gorm:"index" json:"seller_id,omitempty"`
+	Name            string `json:"name"`
+	Type            string `json:"type"`
+	ProductID       uint   `gorm:"index" json:"product_id"`
+	BuyQuantity     int    `json:"buy_quantity,omitempty"`
+	FreeQuantity    int    `json:"free_quantity,omitempty"`
+	Percent         int    `json:"percent,omitempty"`
+	BundleProductID uint   `json:"bundle_product_id,omitempty"`
+	BundlePrice     int    `json:"bundle_price,omitempty"`
+	StartsAt        int64  `json:"starts_at"`
+	EndsAt          int64  `json:"ends_at"`
+	Active          bool   `json:"active"`
+	CreatedAt       int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+// ActiveAt reports whether the promotion applies at the given unix time.
+func (p Promotion) ActiveAt(at int64) bool {
+	return p.Active && (p.StartsAt == 0 || at >= p.StartsAt) && (p.EndsAt == 0 || at < p.EndsAt)
+}
+
+// AppliedDiscount is a promotion applied to a purchase and the amount it took off.
+type AppliedDiscount struct {
+	PromotionID uint   `json:"promotion_id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Amount      int    `json:"amount"`
+}
+
+type PromotionUpdate struct {
+	Name     string `json:"name"`
+	StartsAt *int64 `json:"starts_at"`
+	EndsAt   *int64 `json:"ends_at"`
+	Active   *bool  `json:"active"`
+}
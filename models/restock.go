@@ -0,0 +1,83 @@
+package models
+
+// Restock visit statuses
+const (
+	VisitPlanned   = "planned"
+	VisitCompleted = "completed"
+)
+
+// RestockVisit is an operator's visit to a machine to load products and collect coins.
+// Items start as the pick list for the machine when the visit is planned and record
+// what was loaded once it is completed.
+type RestockVisit struct {
+	ID          uint          `gorm:"primaryKey" json:"id,omitempty"`
+	MachineID   uint          `gorm:"index" json:"machine_id"`
+	OperatorID  uint          `gorm:"index" json:"operator_id"`
+	Status      string        `gorm:"size:16;index" json:"status"`
+	Notes       string        `json:"notes,omitempty"`
+	Loaded      int           `json:"loaded"`
+	CoinsJSON   string        `gorm:"column:coins;type:text" json:"-"`
+	Coins       map[int]int   `gorm:"-" json:"coins"`
+	CoinsTotal  int           `json:"coins_total"`
+	CreatedAt   int64         `gorm:"autoCreateTime" json:"created_at,omitempty"`
+	CompletedAt int64         `json:"completed_at,omitempty"`
+	Items       []RestockItem `gorm:"foreignKey:VisitID" json:"items,omitempty"`
+}
+
+// RestockItem is a slot on a pick list: the stock it had when the list was made, the
+// units to pick to fill it and the units actually loaded.
+type RestockItem struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	VisitID   uint   `gorm:"index" json:"visit_id,omitempty"`
+	SlotCode  string `gorm:"size:8" json:"slot_code"`
+	ProductID uint   `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	ParLevel  int    `json:"par_level"`
+	Capacity  int    `json:"capacity"`
+	Pick      int    `json:"pick"`
+	Loaded    int    `json:"loaded"`
+}
+
+// PickTotal is the number of units of a product to pick for a machine.
+type PickTotal struct {
+	ProductID   uint   `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Units       int    `json:"units"`
+}
+
+// PickList is what to take to a machine to fill the slots at or below their par level.
+type PickList struct {
+	MachineID uint          `json:"machine_id"`
+	Items     []RestockItem `json:"items"`
+	Products  []PickTotal   `json:"products"`
+	Units     int           `json:"units"`
+}
+
+// RestockCompleteRequest records a visit: the units loaded into each slot, by slot
+// code, and the coins collected, a count of coins by denomination.
+type RestockCompleteRequest struct {
+	Loaded map[string]int `json:"loaded"`
+	Coins  map[int]int    `json:"coins"`
+	Notes  string         `json:"notes"`
+}
+
+// RouteStop is a machine on a restocking route and the distance to it from the
+// previous stop, in kilometres.
+type RouteStop struct {
+	MachineID uint    `json:"machine_id"`
+	Name      string  `json:"name"`
+	Location  string  `json:"location"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Priority  string  `json:"priority"`
+	Units     int     `json:"units"`
+	Distance  float64 `json:"distance"`
+}
+
+// RoutePlan is the order to visit the machines needing a restock in. Machines
+// needing a restock without coordinates cannot be routed and are listed in Unrouted.
+type RoutePlan struct {
+	Stops    []RouteStop `json:"stops"`
+	Distance float64     `json:"distance"`
+	Unrouted []RouteStop `json:"unrouted"`
+}
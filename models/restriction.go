@@ -0,0 +1,14 @@
+package models
+
+// ProductRestriction limits who can buy a product and when. MinAge requires
+// a verified date of birth. AllowedFrom and AllowedUntil are HH:MM local
+// times; the window may wrap past midnight and is unrestricted when empty.
+// DailyLimit caps the units a buyer can buy per day. Zero means no limit.
+type ProductRestriction struct {
+	ProductID    uint   `gorm:"primaryKey;autoIncrement:false" json:"product_id"`
+	MinAge       int    `json:"min_age"`
+	AllowedFrom  string `gorm:"size:5" json:"allowed_from"`
+	AllowedUntil string `gorm:"size:5" json:"allowed_until"`
+	DailyLimit   int    `json:"daily_limit"`
+	UpdatedAt    int64  `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
+}
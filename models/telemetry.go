@@ -0,0 +1,66 @@
+package models
+
+// Kinds of telemetry event a machine reports
+const (
+	TelemetryTemperature = "temperature"
+	TelemetryDoorOpen    = "door_open"
+	TelemetryDoorClosed  = "door_closed"
+	TelemetryJam         = "jam"
+	TelemetryCoinTubes   = "coin_tubes"
+)
+
+// MachineKey is the API key a machine authenticates its telemetry with. Only a
+// hash of the key is stored; the key itself is shown once when it is issued.
+type MachineKey struct {
+	MachineID uint   `gorm:"primaryKey;autoIncrement:false" json:"machine_id"`
+	KeyHash   string `gorm:"size:64;uniqueIndex" json:"-"`
+	Prefix    string `gorm:"size:8" json:"prefix"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+// TelemetryEvent is a reading or event reported by a machine. RecordedAt is
+// when the machine recorded it and ReceivedAt when it reached the API.
+type TelemetryEvent struct {
+	ID          uint        `gorm:"primaryKey" json:"id,omitempty"`
+	MachineID   uint        `gorm:"index:idx_telemetry_machine_time" json:"machine_id"`
+	Kind        string      `gorm:"size:32;index" json:"kind"`
+	Temperature *float64    `json:"temperature,omitempty"`
+	Slot        string      `gorm:"size:8" json:"slot,omitempty"`
+	Detail      string      `json:"detail,omitempty"`
+	TubesJSON   string      `gorm:"column:tubes;type:text" json:"-"`
+	Tubes       map[int]int `gorm:"-" json:"tubes,omitempty"`
+	RecordedAt  int64       `gorm:"index:idx_telemetry_machine_time" json:"recorded_at"`
+	ReceivedAt  int64       `gorm:"autoCreateTime;index" json:"received_at"`
+}
+
+// MachineStatus is the latest reported state of a machine, built from its telemetry.
+type MachineStatus struct {
+	MachineID     uint        `gorm:"primaryKey;autoIncrement:false" json:"machine_id"`
+	Temperature   *float64    `json:"temperature"`
+	TemperatureAt int64       `json:"temperature_at"`
+	DoorOpen      bool        `json:"door_open"`
+	DoorAt        int64       `json:"door_at"`
+	LastJam       string      `json:"last_jam"`
+	JamAt         int64       `json:"jam_at"`
+	TubesJSON     string      `gorm:"column:tubes;type:text" json:"-"`
+	Tubes         map[int]int `gorm:"-" json:"tubes"`
+	TubesAt       int64       `json:"tubes_at"`
+	LastSeenAt    int64       `json:"last_seen_at"`
+}
+
+// TelemetryBatch is a batch of events sent by a machine.
+type TelemetryBatch struct {
+	Events []TelemetryEvent `json:"events"`
+}
+
+// TelemetryEventError lists the problems with an event of a batch, numbered from 0.
+type TelemetryEventError struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// TelemetryReport is the outcome of ingesting a batch.
+type TelemetryReport struct {
+	Accepted int                   `json:"accepted"`
+	Rejected []TelemetryEventError `json:"rejected"`
+}
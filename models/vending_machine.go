@@ -1,16 +1,58 @@
 package models
 
+// DepositRequest deposits a coin into MachineID, or into the account deposit without a machine.
 type DepositRequest struct {
-	Amount int `json:"amount" validate:"required"`
+	Amount    int  `json:"amount" validate:"required"`
+	MachineID uint `json:"machine_id,omitempty"`
 }
+
+// CoinSessionRequest opens the coin mechanism of a machine for the buyer UserID.
+type CoinSessionRequest struct {
+	UserID uint `json:"user_id" validate:"required"`
+}
+
+// BuyRequest buys Quantity of ProductID, or every entry of Items when it is set.
+// With MachineID it buys from that machine and pays from the credit in it.
 type BuyRequest struct {
-	ProductID int `json:"product_id" validate:"required"`
-	Quantity  int `json:"quantity" validate:"required"`
+	MachineID   uint      `json:"machine_id,omitempty"`
+	ProductID   int       `json:"product_id" validate:"required"`
+	VariantID   int       `json:"variant_id,omitempty"`
+	SlotCode    string    `json:"slot_code,omitempty"`
+	Quantity    int       `json:"quantity" validate:"required"`
+	Items       []BuyItem `json:"items,omitempty"`
+	VoucherCode string    `json:"voucher_code,omitempty"`
+	Points      int       `json:"points,omitempty"`
+}
+
+// BuyItem buys Quantity of ProductID, or of its variant VariantID when the product has variants.
+// In a machine SlotCode buys whatever the slot with that code sells instead.
+type BuyItem struct {
+	ProductID int    `json:"product_id"`
+	VariantID int    `json:"variant_id,omitempty"`
+	SlotCode  string `json:"slot_code,omitempty"`
+	Quantity  int    `json:"quantity"`
 }
 
 type BuyResponse struct {
-	ProductID         int `json:"product_id"`
-	QuantityPurchased int `json:"quantity_purchased"`
-	AmountSpent       int `json:"amount_spent"`
-	Change            int `json:"change"`
+	OrderID           uint              `json:"order_id"`
+	MachineID         uint              `json:"machine_id,omitempty"`
+	ProductID         int               `json:"product_id"`
+	QuantityPurchased int               `json:"quantity_purchased"`
+	Items             []BuyResponseItem `json:"items"`
+	Subtotal          int               `json:"subtotal"`
+	Discounts         []AppliedDiscount `json:"discounts"`
+	Voucher           *AppliedVoucher   `json:"voucher,omitempty"`
+	PointsRedeemed    int               `json:"points_redeemed"`
+	PointsEarned      int               `json:"points_earned"`
+	AmountSpent       int               `json:"amount_spent"`
+	Change            int               `json:"change"`
+}
+
+type BuyResponseItem struct {
+	ProductID int             `json:"product_id"`
+	ParentID  uint            `json:"parent_id,omitempty"`
+	Quantity  int             `json:"quantity"`
+	UnitPrice int             `json:"unit_price"`
+	Subtotal  int             `json:"subtotal"`
+	Lots      []LotAllocation `json:"lots,omitempty"`
 }
@@ -0,0 +1,52 @@
+package models
+
+const (
+	VoucherFixed      = "fixed"
+	VoucherPercentage = "percentage"
+
+	VoucherModePurchase = "purchase"
+	VoucherModeCredit   = "credit"
+)
+
+// Voucher is a code that takes Value cents (fixed) or Value percent (percentage)
+// off a purchase. Fixed vouchers can also be redeemed into deposit credit.
+// A MaxUses, PerUserLimit or ExpiresAt of zero means no limit.
+type Voucher struct {
+	ID           uint   `gorm:"primaryKey" json:"id,omitempty"`
+	Code         string `gorm:"uniqueIndex;size:64" json:"code"`
+	Type         string `json:"type"`
+	Value        int    `json:"value"`
+	MaxUses      int    `json:"max_uses"`
+	Uses         int    `json:"uses"`
+	PerUserLimit int    `json:"per_user_limit"`
+	ExpiresAt    int64  `json:"expires_at"`
+	Active       bool   `json:"active"`
+	CreatedBy    uint   `json:"created_by,omitempty"`
+	CreatedAt    int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+type VoucherUpdate struct {
+	MaxUses   *int   `json:"max_uses"`
+	ExpiresAt *int64 `json:"expires_at"`
+	Active    *bool  `json:"active"`
+}
+
+// VoucherRedemption records a use of a voucher by a buyer.
+type VoucherRedemption struct {
+	ID        uint   `gorm:"primaryKey" json:"id,omitempty"`
+	VoucherID uint   `gorm:"index" json:"voucher_id"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	Amount    int    `json:"amount"`
+	Mode      string `json:"mode"`
+	CreatedAt int64  `gorm:"autoCreateTime" json:"created_at,omitempty"`
+}
+
+type VoucherRedeemRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// AppliedVoucher is a voucher used on a purchase and the amount it took off.
+type AppliedVoucher struct {
+	Code   string `json:"code"`
+	Amount int    `json:"amount"`
+}
@@ -0,0 +1,122 @@
+// Package notifier delivers notifications to users over email, webhooks and
+// the in-app inbox.
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notification is a message for a single user.
+type Notification struct {
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email,omitempty"`
+	Kind      string `json:"kind"`
+	ProductID uint   `json:"product_id,omitempty"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+}
+
+// Notifier delivers a notification.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Multi delivers a notification through every notifier it holds. All are tried
+// even if one fails and the errors are combined.
+type Multi []Notifier
+
+func (m Multi) Notify(n Notification) error {
+	var failures []string
+	for _, notifier := range m {
+		if err := notifier.Notify(n); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Email sends notifications by SMTP to the email address of the user.
+type Email struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+
+	// sendMail is smtp.SendMail, replaced in tests
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmail returns an Email notifier sending through the SMTP server at host:port.
+func NewEmail(host string, port int, username, password, from string) *Email {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &Email{
+		Addr:     fmt.Sprintf("%s:%d", host, port),
+		From:     from,
+		Auth:     auth,
+		sendMail: smtp.SendMail,
+	}
+}
+
+func (e *Email) Notify(n Notification) error {
+	if n.Email == "" {
+		return nil
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", e.From, n.Email, n.Subject, n.Body)
+	if err := e.sendMail(e.Addr, e.Auth, e.From, []string{n.Email}, []byte(msg)); err != nil {
+		return fmt.Errorf("email notification failed: %v", err)
+	}
+	return nil
+}
+
+// Webhook posts notifications as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook returns a Webhook notifier posting to url.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *Webhook) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook notification failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook notification failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Inbox stores notifications in the in-app inbox of the user with Save.
+type Inbox struct {
+	Save func(n Notification) error
+}
+
+func (i Inbox) Notify(n Notification) error {
+	return i.Save(n)
+}
@@ -0,0 +1,95 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+var lowStock = Notification{
+	UserID:    3,
+	Email:     "seller@example.com",
+	Kind:      "low_stock",
+	ProductID: 9,
+	Subject:   "Cola is running low",
+	Body:      "Cola has 2 left.",
+}
+
+func TestEmail(t *testing.T) {
+	var to []string
+	var msg string
+
+	email := NewEmail("smtp.example.com", 587, "", "", "alerts@example.com")
+	email.sendMail = func(addr string, a smtp.Auth, from string, recipients []string, body []byte) error {
+		if addr != "smtp.example.com:587" {
+			t.Errorf("unexpected address %s", addr)
+		}
+		to = recipients
+		msg = string(body)
+		return nil
+	}
+
+	if err := email.Notify(lowStock); err != nil {
+		t.Fatal(err)
+	}
+	if len(to) != 1 || to[0] != "seller@example.com" {
+		t.Errorf("unexpected recipients %v", to)
+	}
+	if !strings.Contains(msg, "Subject: Cola is running low\r\n") || !strings.Contains(msg, "Cola has 2 left.") {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	t.Run("users without an email address are skipped", func(t *testing.T) {
+		to = nil
+		if err := email.Notify(Notification{Subject: "x"}); err != nil || to != nil {
+			t.Errorf("expected nothing to be sent, got %v %v", to, err)
+		}
+	})
+}
+
+func TestWebhook(t *testing.T) {
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		if received.Kind == "fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	webhook := NewWebhook(server.URL)
+
+	if err := webhook.Notify(lowStock); err != nil {
+		t.Fatal(err)
+	}
+	if received != lowStock {
+		t.Errorf("expected %+v, got %+v", lowStock, received)
+	}
+
+	if err := webhook.Notify(Notification{Kind: "fail"}); err == nil {
+		t.Error("expected an error for a failed delivery")
+	}
+}
+
+func TestMulti(t *testing.T) {
+	var saved []Notification
+	inbox := Inbox{Save: func(n Notification) error {
+		saved = append(saved, n)
+		return nil
+	}}
+	broken := Inbox{Save: func(n Notification) error {
+		return errors.New("inbox unavailable")
+	}}
+
+	err := Multi{broken, inbox}.Notify(lowStock)
+	if err == nil || err.Error() != "inbox unavailable" {
+		t.Errorf("expected the failure to be reported, got %v", err)
+	}
+	if len(saved) != 1 {
+		t.Errorf("expected delivery to continue after a failure, got %d", len(saved))
+	}
+}
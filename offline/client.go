@@ -0,0 +1,93 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client syncs a store with the API, authenticating with the machine key.
+type Client struct {
+	BaseURL    string
+	MachineKey string
+	HTTP       *http.Client
+}
+
+// NewClient returns a client for the API at baseURL.
+func NewClient(baseURL, machineKey string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		MachineKey: machineKey,
+		HTTP:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// envelope is the body of every API response.
+type envelope struct {
+	Status  int             `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Snapshot fetches the state of the machine from the server.
+func (c *Client) Snapshot() (Snapshot, error) {
+	var snapshot Snapshot
+	err := c.do(http.MethodGet, "/v1/sync/snapshot", nil, &snapshot)
+	return snapshot, err
+}
+
+// Sync sends the queued transactions of store to the server, drops the ones it has
+// processed and loads the snapshot it returns. With nothing queued it only refreshes
+// the snapshot.
+func (c *Client) Sync(store *Store) (SyncReport, error) {
+	var report SyncReport
+
+	pending := store.Pending()
+	if len(pending) == 0 {
+		snapshot, err := c.Snapshot()
+		if err != nil {
+			return report, err
+		}
+		report.Snapshot = snapshot
+		return report, store.Load(snapshot)
+	}
+
+	if err := c.do(http.MethodPost, "/v1/sync", SyncRequest{Transactions: pending}, &report); err != nil {
+		return report, err
+	}
+	return report, store.Settle(report.Processed, report.Snapshot)
+}
+
+func (c *Client) do(method, path string, body interface{}, data interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(method, c.BaseURL+path, &payload)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Machine-Key", c.MachineKey)
+
+	response, err := c.HTTP.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var result envelope
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("sync: %s: %v", response.Status, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("sync: %s: %s", response.Status, result.Message)
+	}
+	return json.Unmarshal(result.Data, data)
+}
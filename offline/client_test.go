@@ -0,0 +1,135 @@
+package offline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// fakeServer replays synced transactions the way the API does, holding the state
+// of one machine.
+type fakeServer struct {
+	snapshot Snapshot
+	state    *State
+	seen     map[uint64]bool
+}
+
+func (f *fakeServer) currentSnapshot() Snapshot {
+	snapshot := f.snapshot
+	snapshot.Slots = nil
+	for _, slot := range f.state.Slots {
+		snapshot.Slots = append(snapshot.Slots, slot)
+	}
+	snapshot.Balances = f.state.Balances
+	snapshot.Coins = f.state.Coins
+	for seq := range f.seen {
+		if seq > snapshot.LastSeq {
+			snapshot.LastSeq = seq
+		}
+	}
+	return snapshot
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(status int, message string, data interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "message": message, "data": data})
+	}
+
+	if r.Header.Get("X-Machine-Key") != "vmk_test" {
+		reply(http.StatusUnauthorized, "machine key invalid", nil)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/sync/snapshot":
+		reply(http.StatusOK, "snapshot", f.currentSnapshot())
+	case "/v1/sync":
+		var request SyncRequest
+		json.NewDecoder(r.Body).Decode(&request)
+
+		report := SyncReport{Rejected: []Rejection{}, Adjusted: []Outcome{}}
+		for _, tx := range request.Transactions {
+			report.Processed = append(report.Processed, tx.Seq)
+			if err := Verify(secret, tx); err != nil {
+				report.Rejected = append(report.Rejected, Rejection{Seq: tx.Seq, Reason: err.Error()})
+				continue
+			}
+			if f.seen[tx.Seq] {
+				report.Duplicates++
+				continue
+			}
+			f.seen[tx.Seq] = true
+			report.Applied++
+			if outcome := f.state.Apply(tx); outcome.Status != Applied {
+				report.Adjusted = append(report.Adjusted, outcome)
+			}
+		}
+		report.Snapshot = f.currentSnapshot()
+		reply(http.StatusOK, "synced", report)
+	default:
+		reply(http.StatusNotFound, "not found", nil)
+	}
+}
+
+func TestClientSync(t *testing.T) {
+	snapshot := testSnapshot()
+	fake := &fakeServer{snapshot: snapshot, state: NewState(snapshot), seen: map[uint64]bool{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", "vmk_test")
+	store := openStore(t, filepath.Join(t.TempDir(), "machine.json"))
+
+	if _, err := client.Sync(store); err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+
+	// offline: two buyers sell out A1 between them while the server only knows of two units
+	for _, userID := range []uint{7, 8} {
+		if _, err := store.Deposit(userID, 50); err != nil {
+			t.Fatalf("deposit: %v", err)
+		}
+		if _, err := store.Buy(userID, "A1", 1); err != nil {
+			t.Fatalf("buy: %v", err)
+		}
+	}
+
+	// meanwhile an operator takes a unit out of A1 on the server
+	slot := fake.state.Slots["A1"]
+	slot.Quantity--
+	fake.state.Slots["A1"] = slot
+
+	report, err := client.Sync(store)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if report.Applied != 4 || len(report.Adjusted) != 1 || report.Adjusted[0].Seq != 4 || report.Adjusted[0].Short != 1 {
+		t.Errorf("expected the last sale to be oversold by one, got %+v", report)
+	}
+	if len(store.Pending()) != 0 {
+		t.Errorf("expected an empty queue, got %+v", store.Pending())
+	}
+	if credit := store.Credit(8); credit != 15 {
+		t.Errorf("expected credit 15 from the server, got %d", credit)
+	}
+
+	// syncing the same transactions again changes nothing
+	tx, _ := store.Deposit(7, 10)
+	fake.seen[tx.Seq] = true
+	report, err = client.Sync(store)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if report.Duplicates != 1 || report.Applied != 0 || len(store.Pending()) != 0 {
+		t.Errorf("expected a duplicate to be dropped, got %+v", report)
+	}
+
+	t.Run("wrong machine key", func(t *testing.T) {
+		if _, err := NewClient(server.URL, "vmk_wrong").Snapshot(); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
@@ -0,0 +1,163 @@
+// Package offline lets a machine keep selling while it cannot reach the API. Sales
+// are made against a local store holding the last snapshot of the machine, and
+// recorded as a queue of signed transactions that are replayed on the server when
+// the machine reconnects. The server and the machine settle conflicts the same way,
+// with Apply.
+package offline
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/femibiwoye/go-test/coins"
+)
+
+// Kind is what a transaction records.
+type Kind string
+
+// Transaction kinds
+const (
+	// Deposit is a coin a buyer inserted, credited to them in the machine.
+	Deposit Kind = "deposit"
+	// Purchase is a product vended from a slot and paid from the buyer's credit.
+	Purchase Kind = "purchase"
+	// Reset is change paid out to a buyer from their credit.
+	Reset Kind = "reset"
+)
+
+// Transaction is a sale or payment a machine made offline. Seq numbers the
+// transactions of a machine from 1 and orders them when they are replayed.
+// Amount is the coin deposited, the total charged for a purchase or the change
+// paid out. Signature is the HMAC of the rest of the transaction with the
+// signing secret of the machine.
+type Transaction struct {
+	MachineID uint        `json:"machine_id"`
+	Seq       uint64      `json:"seq"`
+	Kind      Kind        `json:"kind"`
+	UserID    uint        `json:"user_id"`
+	SlotCode  string      `json:"slot_code,omitempty"`
+	ProductID uint        `json:"product_id,omitempty"`
+	Quantity  int         `json:"quantity,omitempty"`
+	Price     int         `json:"price,omitempty"`
+	Amount    int         `json:"amount"`
+	Coins     map[int]int `json:"coins,omitempty"`
+	At        int64       `json:"at"`
+	Signature string      `json:"signature"`
+}
+
+// Slot is a slot of a machine as the machine sees it: the product it sells, at what
+// price, and how many are left.
+type Slot struct {
+	Code      string `json:"code"`
+	ProductID uint   `json:"product_id"`
+	Price     int    `json:"price"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Snapshot is the state of a machine on the server, for the machine to sell against.
+// Slots only hold products the machine can sell offline, without purchase restrictions.
+// Balances is the credit of each buyer in the machine and Coins the coins it holds,
+// by denomination. LastSeq is the last transaction of the machine the server has.
+type Snapshot struct {
+	MachineID     uint         `json:"machine_id"`
+	Slots         []Slot       `json:"slots"`
+	Balances      map[uint]int `json:"balances"`
+	Coins         map[int]int  `json:"coins"`
+	Denominations []int        `json:"denominations"`
+	LastSeq       uint64       `json:"last_seq"`
+	TakenAt       int64        `json:"taken_at"`
+}
+
+// Rejection is a transaction the server refused, which will never be applied.
+type Rejection struct {
+	Seq    uint64 `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+// SyncRequest is the queue of transactions a machine sends when it reconnects.
+type SyncRequest struct {
+	Transactions []Transaction `json:"transactions"`
+}
+
+// SyncReport is the outcome of a sync. Processed lists every transaction the server
+// is done with, applied before or now, or rejected, so the machine can drop them from
+// its queue. Adjusted lists the transactions applied with a conflict.
+type SyncReport struct {
+	Applied    int         `json:"applied"`
+	Duplicates int         `json:"duplicates"`
+	Rejected   []Rejection `json:"rejected"`
+	Adjusted   []Outcome   `json:"adjusted"`
+	Processed  []uint64    `json:"processed"`
+	Snapshot   Snapshot    `json:"snapshot"`
+}
+
+// ErrBadSignature is returned for a transaction not signed with the secret of its machine.
+var ErrBadSignature = errors.New("transaction signature invalid")
+
+// Sign returns the signature of tx with secret.
+func Sign(secret []byte, tx Transaction) string {
+	tx.Signature = ""
+	payload, _ := json.Marshal(tx)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks tx was signed with secret.
+func Verify(secret []byte, tx Transaction) error {
+	signature, err := hex.DecodeString(tx.Signature)
+	if err != nil {
+		return ErrBadSignature
+	}
+	expected, _ := hex.DecodeString(Sign(secret, tx))
+	if !hmac.Equal(signature, expected) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Validate checks tx is a well formed transaction. Deposits must be one of the
+// coin denominations the machine accepts.
+func Validate(tx Transaction, denominations []int) error {
+	if tx.Seq == 0 {
+		return errors.New("seq must start at 1")
+	}
+	if tx.UserID == 0 {
+		return errors.New("user_id is required")
+	}
+
+	switch tx.Kind {
+	case Deposit:
+		if !containsInt(denominations, tx.Amount) {
+			return fmt.Errorf("deposit amount %d is not an accepted coin", tx.Amount)
+		}
+	case Purchase:
+		if tx.SlotCode == "" || tx.ProductID == 0 {
+			return errors.New("purchase needs a slot_code and product_id")
+		}
+		if tx.Quantity < 1 || tx.Price < 0 {
+			return errors.New("purchase quantity must be at least 1 and price cannot be negative")
+		}
+		if tx.Amount != tx.Price*tx.Quantity {
+			return fmt.Errorf("purchase amount %d does not match %d at %d", tx.Amount, tx.Quantity, tx.Price)
+		}
+	case Reset:
+		for _, count := range tx.Coins {
+			if count < 0 {
+				return errors.New("change coin count cannot be negative")
+			}
+		}
+		if tx.Amount != coins.Total(tx.Coins) {
+			return fmt.Errorf("change amount %d does not match the coins paid out", tx.Amount)
+		}
+	default:
+		return fmt.Errorf("unknown transaction kind %q", tx.Kind)
+	}
+
+	return nil
+}
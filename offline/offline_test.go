@@ -0,0 +1,71 @@
+package offline
+
+import (
+	"testing"
+)
+
+var secret = []byte("machine-secret")
+
+func TestSign(t *testing.T) {
+	tx := Transaction{MachineID: 1, Seq: 3, Kind: Purchase, UserID: 7, SlotCode: "A1", ProductID: 4, Quantity: 2, Price: 50, Amount: 100, At: 1700000000}
+	tx.Signature = Sign(secret, tx)
+
+	if err := Verify(secret, tx); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(tx *Transaction)
+		secret []byte
+	}{
+		{name: "wrong secret", change: func(tx *Transaction) {}, secret: []byte("other")},
+		{name: "changed amount", change: func(tx *Transaction) { tx.Amount = 10 }, secret: secret},
+		{name: "changed seq", change: func(tx *Transaction) { tx.Seq = 4 }, secret: secret},
+		{name: "changed user", change: func(tx *Transaction) { tx.UserID = 8 }, secret: secret},
+		{name: "added coins", change: func(tx *Transaction) { tx.Coins = map[int]int{50: 1} }, secret: secret},
+		{name: "not hex", change: func(tx *Transaction) { tx.Signature = "zz" }, secret: secret},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tampered := tx
+			tc.change(&tampered)
+			if err := Verify(tc.secret, tampered); err != ErrBadSignature {
+				t.Errorf("expected ErrBadSignature, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		tx    Transaction
+		valid bool
+	}{
+		{name: "deposit", tx: Transaction{Seq: 1, Kind: Deposit, UserID: 1, Amount: 20}, valid: true},
+		{name: "empty deposit", tx: Transaction{Seq: 1, Kind: Deposit, UserID: 1}},
+		{name: "deposit of a coin not accepted", tx: Transaction{Seq: 1, Kind: Deposit, UserID: 1, Amount: 25}},
+		{name: "purchase", tx: Transaction{Seq: 1, Kind: Purchase, UserID: 1, SlotCode: "A1", ProductID: 2, Quantity: 2, Price: 15, Amount: 30}, valid: true},
+		{name: "purchase amount mismatch", tx: Transaction{Seq: 1, Kind: Purchase, UserID: 1, SlotCode: "A1", ProductID: 2, Quantity: 2, Price: 15, Amount: 15}},
+		{name: "purchase without slot", tx: Transaction{Seq: 1, Kind: Purchase, UserID: 1, ProductID: 2, Quantity: 1, Price: 15, Amount: 15}},
+		{name: "reset", tx: Transaction{Seq: 1, Kind: Reset, UserID: 1, Amount: 70, Coins: map[int]int{50: 1, 10: 2}}, valid: true},
+		{name: "reset coins mismatch", tx: Transaction{Seq: 1, Kind: Reset, UserID: 1, Amount: 60, Coins: map[int]int{50: 1, 10: 2}}},
+		{name: "no seq", tx: Transaction{Kind: Deposit, UserID: 1, Amount: 20}},
+		{name: "no user", tx: Transaction{Seq: 1, Kind: Deposit, Amount: 20}},
+		{name: "unknown kind", tx: Transaction{Seq: 1, Kind: "refund", UserID: 1, Amount: 20}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.tx, []int{5, 10, 20, 50, 100})
+			if tc.valid && err != nil {
+				t.Errorf("expected a valid transaction, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package offline
+
+// Outcome statuses
+const (
+	// Applied is a transaction applied as the machine recorded it.
+	Applied = "applied"
+	// Adjusted is a transaction that conflicted with the state it was applied to.
+	Adjusted = "adjusted"
+)
+
+// State is what transactions are applied to: the slots of a machine by code, the
+// credit of each buyer in the machine, the coins it holds and, on the server only,
+// the account deposits of buyers.
+type State struct {
+	Slots    map[string]Slot
+	Balances map[uint]int
+	Coins    map[int]int
+	Accounts map[uint]int
+}
+
+// Outcome is how a transaction was applied. Short is the units vended that the
+// slot did not have, so the machine oversold. A charge the credit of the buyer
+// no longer covers, because it drifted while the machine was offline, is paid
+// from their account deposit, FromAccount, and what that cannot cover is Unpaid.
+// Unpaid is also change paid out beyond the buyer's credit.
+type Outcome struct {
+	Seq         uint64 `json:"seq"`
+	Kind        Kind   `json:"kind"`
+	Status      string `json:"status"`
+	Short       int    `json:"short,omitempty"`
+	FromAccount int    `json:"from_account,omitempty"`
+	Unpaid      int    `json:"unpaid,omitempty"`
+}
+
+// NewState returns the state of the machine in snapshot, with no account deposits.
+func NewState(snapshot Snapshot) *State {
+	state := &State{
+		Slots:    map[string]Slot{},
+		Balances: map[uint]int{},
+		Coins:    map[int]int{},
+		Accounts: map[uint]int{},
+	}
+	for _, slot := range snapshot.Slots {
+		state.Slots[slot.Code] = slot
+	}
+	for userID, balance := range snapshot.Balances {
+		state.Balances[userID] = balance
+	}
+	for denomination, count := range snapshot.Coins {
+		state.Coins[denomination] = count
+	}
+	return state
+}
+
+// Apply applies tx to the state. What the machine did physically always stands: a
+// product that was vended is sold even if the slot shows no stock, and change that
+// was paid out is taken from the coins. Conflicts are settled the same way whatever
+// the order they are found in, so replaying a queue in Seq order always gives the
+// same state.
+func (s *State) Apply(tx Transaction) Outcome {
+	outcome := Outcome{Seq: tx.Seq, Kind: tx.Kind, Status: Applied}
+
+	switch tx.Kind {
+	case Deposit:
+		s.Balances[tx.UserID] += tx.Amount
+		s.Coins[tx.Amount]++
+
+	case Purchase:
+		slot, ok := s.Slots[tx.SlotCode]
+		switch {
+		case !ok || slot.ProductID != tx.ProductID:
+			// the slot was emptied or changed on the server while the machine sold from it
+			outcome.Short = tx.Quantity
+		case slot.Quantity < tx.Quantity:
+			outcome.Short = tx.Quantity - slot.Quantity
+			slot.Quantity = 0
+			s.Slots[tx.SlotCode] = slot
+		default:
+			slot.Quantity -= tx.Quantity
+			s.Slots[tx.SlotCode] = slot
+		}
+
+		fromCredit := minInt(s.Balances[tx.UserID], tx.Amount)
+		s.Balances[tx.UserID] -= fromCredit
+
+		rest := tx.Amount - fromCredit
+		outcome.FromAccount = minInt(s.Accounts[tx.UserID], rest)
+		s.Accounts[tx.UserID] -= outcome.FromAccount
+		outcome.Unpaid = rest - outcome.FromAccount
+
+	case Reset:
+		returned := minInt(s.Balances[tx.UserID], tx.Amount)
+		s.Balances[tx.UserID] -= returned
+		outcome.Unpaid = tx.Amount - returned
+
+		for denomination, count := range tx.Coins {
+			s.Coins[denomination] -= minInt(s.Coins[denomination], count)
+		}
+	}
+
+	if outcome.Short > 0 || outcome.FromAccount > 0 || outcome.Unpaid > 0 {
+		outcome.Status = Adjusted
+	}
+	return outcome
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,146 @@
+package offline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	snapshot := Snapshot{
+		MachineID: 1,
+		Slots: []Slot{
+			{Code: "A1", ProductID: 10, Price: 50, Quantity: 3},
+			{Code: "A2", ProductID: 11, Price: 20, Quantity: 1},
+		},
+		Balances: map[uint]int{7: 100},
+		Coins:    map[int]int{10: 5, 50: 1},
+	}
+
+	purchase := func(seq uint64, code string, productID uint, quantity, price int) Transaction {
+		return Transaction{Seq: seq, Kind: Purchase, UserID: 7, SlotCode: code, ProductID: productID, Quantity: quantity, Price: price, Amount: quantity * price}
+	}
+
+	tests := []struct {
+		name     string
+		accounts map[uint]int
+		tx       Transaction
+		expected Outcome
+		slot     Slot
+		balance  int
+		account  int
+	}{
+		{
+			name:     "purchase in stock and paid",
+			tx:       purchase(1, "A1", 10, 2, 50),
+			expected: Outcome{Seq: 1, Kind: Purchase, Status: Applied},
+			slot:     Slot{Code: "A1", ProductID: 10, Price: 50, Quantity: 1},
+			balance:  0,
+		},
+		{
+			name:     "oversold slot is emptied",
+			tx:       purchase(2, "A2", 11, 3, 20),
+			expected: Outcome{Seq: 2, Kind: Purchase, Status: Adjusted, Short: 2},
+			slot:     Slot{Code: "A2", ProductID: 11, Price: 20, Quantity: 0},
+			balance:  40,
+		},
+		{
+			name:     "slot changed on the server",
+			tx:       purchase(3, "A2", 99, 1, 20),
+			expected: Outcome{Seq: 3, Kind: Purchase, Status: Adjusted, Short: 1},
+			slot:     Slot{Code: "A2", ProductID: 11, Price: 20, Quantity: 1},
+			balance:  80,
+		},
+		{
+			name:     "drifted credit is made up from the account",
+			accounts: map[uint]int{7: 30},
+			tx:       purchase(4, "A1", 10, 3, 40),
+			expected: Outcome{Seq: 4, Kind: Purchase, Status: Adjusted, FromAccount: 20},
+			slot:     Slot{Code: "A1", ProductID: 10, Price: 50, Quantity: 0},
+			balance:  0,
+			account:  10,
+		},
+		{
+			name:     "what the account cannot cover is unpaid",
+			accounts: map[uint]int{7: 5},
+			tx:       purchase(5, "A1", 10, 3, 50),
+			expected: Outcome{Seq: 5, Kind: Purchase, Status: Adjusted, FromAccount: 5, Unpaid: 45},
+			slot:     Slot{Code: "A1", ProductID: 10, Price: 50, Quantity: 0},
+			balance:  0,
+			account:  0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			state := NewState(snapshot)
+			for userID, deposit := range tc.accounts {
+				state.Accounts[userID] = deposit
+			}
+
+			outcome := state.Apply(tc.tx)
+			if outcome != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, outcome)
+			}
+			if slot := state.Slots[tc.tx.SlotCode]; slot != tc.slot {
+				t.Errorf("expected slot %+v, got %+v", tc.slot, slot)
+			}
+			if state.Balances[7] != tc.balance || state.Accounts[7] != tc.account {
+				t.Errorf("expected credit %d and account %d, got %d and %d", tc.balance, tc.account, state.Balances[7], state.Accounts[7])
+			}
+		})
+	}
+
+	t.Run("deposit adds credit and a coin", func(t *testing.T) {
+		state := NewState(snapshot)
+		outcome := state.Apply(Transaction{Seq: 1, Kind: Deposit, UserID: 8, Amount: 20})
+		if outcome.Status != Applied || state.Balances[8] != 20 || state.Coins[20] != 1 {
+			t.Errorf("expected credit 20 and one 20 coin, got %+v, %d, %v", outcome, state.Balances[8], state.Coins)
+		}
+	})
+
+	t.Run("change paid beyond the credit is unpaid", func(t *testing.T) {
+		state := NewState(snapshot)
+		outcome := state.Apply(Transaction{Seq: 1, Kind: Reset, UserID: 7, Amount: 120, Coins: map[int]int{50: 2, 10: 2}})
+		expected := Outcome{Seq: 1, Kind: Reset, Status: Adjusted, Unpaid: 20}
+		if outcome != expected {
+			t.Errorf("expected %+v, got %+v", expected, outcome)
+		}
+		if !reflect.DeepEqual(state.Coins, map[int]int{10: 3, 50: 0}) {
+			t.Errorf("expected coins to stop at zero, got %v", state.Coins)
+		}
+	})
+
+	t.Run("replaying a queue is deterministic", func(t *testing.T) {
+		queue := []Transaction{
+			{Seq: 1, Kind: Deposit, UserID: 7, Amount: 50},
+			purchase(2, "A2", 11, 2, 20),
+			purchase(3, "A1", 10, 3, 50),
+			{Seq: 4, Kind: Reset, UserID: 7, Amount: 0},
+		}
+
+		var first *State
+		var firstOutcomes []Outcome
+		for run := 0; run < 5; run++ {
+			state := NewState(snapshot)
+			state.Accounts[7] = 20
+			var outcomes []Outcome
+			for _, tx := range queue {
+				outcomes = append(outcomes, state.Apply(tx))
+			}
+			if first == nil {
+				first, firstOutcomes = state, outcomes
+				continue
+			}
+			if !reflect.DeepEqual(state, first) || !reflect.DeepEqual(outcomes, firstOutcomes) {
+				t.Fatalf("replay %d differs", run)
+			}
+		}
+
+		if first.Balances[7] != 0 || first.Accounts[7] != 0 {
+			t.Errorf("expected credit and account used up, got %d and %d", first.Balances[7], first.Accounts[7])
+		}
+		if firstOutcomes[1].Short != 1 || firstOutcomes[2].FromAccount != 20 || firstOutcomes[2].Unpaid != 20 {
+			t.Errorf("unexpected outcomes %+v", firstOutcomes)
+		}
+	})
+}
@@ -0,0 +1,291 @@
+package offline
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/femibiwoye/go-test/coins"
+)
+
+// Errors returned when a sale cannot be made offline
+var (
+	ErrNoSnapshot         = errors.New("store has no snapshot, sync the machine first")
+	ErrInvalidCoin        = errors.New("coin not accepted")
+	ErrUnknownSlot        = errors.New("no such slot")
+	ErrSoldOut            = errors.New("slot sold out")
+	ErrInsufficientCredit = errors.New("insufficient credit")
+	ErrNoCredit           = errors.New("no credit to return")
+)
+
+// Store is the local store of a machine: the last snapshot from the server and the
+// transactions made since, kept in a file so they survive a restart. Sales are
+// checked against the snapshot with the queued transactions applied.
+type Store struct {
+	path   string
+	secret []byte
+	now    func() time.Time
+
+	mu    sync.Mutex
+	saved savedStore
+	state *State
+}
+
+// savedStore is what a store keeps in its file.
+type savedStore struct {
+	Snapshot *Snapshot     `json:"snapshot"`
+	Queue    []Transaction `json:"queue"`
+	Seq      uint64        `json:"seq"`
+}
+
+// Open opens the store in the file at path, creating it on first save. Transactions
+// are signed with secret, the signing secret of the machine.
+func Open(path string, secret []byte) (*Store, error) {
+	s := &Store{path: path, secret: secret, now: time.Now}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.saved); err != nil {
+			return nil, err
+		}
+	}
+
+	s.rebuild()
+	return s, nil
+}
+
+// Load replaces the snapshot with one from the server. Transactions still queued
+// are applied on top of it, as the server has not seen them yet.
+func (s *Store) Load(snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.load(snapshot)
+	s.rebuild()
+	return s.save()
+}
+
+// Settle drops the transactions the server is done with from the queue and loads the
+// snapshot it returned with them, in one write so a crash cannot leave the store with
+// one and not the other.
+func (s *Store) Settle(processed []uint64, snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.acknowledge(processed)
+	s.load(snapshot)
+	s.rebuild()
+	return s.save()
+}
+
+// Deposit credits userID with coin.
+func (s *Store) Deposit(userID uint, coin int) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return Transaction{}, ErrNoSnapshot
+	}
+	if !containsInt(s.saved.Snapshot.Denominations, coin) {
+		return Transaction{}, ErrInvalidCoin
+	}
+
+	return s.record(Transaction{Kind: Deposit, UserID: userID, Amount: coin})
+}
+
+// Buy sells quantity units from the slot with code to userID, paid from their credit.
+func (s *Store) Buy(userID uint, code string, quantity int) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return Transaction{}, ErrNoSnapshot
+	}
+
+	slot, ok := s.state.Slots[code]
+	if !ok {
+		return Transaction{}, ErrUnknownSlot
+	}
+	if quantity < 1 || slot.Quantity < quantity {
+		return Transaction{}, ErrSoldOut
+	}
+	if s.state.Balances[userID] < slot.Price*quantity {
+		return Transaction{}, ErrInsufficientCredit
+	}
+
+	return s.record(Transaction{
+		Kind:      Purchase,
+		UserID:    userID,
+		SlotCode:  code,
+		ProductID: slot.ProductID,
+		Quantity:  quantity,
+		Price:     slot.Price,
+		Amount:    slot.Price * quantity,
+	})
+}
+
+// Reset pays out the credit of userID in the fewest coins the machine holds. Credit it
+// cannot pay out exactly stays in the machine.
+func (s *Store) Reset(userID uint) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return Transaction{}, ErrNoSnapshot
+	}
+
+	change, paid := coins.MakeChange(s.state.Balances[userID], s.state.Coins)
+	if paid == 0 {
+		return Transaction{}, ErrNoCredit
+	}
+
+	return s.record(Transaction{Kind: Reset, UserID: userID, Amount: paid, Coins: change})
+}
+
+// Credit is the credit userID has in the machine.
+func (s *Store) Credit(userID uint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return 0
+	}
+	return s.state.Balances[userID]
+}
+
+// Slot returns the slot with code as the machine sees it.
+func (s *Store) Slot(code string) (Slot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == nil {
+		return Slot{}, false
+	}
+	slot, ok := s.state.Slots[code]
+	return slot, ok
+}
+
+// Pending returns the transactions waiting to be synced, in Seq order.
+func (s *Store) Pending() []Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Transaction{}, s.saved.Queue...)
+}
+
+// Acknowledge drops the transactions the server is done with from the queue.
+func (s *Store) Acknowledge(processed []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.acknowledge(processed)
+	s.rebuild()
+	return s.save()
+}
+
+// load replaces the snapshot. It must be called with the lock held.
+func (s *Store) load(snapshot Snapshot) {
+	s.saved.Snapshot = &snapshot
+	if snapshot.LastSeq > s.saved.Seq {
+		s.saved.Seq = snapshot.LastSeq
+	}
+}
+
+// acknowledge drops processed from the queue. It must be called with the lock held.
+func (s *Store) acknowledge(processed []uint64) {
+	done := map[uint64]bool{}
+	for _, seq := range processed {
+		done[seq] = true
+	}
+
+	queue := s.saved.Queue[:0]
+	for _, tx := range s.saved.Queue {
+		if !done[tx.Seq] {
+			queue = append(queue, tx)
+		}
+	}
+	s.saved.Queue = queue
+}
+
+// record signs tx, applies it and queues it. It must be called with the lock held.
+func (s *Store) record(tx Transaction) (Transaction, error) {
+	s.saved.Seq++
+	tx.MachineID = s.saved.Snapshot.MachineID
+	tx.Seq = s.saved.Seq
+	tx.At = s.now().Unix()
+	tx.Signature = Sign(s.secret, tx)
+
+	s.saved.Queue = append(s.saved.Queue, tx)
+	s.state.Apply(tx)
+
+	if err := s.save(); err != nil {
+		// keep memory and the file in step: the sale did not happen
+		s.saved.Queue = s.saved.Queue[:len(s.saved.Queue)-1]
+		s.saved.Seq--
+		s.rebuild()
+		return Transaction{}, err
+	}
+	return tx, nil
+}
+
+// rebuild works out the state from the snapshot and the queue. Queued transactions
+// up to the LastSeq of the snapshot are already in it and are not applied again.
+func (s *Store) rebuild() {
+	if s.saved.Snapshot == nil {
+		s.state = nil
+		return
+	}
+
+	sort.Slice(s.saved.Queue, func(i, j int) bool { return s.saved.Queue[i].Seq < s.saved.Queue[j].Seq })
+
+	s.state = NewState(*s.saved.Snapshot)
+	for _, tx := range s.saved.Queue {
+		if tx.Seq <= s.saved.Snapshot.LastSeq {
+			continue
+		}
+		s.state.Apply(tx)
+	}
+}
+
+// save writes the store to its file, replacing it in one step so a crash leaves
+// either the old file or the new one.
+func (s *Store) save() error {
+	data, err := json.Marshal(s.saved)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
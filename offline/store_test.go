@@ -0,0 +1,180 @@
+package offline
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testSnapshot() Snapshot {
+	return Snapshot{
+		MachineID:     3,
+		Slots:         []Slot{{Code: "A1", ProductID: 10, Price: 35, Quantity: 2}},
+		Balances:      map[uint]int{},
+		Coins:         map[int]int{5: 4, 10: 2},
+		Denominations: []int{5, 10, 20, 50, 100},
+		LastSeq:       0,
+	}
+}
+
+func openStore(t *testing.T, path string) *Store {
+	t.Helper()
+	store, err := Open(path, secret)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	store.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return store
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "machine.json")
+	store := openStore(t, path)
+
+	if _, err := store.Deposit(7, 50); err != ErrNoSnapshot {
+		t.Fatalf("expected ErrNoSnapshot before the first sync, got %v", err)
+	}
+	if err := store.Load(testSnapshot()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if _, err := store.Deposit(7, 25); err != ErrInvalidCoin {
+		t.Errorf("expected ErrInvalidCoin, got %v", err)
+	}
+	if _, err := store.Deposit(7, 50); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+	if _, err := store.Buy(7, "B1", 1); err != ErrUnknownSlot {
+		t.Errorf("expected ErrUnknownSlot, got %v", err)
+	}
+	if _, err := store.Buy(7, "A1", 2); err != ErrInsufficientCredit {
+		t.Errorf("expected ErrInsufficientCredit, got %v", err)
+	}
+
+	tx, err := store.Buy(7, "A1", 1)
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	expected := Transaction{MachineID: 3, Seq: 2, Kind: Purchase, UserID: 7, SlotCode: "A1", ProductID: 10, Quantity: 1, Price: 35, Amount: 35, At: 1700000000}
+	expected.Signature = Sign(secret, expected)
+	if !reflect.DeepEqual(tx, expected) {
+		t.Errorf("expected %+v, got %+v", expected, tx)
+	}
+	if err := Verify(secret, tx); err != nil {
+		t.Errorf("expected a signed transaction, got %v", err)
+	}
+
+	reset, err := store.Reset(7)
+	if err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if reset.Amount != 15 || !reflect.DeepEqual(reset.Coins, map[int]int{10: 1, 5: 1}) {
+		t.Errorf("expected 15 in a 10 and a 5, got %d in %v", reset.Amount, reset.Coins)
+	}
+	if _, err := store.Reset(7); err != ErrNoCredit {
+		t.Errorf("expected ErrNoCredit, got %v", err)
+	}
+
+	if slot, _ := store.Slot("A1"); slot.Quantity != 1 {
+		t.Errorf("expected 1 left in A1, got %d", slot.Quantity)
+	}
+
+	t.Run("queue survives a restart", func(t *testing.T) {
+		reopened := openStore(t, path)
+		if !reflect.DeepEqual(reopened.Pending(), store.Pending()) {
+			t.Errorf("expected the same queue after reopening")
+		}
+		if slot, _ := reopened.Slot("A1"); slot.Quantity != 1 {
+			t.Errorf("expected 1 left in A1 after reopening, got %d", slot.Quantity)
+		}
+	})
+
+	t.Run("a new snapshot keeps unsynced sales", func(t *testing.T) {
+		if err := store.Acknowledge([]uint64{1}); err != nil {
+			t.Fatalf("acknowledge: %v", err)
+		}
+
+		// the server has the deposit, and restocked A1 to 5 meanwhile
+		snapshot := testSnapshot()
+		snapshot.Slots[0].Quantity = 5
+		snapshot.Balances[7] = 50
+		snapshot.LastSeq = 1
+		if err := store.Load(snapshot); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+
+		if pending := store.Pending(); len(pending) != 2 || pending[0].Seq != 2 || pending[1].Seq != 3 {
+			t.Fatalf("expected the purchase and reset still queued, got %+v", pending)
+		}
+		if slot, _ := store.Slot("A1"); slot.Quantity != 4 {
+			t.Errorf("expected 4 left in A1, got %d", slot.Quantity)
+		}
+		if credit := store.Credit(7); credit != 0 {
+			t.Errorf("expected no credit left, got %d", credit)
+		}
+	})
+
+	t.Run("queued transactions the snapshot has are not applied twice", func(t *testing.T) {
+		// the server applied the purchase but the reply was lost, so it is still queued
+		snapshot := testSnapshot()
+		snapshot.Slots[0].Quantity = 4
+		snapshot.Balances[7] = 15
+		snapshot.LastSeq = 2
+		if err := store.Load(snapshot); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+
+		if pending := store.Pending(); len(pending) != 2 {
+			t.Fatalf("expected the purchase and reset still queued, got %+v", pending)
+		}
+		if slot, _ := store.Slot("A1"); slot.Quantity != 4 {
+			t.Errorf("expected 4 left in A1, got %d", slot.Quantity)
+		}
+		if credit := store.Credit(7); credit != 0 {
+			t.Errorf("expected the reset applied on top, got credit %d", credit)
+		}
+	})
+
+	t.Run("settle acknowledges and loads in one write", func(t *testing.T) {
+		snapshot := testSnapshot()
+		snapshot.Slots[0].Quantity = 4
+		snapshot.LastSeq = 3
+		if err := store.Settle([]uint64{2, 3}, snapshot); err != nil {
+			t.Fatalf("settle: %v", err)
+		}
+
+		reopened := openStore(t, path)
+		if pending := reopened.Pending(); len(pending) != 0 {
+			t.Errorf("expected an empty queue after reopening, got %+v", pending)
+		}
+		if slot, _ := reopened.Slot("A1"); slot.Quantity != 4 {
+			t.Errorf("expected the new snapshot after reopening, got %d in A1", slot.Quantity)
+		}
+	})
+
+	t.Run("seq carries on from the server after losing the store", func(t *testing.T) {
+		fresh := openStore(t, filepath.Join(t.TempDir(), "machine.json"))
+		snapshot := testSnapshot()
+		snapshot.LastSeq = 40
+		if err := fresh.Load(snapshot); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		tx, err := fresh.Deposit(7, 10)
+		if err != nil {
+			t.Fatalf("deposit: %v", err)
+		}
+		if tx.Seq != 41 {
+			t.Errorf("expected seq 41, got %d", tx.Seq)
+		}
+	})
+
+	t.Run("corrupt store", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "machine.json")
+		os.WriteFile(bad, []byte("{"), 0600)
+		if _, err := Open(bad, secret); err == nil {
+			t.Errorf("expected an error opening a corrupt store")
+		}
+	})
+}
@@ -0,0 +1,174 @@
+// Package pricing evaluates promotions against the items of a purchase.
+package pricing
+
+import (
+	"sort"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+// Line is a product being purchased at a unit price. ParentID is the product a
+// variant belongs to, so promotions on the parent apply to it too.
+type Line struct {
+	ProductID uint
+	ParentID  uint
+	Quantity  int
+	UnitPrice int
+}
+
+// promotionOrder is the order promotion types are evaluated in. Bundles go
+// first because they need units of two products.
+var promotionOrder = map[string]int{
+	models.PromotionBundle:     0,
+	models.PromotionMultiBuy:   1,
+	models.PromotionPercentage: 2,
+}
+
+// units are the units of a purchase not yet discounted, by product.
+type units struct {
+	remaining map[uint]int
+	unitPrice map[uint]int
+	parent    map[uint]uint
+	products  []uint
+}
+
+func newUnits(lines []Line) *units {
+	u := &units{remaining: map[uint]int{}, unitPrice: map[uint]int{}, parent: map[uint]uint{}}
+	for _, line := range lines {
+		if _, ok := u.remaining[line.ProductID]; !ok {
+			u.products = append(u.products, line.ProductID)
+		}
+		u.remaining[line.ProductID] += line.Quantity
+		u.unitPrice[line.ProductID] = line.UnitPrice
+		u.parent[line.ProductID] = line.ParentID
+	}
+	sort.Slice(u.products, func(i, j int) bool { return u.products[i] < u.products[j] })
+	return u
+}
+
+// count is the number of units left of a product and its variants.
+func (u *units) count(productID uint) int {
+	total := 0
+	for _, id := range u.products {
+		if id == productID || u.parent[id] == productID {
+			total += u.remaining[id]
+		}
+	}
+	return total
+}
+
+// next returns the cheapest, or dearest, unit left of a product and its variants.
+func (u *units) next(productID uint, cheapest bool) (uint, bool) {
+	var found uint
+	ok := false
+	for _, id := range u.products {
+		if (id != productID && u.parent[id] != productID) || u.remaining[id] == 0 {
+			continue
+		}
+		if !ok || (cheapest && u.unitPrice[id] < u.unitPrice[found]) || (!cheapest && u.unitPrice[id] > u.unitPrice[found]) {
+			found, ok = id, true
+		}
+	}
+	return found, ok
+}
+
+// take takes n units of a product and its variants, cheapest first, and returns their prices.
+func (u *units) take(productID uint, n int) []int {
+	prices := make([]int, 0, n)
+	for len(prices) < n {
+		id, ok := u.next(productID, true)
+		if !ok {
+			break
+		}
+		u.remaining[id]--
+		prices = append(prices, u.unitPrice[id])
+	}
+	return prices
+}
+
+// ApplyPromotions returns the discounts the promotions give on lines at the
+// given unix time. A unit of a product is discounted by at most one promotion;
+// promotions are evaluated bundles first, then multi-buys, then percentages,
+// and in ID order within a type. A promotion on a product with variants applies to
+// its variants as one product: multi-buys give the cheapest units free and bundles
+// are made from the dearest units.
+func ApplyPromotions(lines []Line, promotions []models.Promotion, at int64) []models.AppliedDiscount {
+	units := newUnits(lines)
+
+	ordered := make([]models.Promotion, 0, len(promotions))
+	for _, promotion := range promotions {
+		if _, ok := promotionOrder[promotion.Type]; ok && promotion.ActiveAt(at) {
+			ordered = append(ordered, promotion)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if promotionOrder[ordered[i].Type] != promotionOrder[ordered[j].Type] {
+			return promotionOrder[ordered[i].Type] < promotionOrder[ordered[j].Type]
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+
+	discounts := []models.AppliedDiscount{}
+	for _, promotion := range ordered {
+		amount := 0
+
+		switch promotion.Type {
+		case models.PromotionBundle:
+			for {
+				first, ok := units.next(promotion.ProductID, false)
+				if !ok {
+					break
+				}
+				units.remaining[first]--
+				second, ok := units.next(promotion.BundleProductID, false)
+				saving := units.unitPrice[first] + units.unitPrice[second] - promotion.BundlePrice
+				if !ok || saving <= 0 {
+					units.remaining[first]++
+					break
+				}
+				units.remaining[second]--
+				amount += saving
+			}
+
+		case models.PromotionMultiBuy:
+			groupSize := promotion.BuyQuantity + promotion.FreeQuantity
+			if promotion.BuyQuantity < 1 || promotion.FreeQuantity < 1 {
+				continue
+			}
+			groups := units.count(promotion.ProductID) / groupSize
+			if groups > 0 {
+				prices := units.take(promotion.ProductID, groups*groupSize)
+				for _, price := range prices[:groups*promotion.FreeQuantity] {
+					amount += price
+				}
+			}
+
+		case models.PromotionPercentage:
+			spent := 0
+			for _, price := range units.take(promotion.ProductID, units.count(promotion.ProductID)) {
+				spent += price
+			}
+			amount = spent * promotion.Percent / 100
+		}
+
+		if amount > 0 {
+			discounts = append(discounts, models.AppliedDiscount{
+				PromotionID: promotion.ID,
+				Name:        promotion.Name,
+				Type:        promotion.Type,
+				Amount:      amount,
+			})
+		}
+	}
+
+	return discounts
+}
+
+// TotalDiscount adds up the amounts of discounts.
+func TotalDiscount(discounts []models.AppliedDiscount) int {
+	total := 0
+	for _, discount := range discounts {
+		total += discount.Amount
+	}
+	return total
+}
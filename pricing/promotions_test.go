@@ -0,0 +1,96 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+const now = 1700000000
+
+func TestApplyPromotions(t *testing.T) {
+	buyTwoGetOne := models.Promotion{ID: 1, Name: "3 for 2", Type: models.PromotionMultiBuy, ProductID: 1, BuyQuantity: 2, FreeQuantity: 1, Active: true}
+	tenPercentOff := models.Promotion{ID: 2, Name: "10% off", Type: models.PromotionPercentage, ProductID: 1, Percent: 10, Active: true}
+	mealDeal := models.Promotion{ID: 3, Name: "meal deal", Type: models.PromotionBundle, ProductID: 1, BundleProductID: 2, BundlePrice: 120, Active: true}
+
+	tests := []struct {
+		name       string
+		lines      []Line
+		promotions []models.Promotion
+		expected   []int
+	}{
+		{
+			name:       "multi buy discounts complete groups only",
+			lines:      []Line{{ProductID: 1, Quantity: 7, UnitPrice: 50}},
+			promotions: []models.Promotion{buyTwoGetOne},
+			expected:   []int{100},
+		},
+		{
+			name:       "percentage applies to units left after multi buy",
+			lines:      []Line{{ProductID: 1, Quantity: 4, UnitPrice: 50}},
+			promotions: []models.Promotion{tenPercentOff, buyTwoGetOne},
+			expected:   []int{50, 5},
+		},
+		{
+			name:       "bundle is evaluated first",
+			lines:      []Line{{ProductID: 1, Quantity: 1, UnitPrice: 100}, {ProductID: 2, Quantity: 2, UnitPrice: 50}},
+			promotions: []models.Promotion{tenPercentOff, mealDeal},
+			expected:   []int{30},
+		},
+		{
+			name:       "bundle that saves nothing is skipped",
+			lines:      []Line{{ProductID: 1, Quantity: 1, UnitPrice: 50}, {ProductID: 2, Quantity: 1, UnitPrice: 50}},
+			promotions: []models.Promotion{mealDeal},
+			expected:   []int{},
+		},
+		{
+			name:       "percentage on a parent applies to its variants",
+			lines:      []Line{{ProductID: 11, ParentID: 1, Quantity: 2, UnitPrice: 50}, {ProductID: 12, ParentID: 1, Quantity: 1, UnitPrice: 100}},
+			promotions: []models.Promotion{tenPercentOff},
+			expected:   []int{20},
+		},
+		{
+			name:       "multi buy across variants gives the cheapest free",
+			lines:      []Line{{ProductID: 11, ParentID: 1, Quantity: 2, UnitPrice: 80}, {ProductID: 12, ParentID: 1, Quantity: 1, UnitPrice: 50}},
+			promotions: []models.Promotion{buyTwoGetOne},
+			expected:   []int{50},
+		},
+		{
+			name:       "bundle uses the dearest variant",
+			lines:      []Line{{ProductID: 11, ParentID: 1, Quantity: 1, UnitPrice: 90}, {ProductID: 12, ParentID: 1, Quantity: 1, UnitPrice: 110}, {ProductID: 2, Quantity: 1, UnitPrice: 50}},
+			promotions: []models.Promotion{mealDeal},
+			expected:   []int{40},
+		},
+		{
+			name:       "promotion on a variant does not apply to its siblings",
+			lines:      []Line{{ProductID: 11, ParentID: 1, Quantity: 1, UnitPrice: 50}, {ProductID: 12, ParentID: 1, Quantity: 1, UnitPrice: 50}},
+			promotions: []models.Promotion{{ID: 7, Type: models.PromotionPercentage, ProductID: 11, Percent: 50, Active: true}},
+			expected:   []int{25},
+		},
+		{
+			name:  "promotions outside their window are ignored",
+			lines: []Line{{ProductID: 1, Quantity: 3, UnitPrice: 50}},
+			promotions: []models.Promotion{
+				{ID: 4, Type: models.PromotionPercentage, ProductID: 1, Percent: 50, Active: true, StartsAt: now + 60},
+				{ID: 5, Type: models.PromotionPercentage, ProductID: 1, Percent: 50, Active: true, EndsAt: now},
+				{ID: 6, Type: models.PromotionPercentage, ProductID: 1, Percent: 50, Active: false},
+			},
+			expected: []int{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			discounts := ApplyPromotions(test.lines, test.promotions, now)
+
+			if len(discounts) != len(test.expected) {
+				t.Fatalf("got %d discounts expected %d: %+v", len(discounts), len(test.expected), discounts)
+			}
+			for i, discount := range discounts {
+				if discount.Amount != test.expected[i] {
+					t.Errorf("discount %d: got amount %d expected %d", i, discount.Amount, test.expected[i])
+				}
+			}
+		})
+	}
+}
@@ -28,22 +28,113 @@ func (h *Handler) SetupRoutes() {
 	h.Router.HandleFunc("/v1/user", controllers.GetUser).Methods("GET")
 	h.Router.HandleFunc("/v1/user", controllers.UserUpdate).Methods("PUT")
 	h.Router.HandleFunc("/v1/user", controllers.UserDelete).Methods("DELETE")
+	h.Router.HandleFunc("/v1/users/{user_id}/verify-date-of-birth", controllers.UserVerifyDateOfBirth).Methods("POST")
 	h.Router.HandleFunc("/v1/login", controllers.UserLogin).Methods("POST")
 	h.Router.HandleFunc("/v1/verify-token", controllers.VerifyTokenHandler).Methods("POST")
 	h.Router.HandleFunc("/v1/logout", controllers.Logout)
 	h.Router.HandleFunc("/v1/logout/all", controllers.LogoutAll)
 
+	// product review
+	h.Router.HandleFunc("/v1/admin/reviews", controllers.ReviewQueue).Methods("GET")
+	h.Router.HandleFunc("/v1/admin/reviews/{product_id}", controllers.ReviewDecide).Methods("POST")
+
 	// product
 	h.Router.HandleFunc("/v1/products", controllers.ProductCreate).Methods("POST")
 	h.Router.HandleFunc("/v1/products", controllers.ProductGetALL).Methods("GET")
+	h.Router.HandleFunc("/v1/products/search", controllers.ProductSearch).Methods("GET")
+	h.Router.HandleFunc("/v1/products/import", controllers.ProductImport).Methods("POST")
+	h.Router.HandleFunc("/v1/products/export", controllers.ProductExport).Methods("GET")
 	h.Router.HandleFunc("/v1/products/{product_id}", controllers.ProductGet).Methods("GET")
 	h.Router.HandleFunc("/v1/products/{product_id}", controllers.ProductUpdate).Methods("PUT")
 	h.Router.HandleFunc("/v1/products/{product_id}", controllers.ProductDelete).Methods("DELETE")
+	h.Router.HandleFunc("/v1/products/{product_id}/restore", controllers.ProductRestore).Methods("POST")
+	h.Router.HandleFunc("/v1/products/{product_id}/submit", controllers.ProductSubmit).Methods("POST")
+	h.Router.HandleFunc("/v1/products/{product_id}/variants", controllers.ProductVariantGetAll).Methods("GET")
+	h.Router.HandleFunc("/v1/products/{product_id}/variants", controllers.ProductVariantCreate).Methods("POST")
+	h.Router.HandleFunc("/v1/products/{product_id}/prices", controllers.ProductPriceHistory).Methods("GET")
+	h.Router.HandleFunc("/v1/products/{product_id}/prices", controllers.ProductPriceSchedule).Methods("POST")
+	h.Router.HandleFunc("/v1/products/{product_id}/prices/{price_id}", controllers.ProductPriceCancel).Methods("DELETE")
+	h.Router.HandleFunc("/v1/products/{product_id}/image", controllers.ProductImageUpload).Methods("POST")
+	h.Router.HandleFunc("/v1/products/{product_id}/image", controllers.ProductImageDelete).Methods("DELETE")
+	h.Router.HandleFunc("/v1/products/{product_id}/restrictions", controllers.ProductRestrictionGet).Methods("GET")
+	h.Router.HandleFunc("/v1/products/{product_id}/restrictions", controllers.ProductRestrictionSet).Methods("PUT")
+	h.Router.HandleFunc("/v1/products/{product_id}/restrictions", controllers.ProductRestrictionDelete).Methods("DELETE")
+	h.Router.HandleFunc("/v1/products/{product_id}/lots", controllers.StockLotGetAll).Methods("GET")
+	h.Router.HandleFunc("/v1/products/{product_id}/lots", controllers.StockLotCreate).Methods("POST")
+	h.Router.HandleFunc("/v1/stock/expiring", controllers.StockExpiryReport).Methods("GET")
+	h.Router.HandleFunc("/v1/inbox", controllers.InboxGet).Methods("GET")
+	h.Router.HandleFunc("/v1/inbox/{message_id}/read", controllers.InboxMarkRead).Methods("POST")
+
+	// category
+	h.Router.HandleFunc("/v1/categories", controllers.CategoryCreate).Methods("POST")
+	h.Router.HandleFunc("/v1/categories", controllers.CategoryGetAll).Methods("GET")
+	h.Router.HandleFunc("/v1/categories/{category_id}", controllers.CategoryUpdate).Methods("PUT")
+	h.Router.HandleFunc("/v1/categories/{category_id}", controllers.CategoryDelete).Methods("DELETE")
+
+	// media
+	h.Router.HandleFunc("/media/{key:.+}", controllers.MediaGet).Methods("GET")
+
+	// promotion
+	h.Router.HandleFunc("/v1/promotions", controllers.PromotionCreate).Methods("POST")
+	h.Router.HandleFunc("/v1/promotions", controllers.PromotionGetAll).Methods("GET")
+	h.Router.HandleFunc("/v1/promotions/{promotion_id}", controllers.PromotionUpdate).Methods("PUT")
+	h.Router.HandleFunc("/v1/promotions/{promotion_id}", controllers.PromotionDelete).Methods("DELETE")
+
+	// voucher
+	h.Router.HandleFunc("/v1/vouchers", controllers.VoucherCreate).Methods("POST")
+	h.Router.HandleFunc("/v1/vouchers", controllers.VoucherGetAll).Methods("GET")
+	h.Router.HandleFunc("/v1/vouchers/redeem", controllers.VoucherRedeem).Methods("POST")
+	h.Router.HandleFunc("/v1/vouchers/{voucher_id}", controllers.VoucherUpdate).Methods("PUT")
+
+	// loyalty
+	h.Router.HandleFunc("/v1/loyalty", controllers.LoyaltyGet).Methods("GET")
+	h.Router.HandleFunc("/v1/loyalty/redeem", controllers.LoyaltyRedeem).Methods("POST")
+	h.Router.HandleFunc("/v1/loyalty/rules", controllers.EarningRuleCreate).Methods("POST")
+	h.Router.HandleFunc("/v1/loyalty/rules", controllers.EarningRuleGetAll).Methods("GET")
+	h.Router.HandleFunc("/v1/loyalty/rules/{rule_id}", controllers.EarningRuleDelete).Methods("DELETE")
+
+	// machine
+	h.Router.HandleFunc("/v1/machines", controllers.MachineCreate).Methods("POST")
+	h.Router.HandleFunc("/v1/machines", controllers.MachineGetAll).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}", controllers.MachineGet).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}", controllers.MachineUpdate).Methods("PUT")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/coins", controllers.MachineCoinsSet).Methods("PUT")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/status", controllers.MachineStatusSet).Methods("PUT")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/refunds", controllers.MachineRefund).Methods("POST")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/picklist", controllers.MachinePickList).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/visits", controllers.RestockVisitCreate).Methods("POST")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/forecast", controllers.MachineForecast).Methods("GET")
+	h.Router.HandleFunc("/v1/visits", controllers.RestockVisitGetAll).Methods("GET")
+	h.Router.HandleFunc("/v1/visits/{visit_id}", controllers.RestockVisitGet).Methods("GET")
+	h.Router.HandleFunc("/v1/visits/{visit_id}/complete", controllers.RestockVisitComplete).Methods("PUT")
+	h.Router.HandleFunc("/v1/routes/plan", controllers.RoutePlan).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/products", controllers.MachineProducts).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/planogram", controllers.MachinePlanogramGet).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/planogram", controllers.MachinePlanogramSet).Methods("PUT")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/slots/{slot_code}", controllers.MachineSlotSet).Methods("PUT")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/slots/{slot_code}", controllers.MachineSlotDelete).Methods("DELETE")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/key", controllers.MachineKeyIssue).Methods("POST")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/signing-key", controllers.MachineSigningKeyIssue).Methods("POST")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/offline-transactions", controllers.MachineOfflineTransactions).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/guest-sessions", controllers.MachineGuestSessions).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/telemetry", controllers.MachineTelemetryHistory).Methods("GET")
+	h.Router.HandleFunc("/v1/machines/{machine_id}/telemetry/latest", controllers.MachineTelemetryLatest).Methods("GET")
+	h.Router.HandleFunc("/v1/telemetry", controllers.TelemetryIngest).Methods("POST")
+	h.Router.HandleFunc("/v1/sync/snapshot", controllers.SyncSnapshot).Methods("GET")
+	h.Router.HandleFunc("/v1/sync", controllers.SyncTransactions).Methods("POST")
 
 	// vending machine
 	h.Router.HandleFunc("/v1/deposit", controllers.Deposit).Methods("POST")
 	h.Router.HandleFunc("/v1/buy", controllers.BuyProduct).Methods("POST")
 	h.Router.HandleFunc("/v1/reset", controllers.DepositReset).Methods("POST")
+	h.Router.HandleFunc("/v1/coin-sessions", controllers.CoinSessionStart).Methods("POST")
+
+	// guest sessions
+	h.Router.HandleFunc("/v1/guest/sessions", controllers.GuestSessionStart).Methods("POST")
+	h.Router.HandleFunc("/v1/guest/session", controllers.GuestSessionGet).Methods("GET")
+	h.Router.HandleFunc("/v1/guest/deposit", controllers.GuestDeposit).Methods("POST")
+	h.Router.HandleFunc("/v1/guest/buy", controllers.GuestBuy).Methods("POST")
+	h.Router.HandleFunc("/v1/guest/end", controllers.GuestSessionEnd).Methods("POST")
 
 }
 
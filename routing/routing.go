@@ -0,0 +1,134 @@
+// Package routing plans the order an operator visits machines in to restock them.
+package routing
+
+import (
+	"math"
+	"sort"
+)
+
+// earthRadius is the mean radius of the earth in kilometres.
+const earthRadius = 6371.0
+
+// Priority is how urgently a machine needs a visit.
+type Priority int
+
+// Visit priorities, from least to most urgent.
+const (
+	Normal Priority = iota + 1
+	High
+	Critical
+)
+
+// String returns the name of p used by the API.
+func (p Priority) String() string {
+	switch p {
+	case Normal:
+		return "normal"
+	case High:
+		return "high"
+	case Critical:
+		return "critical"
+	}
+	return "none"
+}
+
+// SlotPriority is the priority of a machine with slots stocked slots, belowPar of them
+// at or below their par level and empty of them sold out. A machine with a sold out
+// slot is critical and one with at least half its slots below par is high. It returns
+// 0 for a machine that does not need a visit.
+func SlotPriority(slots, belowPar, empty int) Priority {
+	switch {
+	case empty > 0:
+		return Critical
+	case belowPar > 0 && belowPar*2 >= slots:
+		return High
+	case belowPar > 0:
+		return Normal
+	}
+	return 0
+}
+
+// Point is a location in degrees.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Distance is the great circle distance between a and b in kilometres.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLong := radians(b.Longitude - a.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// Stop is a machine to visit.
+type Stop struct {
+	ID       uint
+	Location Point
+	Priority Priority
+}
+
+// Leg is a stop on a route and the distance to it from the previous stop, in kilometres.
+type Leg struct {
+	Stop     Stop
+	Distance float64
+}
+
+// Plan orders stops into a route from start. More urgent stops are visited first and
+// stops of the same priority are visited nearest first, each leg starting where the
+// last ended. Without a start the route begins at the most urgent stop with the lowest ID.
+func Plan(start *Point, stops []Stop) []Leg {
+	remaining := append([]Stop{}, stops...)
+	sort.SliceStable(remaining, func(i, j int) bool {
+		if remaining[i].Priority != remaining[j].Priority {
+			return remaining[i].Priority > remaining[j].Priority
+		}
+		return remaining[i].ID < remaining[j].ID
+	})
+
+	legs := make([]Leg, 0, len(remaining))
+	if len(remaining) == 0 {
+		return legs
+	}
+
+	var at Point
+	if start != nil {
+		at = *start
+	} else {
+		at = remaining[0].Location
+	}
+
+	for len(remaining) > 0 {
+		// remaining is sorted by priority, so the candidates are a prefix of it
+		next := 0
+		best := Distance(at, remaining[0].Location)
+		for i := 1; i < len(remaining) && remaining[i].Priority == remaining[0].Priority; i++ {
+			if distance := Distance(at, remaining[i].Location); distance < best {
+				next, best = i, distance
+			}
+		}
+
+		stop := remaining[next]
+		legs = append(legs, Leg{Stop: stop, Distance: best})
+		at = stop.Location
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+
+	return legs
+}
+
+// Total is the length of a route in kilometres.
+func Total(legs []Leg) float64 {
+	var total float64
+	for _, leg := range legs {
+		total += leg.Distance
+	}
+	return total
+}
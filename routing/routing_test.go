@@ -0,0 +1,143 @@
+package routing
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     Point
+		expected float64
+	}{
+		{
+			name:     "same point",
+			a:        Point{6.5244, 3.3792},
+			b:        Point{6.5244, 3.3792},
+			expected: 0,
+		},
+		{
+			name:     "one degree of latitude",
+			a:        Point{0, 0},
+			b:        Point{1, 0},
+			expected: 111.195,
+		},
+		{
+			name:     "lagos to abuja",
+			a:        Point{6.5244, 3.3792},
+			b:        Point{9.0765, 7.3986},
+			expected: 525.9,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			distance := Distance(tc.a, tc.b)
+			if math.Abs(distance-tc.expected) > 0.5 {
+				t.Errorf("expected %.3f km, got %.3f km", tc.expected, distance)
+			}
+			if back := Distance(tc.b, tc.a); math.Abs(back-distance) > 1e-9 {
+				t.Errorf("distance is not symmetric: %.6f and %.6f", distance, back)
+			}
+		})
+	}
+}
+
+func TestSlotPriority(t *testing.T) {
+	tests := []struct {
+		name                   string
+		slots, belowPar, empty int
+		expected               Priority
+	}{
+		{name: "fully stocked", slots: 10, expected: 0},
+		{name: "one slot below par", slots: 10, belowPar: 1, expected: Normal},
+		{name: "half the slots below par", slots: 10, belowPar: 5, expected: High},
+		{name: "a sold out slot", slots: 10, belowPar: 1, empty: 1, expected: Critical},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if priority := SlotPriority(tc.slots, tc.belowPar, tc.empty); priority != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, priority)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	// stops along the equator, about 111 km per degree of longitude
+	stop := func(id uint, longitude float64, priority Priority) Stop {
+		return Stop{ID: id, Location: Point{0, longitude}, Priority: priority}
+	}
+	origin := &Point{0, 0}
+
+	tests := []struct {
+		name     string
+		start    *Point
+		stops    []Stop
+		expected []uint
+	}{
+		{
+			name:     "no stops",
+			start:    origin,
+			expected: []uint{},
+		},
+		{
+			name:     "same priority is visited nearest first",
+			start:    origin,
+			stops:    []Stop{stop(1, 3, Normal), stop(2, 1, Normal), stop(3, 2, Normal)},
+			expected: []uint{2, 3, 1},
+		},
+		{
+			name:     "urgent stops come first however far",
+			start:    origin,
+			stops:    []Stop{stop(1, 1, Normal), stop(2, 5, Critical), stop(3, 2, High)},
+			expected: []uint{2, 3, 1},
+		},
+		{
+			name:     "each leg starts where the last ended",
+			start:    origin,
+			stops:    []Stop{stop(1, 4, Critical), stop(2, -1, Normal), stop(3, 3, Normal)},
+			expected: []uint{1, 3, 2},
+		},
+		{
+			name:     "without a start the route begins at the most urgent stop",
+			stops:    []Stop{stop(3, 5, High), stop(1, 1, Normal), stop(2, 4, High)},
+			expected: []uint{2, 3, 1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			legs := Plan(tc.start, tc.stops)
+
+			ids := []uint{}
+			for _, leg := range legs {
+				ids = append(ids, leg.Stop.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.expected) {
+				t.Errorf("expected route %v, got %v", tc.expected, ids)
+			}
+		})
+	}
+
+	t.Run("legs add up to the total", func(t *testing.T) {
+		legs := Plan(origin, []Stop{stop(1, 1, Normal), stop(2, 2, Normal)})
+		if math.Abs(legs[0].Distance-111.195) > 0.5 || math.Abs(legs[1].Distance-111.195) > 0.5 {
+			t.Errorf("expected legs of about 111 km, got %.3f and %.3f", legs[0].Distance, legs[1].Distance)
+		}
+		if total := Total(legs); math.Abs(total-legs[0].Distance-legs[1].Distance) > 1e-9 {
+			t.Errorf("expected total %.3f, got %.3f", legs[0].Distance+legs[1].Distance, total)
+		}
+	})
+
+	t.Run("does not modify the stops", func(t *testing.T) {
+		stops := []Stop{stop(2, 2, Normal), stop(1, 1, Critical)}
+		Plan(origin, stops)
+		if stops[0].ID != 2 || stops[1].ID != 1 {
+			t.Errorf("stops were reordered: %v", stops)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+// Package search provides an in-process inverted index with prefix and
+// typo tolerant matching. It is used to search products by name.
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Match weights used when ranking documents. An exact term match beats a
+// prefix match, which beats a fuzzy (typo tolerant) match.
+const (
+	exactWeight  = 3.0
+	prefixWeight = 2.0
+	fuzzyWeight  = 1.0
+
+	// startsWithBonus is added when the document text starts with the query.
+	startsWithBonus = 0.5
+)
+
+// Result is a matching document and its relevance score.
+type Result struct {
+	ID    uint
+	Score float64
+}
+
+// Index is an inverted index from terms to document IDs. It is safe for
+// concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[uint]struct{}
+	docs     map[uint]string
+	terms    []string
+	sorted   bool
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[uint]struct{}{},
+		docs:     map[uint]string{},
+	}
+}
+
+// Rebuild replaces the content of the index with docs, keyed by document ID.
+func (i *Index) Rebuild(docs map[uint]string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.postings = map[string]map[uint]struct{}{}
+	i.docs = map[uint]string{}
+	i.sorted = false
+
+	for id, text := range docs {
+		i.add(id, text)
+	}
+}
+
+// Put adds a document to the index, replacing any previous version of it.
+func (i *Index) Put(id uint, text string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+	i.add(id, text)
+}
+
+// Remove deletes a document from the index.
+func (i *Index) Remove(id uint) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+}
+
+// Len returns the number of indexed documents.
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return len(i.docs)
+}
+
+// Search returns the documents matching query ordered by relevance. Every
+// query term is matched exactly, as a prefix of an indexed term, or within a
+// small edit distance. At most limit results are returned; a limit of zero
+// or less returns all matches.
+func (i *Index) Search(query string, limit int) []Result {
+	queryTerms := Tokenize(query)
+	if len(queryTerms) == 0 {
+		return []Result{}
+	}
+
+	i.mu.Lock()
+	i.sortTerms()
+	i.mu.Unlock()
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	scores := map[uint]float64{}
+	for _, queryTerm := range queryTerms {
+		for id, weight := range i.match(queryTerm) {
+			scores[id] += weight
+		}
+	}
+
+	normalizedQuery := strings.Join(queryTerms, " ")
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		if strings.HasPrefix(i.docs[id], normalizedQuery) {
+			score += startsWithBonus
+		}
+		results = append(results, Result{ID: id, Score: score})
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].ID < results[b].ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// match returns the best weight for each document matching a single query term.
+func (i *Index) match(queryTerm string) map[uint]float64 {
+	weights := map[uint]float64{}
+	award := func(term string, weight float64) {
+		for id := range i.postings[term] {
+			if weight > weights[id] {
+				weights[id] = weight
+			}
+		}
+	}
+
+	// prefix matches are contiguous in the sorted term list
+	start := sort.SearchStrings(i.terms, queryTerm)
+	for _, term := range i.terms[start:] {
+		if !strings.HasPrefix(term, queryTerm) {
+			break
+		}
+		if term == queryTerm {
+			award(term, exactWeight)
+		} else {
+			award(term, prefixWeight)
+		}
+	}
+
+	maxEdits := allowedEdits(queryTerm)
+	if maxEdits == 0 {
+		return weights
+	}
+
+	queryRunes := []rune(queryTerm)
+	for _, term := range i.terms {
+		if strings.HasPrefix(term, queryTerm) {
+			continue
+		}
+
+		termRunes := []rune(term)
+		distance := editDistance(queryRunes, termRunes)
+		if len(termRunes) > len(queryRunes) {
+			// allow typos in a partially typed word
+			if prefixDistance := editDistance(queryRunes, termRunes[:len(queryRunes)]); prefixDistance < distance {
+				distance = prefixDistance
+			}
+		}
+
+		if distance <= maxEdits {
+			award(term, fuzzyWeight/float64(distance))
+		}
+	}
+
+	return weights
+}
+
+func (i *Index) add(id uint, text string) {
+	terms := Tokenize(text)
+	i.docs[id] = strings.Join(terms, " ")
+
+	for _, term := range terms {
+		if _, ok := i.postings[term]; !ok {
+			i.postings[term] = map[uint]struct{}{}
+			i.sorted = false
+		}
+		i.postings[term][id] = struct{}{}
+	}
+}
+
+func (i *Index) remove(id uint) {
+	text, ok := i.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range strings.Fields(text) {
+		delete(i.postings[term], id)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+			i.sorted = false
+		}
+	}
+	delete(i.docs, id)
+}
+
+// sortTerms refreshes the sorted term list used for prefix lookups.
+func (i *Index) sortTerms() {
+	if i.sorted {
+		return
+	}
+
+	i.terms = i.terms[:0]
+	for term := range i.postings {
+		i.terms = append(i.terms, term)
+	}
+	sort.Strings(i.terms)
+	i.sorted = true
+}
+
+// Tokenize lower-cases text and splits it into letter and digit runs.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// allowedEdits is the number of typos tolerated for a query term of this length.
+func allowedEdits(term string) int {
+	switch length := len([]rune(term)); {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
@@ -0,0 +1,96 @@
+package search
+
+import "testing"
+
+func newTestIndex() *Index {
+	index := NewIndex()
+	index.Rebuild(map[uint]string{
+		1: "Coca-Cola 330ml",
+		2: "Chocolate Bar",
+		3: "Cold Brew Coffee",
+		4: "Sparkling Water",
+	})
+	return index
+}
+
+func resultIDs(results []Result) []uint {
+	ids := make([]uint, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func TestSearchExactAndPrefix(t *testing.T) {
+	index := newTestIndex()
+
+	t.Run("exact term ranks above prefix", func(t *testing.T) {
+		ids := resultIDs(index.Search("cola", 0))
+		if len(ids) == 0 || ids[0] != 1 {
+			t.Errorf("got %v expected product 1 first", ids)
+		}
+	})
+
+	t.Run("prefix matches partial words", func(t *testing.T) {
+		ids := resultIDs(index.Search("choc", 0))
+		if len(ids) != 1 || ids[0] != 2 {
+			t.Errorf("got %v expected [2]", ids)
+		}
+	})
+
+	t.Run("limit caps the results", func(t *testing.T) {
+		if results := index.Search("co", 1); len(results) != 1 {
+			t.Errorf("got %d results expected 1", len(results))
+		}
+	})
+
+	t.Run("empty query returns nothing", func(t *testing.T) {
+		if results := index.Search("  ", 0); len(results) != 0 {
+			t.Errorf("got %d results expected none", len(results))
+		}
+	})
+}
+
+func TestSearchFuzzy(t *testing.T) {
+	index := newTestIndex()
+
+	t.Run("single typo", func(t *testing.T) {
+		ids := resultIDs(index.Search("watr", 0))
+		if len(ids) != 1 || ids[0] != 4 {
+			t.Errorf("got %v expected [4]", ids)
+		}
+	})
+
+	t.Run("typo in partially typed word", func(t *testing.T) {
+		ids := resultIDs(index.Search("sparkc", 0))
+		if len(ids) != 1 || ids[0] != 4 {
+			t.Errorf("got %v expected [4]", ids)
+		}
+	})
+
+	t.Run("short terms are not fuzzy matched", func(t *testing.T) {
+		if results := index.Search("xyz", 0); len(results) != 0 {
+			t.Errorf("got %v expected no results", resultIDs(results))
+		}
+	})
+}
+
+func TestIndexUpdates(t *testing.T) {
+	index := newTestIndex()
+
+	index.Put(4, "Still Water")
+	if results := index.Search("sparkling", 0); len(results) != 0 {
+		t.Errorf("got %v expected the old name to be gone", resultIDs(results))
+	}
+	if ids := resultIDs(index.Search("still", 0)); len(ids) != 1 || ids[0] != 4 {
+		t.Errorf("got %v expected [4]", ids)
+	}
+
+	index.Remove(4)
+	if results := index.Search("water", 0); len(results) != 0 {
+		t.Errorf("got %v expected removed product to be gone", resultIDs(results))
+	}
+	if index.Len() != 3 {
+		t.Errorf("got %d documents expected 3", index.Len())
+	}
+}
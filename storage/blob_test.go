@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("put and get", func(t *testing.T) {
+		if err := store.Put("products/1/image.png", strings.NewReader("png data")); err != nil {
+			t.Fatal(err)
+		}
+
+		blob, err := store.Get("products/1/image.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer blob.Close()
+
+		content, _ := io.ReadAll(blob)
+		if string(content) != "png data" {
+			t.Errorf("got %q expected %q", content, "png data")
+		}
+	})
+
+	t.Run("url", func(t *testing.T) {
+		if url := store.URL("products/1/image.png"); url != "/media/products/1/image.png" {
+			t.Errorf("got url %q", url)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Delete("products/1/image.png"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get("products/1/image.png"); err != ErrNotFound {
+			t.Errorf("got error %v expected ErrNotFound", err)
+		}
+		if err := store.Delete("products/1/image.png"); err != nil {
+			t.Errorf("deleting a missing blob returned %v", err)
+		}
+	})
+
+	t.Run("keys cannot escape the root", func(t *testing.T) {
+		for _, key := range []string{"../secret", "/etc/passwd", "products/../../secret", ""} {
+			if err := store.Put(key, strings.NewReader("x")); err != ErrInvalidKey {
+				t.Errorf("key %q: got error %v expected ErrInvalidKey", key, err)
+			}
+		}
+	})
+}
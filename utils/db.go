@@ -23,11 +23,27 @@ func ConnectToDB(databaseUrl string) (*gorm.DB, error) {
 
 }
 
+// tables lists every model managed by Migrate and DropTables.
+func tables() []interface{} {
+	return []interface{}{
+		&models.User{}, &models.Product{}, &models.Session{},
+		&models.Category{}, &models.ProductTag{}, &models.ProductAttribute{},
+		&models.PriceChange{}, &models.Promotion{}, &models.Voucher{}, &models.VoucherRedemption{},
+		&models.Order{}, &models.OrderItem{}, &models.PointsAccount{}, &models.PointsTransaction{}, &models.EarningRule{},
+		&models.ProductRestriction{}, &models.StockLot{}, &models.OrderLot{},
+		&models.InboxMessage{}, &models.StockAlert{}, &models.SlotAlert{},
+		&models.Machine{}, &models.MachineCoin{}, &models.MachineSlot{}, &models.MachineDeposit{},
+		&models.MachineKey{}, &models.TelemetryEvent{}, &models.MachineStatus{},
+		&models.RestockVisit{}, &models.RestockItem{},
+		&models.MachineSigningKey{}, &models.OfflineTransaction{}, &models.GuestSession{},
+	}
+}
+
 func Migrate() {
-	db.AutoMigrate(&models.User{}, &models.Product{}, &models.Session{})
+	db.AutoMigrate(tables()...)
 }
 func DropTables() {
-	db.Migrator().DropTable(&models.User{}, &models.Product{}, &models.Session{})
+	db.Migrator().DropTable(tables()...)
 }
 
 func GetItemsByField(model interface{}, field string, value interface{}) *gorm.DB {
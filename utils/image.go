@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thumbnail scales src down to fit within a maxSize x maxSize box, keeping its
+// aspect ratio. Each thumbnail pixel is the average of the source pixels it covers.
+// Images that already fit are copied unscaled.
+func Thumbnail(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thumbWidth, thumbHeight := width, height
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			thumbWidth, thumbHeight = maxSize, height*maxSize/width
+		} else {
+			thumbWidth, thumbHeight = width*maxSize/height, maxSize
+		}
+	}
+	if thumbWidth < 1 {
+		thumbWidth = 1
+	}
+	if thumbHeight < 1 {
+		thumbHeight = 1
+	}
+
+	thumb := image.NewNRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+
+	for y := 0; y < thumbHeight; y++ {
+		top := bounds.Min.Y + y*height/thumbHeight
+		bottom := bounds.Min.Y + (y+1)*height/thumbHeight
+		if bottom == top {
+			bottom++
+		}
+
+		for x := 0; x < thumbWidth; x++ {
+			left := bounds.Min.X + x*width/thumbWidth
+			right := bounds.Min.X + (x+1)*width/thumbWidth
+			if right == left {
+				right++
+			}
+
+			var r, g, b, a, count uint64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+
+			thumb.Set(x, y, color.RGBA64{
+				R: uint16(r / count),
+				G: uint16(g / count),
+				B: uint16(b / count),
+				A: uint16(a / count),
+			})
+		}
+	}
+
+	return thumb
+}
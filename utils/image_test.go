@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		maxSize       int
+		expectedW     int
+		expectedH     int
+	}{
+		{"landscape", 400, 200, 100, 100, 50},
+		{"portrait", 200, 400, 100, 50, 100},
+		{"square", 300, 300, 100, 100, 100},
+		{"already fits", 80, 60, 100, 80, 60},
+		{"thin strip keeps a pixel", 1000, 2, 100, 100, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := image.NewNRGBA(image.Rect(0, 0, test.width, test.height))
+			thumb := Thumbnail(src, test.maxSize)
+			if got := thumb.Bounds(); got.Dx() != test.expectedW || got.Dy() != test.expectedH {
+				t.Errorf("got %dx%d expected %dx%d", got.Dx(), got.Dy(), test.expectedW, test.expectedH)
+			}
+		})
+	}
+
+	t.Run("averages the pixels it covers", func(t *testing.T) {
+		// a black and a white column scale down to one grey pixel
+		src := image.NewNRGBA(image.Rect(10, 10, 12, 11))
+		src.Set(10, 10, color.NRGBA{0, 0, 0, 255})
+		src.Set(11, 10, color.NRGBA{255, 255, 255, 255})
+
+		thumb := Thumbnail(src, 1)
+		r, g, b, a := thumb.At(0, 0).RGBA()
+		if r != 0x7f7f || g != 0x7f7f || b != 0x7f7f || a != 0xffff {
+			t.Errorf("got %x %x %x %x expected mid grey", r, g, b, a)
+		}
+	})
+}
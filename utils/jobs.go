@@ -0,0 +1,16 @@
+package utils
+
+import "time"
+
+// RunEvery runs job in a background goroutine straight away and then once every interval.
+func RunEvery(interval time.Duration, job func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			job()
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/femibiwoye/go-test/models"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ParsePagination reads the page and limit query parameters from the request.
+// Missing values fall back to the first page and DefaultPageLimit.
+func ParsePagination(r *http.Request) (models.Pagination, error) {
+	pagination := models.Pagination{Page: 1, Limit: DefaultPageLimit}
+	query := r.URL.Query()
+
+	if page := query.Get("page"); page != "" {
+		value, err := strconv.Atoi(page)
+		if err != nil || value < 1 {
+			return pagination, errors.New("page must be a positive number")
+		}
+		pagination.Page = value
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > MaxPageLimit {
+			return pagination, errors.New("limit must be between 1 and 100")
+		}
+		pagination.Limit = value
+	}
+
+	return pagination, nil
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/mail"
 	"os"
+	"strconv"
 )
 
 type ErrorResponse struct {
@@ -78,6 +79,15 @@ func Env(key string) string {
 	return os.Getenv(key)
 }
 
+// EnvInt reads an integer environment variable, returning fallback if it is missing or invalid.
+func EnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(Env(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
 // check if a file exists, useful in checking for .env.
 func FileExists(name string) bool {
 	_, err := os.Stat(name)
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEnvInt(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		set      bool
+		expected int
+	}{
+		{"missing", "", false, 90},
+		{"set", "30", true, 30},
+		{"zero", "0", true, 0},
+		{"not a number", "ninety", true, 90},
+		{"empty", "", true, 90},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Unsetenv("TEST_ENV_INT")
+			if test.set {
+				os.Setenv("TEST_ENV_INT", test.value)
+			}
+			defer os.Unsetenv("TEST_ENV_INT")
+
+			if got := EnvInt("TEST_ENV_INT", 90); got != test.expected {
+				t.Errorf("got %d expected %d", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestRunEvery(t *testing.T) {
+	runs := make(chan struct{}, 3)
+	RunEvery(10*time.Millisecond, func() {
+		select {
+		case runs <- struct{}{}:
+		default:
+		}
+	})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("job ran %d times, expected 3", i)
+		}
+	}
+}